@@ -3,16 +3,21 @@ package main
 import (
 	"embed"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 
 	"ladder/handlers"
+	"ladder/pkg/logging"
+	"ladder/pkg/plugin"
+	"ladder/pkg/reader"
 
 	"github.com/akamensky/argparse"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
 )
 
 //go:embed favicon.ico
@@ -21,6 +26,15 @@ var faviconData string
 var cssData embed.FS
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mock-origin" {
+		mockOrigin(os.Args[1:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rules" {
+		rules(os.Args[1:])
+		return
+	}
+
 	parser := argparse.NewParser("ladder", "Every Wall needs a Ladder")
 
 	portEnv := os.Getenv("PORT")
@@ -40,7 +54,85 @@ func main() {
 
 	ruleset := parser.String("r", "ruleset", &argparse.Options{
 		Required: false,
-		Help:     "File, Directory or URL to a ruleset.yml. Overrides RULESET environment variable.",
+		Help:     "Files, Directories or URLs of ruleset.yml, separated by ';'. Overrides RULESET environment variable.",
+	})
+
+	rulesetRefresh := parser.String("", "ruleset-refresh", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("RULESET_REFRESH"),
+		Help:     "Interval the remote rulesets are checked for changes at, eg: 1h. Disabled if empty. Overrides RULESET_REFRESH environment variable",
+	})
+
+	watchRuleset := parser.Flag("", "watch-ruleset", &argparse.Options{
+		Required: false,
+		Help:     "Reload the ruleset once its local files change, keeping the previous rules if the new ones are invalid",
+	})
+
+	plugins := parser.String("", "plugins", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("PLUGINS"),
+		Help:     "Directory of plugin binaries providing custom modifiers. Overrides PLUGINS environment variable",
+	})
+
+	grpcPort := parser.String("", "grpc-port", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("GRPC_PORT"),
+		Help:     "Port the gRPC API will listen on. Disabled if empty. Overrides GRPC_PORT environment variable",
+	})
+
+	timeouts := parser.String("", "timeouts", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("TIMEOUTS"),
+		Help:     "Timeouts of upstream requests, eg: dns=5s,connect=5s,tlsHandshake=5s,responseHeader=20s,body=1m. Overrides TIMEOUTS environment variable",
+	})
+
+	maxBodySize := parser.String("", "max-body-size", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("MAX_BODY_SIZE"),
+		Help:     "Largest upstream body read, eg: 50MB. Larger responses are answered with 502. Unlimited if empty. Overrides MAX_BODY_SIZE environment variable",
+	})
+
+	resolve := parser.StringList("", "resolve", &argparse.Options{
+		Required: false,
+		Help:     "Pin a host to an address, bypassing DNS, eg: www.example.com:203.0.113.7. Repeatable, adds to the RESOLVE environment variable",
+	})
+
+	http3 := parser.Flag("", "http3", &argparse.Options{
+		Required: false,
+		Help:     "Fetch sites over HTTP/3 (QUIC) where their origin supports it, falling back to TCP otherwise",
+	})
+
+	cookies := parser.String("", "cookies", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("COOKIES_FILE"),
+		Help:     "Import the cookies exported from a browser, as cookies.txt or JSON, eg: to proxy a subscription. Overrides COOKIES_FILE environment variable",
+	})
+
+	ech := parser.Flag("", "ech", &argparse.Options{
+		Required: false,
+		Help:     "Encrypt the SNI of upstream requests with Encrypted Client Hello where the origin publishes an ECH config",
+	})
+
+	viaTor := parser.Flag("", "tor", &argparse.Options{
+		Required: false,
+		Help:     "Fetch sites through the SOCKS port of a local Tor client, see TOR_SOCKS",
+	})
+
+	verbose := parser.Flag("v", "verbose", &argparse.Options{
+		Required: false,
+		Help:     "Log the debug events of every request, such as the modifiers applied and the headers they changed",
+	})
+
+	logFormat := parser.String("", "log-format", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("LOG_FORMAT"),
+		Help:     "Format of the logs, text or json. Overrides LOG_FORMAT environment variable",
+	})
+
+	logLevel := parser.String("", "log-level", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("LOG_LEVEL"),
+		Help:     "Lowest level logged, debug, info, warn or error. Overrides LOG_LEVEL environment variable",
 	})
 
 	err := parser.Parse(os.Args)
@@ -48,16 +140,95 @@ func main() {
 		fmt.Print(parser.Usage(err))
 	}
 
+	if err := logging.Setup(os.Stderr, *logFormat, *logLevel); err != nil {
+		fatal(err)
+	}
+
 	if os.Getenv("PREFORK") == "true" {
 		*prefork = true
 	}
 
-	app := fiber.New(
-		fiber.Config{
-			Prefork: *prefork,
-			GETOnly: true,
-		},
-	)
+	if os.Getenv("HTTP3") == "true" {
+		*http3 = true
+	}
+	if *http3 {
+		handlers.EnableHTTP3()
+	}
+
+	if os.Getenv("ECH") == "true" {
+		*ech = true
+	}
+	if *ech {
+		handlers.EnableECH()
+	}
+
+	if os.Getenv("TOR") == "true" {
+		*viaTor = true
+	}
+	if *viaTor {
+		handlers.EnableTor()
+	}
+
+	if err := handlers.SetTimeouts(*timeouts); err != nil {
+		fatal(err)
+	}
+	if err := handlers.SetMaxBodySize(*maxBodySize); err != nil {
+		fatal(err)
+	}
+	if err := handlers.SetRateLimit(os.Getenv("RATE_LIMIT"), os.Getenv("RATE_LIMIT_BURST")); err != nil {
+		fatal(err)
+	}
+	if err := handlers.LoadAPIKeys(os.Getenv("API_KEYS"), os.Getenv("API_KEYS_FILE")); err != nil {
+		fatal(err)
+	}
+	if err := handlers.LoadLogin(); err != nil {
+		fatal(err)
+	}
+
+	pins := *resolve
+	if env := os.Getenv("RESOLVE"); env != "" {
+		pins = append(strings.Split(env, ","), pins...)
+	}
+	if err := handlers.PinHosts(pins); err != nil {
+		fatal(err)
+	}
+
+	if *cookies != "" {
+		if err := handlers.ImportCookies(*cookies); err != nil {
+			fatal(err)
+		}
+	}
+
+	if err := handlers.LoadPlugins(*plugins); err != nil {
+		fatal(err)
+	}
+	defer plugin.Cleanup()
+	defer handlers.CloseBrowser()
+	defer handlers.ShutdownTracing()
+	defer handlers.SaveCookies()
+
+	if *verbose {
+		handlers.LogEvents()
+	}
+
+	config := fiber.Config{
+		Prefork: *prefork,
+		// the bodies of requests proxied upstream are streamed rather than buffered
+		StreamRequestBody: true,
+	}
+	// behind reverse proxies, clients are identified by the address they forward, eg: for rate limits
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		config.ProxyHeader = fiber.HeaderXForwardedFor
+		config.EnableTrustedProxyCheck = true
+		config.TrustedProxies = strings.Split(proxies, ",")
+		config.EnableIPValidation = true
+	}
+	app := fiber.New(config)
+
+	app.Use(handlers.AccessLog)
+	app.Use(handlers.Trace)
+	app.Use(handlers.RecordMetrics)
+	app.Use(handlers.RateLimit)
 
 	userpass := os.Getenv("USERPASS")
 	if userpass != "" {
@@ -69,19 +240,17 @@ func main() {
 		}))
 	}
 
+	app.Use(handlers.Authenticate)
+
 	app.Use(favicon.New(favicon.Config{
 		Data: []byte(faviconData),
 		URL:  "/favicon.ico",
 	}))
 
-	if os.Getenv("NOLOGS") != "true" {
-		app.Use(func(c *fiber.Ctx) error {
-			log.Println(c.Method(), c.Path())
-			return c.Next()
-		})
-	}
-
 	app.Get("/", handlers.Form)
+	app.Get("auth/login", handlers.Login)
+	app.Get("auth/callback", handlers.Callback)
+	app.Get("auth/logout", handlers.Logout)
 	app.Get("/styles.css", func(c *fiber.Ctx) error {
 		cssData, err := cssData.ReadFile("styles.css")
 		if err != nil {
@@ -91,9 +260,88 @@ func main() {
 		return c.Send(cssData)
 	})
 	app.Get("ruleset", handlers.Ruleset)
+	app.Get("reader", func(c *fiber.Ctx) error {
+		// relative asset URLs of the reader require a trailing slash
+		if !strings.HasSuffix(c.Path(), "/") {
+			return c.Redirect(c.Path() + "/")
+		}
+		return c.Next()
+	})
+	app.Use("/reader", filesystem.New(filesystem.Config{
+		Root: http.FS(reader.Assets),
+	}))
 
 	app.Get("raw/*", handlers.Raw)
-	app.Get("api/*", handlers.Api)
-	app.Get("/*", handlers.ProxySite(*ruleset))
-	log.Fatal(app.Listen(":" + *port))
+	app.Get("md/*", handlers.Markdown)
+	app.Get("text/*", handlers.Text)
+	app.Get("epub/*", handlers.Epub)
+	app.Get("pdf/*", handlers.Pdf)
+	app.Get("img/*", handlers.Img)
+	app.Get("feed/*", handlers.Feed)
+	app.Get("metrics", handlers.Metrics)
+	apiRoutes(app)
+	app.Get("graphql", handlers.GraphQL)
+	app.Post("graphql", handlers.GraphQL)
+	proxy := handlers.ProxySite(*ruleset)
+	if os.Getenv("RULESET_WATCH") == "true" {
+		*watchRuleset = true
+	}
+	if *watchRuleset {
+		if err := handlers.WatchRuleset(*ruleset); err != nil {
+			fatal(err)
+		}
+	}
+	if err := handlers.RefreshRuleset(*ruleset, *rulesetRefresh); err != nil {
+		fatal(err)
+	}
+	app.Get("/*", proxy)
+	app.Post("/*", proxy)
+	app.Put("/*", proxy)
+	app.Patch("/*", proxy)
+	app.Delete("/*", proxy)
+	app.Options("/*", handlers.Preflight)
+
+	if *grpcPort != "" && !fiber.IsChild() {
+		go func() {
+			if err := handlers.ServeGRPC(":" + *grpcPort); err != nil {
+				plugin.Cleanup()
+				handlers.CloseBrowser()
+				handlers.SaveCookies()
+				fatal(err)
+			}
+		}()
+	}
+
+	if err := app.Listen(":" + *port); err != nil {
+		plugin.Cleanup()
+		handlers.CloseBrowser()
+		handlers.SaveCookies()
+		fatal(err)
+	}
+}
+
+// apiRoutes registers the routes of the API, versioned under /api/v1, and the deprecated
+// unversioned routes, see handlers.Deprecated.
+func apiRoutes(app fiber.Router) {
+	v1 := app.Group("/api/v1", handlers.APIVersion)
+	v1.Get("fetch/*", handlers.Api)
+	v1.Get("article/*", handlers.Article)
+	v1.Get("content/*", handlers.Content)
+	v1.Get("metadata/*", handlers.Metadata)
+	v1.Get("events", handlers.Events)
+	v1.Get("stats", handlers.Stats)
+	v1.Post("cookies", handlers.Cookies)
+	v1.Get("openapi.yaml", handlers.OpenAPI)
+
+	app.Get("api/docs/*", handlers.Docs)
+	app.Get("api/events", handlers.Deprecated("/api/v1/events"), handlers.Events)
+	app.Get("api/article/*", handlers.Deprecated("/api/v1/article/"), handlers.Article)
+	app.Get("api/openapi.yaml", handlers.Deprecated("/api/v1/openapi.yaml"), handlers.OpenAPI)
+	app.Get("api/*", handlers.Deprecated("/api/v1/fetch/"), handlers.Api)
+}
+
+// fatal logs err and exits.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
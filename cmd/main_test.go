@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIRoutes(t *testing.T) {
+	app := fiber.New()
+	apiRoutes(app)
+
+	tests := []struct {
+		path, successor string
+		status          int
+	}{
+		{"/api/v1/openapi.yaml", "", http.StatusOK},
+		{"/api/openapi.yaml", "/api/v1/openapi.yaml", http.StatusOK},
+		// the routes are matched, but the versions rejected before any fetch
+		{"/api/v1/fetch/https://example.com/", "", http.StatusNotAcceptable},
+		{"/api/v1/article/https://example.com/", "", http.StatusNotAcceptable},
+		{"/api/https://example.com/", "/api/v1/fetch/https://example.com/", http.StatusNotAcceptable},
+		{"/api/article/https://example.com/", "/api/v1/article/https://example.com/", http.StatusNotAcceptable},
+		{"/api/events?tag=abc", "/api/v1/events?tag=abc", http.StatusNotAcceptable},
+		{"/api/https://example.com/?q=1", "/api/v1/fetch/https://example.com/?q=1", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.status == http.StatusNotAcceptable {
+			req.Header.Set("Api-Version", "2")
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.path)
+		assert.Equal(t, "1", resp.Header.Get("Api-Version"), tt.path)
+		if tt.successor == "" {
+			assert.Empty(t, resp.Header.Get("Deprecation"), tt.path)
+		} else {
+			assert.NotEmpty(t, resp.Header.Get("Deprecation"), tt.path)
+			assert.Equal(t, "<"+tt.successor+`>; rel="successor-version"`, resp.Header.Get("Link"), tt.path)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"ladder/pkg/mockorigin"
+
+	"github.com/akamensky/argparse"
+)
+
+// mockOrigin runs the `ladder mock-origin` command, serving fixtures with simulated paywalls.
+func mockOrigin(args []string) {
+	parser := argparse.NewParser("ladder mock-origin", "Serve recorded pages with simulated paywalls for offline rule development")
+
+	port := parser.String("p", "port", &argparse.Options{
+		Required: false,
+		Default:  "8090",
+		Help:     "Port the mock origin will listen on",
+	})
+
+	dir := parser.String("d", "dir", &argparse.Options{
+		Required: false,
+		Default:  "fixtures",
+		Help:     "Fixture directory, with pages stored as <dir>/<host>/<path>",
+	})
+
+	variant := parser.Selector("", "paywall", mockorigin.Variants, &argparse.Options{
+		Required: false,
+		Default:  mockorigin.VariantTruncate,
+		Help:     "Paywall to simulate",
+	})
+
+	if err := parser.Parse(args); err != nil {
+		fmt.Print(parser.Usage(err))
+		os.Exit(1)
+	}
+
+	server, err := mockorigin.NewServer(*dir, *variant)
+	if err != nil {
+		fatal(err)
+	}
+
+	slog.Info("serving fixtures", "dir", *dir, "paywall", *variant, "port", *port)
+	slog.Info("start ladder with MOCK_ORIGIN=http://localhost:" + *port + " to fetch from it")
+	fatal(http.ListenAndServe(":"+*port, server))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ladder/handlers"
+	"ladder/pkg/ladder"
+	"ladder/pkg/plugin"
+	"ladder/pkg/ruleset"
+
+	"github.com/akamensky/argparse"
+)
+
+// rules runs the `ladder rules` commands.
+func rules(args []string) {
+	parser := argparse.NewParser("ladder rules", "Maintain rulesets")
+
+	test := parser.NewCommand("test", "Fetch the testUrls of the rules through ladder and report the rules that stopped working")
+
+	rulesetPath := test.String("r", "ruleset", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("RULESET"),
+		Help:     "Files, Directories or URLs of ruleset.yml, separated by ';'. Overrides RULESET environment variable",
+	})
+
+	domain := test.String("d", "domain", &argparse.Options{
+		Required: false,
+		Help:     "Test the rules of this domain only",
+	})
+
+	concurrency := test.Int("c", "concurrency", &argparse.Options{
+		Required: false,
+		Default:  4,
+		Help:     "Number of pages fetched at once",
+	})
+
+	plugins := test.String("", "plugins", &argparse.Options{
+		Required: false,
+		Default:  os.Getenv("PLUGINS"),
+		Help:     "Directory of plugin binaries providing custom modifiers. Overrides PLUGINS environment variable",
+	})
+
+	if err := parser.Parse(args); err != nil {
+		fmt.Print(parser.Usage(err))
+		os.Exit(1)
+	}
+
+	if *rulesetPath == "" {
+		fatal(fmt.Errorf("no ruleset to test, set RULESET or --ruleset"))
+	}
+	rs, err := ruleset.LoadRuleset(*rulesetPath)
+	if err != nil {
+		fatal(err)
+	}
+	if err := ladder.ValidateRules(rs); err != nil {
+		fatal(err)
+	}
+	if err := handlers.LoadPlugins(*plugins); err != nil {
+		fatal(err)
+	}
+	failed := testRules(rs, *domain, *concurrency)
+	plugin.Cleanup()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// testRules prints the results of the tests of the rules of rs, and reports whether any failed.
+func testRules(rs ruleset.RuleSet, domain string, concurrency int) bool {
+	results := handlers.TestRuleset(context.Background(), rs, domain, concurrency)
+	if len(results) == 0 {
+		fmt.Println("no testUrls to test")
+		return false
+	}
+
+	failures := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed() {
+			status = "FAIL"
+			failures++
+		}
+		via := ""
+		if r.Strategy != "" {
+			via = " via " + r.Strategy
+		}
+		fmt.Printf("%s %s %s (%s%s)\n", status, r.Rule, r.Test.URL, r.Duration.Round(time.Millisecond), via)
+		for _, failure := range r.Failures {
+			fmt.Println("    " + strings.ReplaceAll(failure, "\n", "\n    "))
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-failures, failures)
+	return failures > 0
+}
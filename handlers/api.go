@@ -2,7 +2,8 @@ package handlers
 
 import (
 	_ "embed"
-	"log"
+
+	"ladder/pkg/ladder"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,21 +14,29 @@ var version string
 
 func Api(c *fiber.Ctx) error {
 	// Get the url from the URL
-	urlQuery := c.Params("*")
+	urlQuery, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
 
-	queries := c.Queries()
-	body, req, resp, err := fetchSite(urlQuery, queries)
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), urlQuery, ladder.FetchOptions{Query: query, Tag: c.Get(tagHeader), Preset: preset, Trace: trace.trace()})
 	if err != nil {
-		log.Println("ERROR:", err)
-		c.SendStatus(500)
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
 		return c.SendString(err.Error())
 	}
 
 	response := Response{
 		Version: version,
-		Body:    body,
+		Body:    result.Content,
 	}
 
+	req, resp := result.Request, result.Response
+
 	response.Request.Headers = make([]any, 0, len(req.Header))
 	for k, v := range req.Header {
 		response.Request.Headers = append(response.Request.Headers, map[string]string{
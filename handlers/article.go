@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Article returns the outline of the article in the URL as JSON, as consumed by the reader frontend.
+func Article(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatOutline,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+
+	return c.JSON(result.Outline)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"ladder/pkg/apikey"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// apiKeyHeader is the request header carrying the API key of programmatic clients.
+	apiKeyHeader = "X-Api-Key"
+	// apiKeyQuery is the query parameter carrying the API key of browsers, eg: /?ladder_key=3f9c2a.
+	// It is stored in the cookie of the same name, so that the links of proxied pages stay authorized.
+	apiKeyQuery = "ladder_key"
+	// apiKeyName is the local of the request holding the name of its API key, if any.
+	apiKeyName = "apiKeyName"
+)
+
+// apiKeys are the API keys required by the routes of ladder, if any.
+var apiKeys *apikey.Keys
+
+// LoadAPIKeys requires the API keys listed in list, as comma separated name:key pairs, and in
+// the YAML file at path, to use the proxy and API routes, see apikey.ReadFile.
+func LoadAPIKeys(list, path string) error {
+	keys := apikey.Parse(list)
+	if path != "" {
+		listed, err := apikey.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, listed...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	k, err := apikey.New(keys)
+	if err != nil {
+		return err
+	}
+	apiKeys = k
+	slog.Info("requiring API keys", "keys", k.Len())
+	return nil
+}
+
+// authConfigured reports whether clients are authenticated, with Basic Auth, API keys or the login.
+func authConfigured() bool {
+	return os.Getenv("USERPASS") != "" || apiKeys != nil || login != nil
+}
+
+// publicPaths are the paths served without API key or login: the form, so that browsers can open
+// it, eg: with the ladder_key query parameter, and the routes of the login.
+var publicPaths = map[string]bool{"/": true, "/styles.css": true, "/favicon.ico": true, loginPath: true, callbackPath: true, logoutPath: true}
+
+// Authenticate rejects the requests without an enabled API key, sent in the X-Api-Key header,
+// the ladder_key query parameter or cookie, when API keys are configured, unless the user logged
+// in, when login is configured, see LoadLogin. Browsers navigating to pages are sent to the login,
+// other requests are answered with 401 Unauthorized. The API routes only accept API keys, as the
+// session cookies browsers send along with cross-site requests would make them forgeable. The key
+// and the session are removed from the request, so that they aren't forwarded to proxied sites.
+func Authenticate(c *fiber.Ctx) error {
+	if apiKeys == nil && login == nil {
+		return c.Next()
+	}
+	if checkAPIKey(c) || publicPaths[c.Path()] {
+		return c.Next()
+	}
+	if apiPath(c.Path()) {
+		return apiError(c, fiber.StatusUnauthorized, "missing or invalid API key")
+	}
+	if checkSession(c) {
+		return c.Next()
+	}
+	// browsers navigating accept HTML, unlike the API clients and the scripts of pages
+	if login != nil && c.Method() == fiber.MethodGet && strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+		return c.Redirect(loginPath + "?next=" + url.QueryEscape(c.OriginalURL()))
+	}
+	return apiError(c, fiber.StatusUnauthorized, "missing or invalid API key")
+}
+
+// apiPath reports whether path is one of the routes of programmatic clients: the API, but its
+// documentation, GraphQL and the metrics.
+func apiPath(path string) bool {
+	if strings.HasPrefix(path, "/api/") {
+		return !strings.HasPrefix(path, "/api/docs")
+	}
+	return path == "/graphql" || path == "/metrics"
+}
+
+// checkAPIKey reports whether c carries an enabled API key, removing it from the request.
+func checkAPIKey(c *fiber.Ctx) bool {
+	if apiKeys == nil {
+		return false
+	}
+	key := c.Get(apiKeyHeader)
+	fromQuery := false
+	if key == "" {
+		if key = c.Query(apiKeyQuery); key != "" {
+			fromQuery = true
+		} else {
+			key = c.Cookies(apiKeyQuery)
+		}
+	}
+	name, ok := apiKeys.Check(key)
+	if !ok {
+		return false
+	}
+	c.Locals(apiKeyName, name)
+	c.Request().Header.Del(apiKeyHeader)
+	c.Request().Header.DelCookie(apiKeyQuery)
+	c.Request().URI().QueryArgs().Del(apiKeyQuery)
+	if fromQuery {
+		c.Cookie(&fiber.Cookie{Name: apiKeyQuery, Value: key, Path: "/", HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode, Secure: c.Protocol() == "https"})
+	}
+	return true
+}
+
+// grpcAPIKey rejects the gRPC calls without an enabled API key in their x-api-key metadata,
+// when API keys are configured.
+func grpcAPIKey(ctx context.Context) error {
+	if apiKeys == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var key string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		key = values[0]
+	}
+	if _, ok := apiKeys.Check(key); !ok {
+		return status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+	return nil
+}
+
+// grpcRateLimit rejects the gRPC calls of clients over their rate limit, see RateLimit, with
+// the seconds until they may send another one in their retry-after trailer.
+func grpcRateLimit(ctx context.Context) error {
+	if limiter == nil {
+		return nil
+	}
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	if ok, retry := limiter.Allow(ip); !ok {
+		grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retry.Seconds())))))
+		return status.Error(codes.ResourceExhausted, "too many requests, retry later")
+	}
+	return nil
+}
+
+// grpcCheck rejects the gRPC calls without an enabled API key, or over their rate limit.
+func grpcCheck(ctx context.Context) error {
+	if err := grpcAPIKey(ctx); err != nil {
+		return err
+	}
+	return grpcRateLimit(ctx)
+}
+
+// grpcAuth returns the server options checking the API keys and rate limits of gRPC calls.
+// The gRPC API can't be protected by Basic Auth nor by the login, so it requires API keys when
+// they protect the HTTP routes, rather than being served without authentication.
+func grpcAuth() ([]grpc.ServerOption, error) {
+	if apiKeys == nil && authConfigured() {
+		return nil, errors.New("the gRPC API requires API_KEYS or API_KEYS_FILE when USERPASS or the login protect the HTTP routes")
+	}
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := grpcCheck(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := grpcCheck(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}, nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ladder/pkg/apikey"
+	"ladder/pkg/oidc"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	defer func(keys *apikey.Keys, p *oidc.Provider, s *oidc.Sealer) { apiKeys, login, sealer = keys, p, s }(apiKeys, login, sealer)
+	keys, err := apikey.New(apikey.Parse("ci:3f9c2a"))
+	require.NoError(t, err)
+	apiKeys, login, sealer = keys, &oidc.Provider{}, oidc.NewSealer("secret")
+	session, err := sealer.Seal(sessionCookie, oidc.Session{Subject: "u1", Expiry: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(Authenticate)
+	app.Get("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		path, key, session string
+		want               int
+	}{
+		{"/https://example.com/", "", session, http.StatusOK},
+		{"/https://example.com/", "3f9c2a", "", http.StatusOK},
+		{"/https://example.com/", "", "", http.StatusFound},
+		{"/api/docs/", "", session, http.StatusOK},
+		// the session cookie, sent along with cross-site requests, doesn't authorize the API
+		{"/api/v1/fetch/https://example.com/", "", session, http.StatusUnauthorized},
+		{"/graphql", "", session, http.StatusUnauthorized},
+		{"/metrics", "", session, http.StatusUnauthorized},
+		{"/api/v1/fetch/https://example.com/", "3f9c2a", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept", "text/html")
+		if tt.key != "" {
+			req.Header.Set(apiKeyHeader, tt.key)
+		}
+		if tt.session != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.session})
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, resp.StatusCode, tt.path)
+	}
+}
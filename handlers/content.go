@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// contentFormats are the formats of the content route by their format query parameter.
+var contentFormats = map[string]ladder.Format{
+	"":         ladder.FormatOutline,
+	"json":     ladder.FormatOutline,
+	"html":     ladder.FormatArticleHTML,
+	"markdown": ladder.FormatMarkdown,
+}
+
+// ContentResponse is the JSON response of the content route.
+type ContentResponse struct {
+	Version string `json:"version"`
+	// URL is the URL that was fetched, after the URL modifications of the rule.
+	URL     string          `json:"url"`
+	Outline *ladder.Outline `json:"outline"`
+}
+
+// ErrorResponse is the JSON envelope of the errors of the content and metadata routes.
+type ErrorResponse struct {
+	Version string `json:"version"`
+	Error   struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Content returns the main content of the article in the URL, as its outline wrapped
+// in a ContentResponse, or as HTML or Markdown with ?format=html or ?format=markdown.
+// Errors are reported as an ErrorResponse whatever the format.
+func Content(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+	format, ok := contentFormats[c.Query("format")]
+	if !ok {
+		return apiError(c, fiber.StatusBadRequest, "unknown format '"+c.Query("format")+"', must be one of json, html, markdown")
+	}
+	preset, query := requestPreset(c)
+	delete(query, "format")
+
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: format,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		return apiError(c, errorStatuses.Status(err), err.Error())
+	}
+	if result.Response.StatusCode >= 400 {
+		return apiError(c, result.Response.StatusCode, "upstream responded "+result.Response.Status)
+	}
+	if len(result.Outline.Blocks) == 0 {
+		return apiError(c, fiber.StatusUnprocessableEntity, "no content could be extracted from the page")
+	}
+
+	switch format {
+	case ladder.FormatArticleHTML:
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(result.Content)
+	case ladder.FormatMarkdown:
+		c.Set(fiber.HeaderContentType, mimeMarkdown+"; charset=utf-8")
+		return c.SendString(result.Content)
+	}
+	return c.JSON(ContentResponse{Version: version, URL: result.URL, Outline: result.Outline})
+}
+
+// contentError answers the request with status and an ErrorResponse with message.
+func apiError(c *fiber.Ctx, status int, message string) error {
+	response := ErrorResponse{Version: version}
+	response.Error.Status = status
+	response.Error.Message = message
+	return c.Status(status).JSON(response)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"ladder/pkg/jar"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cookieImportToken authorizes the imports of /api/v1/cookies, which are disabled if empty.
+var cookieImportToken = os.Getenv("COOKIE_IMPORT_TOKEN")
+
+// importer returns the jar of the client, which NewClient or COOKIE_JAR_FILE set before serving,
+// as fetches read it concurrently.
+func importer() (*jar.Jar, error) {
+	if j, ok := client.Jar.(*jar.Jar); ok {
+		return j, nil
+	}
+	return nil, errors.New("the cookie jar of the client can't import cookies")
+}
+
+// ImportCookies imports the cookies exported from a browser to the file at path, in the
+// Netscape cookies.txt format or as JSON, see jar.Jar.Import.
+func ImportCookies(path string) error {
+	j, err := importer()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read cookies: %w", err)
+	}
+	defer f.Close()
+	n, err := j.Import(f)
+	if err != nil {
+		return fmt.Errorf("failed to import cookies from '%s': %w", path, err)
+	}
+	slog.Info("imported cookies", "count", n, "path", path)
+	return nil
+}
+
+// Cookies imports the cookies exported from a browser sent in the body, for clients
+// authorized with the bearer token of COOKIE_IMPORT_TOKEN.
+func Cookies(c *fiber.Ctx) error {
+	if cookieImportToken == "" {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.SendString("Cookie import disabled")
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cookieImportToken)) != 1 {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		c.SendStatus(fiber.StatusUnauthorized)
+		return c.SendString("Invalid cookie import token")
+	}
+
+	j, err := importer()
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendString(err.Error())
+	}
+	n, err := j.Import(bytes.NewReader(c.Body()))
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+	return c.JSON(fiber.Map{"imported": n})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	_ "embed"
+	"path"
+
+	"github.com/gofiber/fiber/v2"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+//go:embed openapi.yaml
+var openapiSpec string
+
+//go:embed docs.html
+var docsHtml string
+
+// swaggerAssets lists the Swagger UI files served under /api/docs.
+var swaggerAssets = map[string]string{
+	"swagger-ui.css":       "text/css",
+	"swagger-ui-bundle.js": "text/javascript",
+	"favicon-32x32.png":    "image/png",
+	"favicon-16x16.png":    "image/png",
+}
+
+// OpenAPI serves the OpenAPI document of the ladder API.
+func OpenAPI(c *fiber.Ctx) error {
+	c.Set("Content-Type", "application/yaml")
+	return c.SendString(openapiSpec)
+}
+
+// Docs serves the Swagger UI of the ladder API.
+func Docs(c *fiber.Ctx) error {
+	name := path.Base(c.Params("*"))
+	contentType, ok := swaggerAssets[name]
+	if !ok {
+		c.Set("Content-Type", "text/html")
+		return c.SendString(docsHtml)
+	}
+
+	data, err := swaggerFiles.ReadFile("/" + name)
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendString(err.Error())
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("Cache-Control", "public, max-age=86400")
+	return c.Send(data)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+
+	"ladder/pkg/epub"
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var filenameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Epub returns the article in the URL as an EPUB book, with its images fetched through ladder.
+func Epub(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatOutline,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+	if result.Response.StatusCode >= 400 {
+		c.SendStatus(result.Response.StatusCode)
+		return c.SendString(result.Response.Status)
+	}
+
+	outline := *result.Outline
+	book := epub.Book{
+		Outline: outline,
+		Images:  client.FetchImages(c.Context(), outline.ImageURLs()),
+	}
+	var buf bytes.Buffer
+	if err := book.Write(&buf, time.Now()); err != nil {
+		logger(c).Error("failed to write EPUB", "error", err)
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, epub.MediaType)
+	c.Attachment(filename(outline.Metadata.Title, ".epub"))
+	return c.Send(buf.Bytes())
+}
+
+// filename returns the name of the file downloaded for an article titled title, eg: ladder-and-friends.epub.
+func filename(title string, ext string) string {
+	name := strings.Trim(filenameRegex.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if name == "" {
+		name = "article"
+	}
+	return name + ext
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ladder/pkg/events"
+	"ladder/pkg/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tagHeader tags a request, so its debug events can be followed with /api/v1/events?tag=.
+const tagHeader = "X-Ladder-Tag"
+
+// debugHeader enables debugging a single request, returning its trace report instead of the body,
+// like debugQuery, or only its trace summary in traceHeader, see newRequestTrace.
+const (
+	debugHeader = "X-Ladder-Debug"
+	debugQuery  = "ladder_debug"
+	traceHeader = "X-Ladder-Trace"
+)
+
+// keepAliveInterval is the interval of the comments sent to idle event streams.
+const keepAliveInterval = 15 * time.Second
+
+func init() {
+	if os.Getenv("DEBUG_EVENTS") == "true" {
+		EnableEvents()
+	}
+}
+
+// EnableEvents publishes the debug events of all requests, for /api/v1/events and LogEvents.
+func EnableEvents() {
+	if client.Events == nil {
+		client.Events = events.NewBus()
+	}
+}
+
+// LogEvents logs the debug events of all requests until the process exits.
+func LogEvents() {
+	EnableEvents()
+	sub := client.Events.Subscribe("")
+	go func() {
+		for e := range sub.Events() {
+			logEvent(e)
+		}
+	}()
+}
+
+// logEvent logs the debug event e.
+func logEvent(e events.Event) {
+	slog.Info(e.Message, "tag", e.Tag, "type", e.Type, "data", e.Data)
+}
+
+// Events streams the debug events of the requests tagged with the tag query
+// parameter, or of all requests without it, as server-sent events. The events of all users
+// are streamed, so it requires Basic Auth, API keys or the login to be configured.
+func Events(c *fiber.Ctx) error {
+	if client.Events == nil {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.SendString("Debug events disabled")
+	}
+	if !authConfigured() {
+		c.SendStatus(fiber.StatusForbidden)
+		return c.SendString("Debug events require USERPASS, API keys or the login to be configured")
+	}
+
+	sub := client.Events.Subscribe(c.Query("tag"))
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case e := <-sub.Events():
+				data, err := json.Marshal(e)
+				if err != nil {
+					slog.Error("failed to encode event", "error", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+
+			// a failed flush means the client disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// requestTrace collects the debug events of a request sent with the debug header or query parameter.
+type requestTrace struct {
+	start  time.Time
+	events []events.Event
+	// report replaces the response with the JSON report of the trace, rather than summarizing
+	// it in traceHeader.
+	report bool
+}
+
+// newRequestTrace returns the trace of the request in c if it enables debugging, otherwise nil:
+// X-Ladder-Debug: 1 (or json) and the ladder_debug query parameter return its report instead of
+// the body, X-Ladder-Debug: header only summarizes it in the X-Ladder-Trace header. The events of
+// the request are logged either way. Only authenticated clients can enable debugging, so it
+// requires Basic Auth, API keys or the login to be configured.
+func newRequestTrace(c *fiber.Ctx) *requestTrace {
+	debug := c.Get(debugHeader)
+	report := debug == "1" || debug == "json" || c.Request().URI().QueryArgs().Has(debugQuery)
+	if debug != "header" && !report {
+		return nil
+	}
+	if !authConfigured() {
+		return nil
+	}
+	return &requestTrace{start: time.Now(), report: report}
+}
+
+// trace returns the function collecting and logging the debug events of the request, for ladder.FetchOptions.Trace.
+func (r *requestTrace) trace() func(events.Event) {
+	if r == nil {
+		return nil
+	}
+	return func(e events.Event) {
+		logEvent(e)
+		r.events = append(r.events, e)
+	}
+}
+
+// passthrough reports whether the upstream body can be streamed to the client, rather than
+// read and modified as a whole: reports replace it, and need the modifiers applied to it.
+func (r *requestTrace) passthrough() bool {
+	return r == nil || !r.report
+}
+
+// finish sets the trace summary header of the response, and replaces the response with the
+// report of the trace unless only the summary was requested.
+func (r *requestTrace) finish(c *fiber.Ctx) {
+	if r == nil {
+		return
+	}
+	summary := r.summary()
+	if !r.report {
+		c.Set(traceHeader, summary)
+		return
+	}
+	report := r.build(c.Response().StatusCode())
+	body, err := json.Marshal(report)
+	if err != nil {
+		logger(c).Error("failed to encode trace", "error", err)
+		return
+	}
+	// the headers of the upstream response, eg: Content-Encoding, don't apply to the report
+	c.Response().Reset()
+	if entry := logging.FromContext(c.Context()); entry != nil {
+		c.Set(fiber.HeaderXRequestID, entry.RequestID)
+	}
+	c.Set(traceHeader, summary)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	c.Response().SetBody(body)
+}
+
+// traceReport is the JSON report of the processing of a request sent with debugging enabled.
+type traceReport struct {
+	// Status is the status of the response the report replaces.
+	Status    int                 `json:"status"`
+	Rule      string              `json:"rule"`
+	Modifiers []traceModifier     `json:"modifiers"`
+	Headers   []traceHeaderChange `json:"headers"`
+	Upstream  *traceUpstream      `json:"upstream,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	// Duration is the time taken by ladder to serve the request, in milliseconds.
+	Duration float64 `json:"duration"`
+	// Events are every debug event of the request, in order.
+	Events []traceEvent `json:"events"`
+}
+
+// traceModifier is a modifier applied to the request or the response, in the order they ran.
+type traceModifier struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+	// Duration is the time spent in the modifier, in milliseconds.
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// traceHeaderChange is a header set, changed or removed by source, the ruleset, a modifier or
+// the normalization of the upstream response.
+type traceHeaderChange struct {
+	Source string `json:"source"`
+	Header string `json:"header"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// traceUpstream is the last upstream response.
+type traceUpstream struct {
+	Status      string `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	// Bytes is the size of the body, -1 if unknown.
+	Bytes int64 `json:"bytes"`
+}
+
+// traceEvent is a debug event, timed from the start of the request.
+type traceEvent struct {
+	// Elapsed is the time since the start of the request, in milliseconds.
+	Elapsed float64           `json:"elapsed"`
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// build returns the report of the events of the request, answered with status.
+func (r *requestTrace) build(status int) *traceReport {
+	report := &traceReport{
+		Status:    status,
+		Modifiers: []traceModifier{},
+		Headers:   []traceHeaderChange{},
+		Duration:  milliseconds(time.Since(r.start)),
+		Events:    make([]traceEvent, 0, len(r.events)),
+	}
+	for _, e := range r.events {
+		report.Events = append(report.Events, traceEvent{
+			Elapsed: milliseconds(e.Time.Sub(r.start)),
+			Type:    e.Type,
+			Message: e.Message,
+			Data:    e.Data,
+		})
+		switch e.Type {
+		case events.TypeRule:
+			if e.Data["strategy"] == "" {
+				report.Rule = e.Message
+			}
+		case events.TypeModifier:
+			d, _ := time.ParseDuration(e.Data["duration"])
+			report.Modifiers = append(report.Modifiers, traceModifier{
+				Name:     e.Data["modifier"],
+				Phase:    e.Data["phase"],
+				Duration: milliseconds(d),
+				Error:    e.Data["error"],
+			})
+		case events.TypeHeader:
+			report.Headers = append(report.Headers, traceHeaderChange{
+				Source: e.Data["source"],
+				Header: e.Data["header"],
+				Old:    e.Data["old"],
+				New:    e.Data["new"],
+			})
+		case events.TypeResponse:
+			if e.Data["bytes"] == "" {
+				// the outcome of a strategy, not an upstream response
+				continue
+			}
+			bytes, _ := strconv.ParseInt(e.Data["bytes"], 10, 64)
+			report.Upstream = &traceUpstream{Status: e.Message, ContentType: e.Data["contentType"], Bytes: bytes}
+		case events.TypeError:
+			report.Error = e.Message
+		}
+	}
+	return report
+}
+
+// milliseconds returns d in milliseconds, to the microsecond.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// summary summarizes the events of the request on a single line, eg:
+// rule="matched rule for example.com"; modifiers="lua"; upstream="200 OK"; bytes=1024; events=12; duration=85ms
+func (r *requestTrace) summary() string {
+	report := r.build(0)
+	modifiers := []string{}
+	for _, m := range report.Modifiers {
+		if !slices.Contains(modifiers, m.Name) {
+			modifiers = append(modifiers, m.Name)
+		}
+	}
+
+	parts := []string{
+		fmt.Sprintf("rule=%q", report.Rule),
+		fmt.Sprintf("modifiers=%q", strings.Join(modifiers, ",")),
+	}
+	if report.Upstream != nil {
+		parts = append(parts, fmt.Sprintf("upstream=%q", report.Upstream.Status), "bytes="+strconv.FormatInt(report.Upstream.Bytes, 10))
+	}
+	if report.Error != "" {
+		parts = append(parts, fmt.Sprintf("error=%q", report.Error))
+	}
+	parts = append(parts,
+		"events="+strconv.Itoa(len(r.events)),
+		"duration="+time.Since(r.start).Round(time.Millisecond).String(),
+	)
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/apikey"
+	"ladder/pkg/events"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/ssrf"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsRequireAuth(t *testing.T) {
+	t.Setenv("USERPASS", "")
+	defer func(bus *events.Bus) { client.Events = bus }(client.Events)
+
+	app := fiber.New()
+	app.Get("/api/v1/events", Events)
+
+	client.Events = nil
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/events", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the events of all users aren't streamed to anyone
+	client.Events = events.NewBus()
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/events", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "require USERPASS, API keys or the login")
+}
+
+func TestRequestTrace(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<html><body><p>"+r.UserAgent()+"</p></body></html>")
+	}))
+	defer upstream.Close()
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	// the upstream server listens on a loopback address
+	defer func(guard *ssrf.Guard) { client.Guard = guard }(client.Guard)
+	client.Guard = nil
+	defer func(rules ruleset.RuleSet) { client.SetRules(rules) }(client.Rules)
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Headers.UserAgent = "googlebot"
+	client.SetRules(ruleset.RuleSet{rule})
+	defer func(keys *apikey.Keys) { apiKeys = keys }(apiKeys)
+	t.Setenv("USERPASS", "")
+
+	app := fiber.New()
+	app.Use(Authenticate)
+	app.Get("/*", ProxySite(""))
+	debug := func(value, key string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/"+upstream.URL+"/", nil)
+		req.Header.Set(debugHeader, value)
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// without authentication, debugging isn't enabled and the page is served
+	apiKeys = nil
+	resp := debug("1", "")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "googlebot")
+	assert.Empty(t, resp.Header.Get(traceHeader))
+
+	keys, err := apikey.New(apikey.Parse("ci:3f9c2a"))
+	require.NoError(t, err)
+	apiKeys = keys
+	resp = debug("1", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = debug("1", "3f9c2a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.MIMEApplicationJSONCharsetUTF8, resp.Header.Get("Content-Type"))
+	var report traceReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, http.StatusOK, report.Status)
+	assert.Contains(t, report.Rule, u.Host)
+	require.NotNil(t, report.Upstream)
+	assert.Equal(t, "200 OK", report.Upstream.Status)
+	assert.Contains(t, report.Headers, traceHeaderChange{Source: "ruleset", Header: "User-Agent", New: "googlebot"})
+	var types []string
+	for _, e := range report.Events {
+		types = append(types, e.Type)
+	}
+	assert.Subset(t, types, []string{events.TypeRule, events.TypeHeader, events.TypeResponse})
+	assert.Contains(t, resp.Header.Get(traceHeader), "upstream=\"200 OK\"")
+
+	// the summary alone leaves the page as is
+	resp = debug("header", "3f9c2a")
+	body, _ = io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "googlebot")
+	assert.Contains(t, resp.Header.Get(traceHeader), "upstream=\"200 OK\"")
+}
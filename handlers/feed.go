@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mimeRSS is the media type of RSS feeds.
+const mimeRSS = "application/rss+xml"
+
+// Feed returns a RSS feed of the articles linked from the index page in the URL,
+// such as the front page or a section of a site without a feed of its own.
+func Feed(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:       query,
+		Format:      ladder.FormatFeed,
+		ProxyOrigin: c.BaseURL(),
+		Tag:         c.Get(tagHeader),
+		Preset:      preset,
+		Trace:       trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+	if result.Response.StatusCode >= 400 {
+		c.SendStatus(result.Response.StatusCode)
+		return c.SendString(result.Response.Status)
+	}
+
+	c.Set(fiber.HeaderContentType, mimeRSS+"; charset=utf-8")
+	return c.SendString(result.Content)
+}
@@ -1,16 +1,12 @@
 package handlers
 
 import (
-	_ "embed"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-//go:embed form.html
-var formHtml string
-
 func Form(c *fiber.Ctx) error {
 	if os.Getenv("DISABLE_FORM") == "true" {
 		c.Set("Content-Type", "text/html")
@@ -20,12 +16,13 @@ func Form(c *fiber.Ctx) error {
 		if os.Getenv("FORM_PATH") != "" {
 			dat, err := os.ReadFile(os.Getenv("FORM_PATH"))
 			if err != nil {
-				log.Println("ERROR: unable to load custom form", err)
+				slog.Error("unable to load custom form", "error", err)
 			} else {
-				formHtml = string(dat)
+				c.Set("Content-Type", "text/html")
+				return c.Send(dat)
 			}
 		}
 		c.Set("Content-Type", "text/html")
-		return c.SendString(formHtml)
+		return pages.Render(c, "form.html", nil)
 	}
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"ladder/pkg/graphql"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var graphqlSchema = graphql.NewSchema(client)
+
+// GraphQL executes a GraphQL query, read from the JSON body of POST requests
+// or from the query, operationName and variables parameters of GET requests.
+func GraphQL(c *fiber.Ctx) error {
+	req := graphql.Request{}
+	if c.Method() == fiber.MethodPost {
+		if err := c.BodyParser(&req); err != nil {
+			c.SendStatus(fiber.StatusBadRequest)
+			return c.SendString(err.Error())
+		}
+	} else {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				c.SendStatus(fiber.StatusBadRequest)
+				return c.SendString(err.Error())
+			}
+		}
+	}
+
+	// the articles extracted are only listed to the client of the same API key
+	ctx := context.Context(c.Context())
+	if name, ok := c.Locals(apiKeyName).(string); ok {
+		ctx = graphql.WithOwner(ctx, name)
+	}
+	body, err := graphqlSchema.Exec(ctx, req)
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendString(err.Error())
+	}
+
+	c.Set("Content-Type", fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
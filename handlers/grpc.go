@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net"
+	"os"
+
+	"ladder/pkg/rpc"
+
+	"google.golang.org/grpc"
+)
+
+// ServeGRPC serves the gRPC API on addr, sharing the client and ruleset of the proxy.
+func ServeGRPC(addr string) error {
+	opts, err := grpcAuth()
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	var rpcOpts []rpc.Option
+	if os.Getenv("EXPOSE_RULESET") == "false" {
+		rpcOpts = append(rpcOpts, rpc.HideRules())
+	}
+
+	s := grpc.NewServer(opts...)
+	rpc.Register(s, client, rpcOpts...)
+	return s.Serve(lis)
+}
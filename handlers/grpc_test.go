@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"ladder/pkg/apikey"
+	"ladder/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCAuth(t *testing.T) {
+	defer func(keys *apikey.Keys) { apiKeys = keys }(apiKeys)
+	apiKeys = nil
+
+	t.Setenv("USERPASS", "")
+	_, err := grpcAuth()
+	assert.NoError(t, err)
+
+	// the HTTP routes are protected, but the gRPC API couldn't be
+	t.Setenv("USERPASS", "user:pass")
+	_, err = grpcAuth()
+	assert.ErrorContains(t, err, "the gRPC API requires API_KEYS")
+
+	keys, err := apikey.New(apikey.Parse("ci:3f9c2a"))
+	require.NoError(t, err)
+	apiKeys = keys
+	_, err = grpcAuth()
+	assert.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "3f9c2a"))
+	assert.NoError(t, grpcCheck(ctx))
+	assert.Equal(t, codes.Unauthenticated, status.Code(grpcCheck(context.Background())))
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	defer func(l *ratelimit.Limiter) { limiter = l }(limiter)
+	limiter = ratelimit.New(1, 1)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}})
+	assert.NoError(t, grpcRateLimit(ctx))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(grpcRateLimit(ctx)))
+
+	// clients are limited by IP address, whatever their port
+	other := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1234}})
+	assert.NoError(t, grpcRateLimit(other))
+}
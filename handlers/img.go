@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"ladder/pkg/imaging"
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// imageParams are the query parameters of the image route, which are not sent upstream.
+var imageParams = []string{"w", "h", "format"}
+
+// Img returns the image in the URL scaled down to the w and h query parameters and
+// converted to the format parameter, eg: /img/https://www.example.com/a.jpg?w=800&format=webp.
+// Images that can't be transformed, eg: SVGs, are returned as received.
+func Img(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+	opts, err := imaging.ParseOptions(c.Query("w"), c.Query("h"), c.Query("format"))
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+	preset, query := requestPreset(c)
+	for _, param := range imageParams {
+		delete(query, param)
+	}
+
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatRaw,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+
+	c.Status(result.Response.StatusCode)
+	c.Set(fiber.HeaderContentType, result.Response.Header.Get("Content-Type"))
+	if cacheControl := result.Response.Header.Get("Cache-Control"); cacheControl != "" {
+		c.Set(fiber.HeaderCacheControl, cacheControl)
+	}
+	body := []byte(result.Content)
+	if result.Response.StatusCode != fiber.StatusOK || opts.IsZero() || len(body) > ladder.MaxImageSize {
+		return c.Send(body)
+	}
+
+	data, mediaType, err := imaging.Transform(body, opts)
+	if err != nil {
+		return c.Send(body)
+	}
+	c.Set(fiber.HeaderContentType, mediaType)
+	return c.Send(data)
+}
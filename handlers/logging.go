@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"ladder/pkg/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// accessLog logs every request served, unless NOLOGS=true.
+var accessLog = os.Getenv("NOLOGS") != "true"
+
+// AccessLog identifies every request with the request ID of its X-Request-Id header, or a new
+// one, returned in the X-Request-Id response header, and logs it once served, along with its
+// status, its duration and the annotations of its fetch, such as the rule matched.
+func AccessLog(c *fiber.Ctx) error {
+	start := time.Now()
+	entry := logging.NewEntry(c.Get(fiber.HeaderXRequestID))
+	c.Context().SetUserValue(logging.ContextKey, entry)
+	c.Set(fiber.HeaderXRequestID, entry.RequestID)
+
+	err := c.Next()
+	if !accessLog {
+		return err
+	}
+	status := responseStatus(c, err)
+	level := slog.LevelInfo
+	if status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := append(entry.Attrs(),
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.String("route", c.Route().Path),
+		slog.Int("status", status),
+		slog.Duration("duration", time.Since(start)),
+	)
+	slog.LogAttrs(c.Context(), level, "request", attrs...)
+	return err
+}
+
+// responseStatus returns the status of the response to c, once the handlers returned err.
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	// the error handler sets the status once the middlewares returned
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// logger returns the logger of the request of c, which logs its request ID.
+func logger(c *fiber.Ctx) *slog.Logger {
+	return logging.Logger(c.Context())
+}
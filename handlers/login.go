@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"ladder/pkg/oidc"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	loginPath    = "/auth/login"
+	callbackPath = "/auth/callback"
+	logoutPath   = "/auth/logout"
+	// sessionCookie holds the session of the user logged in, and loginCookie the login in progress.
+	sessionCookie = "ladder_session"
+	loginCookie   = "ladder_login"
+)
+
+var (
+	// login is the OpenID Connect provider users log in with, if configured.
+	login *oidc.Provider
+	// sealer signs the sessions and logins kept in cookies.
+	sealer *oidc.Sealer
+	// sessionTTL is how long users stay logged in.
+	sessionTTL = 24 * time.Hour
+	// allowedUsers are the emails and @domains of the users allowed to log in, everyone if empty.
+	allowedUsers []string
+)
+
+// LoadLogin requires the users of the HTML routes to log in with the OpenID Connect provider
+// configured by OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL, if set.
+// API keys are still accepted, eg: by programmatic clients, see Authenticate.
+func LoadLogin() error {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	config := oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SESSION_TTL")); err == nil && ttl > 0 {
+		sessionTTL = ttl
+	}
+	if users := os.Getenv("OIDC_ALLOWED_USERS"); users != "" {
+		allowedUsers = strings.Split(users, ",")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	provider, err := oidc.Discover(ctx, config, nil)
+	if err != nil {
+		return err
+	}
+	secret := os.Getenv("SESSION_SECRET")
+	if secret == "" {
+		slog.Warn("SESSION_SECRET is not set, users will have to log in again once ladder restarts")
+	}
+	login, sealer = provider, oidc.NewSealer(secret)
+	slog.Info("users log in with OpenID Connect", "issuer", issuer)
+	return nil
+}
+
+// checkSession reports whether c carries the session of a user logged in, removing it from the request.
+func checkSession(c *fiber.Ctx) bool {
+	if login == nil {
+		return false
+	}
+	var session oidc.Session
+	if err := sealer.Open(sessionCookie, c.Cookies(sessionCookie), &session); err != nil || !session.Valid() {
+		return false
+	}
+	c.Request().Header.DelCookie(sessionCookie)
+	return true
+}
+
+// Login sends the user to log in with the OpenID Connect provider, to come back to the path
+// of the next query parameter.
+func Login(c *fiber.Ctx) error {
+	if login == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	next := c.Query("next")
+	// only paths of ladder, rather than other sites, eg: //evil.example.com
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	l := oidc.NewLogin(next)
+	sealed, err := sealer.Seal(loginCookie, l)
+	if err != nil {
+		return err
+	}
+	setAuthCookie(c, loginCookie, sealed, 10*time.Minute)
+	return c.Redirect(login.AuthCodeURL(l))
+}
+
+// Callback completes the login the provider redirected the user back from.
+func Callback(c *fiber.Ctx) error {
+	if login == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	var l oidc.Login
+	if err := sealer.Open(loginCookie, c.Cookies(loginCookie), &l); err != nil || l.State == "" || c.Query("state") != l.State {
+		return apiError(c, fiber.StatusBadRequest, "invalid or expired login, please log in again")
+	}
+	setAuthCookie(c, loginCookie, "", -1)
+	if reason := c.Query("error"); reason != "" {
+		return apiError(c, fiber.StatusUnauthorized, "login failed: "+reason+" "+c.Query("error_description"))
+	}
+	claims, err := login.Exchange(c.Context(), c.Query("code"), l)
+	if err != nil {
+		logger(c).Error("login failed", "error", err)
+		return apiError(c, fiber.StatusUnauthorized, "login failed")
+	}
+	if !oidc.Allowed(claims, allowedUsers) {
+		logger(c).Warn("user not allowed to log in", "email", claims.Email, "subject", claims.Subject)
+		return apiError(c, fiber.StatusForbidden, "not allowed to use this ladder")
+	}
+	sealed, err := sealer.Seal(sessionCookie, oidc.NewSession(claims, sessionTTL))
+	if err != nil {
+		return err
+	}
+	setAuthCookie(c, sessionCookie, sealed, sessionTTL)
+	return c.Redirect(l.Next)
+}
+
+// Logout ends the session of the user.
+func Logout(c *fiber.Ctx) error {
+	setAuthCookie(c, sessionCookie, "", -1)
+	return c.Redirect("/")
+}
+
+// setAuthCookie sets the cookie name to value for ttl, or deletes it if ttl is negative.
+func setAuthCookie(c *fiber.Ctx, name, value string, ttl time.Duration) {
+	cookie := &fiber.Cookie{Name: name, Value: value, Path: "/", HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode, Secure: c.Protocol() == "https"}
+	if ttl < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	} else {
+		cookie.MaxAge = int(ttl.Seconds())
+	}
+	c.Cookie(cookie)
+}
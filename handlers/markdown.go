@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mimeMarkdown is the media type of Markdown documents.
+const mimeMarkdown = "text/markdown"
+
+// Markdown returns the article in the URL as a Markdown document.
+func Markdown(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatMarkdown,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+
+	c.Status(result.Response.StatusCode)
+	c.Set(fiber.HeaderContentType, mimeMarkdown+"; charset=utf-8")
+	return c.SendString(result.Content)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metadata returns the metadata of the page in the URL, its title, author, date, OpenGraph
+// and Twitter card properties and JSON-LD documents, for link previews and bookmarks.
+// Errors are reported as an ErrorResponse.
+func Metadata(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		return apiError(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatMetadata,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		return apiError(c, errorStatuses.Status(err), err.Error())
+	}
+	if result.Response.StatusCode >= 400 {
+		return apiError(c, result.Response.StatusCode, "upstream responded "+result.Response.Status)
+	}
+
+	return c.JSON(result.PageMetadata)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"ladder/pkg/metrics"
+	"ladder/pkg/resolver"
+	"ladder/pkg/urls"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsHandler serves the metrics of client, when enabled.
+var metricsHandler fiber.Handler
+
+func init() {
+	if os.Getenv("METRICS") == "true" {
+		client.Metrics = metrics.New()
+		client.Metrics.Registry.MustRegister(
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "ladder_dns_cache_hits_total",
+				Help: "Host lookups answered from the DNS cache.",
+			}, func() float64 {
+				hits, _ := resolver.CacheStats()
+				return float64(hits)
+			}),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "ladder_dns_cache_misses_total",
+				Help: "Host lookups sent to the resolver.",
+			}, func() float64 {
+				_, misses := resolver.CacheStats()
+				return float64(misses)
+			}),
+		)
+		metricsHandler = adaptor.HTTPHandler(client.Metrics.Handler())
+	}
+}
+
+// RecordMetrics records the route, status, duration and proxied domain of every request,
+// when metrics are enabled.
+func RecordMetrics(c *fiber.Ctx) error {
+	if client.Metrics == nil {
+		return c.Next()
+	}
+	start := time.Now()
+	err := c.Next()
+	status := responseStatus(c, err)
+	// the route and parameters are those of the handler that served the request
+	route := c.Route().Path
+	client.Metrics.Request(route, status, proxiedDomain(c, route), time.Since(start))
+	return err
+}
+
+// proxiedDomain returns the domain of the URL requested from route, if it proxies one.
+func proxiedDomain(c *fiber.Ctx, route string) string {
+	if !strings.HasSuffix(route, "*") {
+		return ""
+	}
+	rawURL, err := urls.Extract(c.Params("*"), c.Get("Referer"), "/")
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Metrics returns the metrics of ladder in the Prometheus exposition format.
+func Metrics(c *fiber.Ctx) error {
+	if metricsHandler == nil {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.SendString("Metrics disabled")
+	}
+	return metricsHandler(c)
+}
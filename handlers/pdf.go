@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"time"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/pdf"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Pdf returns the article in the URL as a PDF document, with its images fetched through ladder.
+func Pdf(c *fiber.Ctx) error {
+	url, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+
+	preset, query := requestPreset(c)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+		Query:  query,
+		Format: ladder.FormatOutline,
+		Tag:    c.Get(tagHeader),
+		Preset: preset,
+		Trace:  trace.trace(),
+	})
+	if err != nil {
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
+		return c.SendString(err.Error())
+	}
+	if result.Response.StatusCode >= 400 {
+		c.SendStatus(result.Response.StatusCode)
+		return c.SendString(result.Response.Status)
+	}
+
+	outline := *result.Outline
+	doc := pdf.Document{
+		Outline: outline,
+		Images:  client.FetchImages(c.Context(), outline.ImageURLs()),
+	}
+	var buf bytes.Buffer
+	if err := doc.Write(&buf, time.Now()); err != nil {
+		logger(c).Error("failed to write PDF", "error", err)
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, pdf.MediaType)
+	// shown by the browser rather than downloaded, unlike EPUBs
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="`+filename(outline.Metadata.Title, ".pdf")+`"`)
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"ladder/pkg/ladder"
+	"ladder/pkg/plugin"
+)
+
+// LoadPlugins starts the plugin binaries in dir and makes them available to rulesets.
+func LoadPlugins(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	plugins, err := plugin.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	client.Plugins = make(map[string]ladder.Modifier, len(plugins))
+	for name, p := range plugins {
+		client.Plugins[name] = p
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// proxiedMethods are the methods of the requests forwarded to proxied sites.
+var proxiedMethods = strings.Join([]string{
+	fiber.MethodGet, fiber.MethodHead, fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete, fiber.MethodOptions,
+}, ", ")
+
+// Preflight answers the OPTIONS requests of proxied sites locally rather than forwarding them,
+// allowing the CORS preflights of the fetch calls and embedded players of proxied pages: the
+// methods and headers requested are allowed for a day, from any origin but without credentials,
+// so that other sites can't read the pages proxied with the cookies of the user.
+func Preflight(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderAllow, proxiedMethods)
+	if c.Get(fiber.HeaderOrigin) == "" || c.Get(fiber.HeaderAccessControlRequestMethod) == "" {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	c.Set(fiber.HeaderAccessControlAllowMethods, proxiedMethods)
+	if headers := c.Get(fiber.HeaderAccessControlRequestHeaders); headers != "" {
+		c.Set(fiber.HeaderAccessControlAllowHeaders, headers)
+	}
+	c.Set(fiber.HeaderAccessControlMaxAge, "86400")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// allowCrossOrigin allows the requests of other origins, eg: of a player embedded in a page
+// proxied by another ladder, to read the response, as Preflight allowed them.
+func allowCrossOrigin(c *fiber.Ctx) {
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" && origin != c.BaseURL() {
+		c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	}
+}
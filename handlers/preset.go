@@ -0,0 +1,25 @@
+package handlers
+
+import "github.com/gofiber/fiber/v2"
+
+// presetHeader and presetQuery select the preset a request is fetched with instead of the preset
+// of the rule of the site, eg: /https://www.example.com/?ladder_preset=archive, see strategies.Names.
+const (
+	presetHeader = "X-Ladder-Preset"
+	presetQuery  = "ladder_preset"
+)
+
+// requestPreset returns the preset selected by the request, and its query without presetQuery
+// and debugQuery, which are not sent upstream.
+func requestPreset(c *fiber.Ctx) (string, map[string]string) {
+	preset := c.Get(presetHeader)
+	query := c.Queries()
+	if param, ok := query[presetQuery]; ok {
+		if preset == "" {
+			preset = param
+		}
+		delete(query, presetQuery)
+	}
+	delete(query, debugQuery)
+	return preset, query
+}
@@ -1,331 +1,492 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
-
+	"time"
+
+	"ladder/pkg/chaos"
+	"ladder/pkg/headless"
+	"ladder/pkg/jar"
+	"ladder/pkg/ladder"
+	"ladder/pkg/mockorigin"
+	"ladder/pkg/proxypool"
+	"ladder/pkg/resolver"
 	"ladder/pkg/ruleset"
+	"ladder/pkg/scripting"
+	"ladder/pkg/ssrf"
+	"ladder/pkg/tor"
+	"ladder/pkg/tracing"
+	"ladder/pkg/transport"
+	"ladder/pkg/urls"
+	"ladder/pkg/wasm"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// resultHeader classifies what the upstream response shows instead of the page, if anything, see ladder.DetectBlockage.
+const resultHeader = "X-Ladder-Result"
+
 var (
-	UserAgent      = getenv("USER_AGENT", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
-	ForwardedFor   = getenv("X_FORWARDED_FOR", "66.249.66.1")
-	rulesSet       = ruleset.NewRulesetFromEnv()
-	allowedDomains = []string{}
+	UserAgent     = getenv("USER_AGENT", ladder.DefaultUserAgent)
+	ForwardedFor  = getenv("X_FORWARDED_FOR", ladder.DefaultForwardedFor)
+	rulesSet      = ruleset.NewRulesetFromEnv()
+	client        = ladder.NewClient(rulesSet)
+	toolbar       = os.Getenv("TOOLBAR") == "true"
+	errorStatuses = ladder.DefaultErrorStatuses
 )
 
 func init() {
-	allowedDomains = strings.Split(os.Getenv("ALLOWED_DOMAINS"), ",")
-	if os.Getenv("ALLOWED_DOMAINS_RULESET") == "true" {
-		allowedDomains = append(allowedDomains, rulesSet.Domains()...)
+	client.UserAgent = UserAgent
+	if path := os.Getenv("USER_AGENTS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				client.UserAgents = append(client.UserAgents, line)
+			}
+		}
 	}
-}
+	client.ForwardedFor = ForwardedFor
+	client.AllowedDomains = strings.Split(os.Getenv("ALLOWED_DOMAINS"), ",")
+	// the domains of the ruleset follow its reloads, see WatchRuleset and RefreshRuleset
+	client.AllowRuleDomains = os.Getenv("ALLOWED_DOMAINS_RULESET") == "true"
+	client.LogURLs = os.Getenv("LOG_URLS") == "true"
+	client.StripOverlays = os.Getenv("STRIP_OVERLAYS") == "true"
+	client.Masquerade = os.Getenv("MASQUERADE")
+	if err := ladder.ValidateMasquerade(client.Masquerade); err != nil {
+		panic(err)
+	}
+	client.ClientHints = os.Getenv("CLIENT_HINTS")
+	if err := ladder.ValidateClientHints(client.ClientHints); err != nil {
+		panic(err)
+	}
+	client.TLSFingerprint = os.Getenv("TLS_FINGERPRINT")
+	if err := transport.ValidateFingerprint(client.TLSFingerprint, ""); err != nil {
+		panic(err)
+	}
+	client.HeaderOrder = os.Getenv("HEADER_ORDER")
+	if err := transport.ValidateHeaderOrder(client.HeaderOrder); err != nil {
+		panic(err)
+	}
+	client.Resolver = os.Getenv("RESOLVER")
+	if err := resolver.Validate(client.Resolver); err != nil {
+		panic(err)
+	}
+	client.WaybackSave = os.Getenv("WAYBACK_SAVE") == "true"
+	client.Cookies = os.Getenv("FORWARD_COOKIES") == "true"
+	client.CookieJar = os.Getenv("COOKIE_JAR") == "true"
+	if path := os.Getenv("COOKIE_JAR_FILE"); path != "" {
+		j, err := jar.New(path)
+		if err != nil {
+			panic(err)
+		}
+		client.Jar = j
+	}
+	if headers := os.Getenv("FORWARD_HEADERS"); headers != "" {
+		client.ForwardHeaders = strings.Split(headers, ",")
+	}
+	if params := os.Getenv("TRACKING_PARAMS"); params != "" {
+		client.TrackingParams = strings.Split(params, ",")
+	}
+	if strategies := os.Getenv("STRATEGIES"); strategies != "" {
+		client.Strategies = strings.Split(strategies, ",")
+		if err := ladder.ValidateStrategies(client.Strategies); err != nil {
+			panic(err)
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("IMAGE_MAX_WIDTH")); err == nil && width > 0 {
+		client.Images.MaxWidth = width
+	}
+	client.Images.Format = os.Getenv("IMAGE_FORMAT")
 
-// extracts a URL from the request ctx. If the URL in the request
-// is a relative path, it reconstructs the full URL using the referer header.
-func extractUrl(c *fiber.Ctx) (string, error) {
-	// try to extract url-encoded
-	reqUrl, err := url.QueryUnescape(c.Params("*"))
-	if err != nil {
-		// fallback
-		reqUrl = c.Params("*")
+	limits := wasm.DefaultLimits
+	if memory := os.Getenv("WASM_MEMORY_LIMIT"); memory != "" {
+		mib, err := strconv.Atoi(memory)
+		if err != nil || mib < 1 || mib > 4096 {
+			panic(fmt.Sprintf("invalid WASM_MEMORY_LIMIT '%s', expected a number of MiB between 1 and 4096", memory))
+		}
+		// a WebAssembly page is 64KiB
+		limits.MemoryPages = uint32(mib * 16)
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("WASM_TIMEOUT")); err == nil {
+		limits.Timeout = timeout
 	}
+	client.Wasm = wasm.NewRuntime(limits)
 
-	// Extract the actual path from req ctx
-	urlQuery, err := url.Parse(reqUrl)
+	retry, err := ruleset.ParseRetry(os.Getenv("RETRY"))
 	if err != nil {
-		return "", fmt.Errorf("error parsing request URL '%s': %v", reqUrl, err)
+		panic(err)
 	}
+	client.Retry = retry.Or(ladder.DefaultRetry)
+	budget := 0.1
+	if ratio, err := strconv.ParseFloat(os.Getenv("RETRY_BUDGET"), 64); err == nil && ratio >= 0 {
+		budget = ratio
+	}
+	client.RetryBudget = transport.NewRetryBudget(budget)
 
-	isRelativePath := urlQuery.Scheme == ""
+	maxConcurrency, _ := strconv.Atoi(os.Getenv("MAX_CONCURRENCY"))
+	maxConcurrencyPerHost, _ := strconv.Atoi(os.Getenv("MAX_CONCURRENCY_PER_HOST"))
+	if maxConcurrency > 0 || maxConcurrencyPerHost > 0 {
+		client.Concurrency = transport.NewConcurrencyLimit(maxConcurrency, maxConcurrencyPerHost)
+	}
 
-	// eg: https://localhost:8080/images/foobar.jpg -> https://realsite.com/images/foobar.jpg
-	if isRelativePath {
-		// Parse the referer URL from the request header.
-		refererUrl, err := url.Parse(c.Get("referer"))
-		if err != nil {
-			return "", fmt.Errorf("error parsing referer URL from req: '%s': %v", reqUrl, err)
-		}
+	if redirects, err := strconv.Atoi(os.Getenv("MAX_REDIRECTS")); err == nil && redirects >= 0 {
+		client.MaxRedirects = redirects
+	}
+	client.SameOriginRedirects = os.Getenv("REDIRECT_SAME_ORIGIN") == "true"
+	client.RedirectCookies = os.Getenv("REDIRECT_COOKIES") == "true"
 
-		// Extract the real url from referer path
-		realUrl, err := url.Parse(strings.TrimPrefix(refererUrl.Path, "/"))
-		if err != nil {
-			return "", fmt.Errorf("error parsing real URL from referer '%s': %v", refererUrl.Path, err)
-		}
+	if timeout, err := time.ParseDuration(os.Getenv("SCRIPT_TIMEOUT")); err == nil {
+		scripting.DefaultLimits.Timeout = timeout
+	}
 
-		// reconstruct the full URL using the referer's scheme, host, and the relative path / queries
-		fullUrl := &url.URL{
-			Scheme:   realUrl.Scheme,
-			Host:     realUrl.Host,
-			Path:     urlQuery.Path,
-			RawQuery: urlQuery.RawQuery,
-		}
+	switch upstream := os.Getenv("UPSTREAM_CLIENT"); upstream {
+	case "", "nethttp":
+	case "fasthttp":
+		client.FastHTTP = true
+	default:
+		panic(fmt.Sprintf("unknown UPSTREAM_CLIENT '%s', expected nethttp or fasthttp", upstream))
+	}
 
-		if os.Getenv("LOG_URLS") == "true" {
-			log.Printf("modified relative URL: '%s' -> '%s'", reqUrl, fullUrl.String())
-		}
-		return fullUrl.String(), nil
+	statuses, err := ladder.ParseErrorStatuses(os.Getenv("ERROR_STATUS"))
+	if err != nil {
+		panic(err)
+	}
+	errorStatuses = statuses
 
+	guard, err := ssrf.NewGuard(strings.Split(os.Getenv("SSRF_ALLOW"), ","))
+	if err != nil {
+		panic(err)
 	}
+	if err := guard.BlockSelf(strings.Split(os.Getenv("SSRF_SELF"), ",")); err != nil {
+		panic(err)
+	}
+	client.Guard = guard
 
-	// default behavior:
-	// eg: https://localhost:8080/https://realsite.com/images/foobar.jpg -> https://realsite.com/images/foobar.jpg
-	return urlQuery.String(), nil
+	client.Tor = tor.New(getenv("TOR_SOCKS", tor.DefaultSOCKS), os.Getenv("TOR_CONTROL"), os.Getenv("TOR_CONTROL_PASSWORD"))
+	if retries, err := strconv.Atoi(os.Getenv("TOR_RETRIES")); err == nil && retries >= 0 {
+		client.Tor.Retries = retries
+	}
 
-}
+	client.Browser = headless.New(os.Getenv("BROWSER"))
+	if maxWait, err := time.ParseDuration(os.Getenv("BROWSER_MAX_WAIT")); err == nil && maxWait > 0 {
+		client.Browser.MaxWait = maxWait
+	}
+	// the browser connects through ladder, so that the addresses of its requests are checked as they are dialed
+	client.Browser.Dial = transport.Dial(transport.Options{Guard: client.Guard})
+	client.Browser.ProxyListen = os.Getenv("BROWSER_PROXY_LISTEN")
+	client.Browser.ProxyURL = os.Getenv("BROWSER_PROXY_URL")
+
+	if pool := newProxyPool(); pool != nil {
+		client.Proxies = pool
+		go pool.Run(context.Background())
+	}
 
-func ProxySite(rulesetPath string) fiber.Handler {
-	if rulesetPath != "" {
-		rs, err := ruleset.NewRuleset(rulesetPath)
+	if spec := os.Getenv("CHAOS_RATE"); spec != "" {
+		rate, err := strconv.ParseFloat(spec, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			panic(fmt.Sprintf("invalid CHAOS_RATE '%s', expected a share of requests between 0 and 1", spec))
+		}
+		faults, err := chaos.ParseFaults(os.Getenv("CHAOS_FAULTS"))
 		if err != nil {
 			panic(err)
 		}
-		rulesSet = rs
+		if rate > 0 {
+			client.WrapTransport = func(next http.RoundTripper) http.RoundTripper {
+				return &chaos.Transport{Next: next, Rate: rate, Faults: faults}
+			}
+			slog.Warn("chaos mode enabled", "rate", rate, "faults", faults)
+		}
 	}
 
-	return func(c *fiber.Ctx) error {
-		// Get the url from the URL
-		url, err := extractUrl(c)
+	if origin := os.Getenv("MOCK_ORIGIN"); origin != "" {
+		t, err := mockorigin.Transport(origin)
 		if err != nil {
-			log.Println("ERROR In URL extraction:", err)
+			panic(err)
 		}
+		client.Transport = t
+		slog.Warn("fetching all sites from mock origin", "origin", origin)
+	}
+}
 
-		queries := c.Queries()
-		body, _, resp, err := fetchSite(url, queries)
+// newProxyPool returns the pool of upstream proxies listed in PROXY_POOL and PROXY_POOL_FILE, if any.
+func newProxyPool() *proxypool.Pool {
+	var proxies []string
+	if list := os.Getenv("PROXY_POOL"); list != "" {
+		proxies = strings.Split(list, ",")
+	}
+	if path := os.Getenv("PROXY_POOL_FILE"); path != "" {
+		listed, err := proxypool.ReadFile(path)
 		if err != nil {
-			log.Println("ERROR:", err)
-			c.SendStatus(fiber.StatusInternalServerError)
-			return c.SendString(err.Error())
+			panic(err)
 		}
+		proxies = append(proxies, listed...)
+	}
+	if len(proxies) == 0 {
+		return nil
+	}
 
-	c.Cookie(&fiber.Cookie{})
-	c.Set("Content-Type", resp.Header.Get("Content-Type"))
-	c.Set("Content-Security-Policy", resp.Header.Get("Content-Security-Policy"))
-
-		return c.SendString(body)
+	opts := proxypool.Options{
+		Rotation: os.Getenv("PROXY_ROTATION"),
+		CheckURL: os.Getenv("PROXY_CHECK_URL"),
 	}
+	if sticky, err := time.ParseDuration(os.Getenv("PROXY_STICKY")); err == nil {
+		opts.Sticky = sticky
+	}
+	if interval, err := time.ParseDuration(os.Getenv("PROXY_CHECK_INTERVAL")); err == nil {
+		opts.CheckInterval = interval
+	}
+	pool, err := proxypool.New(proxies, opts)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("rotating upstream requests across proxies", "proxies", len(pool.Addrs()))
+	return pool
 }
 
-func modifyURL(uri string, rule ruleset.Rule) (string, error) {
-	newUrl, err := url.Parse(uri)
+// extracts a URL from the request ctx. If the URL in the request
+// is a relative path, it reconstructs the full URL using the referer header.
+func extractUrl(c *fiber.Ctx) (string, error) {
+	_, span := tracing.Start(c.Context(), "extract url")
+	defer span.End()
+	reqUrl, err := urls.Extract(c.Params("*"), c.Get("Referer"), "/")
 	if err != nil {
+		tracing.RecordError(span, err)
 		return "", err
 	}
+	span.SetAttributes(attribute.String("url.full", reqUrl))
 
-	for _, urlMod := range rule.UrlMods.Domain {
-		re := regexp.MustCompile(urlMod.Match)
-		newUrl.Host = re.ReplaceAllString(newUrl.Host, urlMod.Replace)
+	if os.Getenv("LOG_URLS") == "true" && reqUrl != c.Params("*") {
+		logger(c).Info("modified URL", "from", c.Params("*"), "to", reqUrl)
 	}
+	return reqUrl, nil
+}
 
-	for _, urlMod := range rule.UrlMods.Path {
-		re := regexp.MustCompile(urlMod.Match)
-		newUrl.Path = re.ReplaceAllString(newUrl.Path, urlMod.Replace)
+func ProxySite(rulesetPath string) fiber.Handler {
+	if rulesetPath != "" {
+		rs, err := ruleset.NewRuleset(rulesetPath)
+		if err != nil {
+			panic(err)
+		}
+		rulesSet = rs
+		client.Rules = rs
 	}
 
-	v := newUrl.Query()
-	for _, query := range rule.UrlMods.Query {
-		if query.Value == "" {
-			v.Del(query.Key)
-			continue
+	return func(c *fiber.Ctx) error {
+		if c.Query(rawQuery) == "1" {
+			return Raw(c)
 		}
-		v.Set(query.Key, query.Value)
-	}
-	newUrl.RawQuery = v.Encode()
 
-	if rule.GoogleCache {
-		newUrl, err = url.Parse("https://webcache.googleusercontent.com/search?q=cache:" + newUrl.String())
+		// Get the url from the URL
+		url, err := extractUrl(c)
 		if err != nil {
-			return "", err
+			logger(c).Error("failed to extract URL", "error", err)
 		}
-	}
 
-	return newUrl.String(), nil
-}
+		format := acceptedFormat(c)
+		preset, query := requestPreset(c)
+		trace := newRequestTrace(c)
+		defer trace.finish(c)
+		// Memento clients select the archived copy served by the archive strategies
+		archiveTime, _ := http.ParseTime(c.Get("Accept-Datetime"))
+		// the bodies of forms and API calls are streamed upstream
+		var body io.Reader
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && c.Request().Header.ContentLength() != 0 {
+			if body = c.Context().RequestBodyStream(); body == nil {
+				body = bytes.NewReader(c.Body())
+			}
+		}
+		result, err := client.Fetch(c.Context(), url, ladder.FetchOptions{
+			Query:         query,
+			Format:        format,
+			Tag:           c.Get(tagHeader),
+			Preset:        preset,
+			Trace:         trace.trace(),
+			Passthrough:   trace.passthrough(),
+			Range:         c.Get("Range"),
+			IfRange:       c.Get("If-Range"),
+			Accept:        eventStreamAccept(c),
+			Cookie:        c.Get(fiber.HeaderCookie),
+			ProxyOrigin:   c.BaseURL(),
+			ArchiveTime:   archiveTime,
+			Method:        c.Method(),
+			Body:          body,
+			ContentLength: int64(c.Request().Header.ContentLength()),
+			ContentType:   c.Get(fiber.HeaderContentType),
+		})
+		if err != nil {
+			logger(c).Error("failed to fetch", "error", err)
+			return errorPage(c, errorStatuses.Status(err), url, err)
+		}
 
-func fetchSite(urlpath string, queries map[string]string) (string, *http.Request, *http.Response, error) {
-	urlQuery := "?"
-	if len(queries) > 0 {
-		for k, v := range queries {
-			urlQuery += k + "=" + v + "&"
+		c.Vary(fiber.HeaderAccept)
+		c.Status(result.Response.StatusCode)
+		allowCrossOrigin(c)
+		if result.Blockage != "" {
+			c.Set(resultHeader, string(result.Blockage))
+		}
+		switch format {
+		case ladder.FormatOutline:
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+			return c.SendString(result.Content)
+		case ladder.FormatText:
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			return c.SendString(result.Content)
+		case ladder.FormatMarkdown:
+			c.Set(fiber.HeaderContentType, mimeMarkdown+"; charset=utf-8")
+			return c.SendString(result.Content)
 		}
-	}
-	urlQuery = strings.TrimSuffix(urlQuery, "&")
-	urlQuery = strings.TrimSuffix(urlQuery, "?")
 
-	u, err := url.Parse(urlpath)
-	if err != nil {
-		return "", nil, nil, err
+		c.Set("Content-Type", result.Response.Header.Get("Content-Type"))
+		c.Set("Content-Security-Policy", result.Response.Header.Get("Content-Security-Policy"))
+		if location := result.Response.Header.Get("Location"); location != "" {
+			c.Set("Location", location)
+		}
+		if result.Body == nil {
+			// passthrough bodies come with their own headers, see sendBody
+			for name, values := range result.ForwardedHeaders() {
+				for _, value := range values {
+					c.Response().Header.Add(name, value)
+				}
+			}
+		}
+
+		if result.Body == nil && toolbar && strings.HasPrefix(result.Response.Header.Get("Content-Type"), "text/html") {
+			return c.SendString(injectToolbar(result.Content, url, result.Metadata.Title))
+		}
+		return sendBody(c, result)
 	}
+}
 
-	if len(allowedDomains) > 0 && !StringInSlice(u.Host, allowedDomains) {
-		return "", nil, nil, fmt.Errorf("domain not allowed. %s not in %s", u.Host, allowedDomains)
+// acceptedFormat selects the format of a proxied page from the Accept header:
+// the Outline for JSON or Markdown, the extracted text for plain text and HTML otherwise,
+// which includes browsers and clients accepting anything. Requests made by the
+// scripts of proxied pages, eg: fetching a JSON API, always get the upstream content.
+func acceptedFormat(c *fiber.Ctx) ladder.Format {
+	if mode := c.Get("Sec-Fetch-Mode"); (mode != "" && mode != "navigate") || c.Get(fiber.HeaderXRequestedWith) != "" {
+		return ladder.FormatHTML
+	}
+	switch c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON, mimeMarkdown, fiber.MIMETextPlain) {
+	case fiber.MIMEApplicationJSON:
+		return ladder.FormatOutline
+	case mimeMarkdown:
+		return ladder.FormatMarkdown
+	case fiber.MIMETextPlain:
+		return ladder.FormatText
 	}
+	return ladder.FormatHTML
+}
 
-	if os.Getenv("LOG_URLS") == "true" {
-		log.Println(u.String() + urlQuery)
+// eventStreamAccept returns the Accept header of the EventSource requests of proxied pages,
+// which is sent upstream to get their event stream.
+func eventStreamAccept(c *fiber.Ctx) string {
+	if accept := c.Get(fiber.HeaderAccept); accept == mimeEventStream {
+		return accept
 	}
+	return ""
+}
 
-	// Modify the URI according to ruleset
-	rule := fetchRule(u.Host, u.Path)
-	url, err := modifyURL(u.String()+urlQuery, rule)
+// SetTimeouts overrides the default timeouts of upstream requests with spec, a
+// comma separated list of phase=duration pairs, see ruleset.ParseTimeouts.
+func SetTimeouts(spec string) error {
+	timeouts, err := ruleset.ParseTimeouts(spec)
 	if err != nil {
-		return "", nil, nil, err
+		return err
 	}
+	client.Timeouts = timeouts.Or(ladder.DefaultTimeouts)
+	return nil
+}
 
-	// Fetch the site
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", url, nil)
-
-	if rule.Headers.UserAgent != "" {
-		req.Header.Set("User-Agent", rule.Headers.UserAgent)
-	} else {
-		req.Header.Set("User-Agent", UserAgent)
+// SetMaxBodySize bounds the size of the upstream bodies read to spec, a number of bytes with an
+// optional KB, MB or GB suffix, eg: 50MB. Larger responses are answered with 502 Bad Gateway.
+func SetMaxBodySize(spec string) error {
+	if spec == "" {
+		return nil
 	}
-
-	if rule.Headers.XForwardedFor != "" {
-		if rule.Headers.XForwardedFor != "none" {
-			req.Header.Set("X-Forwarded-For", rule.Headers.XForwardedFor)
-		}
-	} else {
-		req.Header.Set("X-Forwarded-For", ForwardedFor)
+	size, err := parseSize(spec)
+	if err != nil {
+		return fmt.Errorf("invalid max body size '%s': %w", spec, err)
 	}
+	client.MaxBodySize = size
+	return nil
+}
 
-	if rule.Headers.Referer != "" {
-		if rule.Headers.Referer != "none" {
-			req.Header.Set("Referer", rule.Headers.Referer)
+// parseSize parses a number of bytes with an optional KB, MB or GB suffix, in powers of 1024.
+func parseSize(spec string) (int64, error) {
+	spec = strings.ToUpper(strings.TrimSpace(spec))
+	unit := int64(1)
+	for suffix, size := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if number, ok := strings.CutSuffix(spec, suffix); ok {
+			spec, unit = strings.TrimSpace(number), size
+			break
 		}
-	} else {
-		req.Header.Set("Referer", u.String())
-	}
-
-	if rule.Headers.Cookie != "" {
-		req.Header.Set("Cookie", rule.Headers.Cookie)
 	}
-
-	resp, err := client.Do(req)
+	n, err := strconv.ParseInt(strings.TrimSuffix(spec, "B"), 10, 64)
 	if err != nil {
-		return "", nil, nil, err
+		return 0, err
 	}
-	defer resp.Body.Close()
-
-	bodyB, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", nil, nil, err
+	if n < 0 {
+		return 0, errors.New("must not be negative")
 	}
+	return n * unit, nil
+}
 
-	if rule.Headers.CSP != "" {
-		//log.Println(rule.Headers.CSP)
-		resp.Header.Set("Content-Security-Policy", rule.Headers.CSP)
+// PinHosts dials the hosts of pins, given as host:ip, at their address instead of looking them
+// up, see resolver.ParseHosts.
+func PinHosts(pins []string) error {
+	if _, err := resolver.ParseHosts(pins); err != nil {
+		return err
 	}
-
-	//log.Print("rule", rule) TODO: Add a debug mode to print the rule
-	body := rewriteHtml(bodyB, u, rule)
-	return body, req, resp, nil
+	client.Resolve = pins
+	return nil
 }
 
-func rewriteHtml(bodyB []byte, u *url.URL, rule ruleset.Rule) string {
-	// Rewrite the HTML
-	body := string(bodyB)
-
-	// images
-	imagePattern := `<img\s+([^>]*\s+)?src="(/)([^"]*)"`
-	re := regexp.MustCompile(imagePattern)
-	body = re.ReplaceAllString(body, fmt.Sprintf(`<img $1 src="%s$3"`, "/https://"+u.Host+"/"))
-
-	// scripts
-	scriptPattern := `<script\s+([^>]*\s+)?src="(/)([^"]*)"`
-	reScript := regexp.MustCompile(scriptPattern)
-	body = reScript.ReplaceAllString(body, fmt.Sprintf(`<script $1 script="%s$3"`, "/https://"+u.Host+"/"))
-
-	// body = strings.ReplaceAll(body, "srcset=\"/", "srcset=\"/https://"+u.Host+"/") // TODO: Needs a regex to rewrite the URL's
-	body = strings.ReplaceAll(body, "href=\"/", "href=\"/https://"+u.Host+"/")
-	body = strings.ReplaceAll(body, "url('/", "url('/https://"+u.Host+"/")
-	body = strings.ReplaceAll(body, "url(/", "url(/https://"+u.Host+"/")
-	body = strings.ReplaceAll(body, "href=\"https://"+u.Host, "href=\"/https://"+u.Host+"/")
-
-	if os.Getenv("RULESET") != "" {
-		body = applyRules(body, rule)
-	}
-	return body
+// EnableHTTP3 fetches all sites over HTTP/3 where their origin supports it.
+func EnableHTTP3() {
+	client.HTTP3 = true
 }
 
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
-	}
-	return value
+// CloseBrowser stops the headless browser, if it was launched.
+func CloseBrowser() {
+	client.Browser.Close()
 }
 
-func fetchRule(domain string, path string) ruleset.Rule {
-	if len(rulesSet) == 0 {
-		return ruleset.Rule{}
-	}
-	rule := ruleset.Rule{}
-	for _, rule := range rulesSet {
-		domains := rule.Domains
-		if rule.Domain != "" {
-			domains = append(domains, rule.Domain)
-		}
-		for _, ruleDomain := range domains {
-			if ruleDomain == domain || strings.HasSuffix(domain, ruleDomain) {
-				if len(rule.Paths) > 0 && !StringInSlice(path, rule.Paths) {
-					continue
-				}
-				// return first match
-				return rule
-			}
+// SaveCookies saves the cookies of the server-side jar to COOKIE_JAR_FILE, if set, eg: on shutdown.
+func SaveCookies() {
+	if j, ok := client.Jar.(*jar.Jar); ok {
+		if err := j.Save(); err != nil {
+			slog.Error("failed to save cookie jar", "error", err)
 		}
 	}
-	return rule
 }
 
-func applyRules(body string, rule ruleset.Rule) string {
-	if len(rulesSet) == 0 {
-		return body
-	}
-
-	for _, regexRule := range rule.RegexRules {
-		re := regexp.MustCompile(regexRule.Match)
-		body = re.ReplaceAllString(body, regexRule.Replace)
-	}
-	for _, injection := range rule.Injections {
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
-		if err != nil {
-			log.Fatal(err)
-		}
-		if injection.Replace != "" {
-			doc.Find(injection.Position).ReplaceWithHtml(injection.Replace)
-		}
-		if injection.Append != "" {
-			doc.Find(injection.Position).AppendHtml(injection.Append)
-		}
-		if injection.Prepend != "" {
-			doc.Find(injection.Position).PrependHtml(injection.Prepend)
-		}
-		body, err = doc.Html()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
+// EnableECH negotiates Encrypted Client Hello with the origins of all sites that publish an ECH config.
+func EnableECH() {
+	client.ECH = true
+}
 
-	return body
+// EnableTor fetches all sites through Tor.
+func EnableTor() {
+	client.ViaTor = true
+	slog.Info("fetching all sites through Tor", "socks", client.Tor.SOCKS)
 }
 
-func StringInSlice(s string, list []string) bool {
-	for _, x := range list {
-		if strings.HasPrefix(s, x) {
-			return true
-		}
+func getenv(key, fallback string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return fallback
 	}
-	return false
+	return value
 }
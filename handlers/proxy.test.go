@@ -2,10 +2,8 @@
 package handlers
 
 import (
-	"ladder/pkg/ruleset"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
@@ -22,38 +20,4 @@ func TestProxySite(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
-func TestRewriteHtml(t *testing.T) {
-	bodyB := []byte(`
-		<html>
-			<head>
-				<title>Test Page</title>
-			</head>
-			<body>
-				<img src="/image.jpg">
-				<script src="/script.js"></script>
-				<a href="/about">About Us</a>
-				<div style="background-image: url('/background.jpg')"></div>
-			</body>
-		</html>
-	`)
-	u := &url.URL{Host: "example.com"}
-
-	expected := `
-		<html>
-			<head>
-				<title>Test Page</title>
-			</head>
-			<body>
-				<img src="/https://example.com/image.jpg">
-				<script script="/https://example.com/script.js"></script>
-				<a href="/https://example.com/about">About Us</a>
-				<div style="background-image: url('/https://example.com/background.jpg')"></div>
-			</body>
-		</html>
-	`
-
-	actual := rewriteHtml(bodyB, u, ruleset.Rule{})
-	assert.Equal(t, expected, actual)
-}
-
 // END: 6f8b3f5d5d5d
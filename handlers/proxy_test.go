@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ladder/pkg/ladder"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptedFormat(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(string(acceptedFormat(c))) })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    ladder.Format
+	}{
+		{"no accept", nil, ladder.FormatHTML},
+		{"anything", map[string]string{"Accept": "*/*"}, ladder.FormatHTML},
+		{"browser", map[string]string{"Accept": "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, ladder.FormatHTML},
+		{"json", map[string]string{"Accept": "application/json"}, ladder.FormatOutline},
+		{"markdown", map[string]string{"Accept": "text/markdown"}, ladder.FormatMarkdown},
+		{"text", map[string]string{"Accept": "text/plain"}, ladder.FormatText},
+		{"q-values", map[string]string{"Accept": "application/json;q=0.5, text/plain"}, ladder.FormatText},
+		{"q-values ordered", map[string]string{"Accept": "text/html;q=0.1, text/markdown;q=0.9"}, ladder.FormatMarkdown},
+		{"wildcard subtype", map[string]string{"Accept": "text/*"}, ladder.FormatHTML},
+		{"wildcard with preference", map[string]string{"Accept": "*/*;q=0.1, application/json"}, ladder.FormatOutline},
+		{"unknown type", map[string]string{"Accept": "image/png"}, ladder.FormatHTML},
+		{"navigation", map[string]string{"Accept": "application/json", "Sec-Fetch-Mode": "navigate"}, ladder.FormatOutline},
+		// the scripts of proxied pages get the upstream content, whatever they accept
+		{"script fetch", map[string]string{"Accept": "application/json", "Sec-Fetch-Mode": "cors"}, ladder.FormatHTML},
+		{"xhr", map[string]string{"Accept": "application/json", "X-Requested-With": "XMLHttpRequest"}, ladder.FormatHTML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, string(tt.want), string(body))
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"ladder/pkg/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// limiter limits the requests per client IP address, if configured.
+var limiter *ratelimit.Limiter
+
+// SetRateLimit limits each client IP address to rate requests per minute, with bursts of up to
+// burst requests, which defaults to rate. Both are numbers, eg: RATE_LIMIT=60, RATE_LIMIT_BURST=20.
+func SetRateLimit(rate, burst string) error {
+	if rate == "" {
+		return nil
+	}
+	perMinute, err := strconv.ParseFloat(rate, 64)
+	if err != nil || perMinute <= 0 {
+		return fmt.Errorf("invalid rate limit '%s', expecting requests per minute", rate)
+	}
+	n := 0
+	if burst != "" {
+		if n, err = strconv.Atoi(burst); err != nil || n < 1 {
+			return fmt.Errorf("invalid rate limit burst '%s'", burst)
+		}
+	}
+	limiter = ratelimit.New(perMinute, n)
+	slog.Info("limiting clients", "requests_per_minute", perMinute)
+	return nil
+}
+
+// RateLimit answers the requests of clients over their rate limit with 429 Too Many Requests,
+// and a Retry-After header with the seconds until they may send another one.
+func RateLimit(c *fiber.Ctx) error {
+	if limiter == nil {
+		return c.Next()
+	}
+	if ok, retry := limiter.Allow(c.IP()); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		return apiError(c, fiber.StatusTooManyRequests, "too many requests, retry later")
+	}
+	return c.Next()
+}
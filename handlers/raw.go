@@ -1,21 +1,75 @@
 package handlers
 
 import (
-	"log"
+	"strings"
+
+	"ladder/pkg/ladder"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// mimeEventStream is the media type of Server-Sent Events, streamed as they arrive.
+const mimeEventStream = "text/event-stream"
+
+// rawQuery is the query parameter serving proxied sites like the raw route, eg: /https://www.example.com/?ladder_raw=1.
+const rawQuery = "ladder_raw"
+
+// Raw streams the upstream response of the URL unchanged: the request rules of the
+// site apply, but neither its response modifiers nor any body rewriting, eg: to debug
+// a rule or to download binaries through ladder.
 func Raw(c *fiber.Ctx) error {
 	// Get the url from the URL
-	urlQuery := c.Params("*")
+	urlQuery, err := extractUrl(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.SendString(err.Error())
+	}
+	preset, query := requestPreset(c)
+	delete(query, rawQuery)
 
-	queries := c.Queries()
-	body, _, _, err := fetchSite(urlQuery, queries)
+	trace := newRequestTrace(c)
+	defer trace.finish(c)
+	result, err := client.Fetch(c.Context(), urlQuery, ladder.FetchOptions{
+		Query:       query,
+		Format:      ladder.FormatRaw,
+		Tag:         c.Get(tagHeader),
+		Preset:      preset,
+		Trace:       trace.trace(),
+		Passthrough: trace.passthrough(),
+		Range:       c.Get("Range"),
+		IfRange:     c.Get("If-Range"),
+		// redirects stay raw
+		ProxyPrefix: "/raw/",
+	})
 	if err != nil {
-		log.Println("ERROR:", err)
-		c.SendStatus(500)
+		logger(c).Error("failed to fetch", "error", err)
+		c.SendStatus(errorStatuses.Status(err))
 		return c.SendString(err.Error())
 	}
-	return c.SendString(body)
+
+	c.Status(result.Response.StatusCode)
+	c.Set(fiber.HeaderContentType, result.Response.Header.Get("Content-Type"))
+	if location := result.Response.Header.Get("Location"); location != "" {
+		c.Set(fiber.HeaderLocation, location)
+	}
+	return sendBody(c, result)
+}
+
+// sendBody sends the body of result, streaming passthrough bodies along with their PassthroughHeaders.
+func sendBody(c *fiber.Ctx, result *ladder.Result) error {
+	if result.Body == nil {
+		return c.SendString(result.Content)
+	}
+	for _, header := range ladder.PassthroughHeaders {
+		if value := result.Response.Header.Get(header); value != "" {
+			c.Set(header, value)
+		}
+	}
+	if strings.HasPrefix(result.Response.Header.Get("Content-Type"), mimeEventStream) {
+		// reverse proxies in front of ladder must not buffer the events either
+		c.Set("X-Accel-Buffering", "no")
+	}
+	// fasthttp copies the stream to the connection and closes it once sent
+	c.Context().SetBodyStream(result.Body, int(result.Response.ContentLength))
+	return nil
 }
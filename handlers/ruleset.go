@@ -1,7 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/ruletest"
 
 	"github.com/gofiber/fiber/v2"
 	"gopkg.in/yaml.v3"
@@ -13,7 +22,7 @@ func Ruleset(c *fiber.Ctx) error {
 		return c.SendString("Rules Disabled")
 	}
 
-	body, err := yaml.Marshal(rulesSet)
+	body, err := yaml.Marshal(client.RuleSet())
 	if err != nil {
 		c.SendStatus(fiber.StatusInternalServerError)
 		return c.SendString(err.Error())
@@ -21,3 +30,50 @@ func Ruleset(c *fiber.Ctx) error {
 
 	return c.SendString(string(body))
 }
+
+// WatchRuleset reloads the ruleset at path, or else of RULESET, once its local files change,
+// keeping the previous rules if the new ones fail to load or are invalid, see ladder.ValidateRules.
+func WatchRuleset(path string) error {
+	path = rulesetPath(path)
+	if path == "" {
+		return errors.New("no ruleset to watch, set RULESET or --ruleset")
+	}
+	if _, err := ruleset.Watch(path, ladder.ValidateRules, client.SetRules); err != nil {
+		return err
+	}
+	slog.Info("watching ruleset", "path", path)
+	return nil
+}
+
+// RefreshRuleset reloads the ruleset at path, or else of RULESET, once its remote rulesets
+// changed, checking them every interval, eg: 1h, like WatchRuleset. Empty interval disables it.
+func RefreshRuleset(path, interval string) error {
+	if interval == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return fmt.Errorf("invalid ruleset refresh interval '%s': %w", interval, err)
+	}
+	path = rulesetPath(path)
+	if _, err := ruleset.Refresh(path, d, ladder.ValidateRules, client.SetRules); err != nil {
+		return err
+	}
+	slog.Info("refreshing remote rulesets", "interval", d)
+	return nil
+}
+
+// TestRuleset tests the rules of rs against their test URLs with the proxy client, configured
+// like the proxy is, see ruletest.Run.
+func TestRuleset(ctx context.Context, rs ruleset.RuleSet, domain string, concurrency int) []ruletest.Result {
+	client.SetRules(rs)
+	return ruletest.Run(ctx, client, rs, domain, concurrency)
+}
+
+// rulesetPath returns path, or else RULESET.
+func rulesetPath(path string) string {
+	if path == "" {
+		return os.Getenv("RULESET")
+	}
+	return path
+}
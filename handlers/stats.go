@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"os"
+	"time"
+
+	"ladder/pkg/stats"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultStatsWindow is the window of /api/v1/stats without window query parameter.
+const defaultStatsWindow = time.Hour
+
+func init() {
+	if os.Getenv("STATS") == "true" {
+		client.Stats = stats.NewRecorder()
+	}
+}
+
+// Stats returns the outcomes of the requests per domain within the window query
+// parameter, eg: 5m, 1h or 24h, least successful domains first.
+func Stats(c *fiber.Ctx) error {
+	if client.Stats == nil {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.SendString("Stats disabled")
+	}
+
+	window := defaultStatsWindow
+	if w := c.Query("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 || d > stats.Retention {
+			c.SendStatus(fiber.StatusBadRequest)
+			return c.SendString("window must be a duration up to " + stats.Retention.String())
+		}
+		window = d
+	}
+
+	return c.JSON(fiber.Map{
+		"window":  window.String(),
+		"domains": client.Stats.Snapshot(window),
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+
+	"ladder/pkg/templates"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// pages renders the landing page, error pages and the reader toolbar.
+// Templates in TEMPLATE_DIR override the embedded ones of the same name.
+var pages = loadTemplates(os.Getenv("TEMPLATE_DIR"))
+
+// bodyTag matches the opening body tag the reader toolbar is injected after.
+var bodyTag = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+func loadTemplates(dir string) *templates.Set {
+	defaults, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	set, err := templates.New(defaults, dir)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// errorPage renders the error page for a failed request of url.
+func errorPage(c *fiber.Ctx, status int, url string, err error) error {
+	page, renderErr := pages.RenderString("error.html", struct {
+		Status  int
+		URL     string
+		Message string
+	}{status, url, err.Error()})
+	if renderErr != nil {
+		slog.Error("unable to render error page", "error", renderErr)
+		c.SendStatus(status)
+		return c.SendString(err.Error())
+	}
+
+	c.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+	c.Status(status)
+	return c.SendString(page)
+}
+
+// injectToolbar inserts the reader toolbar for the page url titled title at the start of the body of page.
+func injectToolbar(page string, url string, title string) string {
+	toolbar, err := pages.RenderString("toolbar.html", struct {
+		URL   string
+		Title string
+	}{url, title})
+	if err != nil {
+		slog.Error("unable to render toolbar", "error", err)
+		return page
+	}
+
+	loc := bodyTag.FindStringIndex(page)
+	if loc == nil {
+		return toolbar + page
+	}
+	return page[:loc[1]] + toolbar + page[loc[1]:]
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"ladder/pkg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerProvider exports the spans of client.Tracer, when tracing is enabled.
+var tracerProvider *sdktrace.TracerProvider
+
+func init() {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return
+	}
+	config := tracing.Config{
+		Endpoint:    endpoint,
+		Headers:     map[string]string{},
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		SampleRatio: 1,
+	}
+	// headers are listed as key=value pairs, eg: x-honeycomb-team=abc123
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			config.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil && ratio >= 0 {
+		config.SampleRatio = ratio
+	}
+	provider, err := tracing.New(config)
+	if err != nil {
+		panic(err)
+	}
+	tracerProvider = provider
+	client.Tracer = provider.Tracer(tracing.Scope)
+	slog.Info("exporting traces", "endpoint", endpoint)
+}
+
+// Trace traces the requests served, continuing the trace of their traceparent header if any,
+// when tracing is enabled. The fetches of the handlers are traced within the span of the request.
+func Trace(c *fiber.Ctx) error {
+	if client.Tracer == nil {
+		return c.Next()
+	}
+	parent := tracing.Propagator.Extract(context.Background(), propagation.MapCarrier{
+		"traceparent": c.Get("Traceparent"),
+		"tracestate":  c.Get("Tracestate"),
+	})
+	_, span := client.Tracer.Start(parent, c.Method()+" "+c.Path(), trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	c.Context().SetUserValue(tracing.ContextKey, span)
+	// the trace isn't forwarded to the proxied sites
+	c.Request().Header.Del("Traceparent")
+	c.Request().Header.Del("Tracestate")
+
+	err := c.Next()
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	status := responseStatus(c, err)
+	span.SetAttributes(
+		attribute.String("http.request.method", c.Method()),
+		attribute.String("http.route", route),
+		attribute.String("url.path", c.Path()),
+		attribute.Int("http.response.status_code", status),
+	)
+	if err != nil {
+		tracing.RecordError(span, err)
+	} else if status >= fiber.StatusInternalServerError {
+		tracing.RecordError(span, fiber.NewError(status))
+	}
+	return err
+}
+
+// ShutdownTracing exports the spans not exported yet.
+func ShutdownTracing() {
+	if tracerProvider != nil {
+		tracerProvider.Shutdown(context.Background())
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiVersion is the current version of the API, served under /api/v1.
+const apiVersion = "1"
+
+// vendorVersion matches the version requested in the Accept header, eg: application/vnd.ladder.v1+json.
+var vendorVersion = regexp.MustCompile(`application/vnd\.ladder\.v(\d+)`)
+
+var (
+	// legacyDeprecation is the date the unversioned routes were deprecated, taken from
+	// LEGACY_API_DEPRECATION (YYYY-MM-DD), eg: the release of the instance that deprecated them.
+	legacyDeprecation = envDate("LEGACY_API_DEPRECATION")
+	// legacySunset is the date the unversioned routes will be removed, taken from LEGACY_API_SUNSET (YYYY-MM-DD).
+	legacySunset = envDate("LEGACY_API_SUNSET")
+)
+
+// envDate returns the date of the environment variable name, formatted as YYYY-MM-DD, if set.
+func envDate(name string) time.Time {
+	date, _ := time.Parse(time.DateOnly, os.Getenv(name))
+	return date
+}
+
+// requestedVersion returns the API version requested with the Api-Version
+// or Accept header, or an empty string if the request does not specify one.
+func requestedVersion(c *fiber.Ctx) string {
+	if v := c.Get("Api-Version"); v != "" {
+		return v
+	}
+	if m := vendorVersion.FindStringSubmatch(c.Get("Accept")); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// APIVersion negotiates the API version of requests to versioned routes.
+// Requests for another version than the current one are rejected.
+func APIVersion(c *fiber.Ctx) error {
+	if v := requestedVersion(c); v != "" && v != apiVersion {
+		c.Set("Api-Version", apiVersion)
+		c.SendStatus(fiber.StatusNotAcceptable)
+		return c.SendString("unsupported API version " + v + ", supported versions: " + apiVersion)
+	}
+
+	c.Set("Api-Version", apiVersion)
+	return c.Next()
+}
+
+// Deprecated marks responses of an unversioned route with the Deprecation and
+// Sunset headers, linking to its successor route: prefix followed by the rest of the
+// request URL, past the route. Without deprecation date, Deprecation is only true.
+func Deprecated(prefix string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if legacyDeprecation.IsZero() {
+			c.Set("Deprecation", "true")
+		} else {
+			c.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecation.Unix(), 10))
+		}
+		if !legacySunset.IsZero() {
+			c.Set("Sunset", legacySunset.Format(http.TimeFormat))
+		}
+		// the original URL keeps the trailing slash and query the wildcard parameter drops
+		rest := strings.TrimPrefix(c.OriginalURL(), strings.TrimSuffix(c.Route().Path, "*"))
+		c.Set("Link", "<"+prefix+rest+`>; rel="successor-version"`)
+		return APIVersion(c)
+	}
+}
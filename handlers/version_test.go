@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeprecated(t *testing.T) {
+	defer func(deprecation, sunset time.Time) { legacyDeprecation, legacySunset = deprecation, sunset }(legacyDeprecation, legacySunset)
+	legacyDeprecation, legacySunset = time.Time{}, time.Time{}
+
+	app := fiber.New()
+	app.Get("/api/*", Deprecated("/api/v1/fetch/"), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/https://example.com/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Deprecation"))
+	assert.Empty(t, resp.Header.Get("Sunset"))
+	assert.Equal(t, `</api/v1/fetch/https://example.com/>; rel="successor-version"`, resp.Header.Get("Link"))
+	assert.Equal(t, apiVersion, resp.Header.Get("Api-Version"))
+
+	legacyDeprecation = time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)
+	legacySunset = time.Date(2027, time.December, 31, 0, 0, 0, 0, time.UTC)
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/https://example.com/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "@1792022400", resp.Header.Get("Deprecation"))
+	assert.Equal(t, "Fri, 31 Dec 2027 00:00:00 GMT", resp.Header.Get("Sunset"))
+}
+
+func TestAPIVersion(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/v1/stats", APIVersion, func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		{"", "", http.StatusOK},
+		{"Api-Version", "1", http.StatusOK},
+		{"Accept", "application/vnd.ladder.v1+json", http.StatusOK},
+		{"Api-Version", "2", http.StatusNotAcceptable},
+		{"Accept", "application/vnd.ladder.v2+json", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, resp.StatusCode, tt.value)
+		assert.Equal(t, apiVersion, resp.Header.Get("Api-Version"))
+	}
+}
@@ -0,0 +1,109 @@
+// Package apikey authenticates the clients of ladder with API keys, so that a public
+// instance isn't an open proxy.
+package apikey
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Key is an API key, named after the client it was issued to.
+type Key struct {
+	// Name identifies the client in logs, eg: alice.
+	Name string `yaml:"name"`
+	// Key is the secret the client sends.
+	Key string `yaml:"key"`
+	// Disabled keys are rejected, eg: to revoke the access of a client while keeping its key listed.
+	Disabled bool `yaml:"disabled"`
+}
+
+// Keys are the API keys accepted by ladder.
+type Keys struct {
+	// digests maps the SHA-256 digests of the enabled keys to their name, so that keys are
+	// compared in constant time whatever their length.
+	digests map[[sha256.Size]byte]string
+}
+
+// New returns the Keys accepting the enabled keys of keys. Keys must be unique.
+func New(keys []Key) (*Keys, error) {
+	k := &Keys{digests: map[[sha256.Size]byte]string{}}
+	seen := map[string]bool{}
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("API key %d '%s' is empty", i+1, key.Name)
+		}
+		if seen[key.Key] {
+			return nil, fmt.Errorf("API key '%s' is listed twice", key.Name)
+		}
+		seen[key.Key] = true
+		if !key.Disabled {
+			k.digests[sha256.Sum256([]byte(key.Key))] = key.Name
+		}
+	}
+	return k, nil
+}
+
+// Parse parses a comma separated list of API keys, as name:key pairs or bare keys, named after
+// their position, eg: alice:3f9c2a,bob:77d1e0.
+func Parse(list string) []Key {
+	var keys []Key
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, key = "key"+strconv.Itoa(len(keys)+1), entry
+		}
+		keys = append(keys, Key{Name: name, Key: key})
+	}
+	return keys
+}
+
+// ReadFile reads the API keys listed as YAML in the file at path:
+//
+//   - name: alice
+//     key: 3f9c2a
+//   - name: bob
+//     key: 77d1e0
+//     disabled: true
+func ReadFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys '%s': %w", path, err)
+	}
+	var keys []Key
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys '%s': %w", path, err)
+	}
+	return keys, nil
+}
+
+// Check returns the name of the enabled key key, and whether it is one.
+func (k *Keys) Check(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	digest := sha256.Sum256([]byte(key))
+	var name string
+	found := 0
+	// every key is compared, so that the time taken doesn't tell which matched
+	for d, n := range k.digests {
+		if subtle.ConstantTimeCompare(d[:], digest[:]) == 1 {
+			name, found = n, 1
+		}
+	}
+	return name, found == 1
+}
+
+// Len returns the number of enabled keys.
+func (k *Keys) Len() int {
+	return len(k.digests)
+}
@@ -0,0 +1,44 @@
+package apikey
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- name: alice
+  key: 3f9c2a
+- name: bob
+  key: 77d1e0
+  disabled: true
+`), 0o600))
+	listed, err := ReadFile(path)
+	require.NoError(t, err)
+	keys, err := New(append(listed, Parse(" carol:5b8e41, 0c4d9f,")...))
+	require.NoError(t, err)
+	assert.Equal(t, 3, keys.Len())
+
+	for key, want := range map[string]string{"3f9c2a": "alice", "5b8e41": "carol", "0c4d9f": "key2"} {
+		name, ok := keys.Check(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want, name, key)
+	}
+	// disabled keys are rejected
+	for _, key := range []string{"77d1e0", "", "3f9c2"} {
+		_, ok := keys.Check(key)
+		assert.False(t, ok, key)
+	}
+
+	_, err = New([]Key{{Name: "alice", Key: "a"}, {Name: "bob", Key: "a"}})
+	assert.EqualError(t, err, "API key 'bob' is listed twice")
+	_, err = New([]Key{{Name: "alice"}})
+	assert.EqualError(t, err, "API key 1 'alice' is empty")
+	_, err = ReadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read API keys")
+}
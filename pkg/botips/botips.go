@@ -0,0 +1,181 @@
+// Package botips provides the IP address ranges that search engines publish for
+// their crawlers, so that ladder can send a X-Forwarded-For address origins verify
+// as Googlebot's or Bingbot's, picked at random from the current ranges on each
+// request rather than a single well-known address.
+//
+// The ranges are fetched from the official lists on first use, refreshed daily and
+// kept in memory. Until they are fetched, or when fetching fails, built-in ranges
+// are used instead. The social network crawlers, which have no published lists,
+// always use the built-in ranges of their networks.
+//
+//	addr := botips.Get("googlebot").Addr()
+package botips
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RefreshInterval is the age after which the ranges are fetched again.
+const RefreshInterval = 24 * time.Hour
+
+// Pool is the IPv4 address ranges of a crawler. It is safe for concurrent use.
+type Pool struct {
+	// Name of the crawler, eg: googlebot.
+	Name string
+	// URL of the published ranges, in the JSON format used by Google and Bing.
+	// The built-in ranges are used as is if empty.
+	URL string
+	// Client fetches the ranges, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu         sync.Mutex
+	prefixes   []netip.Prefix
+	fetched    time.Time
+	refreshing bool
+}
+
+// pools are the crawlers whose ranges are known, with the ranges used until they are fetched.
+var pools = map[string]*Pool{
+	"googlebot": {
+		Name:     "googlebot",
+		URL:      "https://developers.google.com/static/search/apis/ipranges/googlebot.json",
+		prefixes: mustParsePrefixes("66.249.64.0/27", "66.249.66.0/27", "66.249.68.0/27", "66.249.70.0/27", "66.249.72.0/27", "66.249.79.0/27"),
+	},
+	"bingbot": {
+		Name:     "bingbot",
+		URL:      "https://www.bing.com/toolbox/bingbot.json",
+		prefixes: mustParsePrefixes("40.77.167.0/24", "157.55.39.0/24", "207.46.13.0/24"),
+	},
+	"facebookbot": {
+		Name:     "facebookbot",
+		prefixes: mustParsePrefixes("31.13.24.0/21", "66.220.144.0/20", "69.63.176.0/20", "69.171.224.0/19", "173.252.64.0/18"),
+	},
+	"twitterbot": {
+		Name:     "twitterbot",
+		prefixes: mustParsePrefixes("199.16.156.0/22", "199.59.148.0/22"),
+	},
+	"linkedinbot": {
+		Name:     "linkedinbot",
+		prefixes: mustParsePrefixes("108.174.0.0/20"),
+	},
+}
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		parsed[i] = netip.MustParsePrefix(p)
+	}
+	return parsed
+}
+
+// Get returns the Pool of the crawler name, eg: googlebot, bingbot, facebookbot, twitterbot
+// or linkedinbot, or nil if it is unknown.
+func Get(name string) *Pool {
+	return pools[strings.ToLower(name)]
+}
+
+// Addr returns a random address of the ranges of the crawler. The ranges are refreshed
+// in the background when they are older than RefreshInterval.
+func (p *Pool) Addr() string {
+	p.mu.Lock()
+	prefixes := p.prefixes
+	if p.URL != "" && !p.refreshing && time.Since(p.fetched) > RefreshInterval {
+		p.refreshing = true
+		go p.refresh()
+	}
+	p.mu.Unlock()
+	return randomAddr(prefixes[rand.Intn(len(prefixes))]).String()
+}
+
+// Contains reports whether addr is in the ranges of the crawler.
+func (p *Pool) Contains(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh fetches the ranges. Failures are logged and retried after RefreshInterval,
+// keeping the current ranges meanwhile.
+func (p *Pool) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	prefixes, err := p.Fetch(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refreshing = false
+	p.fetched = time.Now()
+	if err != nil {
+		slog.Warn("failed to fetch IP ranges, using the previous ones", "crawler", p.Name, "error", err)
+		return
+	}
+	p.prefixes = prefixes
+}
+
+// Fetch fetches the IPv4 ranges published at the URL of the Pool.
+func (p *Pool) Fetch(ctx context.Context) ([]netip.Prefix, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", p.URL, resp.Status)
+	}
+
+	var ranges struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ranges); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", p.URL, err)
+	}
+	var prefixes []netip.Prefix
+	for _, r := range ranges.Prefixes {
+		if prefix, err := netip.ParsePrefix(r.IPv4Prefix); err == nil && prefix.Addr().Is4() {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("%s lists no IPv4 ranges", p.URL)
+	}
+	return prefixes, nil
+}
+
+// randomAddr returns a random address of prefix.
+func randomAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().As4()
+	host := 32 - prefix.Bits()
+	n := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	if host > 0 {
+		n |= rand.Uint32() & (1<<host - 1)
+	}
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
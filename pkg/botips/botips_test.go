@@ -0,0 +1,72 @@
+package botips
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	assert.Equal(t, "googlebot", Get("Googlebot").Name)
+	assert.Equal(t, "bingbot", Get("bingbot").Name)
+	assert.Nil(t, Get("66.249.66.1"))
+}
+
+func TestRandomAddr(t *testing.T) {
+	prefix := netip.MustParsePrefix("66.249.64.0/27")
+	for i := 0; i < 100; i++ {
+		assert.True(t, prefix.Contains(randomAddr(prefix)))
+	}
+	assert.Equal(t, "66.249.66.1", randomAddr(netip.MustParsePrefix("66.249.66.1/32")).String())
+}
+
+func TestPoolRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"creationTime": "2026-10-01T00:00:00", "prefixes": [
+			{"ipv6Prefix": "2001:4860:4801:10::/64"},
+			{"ipv4Prefix": "192.0.2.0/28"}
+		]}`))
+	}))
+	defer server.Close()
+
+	p := &Pool{Name: "testbot", URL: server.URL, prefixes: mustParsePrefixes("198.51.100.0/24")}
+	// the built-in ranges are used while the published ones are fetched
+	assert.True(t, p.Contains(p.Addr()))
+	assert.Eventually(t, func() bool { return p.Contains("192.0.2.1") }, time.Second, 10*time.Millisecond)
+	assert.False(t, p.Contains("198.51.100.1"))
+	for i := 0; i < 10; i++ {
+		assert.True(t, netip.MustParsePrefix("192.0.2.0/28").Contains(netip.MustParseAddr(p.Addr())))
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/ipv6":
+			w.Write([]byte(`{"prefixes": [{"ipv6Prefix": "2001:4860:4801:10::/64"}]}`))
+		default:
+			w.Write([]byte(`<html>`))
+		}
+	}))
+	defer server.Close()
+
+	for path, want := range map[string]string{"/missing": "404 Not Found", "/ipv6": "lists no IPv4 ranges", "/html": "failed to parse"} {
+		p := &Pool{URL: server.URL + path}
+		_, err := p.Fetch(context.Background())
+		assert.ErrorContains(t, err, want, path)
+	}
+
+	// failed refreshes keep the current ranges
+	p := &Pool{Name: "testbot", URL: server.URL + "/missing", prefixes: mustParsePrefixes("198.51.100.0/24")}
+	p.refresh()
+	require.True(t, p.Contains("198.51.100.1"))
+	assert.WithinDuration(t, time.Now(), p.fetched, time.Second)
+}
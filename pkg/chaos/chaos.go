@@ -0,0 +1,156 @@
+// Package chaos injects synthetic upstream failures into ladder requests, so that
+// the handling of timeouts, blocked requests, truncated bodies and bot challenges
+// can be exercised in staging without waiting for real sites to fail.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault is a kind of injected failure.
+type Fault string
+
+const (
+	// Timeout holds the request until its context is done or Delay elapses, then fails it.
+	Timeout Fault = "timeout"
+	// Forbidden answers 403 Forbidden without contacting the origin.
+	Forbidden Fault = "forbidden"
+	// Truncate cuts the upstream body in half and fails reading the rest. Streamed bodies,
+	// whose length is unknown, eg: server-sent events, are left as is.
+	Truncate Fault = "truncate"
+	// Challenge answers a bot challenge page without contacting the origin.
+	Challenge Fault = "challenge"
+)
+
+// Faults lists all faults.
+var Faults = []Fault{Timeout, Forbidden, Truncate, Challenge}
+
+// faultHeader marks injected responses with their fault.
+const faultHeader = "X-Ladder-Chaos"
+
+// challengePage imitates the interstitial of a bot protection service.
+const challengePage = `<!DOCTYPE html><html><head><title>Just a moment...</title></head>` +
+	`<body><div id="challenge-platform">Checking your browser before accessing the site.</div></body></html>`
+
+// ParseFaults parses a comma separated list of faults, eg: timeout,forbidden. Empty means all faults.
+func ParseFaults(spec string) ([]Fault, error) {
+	if strings.TrimSpace(spec) == "" {
+		return Faults, nil
+	}
+	var faults []Fault
+	for _, name := range strings.Split(spec, ",") {
+		fault := Fault(strings.TrimSpace(name))
+		if !isFault(fault) {
+			return nil, fmt.Errorf("unknown chaos fault '%s', must be one of timeout, forbidden, truncate, challenge", fault)
+		}
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
+
+func isFault(fault Fault) bool {
+	for _, f := range Faults {
+		if f == fault {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport is a http.RoundTripper failing a share of the requests sent through Next.
+type Transport struct {
+	// Next sends the requests that are not failed.
+	Next http.RoundTripper
+	// Rate is the share of requests failed, from 0 to 1.
+	Rate float64
+	// Faults are the faults picked from at random. Defaults to all faults.
+	Faults []Fault
+	// Delay bounds the Timeout fault. Defaults to 10 seconds.
+	Delay time.Duration
+	// Rand returns random numbers in [0, 1). Defaults to math/rand.
+	Rand func() float64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	random := t.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+	if random() >= t.Rate {
+		return t.Next.RoundTrip(req)
+	}
+
+	faults := t.Faults
+	if len(faults) == 0 {
+		faults = Faults
+	}
+	fault := faults[int(random()*float64(len(faults)))%len(faults)]
+
+	switch fault {
+	case Timeout:
+		delay := t.Delay
+		if delay <= 0 {
+			delay = 10 * time.Second
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+		case <-timer.C:
+		}
+		return nil, fmt.Errorf("chaos: injected timeout: %w", context.DeadlineExceeded)
+	case Forbidden:
+		return response(req, http.StatusForbidden, "text/plain; charset=utf-8", fault, "Forbidden"), nil
+	case Challenge:
+		resp := response(req, http.StatusServiceUnavailable, "text/html; charset=utf-8", fault, challengePage)
+		resp.Header.Set("Cf-Mitigated", "challenge")
+		return resp, nil
+	}
+
+	// Truncate
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil || resp.ContentLength < 0 {
+		return resp, err
+	}
+	resp.Header.Set(faultHeader, string(fault))
+	resp.Body = truncatedBody{
+		Reader: io.MultiReader(io.LimitReader(resp.Body, resp.ContentLength/2), failingReader{}),
+		Closer: resp.Body,
+	}
+	return resp, nil
+}
+
+// truncatedBody reads the first part of a body, closing the whole body.
+type truncatedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// response returns a synthetic response to req.
+func response(req *http.Request, status int, contentType string, fault Fault, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}, faultHeader: {string(fault)}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// failingReader fails like a connection closed in the middle of a body.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("chaos: injected truncation: %w", io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,111 @@
+package chaos
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixed returns a Rand function returning values in order.
+func fixed(values ...float64) func() float64 {
+	return func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			// a stream that never ends
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer upstream.Close()
+
+	getPath := func(t *testing.T, tr *Transport, path string) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+path, nil)
+		return tr.RoundTrip(req)
+	}
+	get := func(t *testing.T, tr *Transport) (*http.Response, error) {
+		return getPath(t, tr, "/")
+	}
+
+	t.Run("passed", func(t *testing.T) {
+		resp, err := get(t, &Transport{Next: http.DefaultTransport, Rate: 0.5, Rand: fixed(0.5)})
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "0123456789", string(body))
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		resp, err := get(t, &Transport{Next: http.DefaultTransport, Rate: 1, Faults: []Fault{Forbidden}})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "forbidden", resp.Header.Get(faultHeader))
+	})
+
+	t.Run("challenge", func(t *testing.T) {
+		resp, err := get(t, &Transport{Next: http.DefaultTransport, Rate: 0.1, Rand: fixed(0.05, 0.99)})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "challenge", resp.Header.Get("Cf-Mitigated"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(body), "Just a moment...")
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		resp, err := get(t, &Transport{Next: http.DefaultTransport, Rate: 1, Faults: []Fault{Truncate}})
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, "01234", string(body))
+	})
+
+	t.Run("truncate stream", func(t *testing.T) {
+		start := time.Now()
+		resp, err := getPath(t, &Transport{Next: http.DefaultTransport, Rate: 1, Faults: []Fault{Truncate}}, "/events")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Empty(t, resp.Header.Get(faultHeader))
+		line := make([]byte, 7)
+		_, err = io.ReadFull(resp.Body, line)
+		require.NoError(t, err)
+		assert.Equal(t, "data: 1", string(line))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := get(t, &Transport{Next: http.DefaultTransport, Rate: 1, Faults: []Fault{Timeout}, Delay: 50 * time.Millisecond})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults("")
+	require.NoError(t, err)
+	assert.Equal(t, Faults, faults)
+
+	faults, err = ParseFaults("timeout, challenge")
+	require.NoError(t, err)
+	assert.Equal(t, []Fault{Timeout, Challenge}, faults)
+
+	_, err = ParseFaults("timeout,explode")
+	assert.ErrorContains(t, err, "unknown chaos fault 'explode'")
+}
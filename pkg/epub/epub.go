@@ -0,0 +1,260 @@
+// Package epub converts the articles extracted by ladder into EPUB 3 books, with
+// their metadata, cover and images, so they can be read on e-readers.
+//
+//	result, _ := client.Fetch(ctx, url, ladder.FetchOptions{Format: ladder.FormatOutline})
+//	book := epub.Book{Outline: *result.Outline, Images: client.FetchImages(ctx, result.Outline.ImageURLs())}
+//	err := book.Write(w, time.Now())
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"ladder/pkg/ladder"
+)
+
+// MediaType is the media type of EPUB files.
+const MediaType = "application/epub+zip"
+
+// imageExtensions are the image types EPUB readers must support, with their file extension.
+var imageExtensions = map[string]string{
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+// Book is an article to convert into an EPUB.
+type Book struct {
+	// Outline is the content and metadata of the article.
+	Outline ladder.Outline
+	// Images holds the images of the article by their URL, along with the cover, see ladder.Outline.ImageURLs.
+	// Images missing from it or of types EPUB readers don't support are replaced with their alt text.
+	Images map[string]ladder.Image
+}
+
+// manifestItem is a file of a book listed in its package document.
+type manifestItem struct {
+	ID         string
+	Href       string
+	MediaType  string
+	Properties string
+}
+
+// Write writes the book as an EPUB to w. modified is the modification time required by EPUB.
+func (b Book) Write(w io.Writer, modified time.Time) error {
+	md := b.Outline.Metadata
+	title := md.Title
+	if title == "" {
+		title = b.Outline.URL
+	}
+
+	// images are named after their order, the cover first
+	files := map[string]string{}
+	cover := b.Outline.CoverURL()
+	var items []manifestItem
+	for i, src := range b.Outline.ImageURLs() {
+		image, ok := b.Images[src]
+		if _, supported := imageExtensions[image.MediaType]; !ok || !supported {
+			continue
+		}
+		item := manifestItem{
+			ID:        fmt.Sprintf("image-%d", i),
+			Href:      fmt.Sprintf("images/%d%s", i, imageExtensions[image.MediaType]),
+			MediaType: image.MediaType,
+		}
+		if src == cover {
+			item.ID, item.Properties = "cover-image", "cover-image"
+		}
+		files[src] = item.Href
+		items = append(items, item)
+	}
+
+	language := md.Language
+	if language == "" {
+		language = "und"
+	}
+	date, _, _ := strings.Cut(md.PublishedTime, "T")
+	blocks := b.Outline.Blocks
+	if len(blocks) > 0 && blocks[0].Type == ladder.BlockHeading && blocks[0].Level == 1 && blocks[0].Text == title {
+		blocks = blocks[1:]
+	}
+	data := struct {
+		Title, URL, Language, Author, Publisher, Date, Modified, Cover string
+		Items                                                          []manifestItem
+		Blocks                                                         []ladder.Block
+		Images                                                         map[string]string
+	}{
+		Title:     title,
+		URL:       b.Outline.URL,
+		Language:  language,
+		Author:    md.Author,
+		Publisher: md.SiteName,
+		Date:      date,
+		Modified:  modified.UTC().Format(time.RFC3339),
+		Cover:     files[cover],
+		Items:     items,
+		Blocks:    blocks,
+		Images:    files,
+	}
+
+	z := zip.NewWriter(w)
+	// the mimetype must come first and be stored uncompressed, so that readers can identify the file
+	mimetype, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, MediaType); err != nil {
+		return err
+	}
+
+	for _, file := range []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"META-INF/container.xml", containerTemplate},
+		{"OEBPS/content.opf", packageTemplate},
+		{"OEBPS/nav.xhtml", navTemplate},
+		{"OEBPS/article.xhtml", articleTemplate},
+	} {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if err := file.tmpl.Execute(f, data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", file.name, err)
+		}
+	}
+
+	for _, src := range b.Outline.ImageURLs() {
+		href, ok := files[src]
+		if !ok {
+			continue
+		}
+		// images are compressed already
+		f, err := z.CreateHeader(&zip.FileHeader{Name: path.Join("OEBPS", href), Method: zip.Store, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(b.Images[src].Data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// escape escapes s for XML text and attributes.
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+var funcs = template.FuncMap{
+	"x": escape,
+	"heading": func(level int) int {
+		return min(max(level, 1), 6)
+	},
+}
+
+var containerTemplate = template.Must(template.New("container").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var packageTemplate = template.Must(template.New("package").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id" xml:lang="{{x .Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">{{x .URL}}</dc:identifier>
+    <dc:title>{{x .Title}}</dc:title>
+    <dc:language>{{x .Language}}</dc:language>
+    <dc:source>{{x .URL}}</dc:source>
+{{- if .Author}}
+    <dc:creator>{{x .Author}}</dc:creator>
+{{- end}}
+{{- if .Publisher}}
+    <dc:publisher>{{x .Publisher}}</dc:publisher>
+{{- end}}
+{{- if .Date}}
+    <dc:date>{{x .Date}}</dc:date>
+{{- end}}
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+{{- if .Cover}}
+    <meta name="cover" content="cover-image"/>
+{{- end}}
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="article" href="article.xhtml" media-type="application/xhtml+xml"/>
+{{- range .Items}}
+    <item id="{{.ID}}" href="{{.Href}}" media-type="{{.MediaType}}"{{if .Properties}} properties="{{.Properties}}"{{end}}/>
+{{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="article"/>
+  </spine>
+</package>
+`))
+
+var navTemplate = template.Must(template.New("nav").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{x .Language}}">
+<head><title>{{x .Title}}</title></head>
+<body>
+  <nav epub:type="toc">
+    <ol>
+      <li><a href="article.xhtml">{{x .Title}}</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var articleTemplate = template.Must(template.New("article").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{x .Language}}">
+<head><title>{{x .Title}}</title></head>
+<body>
+  <h1>{{x .Title}}</h1>
+{{- if .Author}}
+  <p>{{x .Author}}</p>
+{{- end}}
+  <p><a href="{{x .URL}}">{{x .URL}}</a></p>
+{{- range .Blocks}}
+{{- if eq .Type "heading"}}
+  <h{{heading .Level}}>{{x .Text}}</h{{heading .Level}}>
+{{- else if eq .Type "paragraph"}}
+  <p>{{x .Text}}</p>
+{{- else if eq .Type "list"}}
+  <{{if .Ordered}}ol{{else}}ul{{end}}>
+{{- range .Items}}
+    <li>{{x .}}</li>
+{{- end}}
+  </{{if .Ordered}}ol{{else}}ul{{end}}>
+{{- else if eq .Type "quote"}}
+  <blockquote><p>{{x .Text}}</p></blockquote>
+{{- else if eq .Type "code"}}
+  <pre><code>{{x .Text}}</code></pre>
+{{- else if eq .Type "image"}}
+{{- $href := index $.Images .Src}}
+{{- if $href}}
+  <p><img src="{{x $href}}" alt="{{x .Text}}"/></p>
+{{- else if .Text}}
+  <p>[{{x .Text}}]</p>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,100 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+
+	"ladder/pkg/ladder"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// png is a 1x1 transparent PNG.
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestWrite(t *testing.T) {
+	book := Book{
+		Outline: ladder.Outline{
+			URL: "https://www.example.com/article?a=1&b=2",
+			Metadata: ladder.Metadata{
+				Title:         "Ladder & friends",
+				Author:        "Jane Doe",
+				SiteName:      "Example",
+				PublishedTime: "2024-01-02T15:04:05Z",
+				Language:      "en",
+				Image:         "/cover.png",
+			},
+			Blocks: []ladder.Block{
+				{Type: ladder.BlockHeading, Level: 1, Text: "Ladder & friends"},
+				{Type: ladder.BlockParagraph, Text: "a <b> c"},
+				{Type: ladder.BlockImage, Text: "Diagram", Src: "https://www.example.com/diagram.png"},
+				{Type: ladder.BlockImage, Text: "Missing", Src: "https://www.example.com/missing.png"},
+				{Type: ladder.BlockList, Items: []string{"one", "two"}, Ordered: true},
+				{Type: ladder.BlockCode, Text: "if a < b {}"},
+			},
+		},
+		Images: map[string]ladder.Image{
+			"https://www.example.com/cover.png":   {MediaType: "image/png", Data: png},
+			"https://www.example.com/diagram.png": {MediaType: "image/png", Data: png},
+			"https://www.example.com/missing.png": {MediaType: "image/x-icon", Data: png},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, book.Write(&buf, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)))
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	var names []string
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+		names = append(names, f.Name)
+
+		if f.Name == "mimetype" {
+			assert.Equal(t, zip.Store, f.Method)
+		} else if !bytes.HasPrefix(b, []byte("\x89PNG")) {
+			// every other document is well-formed XML
+			d := xml.NewDecoder(bytes.NewReader(b))
+			for {
+				_, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err, f.Name)
+			}
+		}
+	}
+
+	assert.Equal(t, []string{
+		"mimetype", "META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/article.xhtml",
+		"OEBPS/images/0.png", "OEBPS/images/1.png",
+	}, names)
+	assert.Equal(t, MediaType, files["mimetype"])
+
+	opf := files["OEBPS/content.opf"]
+	assert.Contains(t, opf, "<dc:title>Ladder &amp; friends</dc:title>")
+	assert.Contains(t, opf, "<dc:identifier id=\"id\">https://www.example.com/article?a=1&amp;b=2</dc:identifier>")
+	assert.Contains(t, opf, "<dc:creator>Jane Doe</dc:creator>")
+	assert.Contains(t, opf, "<dc:date>2024-01-02</dc:date>")
+	assert.Contains(t, opf, `<meta property="dcterms:modified">2024-01-03T00:00:00Z</meta>`)
+	assert.Contains(t, opf, `<item id="cover-image" href="images/0.png" media-type="image/png" properties="cover-image"/>`)
+	assert.Contains(t, opf, `<item id="image-1" href="images/1.png" media-type="image/png"/>`)
+
+	article := files["OEBPS/article.xhtml"]
+	assert.Equal(t, 1, bytes.Count([]byte(article), []byte("<h1>")))
+	assert.Contains(t, article, "<p>a &lt;b&gt; c</p>")
+	assert.Contains(t, article, `<img src="images/1.png" alt="Diagram"/>`)
+	assert.Contains(t, article, "<p>[Missing]</p>")
+	assert.Contains(t, article, "<li>two</li>")
+	assert.Contains(t, article, "<pre><code>if a &lt; b {}</code></pre>")
+}
@@ -0,0 +1,110 @@
+// Package events broadcasts structured debug events describing how ladder
+// processes a request, such as the rule matched, the modifiers applied and the
+// headers they changed, for real-time rule debugging.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by ladder.Client.
+const (
+	// TypeRule reports the rule matched by the requested URL.
+	TypeRule = "rule"
+	// TypeRequest reports the request about to be sent upstream.
+	TypeRequest = "request"
+	// TypeModifier reports a modifier applied, with its duration and error, if any.
+	TypeModifier = "modifier"
+	// TypeHeader reports a header set, changed or removed by a modifier or by the rule.
+	TypeHeader = "header"
+	// TypeResponse reports the upstream response.
+	TypeResponse = "response"
+	// TypeError reports a failed request.
+	TypeError = "error"
+)
+
+// bufferSize is the number of events buffered per subscriber. Events
+// published to a subscriber with a full buffer are dropped.
+const bufferSize = 256
+
+// Event is a single step of the processing of a request.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Tag identifies the request the event belongs to.
+	Tag     string            `json:"tag"`
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Bus broadcasts events to its subscribers. It is safe for concurrent use.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus returns a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]struct{}{}}
+}
+
+// Active reports whether the bus has subscribers, so publishers can skip building events nobody receives.
+func (b *Bus) Active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
+
+// Publish sends e to the subscribers of its tag. It never blocks.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if s.tag != "" && s.tag != e.Tag {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a Subscription to the events of the requests tagged tag,
+// or to the events of all requests if tag is empty.
+func (b *Bus) Subscribe(tag string) *Subscription {
+	s := &Subscription{bus: b, tag: tag, ch: make(chan Event, bufferSize)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Subscription receives the events published to a Bus until it is closed.
+type Subscription struct {
+	bus  *Bus
+	tag  string
+	ch   chan Event
+	once sync.Once
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unsubscribes s from its Bus.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		defer s.bus.mu.Unlock()
+		delete(s.bus.subs, s)
+		close(s.ch)
+	})
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	assert.False(t, bus.Active())
+
+	all := bus.Subscribe("")
+	tagged := bus.Subscribe("a")
+	assert.True(t, bus.Active())
+
+	bus.Publish(Event{Tag: "a", Type: TypeRule})
+	bus.Publish(Event{Tag: "b", Type: TypeRequest})
+
+	e := <-all.Events()
+	assert.Equal(t, TypeRule, e.Type)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, TypeRequest, (<-all.Events()).Type)
+	assert.Equal(t, TypeRule, (<-tagged.Events()).Type)
+	assert.Empty(t, tagged.Events())
+
+	all.Close()
+	all.Close()
+	_, ok := <-all.Events()
+	assert.False(t, ok)
+
+	tagged.Close()
+	assert.False(t, bus.Active())
+	bus.Publish(Event{Tag: "a"})
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	s := bus.Subscribe("")
+	defer s.Close()
+
+	for i := 0; i < bufferSize+10; i++ {
+		bus.Publish(Event{Type: TypeHeader})
+	}
+	assert.Len(t, s.Events(), bufferSize)
+}
@@ -0,0 +1,171 @@
+// Package graphql exposes the extraction pipeline of ladder as a GraphQL API,
+// so frontends can select exactly the article fields they need in one round trip.
+// The schema is defined in schema.graphql.
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ladder/pkg/ladder"
+
+	gql "github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var schema string
+
+var (
+	// MaxSaved is the number of extracted articles kept in memory per client for the
+	// savedArticles query.
+	MaxSaved = 100
+	// MaxFetches is the number of pages a request may fetch, eg: with aliases of article.
+	MaxFetches = 10
+)
+
+type (
+	ownerKey  struct{}
+	budgetKey struct{}
+)
+
+// WithOwner returns ctx for the requests of the client owner, eg: the name of its API key.
+// savedArticles only lists the articles extracted by the requests of the same client, and
+// requests without owner keep none.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// Request is a GraphQL request, as sent in the body of a POST request
+// or in the query string of a GET request.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Schema executes GraphQL requests against a ladder.Client.
+type Schema struct {
+	schema *gql.Schema
+}
+
+// NewSchema returns a Schema fetching articles with client.
+func NewSchema(client *ladder.Client) *Schema {
+	r := &resolver{client: client}
+	return &Schema{
+		schema: gql.MustParseSchema(schema, r, gql.UseFieldResolvers(), gql.MaxDepth(8)),
+	}
+}
+
+// Exec executes req and returns the JSON encoded response, including query errors.
+func (s *Schema) Exec(ctx context.Context, req Request) ([]byte, error) {
+	budget := &atomic.Int32{}
+	budget.Store(int32(MaxFetches))
+	ctx = context.WithValue(ctx, budgetKey{}, budget)
+	return json.Marshal(s.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// resolver resolves the Query type.
+type resolver struct {
+	client *ladder.Client
+
+	mu sync.Mutex
+	// saved are the articles extracted most recently, by owner, see WithOwner.
+	saved map[string][]*article
+}
+
+// fetch fetches rawURL as format, if the request of ctx didn't fetch MaxFetches pages yet.
+func (r *resolver) fetch(ctx context.Context, rawURL string, format ladder.Format) (*ladder.Result, error) {
+	if budget, ok := ctx.Value(budgetKey{}).(*atomic.Int32); ok && budget.Add(-1) < 0 {
+		return nil, fmt.Errorf("the query fetches more than %d pages", MaxFetches)
+	}
+	return r.client.Fetch(ctx, rawURL, ladder.FetchOptions{Format: format})
+}
+
+func (r *resolver) Article(ctx context.Context, args struct{ URL string }) (*article, error) {
+	result, err := r.fetch(ctx, args.URL, ladder.FormatOutline)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &article{
+		URL:       result.Outline.URL,
+		Metadata:  result.Outline.Metadata,
+		Blocks:    make([]block, 0, len(result.Outline.Blocks)),
+		FetchedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, b := range result.Outline.Blocks {
+		a.Blocks = append(a.Blocks, block{b})
+	}
+
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	if owner == "" {
+		return a, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		r.saved = map[string][]*article{}
+	}
+	saved := append([]*article{a}, r.saved[owner]...)
+	r.saved[owner] = saved[:min(len(saved), MaxSaved)]
+	return a, nil
+}
+
+func (r *resolver) Metadata(ctx context.Context, args struct{ URL string }) (ladder.Metadata, error) {
+	result, err := r.fetch(ctx, args.URL, ladder.FormatRaw)
+	if err != nil {
+		return ladder.Metadata{}, err
+	}
+	return result.Metadata, nil
+}
+
+func (r *resolver) SavedArticles(ctx context.Context, args struct{ Limit int32 }) []*article {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := r.saved[owner]
+	n := min(max(int(args.Limit), 0), len(saved))
+	return append([]*article{}, saved[:n]...)
+}
+
+// article resolves the Article type.
+type article struct {
+	URL       string
+	Metadata  ladder.Metadata
+	Blocks    []block
+	FetchedAt string
+}
+
+func (a *article) Text() string {
+	parts := make([]string, 0, len(a.Blocks))
+	for _, b := range a.Blocks {
+		switch {
+		case b.Block.Type == ladder.BlockList:
+			parts = append(parts, strings.Join(b.Block.Items, "\n"))
+		case b.Block.Type != ladder.BlockImage:
+			parts = append(parts, b.Block.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// block resolves the Block type.
+type block struct {
+	ladder.Block
+}
+
+func (b block) Type() string { return string(b.Block.Type) }
+func (b block) Level() int32 { return int32(b.Block.Level) }
+func (b block) Items() []string {
+	if b.Block.Items == nil {
+		return []string{}
+	}
+	return b.Block.Items
+}
@@ -0,0 +1,95 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ladder/pkg/ladder"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<html lang="en"><head><title>Title</title><meta name="author" content="Jane"></head>
+<body><nav>Menu</nav><article><h1>Heading</h1><p>First paragraph.</p><ul><li>One</li><li>Two</li></ul></article></body></html>`
+
+func TestSchema(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, page)
+	}))
+	defer upstream.Close()
+
+	s := NewSchema(ladder.NewClient(nil))
+	ctx := WithOwner(context.Background(), "alice")
+
+	t.Run("metadata", func(t *testing.T) {
+		resp, err := s.Exec(ctx, Request{
+			Query:     `query($url: String!) { metadata(url: $url) { title author } }`,
+			Variables: map[string]any{"url": upstream.URL},
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"data":{"metadata":{"title":"Title","author":"Jane"}}}`, string(resp))
+	})
+
+	t.Run("article", func(t *testing.T) {
+		resp, err := s.Exec(ctx, Request{
+			Query: `{ article(url: "` + upstream.URL + `") { metadata { language } text blocks { type level items } } }`,
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"data":{"article":{
+			"metadata":{"language":"en"},
+			"text":"Heading\n\nFirst paragraph.\n\nOne\nTwo",
+			"blocks":[
+				{"type":"heading","level":1,"items":[]},
+				{"type":"paragraph","level":0,"items":[]},
+				{"type":"list","level":0,"items":["One","Two"]}
+			]
+		}}}`, string(resp))
+	})
+
+	t.Run("saved articles", func(t *testing.T) {
+		resp, err := s.Exec(ctx, Request{Query: `{ savedArticles { url metadata { title } } }`})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"data":{"savedArticles":[{"url":"`+upstream.URL+`/","metadata":{"title":"Title"}}]}}`, string(resp))
+
+		resp, err = s.Exec(ctx, Request{Query: `{ savedArticles(limit: 0) { url } }`})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"data":{"savedArticles":[]}}`, string(resp))
+
+		// the articles of a client aren't listed to others
+		for _, other := range []context.Context{WithOwner(context.Background(), "bob"), context.Background()} {
+			resp, err = s.Exec(other, Request{Query: `{ savedArticles { url } }`})
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"data":{"savedArticles":[]}}`, string(resp))
+		}
+	})
+
+	t.Run("fetch limit", func(t *testing.T) {
+		defer func(n int) { MaxFetches = n }(MaxFetches)
+		MaxFetches = 2
+		query := `{ a: metadata(url: "` + upstream.URL + `") { title } b: metadata(url: "` + upstream.URL + `") { title } }`
+		resp, err := s.Exec(ctx, Request{Query: query})
+		require.NoError(t, err)
+		assert.NotContains(t, string(resp), `"errors"`)
+
+		// aliases don't fetch a page more than MaxFetches times
+		query = `{ a: metadata(url: "` + upstream.URL + `") { title } b: metadata(url: "` + upstream.URL + `") { title } c: article(url: "` + upstream.URL + `") { text } }`
+		resp, err = s.Exec(ctx, Request{Query: query})
+		require.NoError(t, err)
+		assert.Contains(t, string(resp), "the query fetches more than 2 pages")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		resp, err := s.Exec(ctx, Request{Query: `{ article(url: "http://127.0.0.1:1") { text } }`})
+		require.NoError(t, err)
+		assert.Contains(t, string(resp), `"errors"`)
+
+		resp, err = s.Exec(ctx, Request{Query: `{ unknown }`})
+		require.NoError(t, err)
+		assert.Contains(t, string(resp), `Cannot query field \"unknown\"`)
+	})
+}
@@ -0,0 +1,195 @@
+// Package headless renders pages in a headless Chrome or Chromium, for sites that assemble
+// their content with JavaScript, and returns their DOM once rendered as a HTML response.
+//
+// It drives, with chromedp, a browser it launches on first use, or a running one, eg: in a
+// browserless container. Each page is rendered in a new browser context, isolating its cookies
+// and storage from the others, and sending its requests through a proxy connecting with Dial.
+//
+//	b := headless.New("chromium")
+//	defer b.Close()
+//	client := &http.Client{Transport: &headless.Transport{Browser: b, Next: http.DefaultTransport}}
+package headless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// DefaultMaxWait bounds the time a page is waited for once navigated to.
+const DefaultMaxWait = 30 * time.Second
+
+// DefaultIdle is the time without network requests after which pages are deemed rendered,
+// when neither a selector nor an idle time is waited for.
+const DefaultIdle = 500 * time.Millisecond
+
+// launchTimeout bounds the time the browser takes to start.
+const launchTimeout = 20 * time.Second
+
+// executables are the names of the browsers looked up in PATH, in order, when none is given.
+var executables = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless-shell"}
+
+// Browser is a headless browser, launched on first use. It is safe for concurrent use.
+type Browser struct {
+	// Exec is the path or name of the browser executable, or the DevTools endpoint of a running
+	// browser, as a ws:// URL or the http:// URL of its /json/version. If empty, the first of
+	// chromium, chromium-browser, google-chrome, google-chrome-stable, chrome or headless-shell
+	// found in PATH is launched.
+	Exec string
+	// Flags are added to the command line of the browser launched.
+	Flags []string
+	// MaxWait bounds the time a page is waited for once navigated to. Defaults to DefaultMaxWait.
+	MaxWait time.Duration
+	// Dial, if set, makes the connections of the pages rendered, which are sent through a proxy
+	// rather than made by the browser, eg: so that the addresses they connect to are those
+	// checked against private networks, rather than resolved again by the browser.
+	Dial DialFunc
+	// ProxyListen is the address the proxy of Dial listens on. Defaults to 127.0.0.1:0, a
+	// random port of the loopback interface, which a browser running elsewhere can't reach.
+	ProxyListen string
+	// ProxyURL is the URL of the proxy of Dial the browser connects to, eg: http://ladder:9223
+	// for a browser in another container. Defaults to the address ProxyListen listens on.
+	ProxyURL string
+
+	mu      sync.Mutex
+	browser context.Context
+	cancel  context.CancelFunc
+	proxy   *proxy
+}
+
+// New returns the Browser launched with, or connecting to, exec. See Browser.Exec.
+func New(exec string) *Browser {
+	return &Browser{Exec: exec, MaxWait: DefaultMaxWait}
+}
+
+// remote reports whether b connects to a running browser rather than launching one.
+func (b *Browser) remote() bool {
+	return strings.HasPrefix(b.Exec, "ws://") || strings.HasPrefix(b.Exec, "wss://") ||
+		strings.HasPrefix(b.Exec, "http://") || strings.HasPrefix(b.Exec, "https://")
+}
+
+// start returns the context of the browser, launching or connecting to it if needed, and the
+// URL of the proxy its pages connect through, if any.
+func (b *Browser) start(ctx context.Context) (context.Context, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Dial != nil && b.proxy == nil {
+		listen := b.ProxyListen
+		if listen == "" {
+			listen = "127.0.0.1:0"
+		}
+		p, err := startProxy(listen, b.Dial)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to start the proxy of the browser: %w", err)
+		}
+		b.proxy = p
+	}
+	proxyURL := ""
+	if b.proxy != nil {
+		proxyURL = b.ProxyURL
+		if proxyURL == "" {
+			proxyURL = "http://" + b.proxy.Addr()
+		}
+	}
+	// the browser exited, or the connection to it was lost
+	if b.browser != nil && b.browser.Err() == nil {
+		return b.browser, proxyURL, nil
+	}
+	if b.cancel != nil {
+		b.cancel()
+	}
+
+	var allocator context.Context
+	var cancelAllocator context.CancelFunc
+	if b.remote() {
+		allocator, cancelAllocator = chromedp.NewRemoteAllocator(context.Background(), b.Exec)
+	} else {
+		path, err := b.execPath()
+		if err != nil {
+			return nil, "", err
+		}
+		opts := append(chromedp.DefaultExecAllocatorOptions[:],
+			chromedp.ExecPath(path),
+			chromedp.Flag("headless", "new"),
+			chromedp.Flag("mute-audio", true),
+			chromedp.Flag("hide-scrollbars", true),
+			// WebRTC would otherwise connect over UDP, around the proxy
+			chromedp.Flag("force-webrtc-ip-handling-policy", "disable_non_proxied_udp"),
+		)
+		if os.Geteuid() == 0 {
+			// the sandbox of Chrome refuses to run as root, as in most containers
+			opts = append(opts, chromedp.NoSandbox)
+		}
+		for _, flag := range b.Flags {
+			name, value, found := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+			if found {
+				opts = append(opts, chromedp.Flag(name, value))
+			} else {
+				opts = append(opts, chromedp.Flag(name, true))
+			}
+		}
+		allocator, cancelAllocator = chromedp.NewExecAllocator(context.Background(), opts...)
+	}
+	browser, cancelBrowser := chromedp.NewContext(allocator)
+	cancel := func() {
+		cancelBrowser()
+		cancelAllocator()
+	}
+
+	// the browser is launched, or connected to, by running a first action
+	started := make(chan error, 1)
+	go func() { started <- chromedp.Run(browser) }()
+	var err error
+	select {
+	case err = <-started:
+	case <-time.After(launchTimeout):
+		err = errors.New("the browser didn't start its DevTools endpoint")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		if b.remote() {
+			return nil, "", fmt.Errorf("failed to connect to the browser at %s: %w", b.Exec, err)
+		}
+		return nil, "", fmt.Errorf("failed to launch the browser: %w", err)
+	}
+	b.browser, b.cancel = browser, cancel
+	return browser, proxyURL, nil
+}
+
+// execPath returns the path of the browser to launch.
+func (b *Browser) execPath() (string, error) {
+	if b.Exec != "" {
+		return b.Exec, nil
+	}
+	for _, name := range executables {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no browser found in PATH, looked for %s", strings.Join(executables, ", "))
+}
+
+// Close stops the browser if b launched it, or disconnects from it, and stops the proxy of Dial.
+// The browser is launched again on next use.
+func (b *Browser) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.browser, b.cancel = nil, nil
+	if b.proxy != nil {
+		b.proxy.Close()
+		b.proxy = nil
+	}
+	return nil
+}
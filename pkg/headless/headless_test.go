@@ -0,0 +1,202 @@
+package headless
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDial dials like net.Dialer, counting the connections, unless addr is blocked.
+func countingDial(dials *atomic.Int32, blocked string) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == blocked {
+			return nil, fmt.Errorf("%s is blocked", addr)
+		}
+		dials.Add(1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get("X-Forwarded-For"))
+	}))
+	defer upstream.Close()
+	var dials atomic.Int32
+	p, err := startProxy("127.0.0.1:0", countingDial(&dials, "127.0.0.1:1"))
+	require.NoError(t, err)
+	defer p.Close()
+	proxyURL, _ := url.Parse("http://" + p.Addr())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL+"/page", nil)
+	req.Header.Set("X-Forwarded-For", "66.249.66.1")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "/page 66.249.66.1", string(body))
+	assert.Empty(t, resp.Header.Get("X-Hop"))
+	assert.EqualValues(t, 1, dials.Load())
+
+	// the connections dial refuses fail
+	resp, err = client.Get("http://127.0.0.1:1/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// requests to the proxy itself aren't forwarded
+	resp, err = http.Get(proxyURL.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestProxyTunnel(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tunneled")
+	}))
+	defer upstream.Close()
+	var dials atomic.Int32
+	p, err := startProxy("127.0.0.1:0", countingDial(&dials, "127.0.0.1:1"))
+	require.NoError(t, err)
+	defer p.Close()
+	proxyURL, _ := url.Parse("http://" + p.Addr())
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	resp, err := (&http.Client{Transport: transport}).Get(upstream.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "tunneled", string(body))
+	assert.EqualValues(t, 1, dials.Load())
+
+	// tunnels dial refuses are forbidden
+	conn, err := net.Dial("tcp", p.Addr())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "CONNECT 127.0.0.1:1 HTTP/1.1\r\nHost: 127.0.0.1:1\r\n\r\n")
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// browser returns a Browser launching the browser found in PATH, skipping the test if there is none.
+func browser(t *testing.T) *Browser {
+	b := New("")
+	if _, err := b.execPath(); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestRender(t *testing.T) {
+	b := browser(t)
+	var dials atomic.Int32
+	b.Dial = countingDial(&dials, "")
+	var requests atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			requests.Store(r.Header.Clone())
+			w.Header().Set("Set-Cookie", "a=1")
+			io.WriteString(w, `<!DOCTYPE html><html><body><img src="/blocked.png"><script>
+				setTimeout(() => document.body.append(document.createElement("article")), 100)
+			</script></body></html>`)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	var blocked atomic.Value
+	rt := &Transport{
+		Browser: b,
+		Wait:    Wait{Selector: "article", Idle: time.Millisecond},
+		Allow: func(_ context.Context, u *url.URL) error {
+			if strings.HasSuffix(u.Path, ".png") {
+				blocked.Store(u.String())
+				return errors.New("private network")
+			}
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/page", nil)
+	req.Header.Set("User-Agent", "ladder")
+	req.Header.Set("X-Forwarded-For", "66.249.66.1")
+	req.Header.Set("Cookie", "session=1")
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "<article></article>")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "a=1", resp.Header.Get("Set-Cookie"))
+	assert.Equal(t, server.URL+"/blocked.png", blocked.Load())
+
+	// the page was requested with the headers of req, through Dial
+	header := requests.Load().(http.Header)
+	assert.Equal(t, "ladder", header.Get("User-Agent"))
+	assert.Equal(t, "66.249.66.1", header.Get("X-Forwarded-For"))
+	assert.Contains(t, header.Get("Cookie"), "session=1")
+	assert.Positive(t, dials.Load())
+}
+
+func TestTransportNotHTML(t *testing.T) {
+	next := &fakeTransport{}
+	rt := &Transport{Browser: New(""), Next: next}
+
+	// requests other than GET are never rendered
+	req, _ := http.NewRequest(http.MethodHead, "https://www.example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, 1, next.calls)
+}
+
+func TestRenderNotHTML(t *testing.T) {
+	b := browser(t)
+	b.Dial = countingDial(new(atomic.Int32), "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	}))
+	defer server.Close()
+	next := &fakeTransport{}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/image.png", nil)
+	resp, err := (&Transport{Browser: b, Next: next}).RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, 1, next.calls)
+
+	_, err = (&Transport{Browser: b}).RoundTrip(req.Clone(req.Context()))
+	assert.ErrorIs(t, err, ErrNotHTML)
+}
+
+type fakeTransport struct {
+	calls int
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody, Request: req}, nil
+}
@@ -0,0 +1,155 @@
+package headless
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DialFunc connects to addr, eg: the dialer of ladder checking the addresses it resolves.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// proxy is the HTTP proxy the browser contexts send their requests through, so that their
+// connections are made by Dial, which checks the address it connects to rather than the
+// browser resolving hosts anew after they were checked.
+type proxy struct {
+	dial      DialFunc
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+}
+
+// hopHeaders are the headers of a single connection, which aren't forwarded.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// startProxy starts a proxy listening on addr, connecting with dial.
+func startProxy(addr string, dial DialFunc) (*proxy, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &proxy{dial: dial, listener: listener}
+	p.transport = &http.Transport{
+		DialContext:         dial,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// ServeHTTP tunnels CONNECT requests, eg: of HTTPS pages and WebSockets, and forwards the
+// other requests, which hold absolute URLs.
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		if r.URL.Host == "" {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		p.forwardRequest(w, r)
+		return
+	}
+
+	upstream, err := p.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		slog.Debug("browser request failed", "host", r.Host, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	// either side closing ends the tunnel
+	copyConn := func(dst net.Conn, src io.Reader) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		dst.Close()
+	}
+	go copyConn(upstream, buffered)
+	go copyConn(conn, upstream)
+	wg.Wait()
+}
+
+// forwardRequest sends r to its destination and copies the response back. Unlike
+// httputil.ReverseProxy, it leaves X-Forwarded-For as the browser sent it.
+func (p *proxy) forwardRequest(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		slog.Debug("browser request failed", "url", r.URL.String(), "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	// streamed responses, eg: event streams, are passed on as they arrive
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// removeHopHeaders removes the hop-by-hop headers of header, including those listed in Connection.
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, key := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(key))
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// Close stops the proxy. The tunnels in use are left to the browser to close, along with its pages.
+func (p *proxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
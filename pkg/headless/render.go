@@ -0,0 +1,345 @@
+package headless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// ErrNotHTML is returned when the URL rendered is not a HTML document, eg: an image or a PDF.
+var ErrNotHTML = errors.New("not a HTML document")
+
+// pollInterval is the interval at which the selectors and the network activity are checked.
+const pollInterval = 50 * time.Millisecond
+
+// Wait configures when a page is deemed rendered, once loaded. The zero Wait waits for
+// DefaultIdle without network requests.
+type Wait struct {
+	// Selector waits for an element matching this CSS selector, eg: article .content.
+	// Rendering fails if none appears within Browser.MaxWait.
+	Selector string
+	// Idle waits for the page to send no network request for this long, eg: 500ms.
+	// The page is returned as it is after Browser.MaxWait if it never gets idle.
+	Idle time.Duration
+}
+
+// Page is a page rendered by the browser.
+type Page struct {
+	// URL is the URL of the document, after redirects.
+	URL string
+	// StatusCode and Header are those of the response of the document.
+	StatusCode int
+	Header     http.Header
+	// HTML is the serialized DOM of the document once rendered.
+	HTML string
+}
+
+// pageState tracks the events of the page being rendered.
+type pageState struct {
+	loaded   chan struct{}
+	mu       sync.Mutex
+	frameID  cdp.FrameID
+	inflight map[network.RequestID]bool
+	activity time.Time
+	document *network.Response
+}
+
+// skippedHeaders are the request headers the browser sets itself, or that Render passes otherwise.
+var skippedHeaders = map[string]bool{
+	"User-Agent": true, "Cookie": true, "Referer": true, "Accept": true, "Accept-Encoding": true,
+	"Connection": true, "Host": true, "Range": true, "Upgrade-Insecure-Requests": true,
+}
+
+// Render navigates to the URL of req with its User-Agent, cookies, Referer and other headers,
+// and returns the page once rendered according to wait. allow, if set, checks the URLs the page
+// requests, including those it redirects to, failing those it rejects.
+func (b *Browser) Render(ctx context.Context, req *http.Request, wait Wait, allow func(context.Context, *url.URL) error) (*Page, error) {
+	browser, proxyURL, err := b.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// each page gets a browser context of its own, disposed of along with the page
+	tab, cancel := chromedp.NewContext(browser, chromedp.WithNewBrowserContext(func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+		if proxyURL != "" {
+			// loopback addresses go through the proxy too, rather than being reached directly
+			p = p.WithProxyServer(proxyURL).WithProxyBypassList("<-loopback>")
+		}
+		return p
+	}))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	state := &pageState{loaded: make(chan struct{}), inflight: map[network.RequestID]bool{}, activity: time.Now()}
+	chromedp.ListenTarget(tab, func(ev any) { state.event(tab, ev, allow) })
+
+	actions := []chromedp.Action{network.Enable()}
+	if allow != nil {
+		actions = append(actions, fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*"}}))
+	}
+	if ua := req.Header.Get("User-Agent"); ua != "" {
+		override := emulation.SetUserAgentOverride(ua)
+		if lang := req.Header.Get("Accept-Language"); lang != "" {
+			override = override.WithAcceptLanguage(lang)
+		}
+		actions = append(actions, override)
+	}
+	headers := network.Headers{}
+	for key, values := range req.Header {
+		if !skippedHeaders[key] && !strings.HasPrefix(key, "Sec-") {
+			headers[key] = strings.Join(values, ", ")
+		}
+	}
+	if len(headers) > 0 {
+		actions = append(actions, network.SetExtraHTTPHeaders(headers))
+	}
+	// cookies are set for the site only, rather than sent along with every request as headers
+	if cookies := req.Cookies(); len(cookies) > 0 {
+		params := make([]*network.CookieParam, 0, len(cookies))
+		for _, cookie := range cookies {
+			params = append(params, &network.CookieParam{Name: cookie.Name, Value: cookie.Value, URL: req.URL.String()})
+		}
+		actions = append(actions, network.SetCookies(params))
+	}
+	if err := chromedp.Run(tab, actions...); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	state.mu.Lock()
+	// the main frame of a page has the ID of its target
+	state.frameID = cdp.FrameID(chromedp.FromContext(tab).Target.TargetID)
+	state.mu.Unlock()
+
+	var errorText string
+	err = chromedp.Run(tab, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		_, _, errorText, err = page.Navigate(req.URL.String()).WithReferrer(req.Referer()).Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	if errorText != "" {
+		if doc := state.documentResponse(); doc != nil && !isHTML(doc.MimeType) {
+			return nil, ErrNotHTML
+		}
+		return nil, fmt.Errorf("failed to load %s: %s", req.URL, errorText)
+	}
+
+	maxWait := b.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	deadline := time.NewTimer(maxWait)
+	defer deadline.Stop()
+	select {
+	case <-state.loaded:
+	case <-deadline.C:
+		// pages waiting on hanging resources are rendered anyway
+	case <-tab.Done():
+		return nil, contextError(ctx, tab.Err())
+	}
+	if doc := state.documentResponse(); doc != nil && !isHTML(doc.MimeType) {
+		return nil, ErrNotHTML
+	}
+	if err := state.wait(tab, wait, deadline.C); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	var document struct {
+		URL  string `json:"url"`
+		HTML string `json:"html"`
+	}
+	err = chromedp.Run(tab, chromedp.Evaluate(
+		`({url: document.URL, html: (document.doctype ? new XMLSerializer().serializeToString(document.doctype) + "\n" : "") + document.documentElement.outerHTML})`,
+		&document,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the DOM of %s: %w", req.URL, contextError(ctx, err))
+	}
+
+	page := &Page{URL: document.URL, StatusCode: http.StatusOK, Header: http.Header{}, HTML: document.HTML}
+	if doc := state.documentResponse(); doc != nil {
+		if doc.Status > 0 {
+			page.StatusCode = int(doc.Status)
+		}
+		for key, value := range doc.Headers {
+			for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+				page.Header.Add(key, v)
+			}
+		}
+	}
+	return page, nil
+}
+
+// contextError returns the error of ctx, the context of the request, if it is done, rather
+// than err, the error of the browser it cancelled.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// wait waits for the page of tab to be rendered according to wait, or for deadline.
+func (s *pageState) wait(tab context.Context, wait Wait, deadline <-chan time.Time) error {
+	idle := wait.Idle
+	if idle <= 0 && wait.Selector == "" {
+		idle = DefaultIdle
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	found := wait.Selector == ""
+	selector, _ := json.Marshal(wait.Selector)
+	for {
+		if !found {
+			if err := chromedp.Run(tab, chromedp.Evaluate("document.querySelector("+string(selector)+") !== null", &found)); err != nil {
+				return err
+			}
+		}
+		if found && (idle <= 0 || s.idleFor(idle)) {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			if !found {
+				return fmt.Errorf("timed out waiting for '%s'", wait.Selector)
+			}
+			// pages that never get idle, eg: polling, are rendered anyway
+			return nil
+		case <-tab.Done():
+			return tab.Err()
+		}
+	}
+}
+
+// idleFor reports whether the page sent no request for d.
+func (s *pageState) idleFor(d time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.inflight) == 0 && time.Since(s.activity) >= d
+}
+
+func (s *pageState) documentResponse() *network.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.document
+}
+
+// event tracks the load, network activity and document response of the page of tab, and
+// checks the URLs it requests with allow.
+func (s *pageState) event(tab context.Context, ev any, allow func(context.Context, *url.URL) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch ev := ev.(type) {
+	case *page.EventLoadEventFired:
+		select {
+		case <-s.loaded:
+		default:
+			close(s.loaded)
+		}
+	case *network.EventRequestWillBeSent:
+		s.inflight[ev.RequestID] = true
+		s.activity = time.Now()
+	case *network.EventLoadingFinished:
+		delete(s.inflight, ev.RequestID)
+		s.activity = time.Now()
+	case *network.EventLoadingFailed:
+		delete(s.inflight, ev.RequestID)
+		s.activity = time.Now()
+	case *network.EventResponseReceived:
+		if ev.Type == network.ResourceTypeDocument && ev.FrameID == s.frameID && ev.Response != nil {
+			s.document = ev.Response
+		}
+	case *fetch.EventRequestPaused:
+		if allow == nil {
+			return
+		}
+		// replied to asynchronously, as events are handled while reading the connection
+		go func() {
+			c := chromedp.FromContext(tab)
+			ctx := cdp.WithExecutor(tab, c.Target)
+			u, err := url.Parse(ev.Request.URL)
+			if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				err = allow(ctx, u)
+			}
+			if err != nil {
+				fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+				return
+			}
+			fetch.ContinueRequest(ev.RequestID).Do(ctx)
+		}()
+	}
+}
+
+func isHTML(mimeType string) bool {
+	return mimeType == "" || mimeType == "text/html" || mimeType == "application/xhtml+xml"
+}
+
+// Transport is a http.RoundTripper that renders the pages it fetches in a browser,
+// responding with their DOM once rendered.
+type Transport struct {
+	Browser *Browser
+	// Next fetches the requests the browser doesn't render: those other than GET, with a
+	// Range, and the URLs that are not HTML documents, eg: images. If nil, they fail.
+	Next http.RoundTripper
+	// Wait configures when pages are deemed rendered.
+	Wait Wait
+	// Allow, if set, checks the URLs pages request, eg: against private networks.
+	Allow func(context.Context, *url.URL) error
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Next != nil && (req.Method != http.MethodGet || req.Header.Get("Range") != "" || req.Header.Get("Accept") == "text/event-stream") {
+		return t.Next.RoundTrip(req)
+	}
+	page, err := t.Browser.Render(req.Context(), req, t.Wait, t.Allow)
+	if errors.Is(err, ErrNotHTML) && t.Next != nil {
+		return t.Next.RoundTrip(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := page.Header
+	// the DOM is serialized in UTF-8, uncompressed
+	for _, key := range []string{"Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+		header.Del(key)
+	}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	resp := &http.Response{
+		Status:        strconv.Itoa(page.StatusCode) + " " + http.StatusText(page.StatusCode),
+		StatusCode:    page.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(page.HTML)),
+		ContentLength: int64(len(page.HTML)),
+		Request:       req,
+	}
+	if u, err := url.Parse(page.URL); err == nil && page.URL != req.URL.String() && u.Scheme != "" {
+		// the request of the response is that of the document after redirects
+		resp.Request = req.Clone(req.Context())
+		resp.Request.URL = u
+		resp.Request.Host = u.Host
+	}
+	return resp, nil
+}
@@ -0,0 +1,189 @@
+// Package imaging resizes and converts the images proxied by ladder, so that
+// readers on mobile connections don't download images larger than their screen.
+//
+//	opts, err := imaging.ParseOptions(c.Query("w"), c.Query("h"), c.Query("format"))
+//	data, mediaType, err := imaging.Transform(body, opts)
+//
+// JPEG, PNG, GIF and WebP images are decoded. Other images, such as SVGs, return
+// ErrUnsupported and are served unchanged.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxDimension bounds the width and height that can be requested.
+	MaxDimension = 4096
+	// maxPixels bounds the dimensions of the images decoded, larger images return ErrUnsupported.
+	maxPixels = 40_000_000
+	// jpegQuality is the quality of the JPEGs encoded.
+	jpegQuality = 80
+)
+
+// Format is the format images are converted to.
+type Format string
+
+const (
+	// FormatOriginal keeps the format of JPEG and PNG images. Scaled WebP and GIF images are
+	// encoded as JPEG, or as PNG when they are transparent, and GIFs lose their animation.
+	FormatOriginal Format = ""
+	// FormatJPEG encodes images as JPEG, dropping their transparency.
+	FormatJPEG Format = "jpeg"
+	// FormatPNG encodes images as PNG.
+	FormatPNG Format = "png"
+	// FormatWebP asks for the smallest image browsers with WebP support can show. Go has no WebP
+	// encoder, so images are encoded as JPEG, or as PNG when they are transparent.
+	FormatWebP Format = "webp"
+)
+
+// Options are the transformations applied to an image. The zero Options leaves images unchanged.
+type Options struct {
+	// Width and Height bound the dimensions of the image, which is scaled down to fit
+	// within them keeping its aspect ratio. Zero leaves the dimension unbounded.
+	Width  int
+	Height int
+	// Format is the format of the image returned.
+	Format Format
+}
+
+// IsZero reports whether opts leaves images unchanged.
+func (opts Options) IsZero() bool {
+	return opts == Options{}
+}
+
+// ParseOptions parses the width, height and format of the query parameters of the image
+// route, eg: w=800 and format=webp. Empty parameters are left unset.
+func ParseOptions(width string, height string, format string) (Options, error) {
+	var opts Options
+	var err error
+	if opts.Width, err = parseDimension("width", width); err != nil {
+		return Options{}, err
+	}
+	if opts.Height, err = parseDimension("height", height); err != nil {
+		return Options{}, err
+	}
+	switch f := Format(format); f {
+	case FormatOriginal, FormatJPEG, FormatPNG, FormatWebP:
+		opts.Format = f
+	case "jpg":
+		opts.Format = FormatJPEG
+	default:
+		return Options{}, fmt.Errorf("unknown image format '%s', expected jpeg, png or webp", format)
+	}
+	return opts, nil
+}
+
+func parseDimension(name string, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > MaxDimension {
+		return 0, fmt.Errorf("invalid image %s '%s', expected a number of pixels from 1 to %d", name, value, MaxDimension)
+	}
+	return n, nil
+}
+
+// ErrUnsupported is returned for images that can't be decoded or are too large to be.
+var ErrUnsupported = errors.New("unsupported image")
+
+// Transform applies opts to the image data and returns it along with its media type.
+// Images are never scaled up, and images that need neither scaling nor conversion are
+// returned as is. Images that can't be decoded, eg: SVGs, return ErrUnsupported.
+func Transform(data []byte, opts Options) ([]byte, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels exceed the limit", ErrUnsupported, config.Width, config.Height)
+	}
+
+	width, height := fit(config.Width, config.Height, opts.Width, opts.Height)
+	scaled := width != config.Width || height != config.Height
+	target := opts.Format
+	if target == FormatOriginal && (format == "jpeg" || format == "png") {
+		target = Format(format)
+	}
+	if !scaled && (target == FormatOriginal || target == Format(format)) {
+		return data, "image/" + format, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+	if scaled {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+		img = dst
+	}
+
+	if target == FormatWebP || target == FormatOriginal {
+		target = FormatJPEG
+		if !opaque(img) {
+			target = FormatPNG
+		}
+		if !scaled && target == Format(format) {
+			return data, "image/" + format, nil
+		}
+	}
+	var buf bytes.Buffer
+	switch target {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: jpegQuality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), "image/" + string(target), nil
+}
+
+// fit returns the dimensions of a width × height image scaled down to fit within
+// maxWidth × maxHeight, keeping its aspect ratio. Zero bounds are ignored.
+func fit(width int, height int, maxWidth int, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(int(float64(width)*scale+0.5), 1), max(int(float64(height)*scale+0.5), 1)
+}
+
+// opaque reports whether img has no transparent pixels.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flatten draws img over a white background, as JPEGs have no transparency.
+func flatten(img image.Image) image.Image {
+	if opaque(img) {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
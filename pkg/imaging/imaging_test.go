@@ -0,0 +1,107 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width int, height int, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions("800", "", "webp")
+	if err != nil || opts != (Options{Width: 800, Format: FormatWebP}) {
+		t.Errorf("ParseOptions() = %+v, %v", opts, err)
+	}
+	if opts, err := ParseOptions("", "", "jpg"); err != nil || opts.Format != FormatJPEG {
+		t.Errorf("ParseOptions(jpg) = %+v, %v", opts, err)
+	}
+	if opts, err := ParseOptions("", "", ""); err != nil || !opts.IsZero() {
+		t.Errorf("ParseOptions() = %+v, %v, want zero", opts, err)
+	}
+	for _, args := range [][3]string{{"0", "", ""}, {"-1", "", ""}, {"", "99999", ""}, {"abc", "", ""}, {"", "", "avif"}} {
+		if _, err := ParseOptions(args[0], args[1], args[2]); err == nil {
+			t.Errorf("ParseOptions(%q) succeeded", args)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	opaquePNG := encodePNG(t, 200, 100, 255)
+	transparentPNG := encodePNG(t, 200, 100, 128)
+	photo := encodeJPEG(t, 200, 100)
+
+	tests := []struct {
+		name          string
+		data          []byte
+		opts          Options
+		wantMediaType string
+		wantWidth     int
+		wantHeight    int
+		wantUnchanged bool
+	}{
+		{"unchanged", photo, Options{}, "image/jpeg", 200, 100, true},
+		{"not scaled up", photo, Options{Width: 400}, "image/jpeg", 200, 100, true},
+		{"width", photo, Options{Width: 100}, "image/jpeg", 100, 50, false},
+		{"height", opaquePNG, Options{Height: 20}, "image/png", 40, 20, false},
+		{"both", opaquePNG, Options{Width: 100, Height: 20}, "image/png", 40, 20, false},
+		{"to jpeg", transparentPNG, Options{Format: FormatJPEG}, "image/jpeg", 200, 100, false},
+		{"webp opaque", opaquePNG, Options{Width: 100, Format: FormatWebP}, "image/jpeg", 100, 50, false},
+		{"webp transparent", transparentPNG, Options{Format: FormatWebP}, "image/png", 200, 100, true},
+		{"webp transparent scaled", transparentPNG, Options{Width: 50, Format: FormatWebP}, "image/png", 50, 25, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, mediaType, err := Transform(tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mediaType != tt.wantMediaType {
+				t.Errorf("media type = %s, want %s", mediaType, tt.wantMediaType)
+			}
+			if unchanged := bytes.Equal(data, tt.data); unchanged != tt.wantUnchanged {
+				t.Errorf("unchanged = %v, want %v", unchanged, tt.wantUnchanged)
+			}
+			config, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if "image/"+format != mediaType {
+				t.Errorf("encoded as %s, want %s", format, mediaType)
+			}
+			if config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+				t.Errorf("dimensions = %dx%d, want %dx%d", config.Width, config.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+
+	if _, _, err := Transform([]byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), Options{Width: 100}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Transform(svg) error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,186 @@
+package jar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxImportSize bounds the size of the cookie exports imported.
+const maxImportSize = 16 << 20
+
+// exported is a cookie as exported by browser extensions such as Cookie-Editor, or in the
+// storage state of Playwright and Puppeteer.
+type exported struct {
+	Domain   string `json:"domain"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"httpOnly"`
+	HostOnly bool   `json:"hostOnly"`
+	// ExpirationDate is the expiry in seconds since the epoch of extensions,
+	// and Expires that of Playwright and Puppeteer, -1 for session cookies.
+	ExpirationDate float64 `json:"expirationDate"`
+	Expires        float64 `json:"expires"`
+}
+
+// Import stores the cookies exported from a browser read from r, in the Netscape cookies.txt
+// format of curl and wget, or as JSON, as exported by extensions such as Cookie-Editor or in the
+// storage state of Playwright, and returns the number of cookies imported. Expired cookies are
+// skipped. The Jar sends the cookies it imported to their sites, see Imported, and saves them
+// to its file right away.
+func (j *Jar) Import(r io.Reader) (int, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImportSize+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > maxImportSize {
+		return 0, fmt.Errorf("cookie export larger than %d bytes", maxImportSize)
+	}
+
+	var cookies []exported
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		cookies, err = parseJSON(trimmed)
+	} else {
+		cookies, err = parseNetscape(data)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// cookies are stored per URL, as the cookiejar stores the cookies of a response
+	var urls []*url.URL
+	byURL := map[url.URL][]*http.Cookie{}
+	now := time.Now()
+	for _, e := range cookies {
+		host := strings.TrimPrefix(strings.ToLower(e.Domain), ".")
+		if host == "" || e.Name == "" {
+			return 0, fmt.Errorf("invalid cookie '%s' of domain '%s'", e.Name, e.Domain)
+		}
+		cookie := &http.Cookie{Name: e.Name, Value: e.Value, Path: e.Path, Secure: e.Secure, HttpOnly: e.HttpOnly}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		if !e.HostOnly {
+			cookie.Domain = host
+		}
+		if expiry := max(e.ExpirationDate, e.Expires); expiry > 0 {
+			sec, frac := math.Modf(expiry)
+			cookie.Expires = time.Unix(int64(sec), int64(frac*1e9))
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		scheme := "http"
+		if e.Secure {
+			scheme = "https"
+		}
+		u := url.URL{Scheme: scheme, Host: host, Path: cookie.Path}
+		if _, ok := byURL[u]; !ok {
+			urls = append(urls, &u)
+		}
+		byURL[u] = append(byURL[u], cookie)
+	}
+
+	n := 0
+	for _, u := range urls {
+		j.setCookies(u, byURL[*u], true)
+		n += len(byURL[*u])
+	}
+	if err := j.Save(); err != nil {
+		return n, fmt.Errorf("failed to save cookie jar: %w", err)
+	}
+	return n, nil
+}
+
+// Imported reports whether the Jar imported cookies of the site of u, or of its registrable domain.
+func (j *Jar) Imported(u *url.URL) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.imported[site(u.Hostname())]
+}
+
+// site returns the registrable domain of host, eg: example.com for www.example.com, or host
+// itself if it has none.
+func site(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// parseJSON parses the cookies of a JSON array, or of the cookies of a JSON object.
+func parseJSON(data []byte) ([]exported, error) {
+	var cookies []exported
+	if data[0] == '{' {
+		var state struct {
+			Cookies []exported `json:"cookies"`
+		}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse cookie export: %w", err)
+		}
+		if state.Cookies == nil {
+			return nil, errors.New("failed to parse cookie export: no cookies array")
+		}
+		return state.Cookies, nil
+	}
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, fmt.Errorf("failed to parse cookie export: %w", err)
+	}
+	return cookies, nil
+}
+
+// parseNetscape parses the cookies of a Netscape cookies.txt file, whose lines hold the tab
+// separated domain, subdomains flag, path, secure flag, expiry, name and value of cookies.
+func parseNetscape(data []byte) ([]exported, error) {
+	var cookies []exported
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxImportSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(text, "#HttpOnly_"); ok {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) == 6 {
+			// cookies without value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("invalid cookie on line %d of cookies.txt: expected 7 tab separated fields, got %d", line, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry on line %d of cookies.txt: %w", line, err)
+		}
+		cookies = append(cookies, exported{
+			Domain:         fields[0],
+			HostOnly:       !strings.EqualFold(fields[1], "TRUE") && !strings.HasPrefix(fields[0], "."),
+			Path:           fields[2],
+			Secure:         strings.EqualFold(fields[3], "TRUE"),
+			ExpirationDate: float64(expiry),
+			Name:           fields[5],
+			Value:          fields[6],
+			HttpOnly:       httpOnly,
+		})
+	}
+	return cookies, scanner.Err()
+}
@@ -0,0 +1,221 @@
+// Package jar stores the cookies set by upstream sites server-side, so that
+// multi-request flows such as consent walls and soft logins work through ladder
+// even though the cookies of clients are not forwarded. Cookies are kept in
+// memory, keyed by the registrable domain of the sites, and optionally saved
+// to a file to survive restarts.
+//
+//	j, err := jar.New("/var/lib/ladder/cookies.json")
+//	client := &http.Client{Jar: j}
+package jar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// saveDelay is the time the cookies of a Jar are saved after they change, so that the
+// cookies set by a burst of responses are saved at once.
+var saveDelay = time.Second
+
+// Jar is a http.CookieJar persisting its cookies to a file, if set. It is safe for concurrent use.
+type Jar struct {
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	path    string
+	entries map[string]entry
+	// imported holds the registrable domains of the cookies imported, see Import.
+	imported map[string]bool
+	// dirty is set once entries changed since they were saved, and saveTimer saves them.
+	dirty     bool
+	saveTimer *time.Timer
+	// saveMu serializes the writes of the file.
+	saveMu sync.Mutex
+}
+
+// entry is a cookie along with the URL that set it, as saved to the file of a Jar.
+type entry struct {
+	URL string `json:"url"`
+	// SetCookie is the cookie serialized as a Set-Cookie header, with an absolute expiry.
+	SetCookie string    `json:"setCookie"`
+	Expires   time.Time `json:"expires,omitempty"`
+	// Imported is set for the cookies of the sites whose cookies were imported.
+	Imported bool `json:"imported,omitempty"`
+}
+
+// New returns a Jar saving its cookies to the file at path, and loads the cookies saved
+// there already, if any. An empty path keeps the cookies in memory only.
+func New(path string) (*Jar, error) {
+	cj, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	j := &Jar{jar: cj, path: path, entries: map[string]entry{}, imported: map[string]bool{}}
+	if path == "" {
+		return j, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookie jar '%s': %w", path, err)
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse cookie jar '%s': %w", path, err)
+	}
+	now := time.Now()
+	for _, e := range entries {
+		u, err := url.Parse(e.URL)
+		if err != nil || (!e.Expires.IsZero() && e.Expires.Before(now)) {
+			continue
+		}
+		cookies := (&http.Response{Header: http.Header{"Set-Cookie": {e.SetCookie}}}).Cookies()
+		if len(cookies) == 0 {
+			continue
+		}
+		j.jar.SetCookies(u, cookies)
+		j.entries[key(u, cookies[0])] = e
+		if e.Imported {
+			j.imported[site(u.Hostname())] = true
+		}
+	}
+	return j, nil
+}
+
+// Cookies returns the cookies to send in a request to u.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies stores the cookies received in a response from u, and saves the Jar
+// to its file shortly after. Errors saving the file are logged.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.setCookies(u, cookies, false)
+}
+
+// setCookies stores the cookies received from u, or imported for u, and schedules saving the
+// Jar to its file.
+func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, imported bool) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if imported {
+		j.imported[site(u.Hostname())] = true
+	}
+	if j.path == "" {
+		return
+	}
+	now := time.Now()
+	for _, cookie := range cookies {
+		c := *cookie
+		k := key(u, &c)
+		if c.MaxAge > 0 {
+			// Max-Age is relative to the time the cookie was received
+			c.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+			c.MaxAge = 0
+		}
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.entries, k)
+			continue
+		}
+		j.entries[k] = entry{URL: u.Scheme + "://" + u.Host + u.EscapedPath(), SetCookie: c.String(), Expires: c.Expires, Imported: j.imported[site(u.Hostname())]}
+	}
+	j.dirty = true
+	if j.saveTimer == nil {
+		j.saveTimer = time.AfterFunc(saveDelay, func() {
+			if err := j.Save(); err != nil {
+				slog.Error("failed to save cookie jar", "error", err)
+			}
+		})
+	}
+}
+
+// Save writes the unexpired cookies of the Jar to its file, atomically, if they changed since
+// they were last saved. Changes are saved shortly after they are made, Save saves them right
+// away, eg: on shutdown.
+func (j *Jar) Save() error {
+	j.saveMu.Lock()
+	defer j.saveMu.Unlock()
+
+	j.mu.Lock()
+	if j.saveTimer != nil {
+		j.saveTimer.Stop()
+		j.saveTimer = nil
+	}
+	if !j.dirty {
+		j.mu.Unlock()
+		return nil
+	}
+	j.dirty = false
+	data, err := j.marshal(time.Now())
+	j.mu.Unlock()
+	if err == nil {
+		err = j.write(data)
+	}
+	if err != nil {
+		// the changes are saved again along with the next ones
+		j.mu.Lock()
+		j.dirty = true
+		j.mu.Unlock()
+	}
+	return err
+}
+
+// marshal returns the unexpired cookies of the Jar, as saved to its file.
+func (j *Jar) marshal(now time.Time) ([]byte, error) {
+	keys := make([]string, 0, len(j.entries))
+	for k, e := range j.entries {
+		if !e.Expires.IsZero() && e.Expires.Before(now) {
+			delete(j.entries, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = j.entries[k]
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// write replaces the file of the Jar with data, atomically.
+func (j *Jar) write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// key identifies cookie, received from u, among the cookies of the Jar.
+func key(u *url.URL, cookie *http.Cookie) string {
+	domain := cookie.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	return domain + ";" + cookie.Path + ";" + cookie.Name
+}
@@ -0,0 +1,130 @@
+package jar
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func names(cookies []*http.Cookie) []string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	return names
+}
+
+func TestJar(t *testing.T) {
+	j, err := New("")
+	require.NoError(t, err)
+	u, _ := url.Parse("https://www.example.com/news/article")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1", Path: "/"},
+		{Name: "consent", Value: "yes", Domain: "example.com", Path: "/"},
+	})
+
+	assert.ElementsMatch(t, []string{"session=1", "consent=yes"}, names(j.Cookies(u)))
+	other, _ := url.Parse("https://shop.example.com/")
+	assert.Equal(t, []string{"consent=yes"}, names(j.Cookies(other)))
+	unrelated, _ := url.Parse("https://www.example.org/")
+	assert.Empty(t, j.Cookies(unrelated))
+}
+
+func TestJarPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	j, err := New(path)
+	require.NoError(t, err)
+	u, _ := url.Parse("https://www.example.com/")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1", Path: "/", HttpOnly: true},
+		{Name: "consent", Value: "yes", Path: "/", MaxAge: 3600},
+		{Name: "tracking", Value: "x", Path: "/"},
+	})
+	j.SetCookies(u, []*http.Cookie{{Name: "tracking", Path: "/", MaxAge: -1}})
+	require.NoError(t, j.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	reloaded, err := New(path)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"session=1", "consent=yes"}, names(reloaded.Cookies(u)))
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = New(path)
+	assert.Error(t, err)
+}
+
+func TestJarSaveDelay(t *testing.T) {
+	defer func(delay time.Duration) { saveDelay = delay }(saveDelay)
+	saveDelay = 50 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	j, err := New(path)
+	require.NoError(t, err)
+	u, _ := url.Parse("https://www.example.com/")
+	for i := 0; i < 10; i++ {
+		j.SetCookies(u, []*http.Cookie{{Name: "visit", Value: strconv.Itoa(i), Path: "/"}})
+	}
+
+	// the changes are saved at once, after the delay
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Eventually(t, func() bool {
+		reloaded, err := New(path)
+		return err == nil && slices.Equal([]string{"visit=9"}, names(reloaded.Cookies(u)))
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	j, err := New(path)
+	require.NoError(t, err)
+
+	n, err := j.Import(strings.NewReader("# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t4102444800\tsession\tsubscriber\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/news\tFALSE\t0\ttoken\tabc\n" +
+		"www.example.com\tFALSE\t/\tFALSE\t946684800\texpired\tx\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	article, _ := url.Parse("https://www.example.com/news/article")
+	assert.ElementsMatch(t, []string{"session=subscriber", "token=abc"}, names(j.Cookies(article)))
+	shop, _ := url.Parse("https://shop.example.com/")
+	assert.Equal(t, []string{"session=subscriber"}, names(j.Cookies(shop)))
+	insecure, _ := url.Parse("http://shop.example.com/")
+	assert.Empty(t, j.Cookies(insecure))
+	assert.True(t, j.Imported(shop))
+	other, _ := url.Parse("https://www.example.org/")
+	assert.False(t, j.Imported(other))
+
+	n, err = j.Import(strings.NewReader(`[{"domain": "www.example.org", "hostOnly": true, "name": "consent", "value": "yes", "path": "/", "expirationDate": 4102444800.5}]`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"consent=yes"}, names(j.Cookies(other)))
+
+	n, err = j.Import(strings.NewReader(`{"cookies": [{"domain": ".example.net", "name": "sid", "value": "1", "path": "/", "expires": -1}], "origins": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// the sites cookies were imported for survive restarts
+	reloaded, err := New(path)
+	require.NoError(t, err)
+	assert.True(t, reloaded.Imported(other))
+	assert.ElementsMatch(t, []string{"session=subscriber", "token=abc"}, names(reloaded.Cookies(article)))
+
+	_, err = j.Import(strings.NewReader("www.example.com\tFALSE\t/\n"))
+	assert.ErrorContains(t, err, "line 1")
+	_, err = j.Import(strings.NewReader(`[{"domain": "", "name": "a"}]`))
+	assert.Error(t, err)
+}
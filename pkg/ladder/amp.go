@@ -0,0 +1,109 @@
+package ladder
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AMPCanonical as the amp of a rule fetches the canonical version of AMP URLs, see ResolveCanonicalFromAMP.
+const AMPCanonical = "canonical"
+
+// ampVariants are the URL schemes of AMP versions usable as the amp of a rule, see RequestAMPVersion.
+var ampVariants = map[string]func(u *url.URL){
+	// path appends /amp to the path, eg: /article/amp, as WordPress does
+	"path": func(u *url.URL) {
+		if strings.HasSuffix(u.Path, "/") {
+			u.Path += "amp/"
+		} else {
+			u.Path += "/amp"
+		}
+		u.RawPath = ""
+	},
+	// subdomain serves the AMP version on the amp subdomain, eg: amp.example.com
+	"subdomain": func(u *url.URL) {
+		u.Host = "amp." + strings.TrimPrefix(u.Host, "www.")
+	},
+	// query requests the AMP version with ?outputType=amp
+	"query": func(u *url.URL) {
+		query := u.Query()
+		query.Set("outputType", "amp")
+		u.RawQuery = query.Encode()
+	},
+}
+
+// ampModifier rewrites the URL of upstream requests with rewrite.
+type ampModifier struct {
+	rewrite func(u *url.URL)
+}
+
+func (m ampModifier) ModifyRequest(req *http.Request) error {
+	m.rewrite(req.URL)
+	return nil
+}
+
+func (m ampModifier) ModifyResponse(_ *http.Response, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+// RequestAMPVersion returns a Modifier requesting the AMP version of pages, whose URL follows
+// variant: path, subdomain or query. AMP pages often leave out the scripts of paywalls.
+// URLs that are AMP already are left as is.
+func RequestAMPVersion(variant string) (Modifier, error) {
+	rewrite, ok := ampVariants[variant]
+	if !ok {
+		return nil, fmt.Errorf("unknown amp '%s', available: %s, path, query, subdomain", variant, AMPCanonical)
+	}
+	return ampModifier{func(u *url.URL) {
+		if !isAMP(u) {
+			rewrite(u)
+		}
+	}}, nil
+}
+
+// ResolveCanonicalFromAMP returns a Modifier requesting the canonical version of AMP pages,
+// removing the amp subdomain, path segment and query parameters of their URL.
+func ResolveCanonicalFromAMP() Modifier {
+	return ampModifier{canonicalFromAMP}
+}
+
+// isAMP reports whether u looks like the URL of an AMP page.
+func isAMP(u *url.URL) bool {
+	if strings.HasPrefix(u.Host, "amp.") || strings.HasSuffix(u.Path, ".amp") {
+		return true
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "amp" {
+			return true
+		}
+	}
+	query := u.Query()
+	return query.Has("amp") || strings.EqualFold(query.Get("outputType"), "amp")
+}
+
+// canonicalFromAMP rewrites the AMP URL u to the URL of its canonical page.
+func canonicalFromAMP(u *url.URL) {
+	u.Host = strings.TrimPrefix(u.Host, "amp.")
+
+	var path []string
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment != "amp" {
+			path = append(path, segment)
+		}
+	}
+	u.Path = strings.TrimSuffix(strings.Join(path, "/"), ".amp")
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = ""
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		if strings.EqualFold(query.Get("outputType"), "amp") {
+			query.Del("outputType")
+		}
+		query.Del("amp")
+		u.RawQuery = query.Encode()
+	}
+}
@@ -0,0 +1,75 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestAMPVersion(t *testing.T) {
+	tests := []struct {
+		variant, url, want string
+	}{
+		{"path", "https://www.example.com/2024/article", "https://www.example.com/2024/article/amp"},
+		{"path", "https://www.example.com/2024/article/", "https://www.example.com/2024/article/amp/"},
+		{"subdomain", "https://www.example.com/article", "https://amp.example.com/article"},
+		{"query", "https://www.example.com/article?id=1", "https://www.example.com/article?id=1&outputType=amp"},
+		// AMP URLs are left as is
+		{"path", "https://amp.example.com/article", "https://amp.example.com/article"},
+		{"subdomain", "https://www.example.com/article?outputType=amp", "https://www.example.com/article?outputType=amp"},
+	}
+	for _, test := range tests {
+		m, err := RequestAMPVersion(test.variant)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, test.url, nil)
+		require.NoError(t, m.ModifyRequest(req))
+		assert.Equal(t, test.want, req.URL.String(), test.url)
+	}
+
+	_, err := RequestAMPVersion("amp")
+	assert.ErrorContains(t, err, "unknown amp 'amp', available: canonical, path, query, subdomain")
+}
+
+func TestResolveCanonicalFromAMP(t *testing.T) {
+	tests := map[string]string{
+		"https://amp.example.com/article":                     "https://example.com/article",
+		"https://www.example.com/2024/article/amp/":           "https://www.example.com/2024/article/",
+		"https://www.example.com/amp/2024/article":            "https://www.example.com/2024/article",
+		"https://www.example.com/article.amp":                 "https://www.example.com/article",
+		"https://www.example.com/amp":                         "https://www.example.com/",
+		"https://www.example.com/article?outputType=amp&id=1": "https://www.example.com/article?id=1",
+		"https://www.example.com/article?amp=1":               "https://www.example.com/article",
+		"https://www.example.com/ampersand?id=1":              "https://www.example.com/ampersand?id=1",
+	}
+	for rawURL, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, rawURL, nil)
+		require.NoError(t, ResolveCanonicalFromAMP().ModifyRequest(req))
+		assert.Equal(t, want, req.URL.String(), rawURL)
+	}
+}
+
+func TestFetchAMP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	client := NewClient(ruleset.RuleSet{{Domain: u.Host, AMP: "path"}})
+	result, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "/article/amp", result.Content)
+
+	client.Rules = ruleset.RuleSet{{Domain: u.Host, AMP: AMPCanonical}}
+	result, err = client.Fetch(context.Background(), upstream.URL+"/amp/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "/article", result.Content)
+}
@@ -0,0 +1,84 @@
+package ladder
+
+import (
+	"html/template"
+	"strings"
+)
+
+// articleTemplate renders an Outline as a standalone HTML document.
+var articleTemplate = template.Must(template.New("article").Funcs(template.FuncMap{
+	"heading": func(level int) int {
+		return min(max(level, 1), 6)
+	},
+}).Parse(`<!DOCTYPE html>
+<html{{with .Metadata.Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="canonical" href="{{.URL}}">
+</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+{{- with .Byline}}
+<p>{{.}}</p>
+{{- end}}
+{{- range .Blocks}}
+{{- if eq .Type "heading"}}
+{{- if eq (heading .Level) 1}}
+<h1>{{.Text}}</h1>
+{{- else if eq (heading .Level) 2}}
+<h2>{{.Text}}</h2>
+{{- else if eq (heading .Level) 3}}
+<h3>{{.Text}}</h3>
+{{- else if eq (heading .Level) 4}}
+<h4>{{.Text}}</h4>
+{{- else if eq (heading .Level) 5}}
+<h5>{{.Text}}</h5>
+{{- else}}
+<h6>{{.Text}}</h6>
+{{- end}}
+{{- else if eq .Type "paragraph"}}
+<p>{{.Text}}</p>
+{{- else if eq .Type "list"}}
+{{- if .Ordered}}
+<ol>{{range .Items}}<li>{{.}}</li>{{end}}</ol>
+{{- else}}
+<ul>{{range .Items}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+{{- else if eq .Type "quote"}}
+<blockquote><p>{{.Text}}</p></blockquote>
+{{- else if eq .Type "code"}}
+<pre><code>{{.Text}}</code></pre>
+{{- else if eq .Type "image"}}
+<figure><img src="{{.Src}}" alt="{{.Text}}">{{with .Text}}<figcaption>{{.}}</figcaption>{{end}}</figure>
+{{- end}}
+{{- end}}
+</article>
+<p><a href="{{.URL}}">{{.URL}}</a></p>
+</body>
+</html>
+`))
+
+// HTML renders the outline as a standalone HTML document without styles or scripts,
+// titled after the page and linking to its URL, eg: to embed articles into other apps.
+func (o Outline) HTML() string {
+	title := o.Metadata.Title
+	if title == "" {
+		title = o.URL
+	}
+	blocks := o.Blocks
+	if len(blocks) > 0 && blocks[0].Type == BlockHeading && blocks[0].Level == 1 && blocks[0].Text == title {
+		blocks = blocks[1:]
+	}
+	var sb strings.Builder
+	// the template only fails on writes, which strings.Builder doesn't
+	_ = articleTemplate.Execute(&sb, struct {
+		Outline
+		Title  string
+		Byline string
+		Blocks []Block
+	}{o, title, o.Byline(), blocks})
+	return sb.String()
+}
@@ -0,0 +1,32 @@
+package ladder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlineHTML(t *testing.T) {
+	outline := Outline{
+		URL:      "https://www.example.com/article",
+		Metadata: Metadata{Title: "Ladder & friends", Author: "Jane Doe", Language: "en"},
+		Blocks: []Block{
+			{Type: BlockHeading, Level: 1, Text: "Ladder & friends"},
+			{Type: BlockParagraph, Text: "a <script>alert(1)</script> c"},
+			{Type: BlockHeading, Level: 9, Text: "Deep"},
+			{Type: BlockList, Items: []string{"one", "two"}, Ordered: true},
+			{Type: BlockImage, Src: "javascript:alert(1)", Text: "Diagram"},
+		},
+	}
+	html := outline.HTML()
+	assert.Contains(t, html, `<html lang="en">`)
+	assert.Contains(t, html, "<title>Ladder &amp; friends</title>")
+	assert.Equal(t, 1, strings.Count(html, "<h1>"))
+	assert.Contains(t, html, "<p>By Jane Doe</p>")
+	assert.Contains(t, html, "<p>a &lt;script&gt;alert(1)&lt;/script&gt; c</p>")
+	assert.Contains(t, html, "<h6>Deep</h6>")
+	assert.Contains(t, html, "<ol><li>one</li><li>two</li></ol>")
+	assert.Contains(t, html, `<img src="#ZgotmplZ" alt="Diagram">`)
+	assert.Contains(t, html, `<a href="https://www.example.com/article">https://www.example.com/article</a>`)
+}
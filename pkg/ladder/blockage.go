@@ -0,0 +1,88 @@
+package ladder
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Blockage classifies what an upstream response shows instead of the page, if anything.
+type Blockage string
+
+const (
+	// BlockageNone is a response showing the page.
+	BlockageNone Blockage = "ok"
+	// BlockageHardPaywall is a page whose content is reserved to subscribers.
+	BlockageHardPaywall Blockage = "hard-paywall"
+	// BlockageMeteredPaywall is a page shown once the free articles of the visitor are used up.
+	BlockageMeteredPaywall Blockage = "metered-paywall"
+	// BlockageCaptcha is a captcha served instead of the page.
+	BlockageCaptcha Blockage = "captcha"
+	// BlockageBotChallenge is an interstitial checking the browser, eg: Cloudflare's, served instead of the page.
+	BlockageBotChallenge Blockage = "bot-challenge"
+	// BlockageError is any other error response.
+	BlockageError Blockage = "error"
+)
+
+const (
+	// captchaSelector matches the widgets of captcha providers.
+	captchaSelector = `.g-recaptcha, .h-captcha, .cf-turnstile, #px-captcha, iframe[src*="recaptcha"], iframe[src*="hcaptcha.com"], ` +
+		`iframe[src*="captcha-delivery.com"], script[src*="captcha-delivery.com"], script[src*="challenges.cloudflare.com/turnstile"]`
+	// challengeSelector matches the elements of browser checking interstitials.
+	challengeSelector = `#challenge-form, #challenge-running, #cf-challenge-running, script[src*="/cdn-cgi/challenge-platform/"], ` +
+		`#sec-if-cpt-container, #distilIdentificationBlock`
+	// meterSelector matches the counters and registration prompts of metered paywalls.
+	meterSelector = `.meter, .paywall-meter, .article-meter, .tp-meter, [data-meter], .regwall, .registration-wall`
+	// paywallSelector matches the walls and offers of hard paywalls.
+	paywallSelector = `.paywall, #paywall, [data-paywall], .piano-offer, .tp-modal, .subscriber-only, .subscription-wall`
+)
+
+var (
+	challengeTitleRegex = regexp.MustCompile(`(?i)^\s*(just a moment|attention required|access denied|one more step|are you a robot|pardon our interruption)`)
+	meterRegex          = regexp.MustCompile(`(?i)\b(\d+|no) free (articles?|stories) (left|remaining)|(reached|used up) (your|all( of)? your) (free articles|article limit)|register (for free )?to (continue|keep) reading`)
+	hardPaywallRegex    = regexp.MustCompile(`(?i)subscribe (now )?to (continue|read|unlock)|this (article|content|story) is (only available to|for|exclusive to) subscribers`)
+)
+
+// DetectBlockage classifies the upstream response with status, header and body, from its status
+// and, for HTML responses, the elements and text of the document: the widgets of captchas, the
+// interstitials of bot challenges, and the walls, offers and wording of hard or metered paywalls.
+func DetectBlockage(status int, header http.Header, body string) Blockage {
+	if header.Get("Cf-Mitigated") == "challenge" {
+		return BlockageBotChallenge
+	}
+	if !strings.Contains(header.Get("Content-Type"), "html") {
+		if status >= 400 {
+			return BlockageError
+		}
+		return BlockageNone
+	}
+	doc, err := parseDocument(body)
+	if err != nil {
+		if status >= 400 {
+			return BlockageError
+		}
+		return BlockageNone
+	}
+
+	if doc.Find(captchaSelector).Length() > 0 {
+		return BlockageCaptcha
+	}
+	title := doc.Find("title").First().Text()
+	if doc.Find(challengeSelector).Length() > 0 ||
+		((status == http.StatusForbidden || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) && challengeTitleRegex.MatchString(title)) {
+		return BlockageBotChallenge
+	}
+	if status >= 400 {
+		return BlockageError
+	}
+
+	doc.Find("script, style, noscript, template").Remove()
+	text := doc.Find("body").Text()
+	if doc.Find(meterSelector).Length() > 0 || meterRegex.MatchString(text) {
+		return BlockageMeteredPaywall
+	}
+	if doc.Find(paywallSelector).Length() > 0 || hardPaywallRegex.MatchString(text) {
+		return BlockageHardPaywall
+	}
+	return BlockageNone
+}
@@ -0,0 +1,52 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectBlockage(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   Blockage
+	}{
+		{"page", http.StatusOK, html, "<article><p>The full story.</p></article>", BlockageNone},
+		{"cloudflare header", http.StatusForbidden, http.Header{"Cf-Mitigated": {"challenge"}}, "", BlockageBotChallenge},
+		{"cloudflare interstitial", http.StatusForbidden, html, "<title>Just a moment...</title><form id=\"challenge-form\"></form>", BlockageBotChallenge},
+		{"akamai", http.StatusForbidden, html, "<title>Access Denied</title><h1>Access Denied</h1>", BlockageBotChallenge},
+		{"recaptcha", http.StatusOK, html, `<div class="g-recaptcha" data-sitekey="x"></div>`, BlockageCaptcha},
+		{"datadome", http.StatusForbidden, html, `<iframe src="https://geo.captcha-delivery.com/captcha/?cid=1"></iframe>`, BlockageCaptcha},
+		{"meter", http.StatusOK, html, "<p>Intro</p><div>You have 0 free articles left this month.</div>", BlockageMeteredPaywall},
+		{"regwall", http.StatusOK, html, `<p>Intro</p><div class="regwall">Sign up</div>`, BlockageMeteredPaywall},
+		{"paywall", http.StatusOK, html, `<p>Intro</p><div class="paywall">Offer</div>`, BlockageHardPaywall},
+		{"wording", http.StatusOK, html, "<p>Intro</p><p>Subscribe to continue reading.</p>", BlockageHardPaywall},
+		// the wording of scripts is not visible
+		{"script", http.StatusOK, html, `<p>Story</p><script>"Subscribe to continue"</script>`, BlockageNone},
+		{"not found", http.StatusNotFound, html, "<h1>Not found</h1>", BlockageError},
+		{"json error", http.StatusInternalServerError, http.Header{"Content-Type": {"application/json"}}, `{"class":"paywall"}`, BlockageError},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, DetectBlockage(test.status, test.header, test.body), test.name)
+	}
+}
+
+func TestFetchBlockage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>Intro</p><div class="paywall">Offer</div>`))
+	}))
+	defer upstream.Close()
+
+	result, err := NewClient(nil).Fetch(context.Background(), upstream.URL, FetchOptions{Format: FormatText})
+	require.NoError(t, err)
+	assert.Equal(t, BlockageHardPaywall, result.Blockage)
+}
@@ -0,0 +1,57 @@
+package ladder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+const (
+	// bufferSize is the initial capacity of pooled buffers, sized to hold a typical HTML page.
+	bufferSize = 128 << 10
+	// maxBufferSize is the capacity above which buffers are dropped instead of being
+	// returned to the pool, so that a few huge pages don't pin memory.
+	maxBufferSize = 4 << 20
+)
+
+var buffers = sync.Pool{
+	New: func() any {
+		return bytes.NewBuffer(make([]byte, 0, bufferSize))
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. The contents of buf must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxBufferSize {
+		return
+	}
+	buf.Reset()
+	buffers.Put(buf)
+}
+
+// readAll reads r into buf, growing buf up front when the size is known.
+func readAll(buf *bytes.Buffer, r io.Reader, size int64) ([]byte, error) {
+	if size > 0 && size <= maxBufferSize {
+		buf.Grow(int(size))
+	}
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+// marshalJSON encodes v as JSON into a pooled buffer and returns it as a string.
+func marshalJSON(v any) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return "", err
+	}
+	// Encode terminates the value with a newline, which json.Marshal doesn't
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
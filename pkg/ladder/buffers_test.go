@@ -0,0 +1,50 @@
+package ladder
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAll(t *testing.T) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	body := strings.Repeat("<p>ladder</p>", 1000)
+	b, err := readAll(buf, strings.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	assert.Equal(t, body, string(b))
+
+	// unknown content length
+	buf.Reset()
+	b, err = readAll(buf, strings.NewReader(body), -1)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(b))
+}
+
+func TestPutBuffer(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("stale")
+	putBuffer(buf)
+	assert.Zero(t, buf.Len())
+
+	// oversized buffers are left to the garbage collector
+	huge := bytes.NewBuffer(make([]byte, 0, maxBufferSize+1))
+	huge.WriteString("kept")
+	putBuffer(huge)
+	assert.Equal(t, "kept", huge.String())
+}
+
+func TestMarshalJSON(t *testing.T) {
+	outline := Outline{URL: "https://www.example.com/<article>", Metadata: Metadata{Title: "A & B"}}
+	want, err := json.Marshal(outline)
+	require.NoError(t, err)
+
+	got, err := marshalJSON(outline)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got)
+}
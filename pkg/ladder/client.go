@@ -0,0 +1,965 @@
+// Package ladder exposes the fetching and extraction pipeline of the ladder
+// proxy as a library, so other Go programs can bypass paywalls and extract
+// articles without running the HTTP server.
+//
+//	client := ladder.NewClient(rules)
+//	result, err := client.Fetch(ctx, "https://www.example.com/article", ladder.FetchOptions{
+//		Format: ladder.FormatText,
+//	})
+//	fmt.Println(result.Metadata.Title, result.Content)
+package ladder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ladder/pkg/botips"
+	"ladder/pkg/events"
+	"ladder/pkg/headless"
+	"ladder/pkg/jar"
+	"ladder/pkg/logging"
+	"ladder/pkg/metrics"
+	"ladder/pkg/proxypool"
+	"ladder/pkg/resolver"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/ssrf"
+	"ladder/pkg/stats"
+	"ladder/pkg/tor"
+	"ladder/pkg/tracing"
+	"ladder/pkg/transport"
+	"ladder/pkg/urls"
+	"ladder/pkg/wasm"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultUserAgent is the User-Agent sent upstream when neither the Client nor the matching rule sets one.
+	DefaultUserAgent = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	// DefaultForwardedFor is the X-Forwarded-For address sent upstream when neither the Client nor the matching rule
+	// sets one: an address of Googlebot, matching DefaultUserAgent.
+	DefaultForwardedFor = "googlebot"
+	// DefaultMaxRedirects is the number of upstream redirects followed by the Clients returned by NewClient.
+	DefaultMaxRedirects = 10
+)
+
+// DefaultTimeouts are the timeouts of upstream requests used when neither the Client nor the matching rule sets one.
+var DefaultTimeouts = ruleset.Timeouts{
+	DNS:            10 * time.Second,
+	Connect:        10 * time.Second,
+	TLSHandshake:   10 * time.Second,
+	ResponseHeader: 30 * time.Second,
+	Body:           60 * time.Second,
+}
+
+// DefaultRetry is the retry of upstream requests used when neither the Client nor the matching
+// rule sets one: requests are sent once.
+var DefaultRetry = ruleset.Retry{
+	Attempts:   1,
+	Backoff:    200 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+// Client fetches sites the way the ladder proxy does, applying the matching
+// rule of its RuleSet to the outgoing request and to the response.
+// A Client is safe for concurrent use once configured.
+type Client struct {
+	// Rules is the RuleSet used to modify requests and responses. Once the Client is in use,
+	// it is replaced with SetRules.
+	Rules ruleset.RuleSet
+	// rulesMu guards Rules against SetRules.
+	rulesMu sync.RWMutex
+	// UserAgent is sent upstream unless overridden by a rule. UserAgentRotate picks one of UserAgents per site.
+	UserAgent string
+	// Masquerade sends the headers of a crawler, eg: facebookbot, instead of UserAgent and
+	// ForwardedFor, unless overridden by a rule, see Masquerades.
+	Masquerade string
+	// ClientHints sends the navigation headers of a browser consistent with the User-Agent,
+	// unless overridden by a rule, eg: ClientHintsAuto, see ruleset.Rule.Headers.
+	ClientHints string
+	// UserAgents is the pool of User-Agents rotated across sites, DefaultUserAgents if empty.
+	UserAgents []string
+	// ForwardedFor is sent upstream as X-Forwarded-For unless overridden by a rule.
+	// googlebot or bingbot send a random address of the crawler, see botips.Get.
+	ForwardedFor string
+	// AllowedDomains restricts fetching to hosts starting with one of the domains. Empty means no limitations.
+	AllowedDomains []string
+	// AllowRuleDomains also allows the hosts matching the domains of the rules, following the
+	// rules set with SetRules.
+	AllowRuleDomains bool
+	// LogURLs logs every fetched URL.
+	LogURLs bool
+	// Timeouts bounds the phases of upstream requests, unless overridden by a rule.
+	Timeouts ruleset.Timeouts
+	// MaxBodySize bounds the size in bytes of the upstream bodies read, once decoded, so that a
+	// huge response can't exhaust memory. Fetches of larger bodies fail with ErrBodyTooLarge.
+	// Passthrough bodies are streamed and not bounded. 0 means no limit.
+	MaxBodySize int64
+	// Retry retries the upstream requests answered with 429 Too Many Requests or a server error,
+	// or timing out, unless overridden by a rule.
+	Retry ruleset.Retry
+	// RetryBudget bounds the retries across all requests, if set.
+	RetryBudget *transport.RetryBudget
+	// Concurrency bounds the upstream requests in flight, overall and per host, if set. Retries
+	// and redirects wait for a slot again, and passthrough responses hold theirs until closed,
+	// for the body timeout at most, while event streams release theirs once their headers arrived.
+	Concurrency *transport.ConcurrencyLimit
+	// TLSFingerprint is the browser TLS ClientHello preset impersonated upstream, eg: chrome,
+	// unless overridden by a rule, see transport.Fingerprints. Empty sends the ClientHello of Go.
+	TLSFingerprint string
+	// Resolver looks up the addresses of sites, eg: google or dns://9.9.9.9, unless overridden by a rule,
+	// see resolver.Get. Empty uses the resolver of the operating system.
+	Resolver string
+	// Resolve pins hosts to addresses as host:ip, eg: staging.example.com:10.0.0.7, which are dialed
+	// without looking them up, unless a rule pins the same host, see resolver.ParseHosts.
+	Resolve []string
+	// HeaderOrder is the browser whose HTTP/1.1 header order and casing is sent upstream, eg: chrome,
+	// unless overridden by a rule, see transport.HeaderOrders. Empty sends the sorted headers of Go.
+	HeaderOrder string
+	// ForwardHeaders lists the upstream response headers servers forward to the client along with
+	// rewritten bodies, unless the rule lists its own, see Result.ForwardedHeaders.
+	ForwardHeaders []string
+	// TrackingParams lists the query parameters stripped from the fetched URLs, unless the rule
+	// lists its own, see DefaultTrackingParams.
+	TrackingParams []string
+	// Strategies lists the strategies of fetching pages tried in order until one gets the page,
+	// unless the rule lists its own, eg: DefaultStrategies. Empty fetches pages directly only.
+	Strategies []string
+	// WaybackSave captures the pages the Wayback Machine has no snapshot of with Save Page Now,
+	// when fetching them with StrategyArchiveOrg.
+	WaybackSave bool
+	// StripOverlays removes the elements that look like paywall overlays from the sites
+	// no rule matches, see ruleset.Rule.StripOverlays.
+	StripOverlays bool
+	// Cookies forwards the cookies of the sites no rule matches, see ruleset.Rule.Cookies.
+	Cookies bool
+	// CookieJar stores the cookies of the sites no rule matches in Jar, see ruleset.Rule.CookieJar.
+	CookieJar bool
+	// Jar stores the cookies of the sites whose rule sets CookieJar, and of the sites a jar.Jar
+	// imported cookies of, set to an in-memory jar.Jar by NewClient. It is read by concurrent
+	// fetches, so it must not be replaced once the Client is in use. If nil, no cookie is stored.
+	Jar http.CookieJar
+	// Images scales down the images of the sites whose rule doesn't set its own, see ruleset.Rule.Images.
+	Images ruleset.Images
+	// MaxRedirects bounds the upstream redirects followed by a fetch. Redirects beyond it
+	// are returned with their Location rewritten to route back through the ladder instance.
+	MaxRedirects int
+	// SameOriginRedirects follows the upstream redirects to the origin of the fetched URL only, like
+	// those beyond MaxRedirects, in addition to those of the sites whose rule sets it.
+	SameOriginRedirects bool
+	// RedirectCookies sends the cookies set by upstream redirects along with the next requests of
+	// the redirect chain and returns them with the response, in addition to those of the sites
+	// whose rule sets it, see ruleset.Rule.Redirects.
+	RedirectCookies bool
+	// HTTP3 fetches all sites over HTTP/3 where their origin supports it, in addition
+	// to those whose rule sets it, see transport.Options.
+	HTTP3 bool
+	// ECH negotiates Encrypted Client Hello with the origins of all sites publishing an ECH config,
+	// in addition to those whose rule sets it, see transport.Options.
+	ECH bool
+	// FastHTTP sends upstream requests with fasthttp where HTTP/1.1 suffices, see transport.Options.
+	FastHTTP bool
+	// Plugins holds the Modifiers that rules can reference by name in their plugins list.
+	Plugins map[string]Modifier
+	// Wasm runs the WASM modules referenced by rules.
+	// If nil, a runtime with wasm.DefaultLimits is created on first use.
+	Wasm *wasm.Runtime
+	// Events receives the debug events of every fetch, if set.
+	Events *events.Bus
+	// Stats aggregates the outcomes of every fetch per domain, if set.
+	Stats *stats.Recorder
+	// Metrics records the latency of upstreams, the time spent in modifiers and the outcomes of
+	// strategies, if set.
+	Metrics *metrics.Metrics
+	// Tracer traces every fetch, with spans for the strategies tried, the modifiers applied and
+	// the upstream requests, if set. Fetches whose context is traced are traced regardless.
+	Tracer trace.Tracer
+	// Transport sends the upstream requests, if set. It replaces the transport
+	// configured by the TLS options of rules, eg: to serve canned responses in tests.
+	Transport http.RoundTripper
+	// Guard blocks fetching non-HTTP(S) URLs and internal addresses, if set.
+	// It checks the resolved addresses of hosts, unless Transport is set.
+	Guard *ssrf.Guard
+	// Proxies rotates the upstream requests across a pool of proxies, if set, see transport.Options.
+	Proxies *proxypool.Pool
+	// Tor fetches the sites whose rule sets Tor through Tor, if set.
+	Tor *tor.Tor
+	// ViaTor fetches all sites through Tor.
+	ViaTor bool
+	// Browser renders the pages of the sites whose rule sets browser.render, and those fetched with
+	// StrategyBrowser, if set.
+	Browser *headless.Browser
+	// WrapTransport wraps the transport of every upstream request, if set, eg: to inject faults.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	wasmOnce sync.Once
+}
+
+// NewClient returns a Client using rules and the default User-Agent and X-Forwarded-For headers.
+func NewClient(rules ruleset.RuleSet) *Client {
+	// an in-memory jar can't fail to be created
+	j, _ := jar.New("")
+	return &Client{
+		Rules:          rules,
+		UserAgent:      DefaultUserAgent,
+		ForwardedFor:   DefaultForwardedFor,
+		Timeouts:       DefaultTimeouts,
+		Retry:          DefaultRetry,
+		MaxRedirects:   DefaultMaxRedirects,
+		ForwardHeaders: DefaultForwardHeaders,
+		TrackingParams: DefaultTrackingParams,
+		Jar:            j,
+	}
+}
+
+// SetRules replaces the RuleSet of c, eg: once its files changed. Fetches in flight keep the
+// rule they matched.
+func (c *Client) SetRules(rules ruleset.RuleSet) {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+	c.Rules = rules
+}
+
+// RuleSet returns the RuleSet of c.
+func (c *Client) RuleSet() ruleset.RuleSet {
+	c.rulesMu.RLock()
+	defer c.rulesMu.RUnlock()
+	return c.Rules
+}
+
+// allowHost returns ErrNotAllowed unless the host of u starts with one of AllowedDomains or,
+// if AllowRuleDomains, its hostname matches the domain of a rule, including glob and regex domains.
+func (c *Client) allowHost(u *url.URL) error {
+	host := u.Host
+	if !c.AllowRuleDomains {
+		if len(c.AllowedDomains) > 0 && !StringInSlice(host, c.AllowedDomains) {
+			return fmt.Errorf("%w. %s not in %s", ErrNotAllowed, host, c.AllowedDomains)
+		}
+		return nil
+	}
+
+	// empty domains, eg: of an unset ALLOWED_DOMAINS, would allow any host
+	allowed := slices.DeleteFunc(slices.Clone(c.AllowedDomains), func(domain string) bool {
+		return domain == ""
+	})
+	rules := c.RuleSet()
+	switch {
+	case len(allowed) == 0 && len(rules) == 0:
+	case StringInSlice(host, allowed):
+	case slices.ContainsFunc(rules, func(rule ruleset.Rule) bool { return rule.MatchDomain(u.Hostname()) }):
+	default:
+		return fmt.Errorf("%w. %s not in %s nor the domains of the rules", ErrNotAllowed, host, allowed)
+	}
+	return nil
+}
+
+// Fetch retrieves rawURL according to the rule matching its domain and path,
+// and returns the response content in the requested format along with its metadata.
+func (c *Client) Fetch(ctx context.Context, rawURL string, opts FetchOptions) (*Result, error) {
+	t := c.newTracer(opts.Tag, opts.Trace)
+	ctx, span := c.startSpan(ctx, "fetch", trace.WithAttributes(attribute.String("url.full", rawURL)))
+	defer span.End()
+	start := time.Now()
+	result, err := c.fetchStrategies(ctx, rawURL, opts, t)
+	if err != nil {
+		tracing.RecordError(span, err)
+		t.emit(events.TypeError, err.Error(), nil)
+	}
+	c.annotateLog(ctx, result, err, time.Since(start))
+	if c.Stats != nil {
+		c.recordOutcome(rawURL, result, err)
+	}
+	return result, err
+}
+
+// annotateLog adds the outcome of a fetch that took d to the access log entry of its request:
+// the rule matched, the strategy that got the page, the upstream status, and the URL fetched
+// if c.LogURLs.
+func (c *Client) annotateLog(ctx context.Context, result *Result, err error, d time.Duration) {
+	args := []any{"fetch_duration", d}
+	if err != nil {
+		args = append(args, "fetch_error", err.Error())
+	}
+	if result != nil {
+		rule := result.Rule.Domain
+		if rule == "" && len(result.Rule.Domains) > 0 {
+			rule = result.Rule.Domains[0]
+		}
+		if rule != "" {
+			args = append(args, "rule", rule)
+		}
+		if result.Strategy != "" {
+			args = append(args, "strategy", result.Strategy)
+		}
+		if result.Response != nil {
+			args = append(args, "upstream_status", result.Response.StatusCode)
+		}
+		if c.LogURLs {
+			args = append(args, "upstream", result.URL)
+		}
+	}
+	logging.Annotate(ctx, args...)
+}
+
+// recordOutcome records the outcome of fetching rawURL in c.Stats. The content is only
+// inspected for paywalls and challenges in FormatHTML, the format served to readers.
+func (c *Client) recordOutcome(rawURL string, result *Result, err error) {
+	u, parseErr := url.Parse(rawURL)
+	if parseErr != nil || u.Host == "" {
+		return
+	}
+
+	outcome := stats.Error
+	if err == nil {
+		content := ""
+		if result.Format == FormatHTML && result.Body == nil {
+			content = result.Content
+		}
+		outcome = stats.Classify(result.Response.StatusCode, result.Response.Header, content)
+	}
+	c.Stats.Record(urls.NormalizeHost(u.Host), outcome)
+}
+
+func (c *Client) fetch(ctx context.Context, rawURL string, opts FetchOptions, t tracer) (*Result, error) {
+	if opts.Format == "" {
+		opts.Format = FormatHTML
+	}
+	if opts.ProxyPrefix == "" {
+		opts.ProxyPrefix = "/"
+	}
+	if opts.ImagePrefix == "" {
+		opts.ImagePrefix = DefaultImagePrefix
+	}
+
+	rawURL, err := urls.WithQuery(rawURL, opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u = urls.Normalize(u)
+
+	if err := c.allowHost(u); err != nil {
+		return nil, err
+	}
+
+	if c.LogURLs {
+		logging.Logger(ctx).Info("fetching", "url", u.String())
+	}
+
+	// Modify the URI according to ruleset
+	rules := c.RuleSet()
+	rule := rules.Match(u.Host, u.Path)
+	if domains := rule.AllDomains(); len(domains) > 0 {
+		t.emit(events.TypeRule, "matched rule for "+strings.Join(domains, ", "), nil)
+	} else {
+		t.emit(events.TypeRule, "no rule matched "+u.Host+u.Path, nil)
+		rule.StripOverlays = c.StripOverlays
+		rule.Cookies = c.Cookies
+		rule.CookieJar = c.CookieJar
+	}
+	if rule.TLS.Fingerprint == "" {
+		rule.TLS.Fingerprint = c.TLSFingerprint
+	}
+	if rule.TLS.HeaderOrder == "" {
+		rule.TLS.HeaderOrder = c.HeaderOrder
+	}
+	if rule.Resolver == "" {
+		rule.Resolver = c.Resolver
+	}
+	if rule.Headers.Masquerade == "" {
+		rule.Headers.Masquerade = c.Masquerade
+	}
+	if rule.Headers.ClientHints == "" {
+		rule.Headers.ClientHints = c.ClientHints
+	}
+	rule.TLS.HTTP3 = rule.TLS.HTTP3 || c.HTTP3
+	rule.TLS.ECH = rule.TLS.ECH || c.ECH
+	rule.Tor = rule.Tor || c.ViaTor
+	if len(rule.Headers.Forward) == 0 {
+		rule.Headers.Forward = c.ForwardHeaders
+	}
+	if len(rule.TrackingParams) == 0 {
+		rule.TrackingParams = c.TrackingParams
+	}
+	if j, ok := c.Jar.(interface{ Imported(*url.URL) bool }); ok && j.Imported(u) {
+		// the cookies imported from a browser are sent to their sites whatever their rule
+		rule.CookieJar = true
+	}
+	if err := applyPreset(&rule, opts.Preset); err != nil {
+		return nil, err
+	}
+	applyStrategy(&rule, opts.strategy)
+	if rule.Images == (ruleset.Images{}) {
+		rule.Images = c.Images
+	}
+	fetchURL, err := modifyURL(u.String(), rule)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkURL(fetchURL, opts.ProxyOrigin); err != nil {
+		return nil, err
+	}
+
+	// Fetch the site
+	if err := transport.ValidateFingerprint(rule.TLS.Fingerprint, rule.TLS.ClientHello); err != nil {
+		return nil, err
+	}
+	if err := transport.ValidateHTTP2(rule.TLS.HTTP2); err != nil {
+		return nil, err
+	}
+	if err := transport.ValidateHeaderOrder(rule.TLS.HeaderOrder); err != nil {
+		return nil, err
+	}
+	if err := resolver.Validate(rule.Resolver); err != nil {
+		return nil, err
+	}
+	hosts, err := c.hostPins(rule)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateMasquerade(rule.Headers.Masquerade); err != nil {
+		return nil, err
+	}
+	if err := ValidateClientHints(rule.Headers.ClientHints); err != nil {
+		return nil, err
+	}
+	var proxies transport.Proxies
+	if c.Proxies != nil {
+		proxies = c.Proxies
+	}
+	if rule.Tor {
+		if c.Tor == nil {
+			return nil, fmt.Errorf("the rule of %s fetches it through Tor, which is not configured", u.Host)
+		}
+		proxies = c.Tor
+	}
+	timeouts := rule.Timeouts.Or(c.Timeouts)
+	client := &http.Client{Transport: c.Transport}
+	if client.Transport == nil {
+		client.Transport = transport.New(transport.Options{
+			ECH:         rule.TLS.ECH,
+			Fingerprint: rule.TLS.Fingerprint,
+			ClientHello: rule.TLS.ClientHello,
+			HTTP2:       rule.TLS.HTTP2,
+			HTTP3:       rule.TLS.HTTP3,
+			HeaderOrder: rule.TLS.HeaderOrder,
+			Resolver:    rule.Resolver,
+			Hosts:       hosts,
+			Timeouts: transport.Timeouts{
+				DNS:            timeouts.DNS,
+				Connect:        timeouts.Connect,
+				TLSHandshake:   timeouts.TLSHandshake,
+				ResponseHeader: timeouts.ResponseHeader,
+			},
+			Proxies:  proxies,
+			Guard:    c.Guard,
+			FastHTTP: c.FastHTTP,
+		})
+		if rule.Tor {
+			client.Transport = &tor.Transport{Next: client.Transport, Tor: c.Tor}
+		}
+	}
+	if rule.Browser.Render {
+		if c.Browser == nil {
+			return nil, fmt.Errorf("the rule of %s renders it in a browser, which is not configured", u.Host)
+		}
+		t.emit(events.TypeRequest, "rendering in the browser", nil)
+		client.Transport = &headless.Transport{
+			Browser: c.Browser,
+			Next:    client.Transport,
+			Wait:    headless.Wait{Selector: rule.Browser.WaitFor, Idle: rule.Browser.Idle},
+			Allow:   c.allowURL,
+		}
+	}
+	redirects := &redirectPolicy{
+		max:        c.MaxRedirects,
+		sameOrigin: rule.Redirects.SameOrigin || c.SameOriginRedirects,
+		cookies:    rule.Redirects.Cookies || c.RedirectCookies,
+		guard:      c.Guard,
+		t:          t,
+	}
+	if rule.Redirects.Max != 0 {
+		redirects.max = max(rule.Redirects.Max, 0)
+	}
+	if origin, err := url.Parse(opts.ProxyOrigin); err == nil {
+		redirects.proxyHost = origin.Host
+	}
+	client.CheckRedirect = redirects.check
+	if c.Concurrency != nil {
+		// bodies hold their slots for as long as they are expected to take, and streams not at all
+		client.Transport = &transport.ConcurrencyTransport{Next: client.Transport, Limit: c.Concurrency, MaxHold: timeouts.Body}
+	}
+	if c.WrapTransport != nil {
+		client.Transport = c.WrapTransport(client.Transport)
+	}
+	if retry := rule.Retry.Or(c.Retry); retry.Attempts > 1 {
+		client.Transport = &transport.RetryTransport{
+			Next:   client.Transport,
+			Retry:  transport.Retry{Attempts: retry.Attempts, Backoff: retry.Backoff, MaxBackoff: retry.MaxBackoff},
+			Budget: c.RetryBudget,
+			OnRetry: func(attempt int, delay time.Duration, reason string) {
+				t.emit(events.TypeRequest, "retrying after "+reason+" in "+delay.String(), map[string]string{"attempt": strconv.Itoa(attempt)})
+			},
+		}
+	}
+	if rule.CookieJar && c.Jar != nil {
+		client.Jar = c.Jar
+	}
+	// passthrough results own the request, which is released when their body is closed
+	ctx, cancel := context.WithCancel(ctx)
+	passthrough := false
+	defer func() {
+		if !passthrough {
+			cancel()
+		}
+	}()
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	body := opts.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fetchURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Body != nil {
+		// the body isn't closed: it is owned by the caller
+		req.Body = io.NopCloser(opts.Body)
+		req.GetBody = nil
+		req.ContentLength = opts.ContentLength
+		if req.ContentLength <= 0 {
+			req.ContentLength = -1
+		}
+	}
+	c.setHeaders(req, u, rule)
+	setClientHints(req, rule.Headers.ClientHints)
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+	if method != http.MethodGet && method != http.MethodHead && req.Header.Get("Origin") == "" {
+		// sites reject the forms submitted from other origins
+		req.Header.Set("Origin", u.Scheme+"://"+u.Host)
+	}
+	if opts.Range != "" {
+		req.Header.Set("Range", opts.Range)
+		if opts.IfRange != "" {
+			req.Header.Set("If-Range", opts.IfRange)
+		}
+	}
+	if opts.Accept != "" {
+		req.Header.Set("Accept", opts.Accept)
+	}
+	if opts.strategy == StrategyArchiveIs && !opts.ArchiveTime.IsZero() {
+		req.Header.Set("Accept-Datetime", opts.ArchiveTime.UTC().Format(http.TimeFormat))
+	}
+	if rule.Cookies && opts.Cookie != "" {
+		cookie := opts.Cookie
+		if rule.Headers.Cookie != "" {
+			cookie = rule.Headers.Cookie + "; " + cookie
+		}
+		req.Header.Set("Cookie", cookie)
+	}
+	t.headers("ruleset", req.Header)
+
+	list, err := c.modifiers(rule)
+	if err != nil {
+		return nil, err
+	}
+	defer list.release()
+	modifiers := list.modifiers
+	for _, m := range modifiers {
+		before := req.Header.Clone()
+		done := c.observeModifier(ctx, t, m.name, "request", "request")
+		err := m.ModifyRequest(req)
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+		t.headerChanges(m.name, before, req.Header)
+	}
+	if err := c.modifyRequestBody(ctx, req, modifiers, t); err != nil {
+		return nil, err
+	}
+
+	t.emit(events.TypeRequest, req.Method+" "+req.URL.String(), nil)
+	start := time.Now()
+	_, span := c.startSpan(ctx, req.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", req.URL.String()),
+		attribute.String("server.address", u.Hostname()),
+	))
+	resp, err := client.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		span.End()
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	span.End()
+	c.Metrics.Upstream(u.Hostname(), time.Since(start))
+	if len(redirects.captured) > 0 {
+		resp.Header["Set-Cookie"] = append(redirects.captured, resp.Header["Set-Cookie"]...)
+	}
+	before := resp.Header.Clone()
+	normalizeHeaders(resp.Header)
+	rewriteLocation(resp, req, opts.ProxyPrefix)
+	if rule.Cookies {
+		cookieURL := u
+		if resp.Request != nil && resp.Request.URL.String() != fetchURL {
+			cookieURL = resp.Request.URL
+		}
+		rewriteSetCookies(resp, cookieURL, opts.ProxyOrigin, opts.ProxyPrefix)
+	}
+	t.headerChanges("normalization", before, resp.Header)
+
+	if passthrough = canPassthrough(opts, rule, resp); passthrough {
+		bodyTimeout := timeouts.Body
+		if isEventStream(resp) {
+			// event streams last as long as the page is open
+			bodyTimeout = 0
+		}
+		if req.Method == http.MethodHead && opts.Format != FormatRaw && (modifiesBody(rule) || !isBinary(resp)) {
+			// the length of the rewritten page isn't known without fetching it
+			resp.ContentLength = -1
+		}
+		t.emit(events.TypeResponse, resp.Status, map[string]string{
+			"contentType": resp.Header.Get("Content-Type"),
+			"bytes":       strconv.FormatInt(resp.ContentLength, 10),
+			"passthrough": "true",
+		})
+		if rule.Headers.CSP != "" {
+			resp.Header.Set("Content-Security-Policy", rule.Headers.CSP)
+		}
+		return &Result{
+			URL:      fetchURL,
+			Request:  req,
+			Response: resp,
+			Rule:     rule,
+			Format:   opts.Format,
+			Body:     newStreamBody(resp.Body, bodyTimeout, cancel),
+		}, nil
+	}
+	if c.MaxBodySize > 0 && resp.ContentLength > c.MaxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s is %d bytes, over the limit of %d bytes", ErrBodyTooLarge, fetchURL, resp.ContentLength, c.MaxBodySize)
+	}
+	before = resp.Header.Clone()
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	t.headerChanges("decoding", before, resp.Header)
+	defer resp.Body.Close()
+
+	// the body is read into a pooled buffer, every use of it below copies it into a string
+	buf := getBuffer()
+	defer putBuffer(buf)
+	bodyB, err := readBody(buf, resp, timeouts.Body, c.MaxBodySize, cancel)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBodySize > 0 && int64(len(bodyB)) > c.MaxBodySize {
+		return nil, fmt.Errorf("%w: %s is over the limit of %d bytes", ErrBodyTooLarge, fetchURL, c.MaxBodySize)
+	}
+
+	t.emit(events.TypeResponse, resp.Status, map[string]string{
+		"contentType": resp.Header.Get("Content-Type"),
+		"bytes":       strconv.Itoa(len(bodyB)),
+	})
+
+	rawBody := bodyB
+	if opts.Format == FormatRaw {
+		// raw responses are returned as received, response modifiers included
+		modifiers = nil
+	}
+	for _, m := range modifiers {
+		before := resp.Header.Clone()
+		done := c.observeModifier(ctx, t, m.name, "response", "response")
+		bodyB, err = m.ModifyResponse(resp, bodyB)
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+		t.headerChanges(m.name, before, resp.Header)
+	}
+
+	if rule.Headers.CSP != "" {
+		resp.Header.Set("Content-Security-Policy", rule.Headers.CSP)
+	}
+
+	result := &Result{
+		URL:      fetchURL,
+		Request:  req,
+		Response: resp,
+		Rule:     rule,
+		Format:   opts.Format,
+	}
+	blockageBody := ""
+	if isHTML(resp) {
+		blockageBody = string(bodyB)
+	}
+	result.Blockage = DetectBlockage(resp.StatusCode, resp.Header, blockageBody)
+	if opts.strategy != "" {
+		result.failure = strategyFailure(result.Blockage, resp, bodyB)
+	}
+	switch opts.Format {
+	case FormatHTML, FormatRaw:
+		if isHTML(resp) {
+			result.Metadata = extractMetadata(string(bodyB))
+		}
+		switch {
+		case opts.Format == FormatRaw:
+			result.Content = string(rawBody)
+		case isBinary(resp):
+			// binary bodies are never rewritten, only modifiers may change them
+			result.Content = string(bodyB)
+		default:
+			pageURL := u
+			if resp.Request != nil && resp.Request.URL.String() != fetchURL {
+				// relative links of redirected pages are relative to the redirect target
+				pageURL = resp.Request.URL
+			}
+			if isFeed(resp, bodyB) {
+				// injections apply to HTML documents only
+				result.Content = applyRegexRules(rewriteFeed(bodyB, pageURL, opts.ProxyOrigin, opts.ProxyPrefix), rule)
+				break
+			}
+			if isCSS(resp) {
+				base := baseURL(pageURL)
+				// injections apply to HTML documents only
+				result.Content = applyRegexRules(rewriteCSS(string(bodyB), &base, opts.ProxyPrefix), rule)
+				break
+			}
+			result.Content = applyRules(rewriteHtml(bodyB, pageURL, opts.ProxyPrefix, newImageRoute(opts.ImagePrefix, rule.Images)), rule, resp.Header)
+		}
+	case FormatText, FormatOutline, FormatMarkdown, FormatArticleText, FormatArticleHTML, FormatFeed:
+		// the body is parsed once, and metadata, text and outline extracted from the same document
+		doc, err := parseDocument(applyRegexRules(string(bodyB), rule))
+		if err != nil {
+			return nil, err
+		}
+		applyDocumentRules(doc, rule, resp.Header)
+		if isHTML(resp) {
+			result.Metadata = metadataFromDocument(doc)
+		}
+		if opts.Format == FormatText {
+			result.Content = textFromDocument(doc)
+			break
+		}
+		if opts.Format == FormatFeed {
+			index := indexFromDocument(doc, u.String(), result.Metadata)
+			result.Index = &index
+			// feed readers don't resolve relative links
+			content, err := index.RSS(opts.ProxyOrigin + opts.ProxyPrefix)
+			if err != nil {
+				return nil, err
+			}
+			result.Content = content
+			break
+		}
+
+		outline := outlineFromDocument(doc, u.String(), result.Metadata)
+		result.Outline = &outline
+		switch opts.Format {
+		case FormatMarkdown:
+			result.Content = outline.Markdown()
+			return result, nil
+		case FormatArticleText:
+			result.Content = outline.PlainText()
+			return result, nil
+		case FormatArticleHTML:
+			result.Content = outline.HTML()
+			return result, nil
+		}
+		content, err := marshalJSON(outline)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = content
+	case FormatMetadata:
+		// the body is neither rewritten nor extracted, the metadata are in its head
+		md := newPageMetadata(u.String())
+		if isHTML(resp) {
+			doc, err := parseDocument(string(bodyB))
+			if err != nil {
+				return nil, err
+			}
+			md = pageMetadataFromDocument(doc, u.String())
+		}
+		result.Metadata = md.Metadata
+		result.PageMetadata = &md
+		content, err := marshalJSON(md)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = content
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", opts.Format)
+	}
+
+	return result, nil
+}
+
+// checkURL checks rawURL with the Guard of c, if set, which also blocks fetching proxyOrigin,
+// the origin of ladder itself, as the request would loop back into ladder.
+func (c *Client) checkURL(rawURL, proxyOrigin string) error {
+	if c.Guard == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if origin, err := url.Parse(proxyOrigin); err == nil && origin.Host != "" && strings.EqualFold(u.Host, origin.Host) {
+		return fmt.Errorf("%w: %s is ladder itself", ssrf.ErrBlocked, u.Host)
+	}
+	return c.Guard.CheckURL(u)
+}
+
+// startSpan starts the span name with the Tracer of c, as a child of the span of ctx, if any, see
+// tracing.Context. Without Tracer, only the fetches of traced contexts are traced.
+func (c *Client) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if c.Tracer == nil {
+		return tracing.Start(ctx, name, opts...)
+	}
+	return c.Tracer.Start(tracing.Context(ctx), name, opts...)
+}
+
+// allowURL checks u, requested by a page rendered in the browser, with the guard of c, if set.
+// Its host is resolved only when the browser connects by itself: otherwise its connections are
+// made by Browser.Dial, which checks the addresses it connects to, rather than those resolved here
+// that the browser could resolve differently.
+func (c *Client) allowURL(ctx context.Context, u *url.URL) error {
+	if c.Guard == nil {
+		return nil
+	}
+	if err := c.Guard.CheckURL(u); err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if c.Guard.AllowsHost(host) || net.ParseIP(host) != nil || c.Browser.Dial != nil {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if err := c.Guard.CheckIP(host, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBody reads the body of resp into buf, cancelling its request with cancel if reading takes longer than timeout.
+// If limit is positive, no more than limit+1 bytes are read, so that callers can tell bodies over the limit.
+func readBody(buf *bytes.Buffer, resp *http.Response, timeout time.Duration, limit int64, cancel context.CancelFunc) ([]byte, error) {
+	var r io.Reader = resp.Body
+	if limit > 0 {
+		r = io.LimitReader(resp.Body, limit+1)
+	}
+	if timeout <= 0 {
+		return readAll(buf, r, resp.ContentLength)
+	}
+
+	timer := time.AfterFunc(timeout, cancel)
+	body, err := readAll(buf, r, resp.ContentLength)
+	if !timer.Stop() {
+		return nil, fmt.Errorf("reading response body timed out after %s", timeout)
+	}
+	return body, err
+}
+
+// hostPins returns the pins of hosts of c and rule, as transport.Options.Hosts. The pins of the
+// rule replace those of c for the same hosts.
+func (c *Client) hostPins(rule ruleset.Rule) (string, error) {
+	if len(c.Resolve) == 0 && len(rule.Resolve) == 0 {
+		return "", nil
+	}
+	hosts, err := resolver.ParseHosts(c.Resolve)
+	if err != nil {
+		return "", err
+	}
+	ruleHosts, err := resolver.ParseHosts(rule.Resolve)
+	if err != nil {
+		return "", err
+	}
+	maps.Copy(hosts, ruleHosts)
+	return resolver.FormatHosts(hosts), nil
+}
+
+// setHeaders sets the User-Agent, X-Forwarded-For, Referer and Cookie headers of req,
+// preferring the values of rule over the defaults of the Client.
+func (c *Client) setHeaders(req *http.Request, u *url.URL, rule ruleset.Rule) {
+	// the headers of the rule override those of the crawler it masquerades as, which override those of the Client
+	m := masquerades[strings.ToLower(rule.Headers.Masquerade)]
+	if rule.Headers.UserAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent(rule.Headers.UserAgent, u))
+	} else if m.userAgent != "" {
+		req.Header.Set("User-Agent", m.userAgent)
+	} else {
+		req.Header.Set("User-Agent", c.userAgent(c.UserAgent, u))
+	}
+
+	if rule.Headers.XForwardedFor != "" {
+		if rule.Headers.XForwardedFor != "none" {
+			req.Header.Set("X-Forwarded-For", forwardedFor(rule.Headers.XForwardedFor))
+		}
+	} else if m.forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor(m.forwardedFor))
+	} else {
+		req.Header.Set("X-Forwarded-For", forwardedFor(c.ForwardedFor))
+	}
+
+	if rule.Headers.Referer != "" {
+		if rule.Headers.Referer != "none" {
+			req.Header.Set("Referer", rule.Headers.Referer)
+		}
+	} else if m.referer != "" {
+		req.Header.Set("Referer", m.referer)
+	} else {
+		req.Header.Set("Referer", u.String())
+	}
+
+	if rule.Headers.Cookie != "" {
+		req.Header.Set("Cookie", rule.Headers.Cookie)
+	}
+}
+
+// forwardedFor returns the X-Forwarded-For address addr, or if it names a crawler, eg:
+// googlebot, a random address of its published ranges, see botips.Get.
+func forwardedFor(addr string) string {
+	if pool := botips.Get(addr); pool != nil {
+		return pool.Addr()
+	}
+	return addr
+}
+
+// StringInSlice reports whether s starts with any of the strings in list.
+func StringInSlice(s string, list []string) bool {
+	for _, x := range list {
+		if strings.HasPrefix(s, x) {
+			return true
+		}
+	}
+	return false
+}
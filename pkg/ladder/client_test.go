@@ -0,0 +1,720 @@
+package ladder
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ladder/pkg/metrics"
+	"ladder/pkg/proxypool"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/ssrf"
+	"ladder/pkg/stats"
+	"ladder/pkg/tor"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// TestFetchConcurrent checks that concurrent fetches don't share request state.
+func TestFetchConcurrent(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>page " + r.URL.Path + " " + r.Header.Get("X-Request") + "</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: "article"}}}
+	rule.Lua.Request = `request.headers["X-Request"] = request.url`
+	client := NewClient(ruleset.RuleSet{rule})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := "/" + strconv.Itoa(i)
+			result, err := client.Fetch(context.Background(), upstream.URL+path, FetchOptions{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "<p>article "+path+" "+upstream.URL+path+"</p>", result.Content)
+
+			// the rule of a result is a copy
+			result.Rule.RegexRules[0].Replace = "changed"
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, client.Rules, 1)
+	assert.Equal(t, "article", client.Rules[0].RegexRules[0].Replace)
+}
+
+// TestSetRules checks that the rules can be replaced while fetches are in flight.
+func TestSetRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>page</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rules := func(replace string) ruleset.RuleSet {
+		return ruleset.RuleSet{{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: replace}}}}
+	}
+	client := NewClient(rules("article"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+			if assert.NoError(t, err) {
+				assert.Contains(t, []string{"<p>article</p>", "<p>story</p>"}, result.Content)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			client.SetRules(rules("story"))
+		}()
+	}
+	wg.Wait()
+
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>story</p>", result.Content)
+	assert.Equal(t, "story", client.RuleSet()[0].RegexRules[0].Replace)
+}
+
+func TestAllowRuleDomains(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<p>page</p>"))
+	}))
+	defer upstream.Close()
+
+	client := NewClient(ruleset.RuleSet{{Domain: "www.example.com"}})
+	client.AllowedDomains = []string{""}
+	client.AllowRuleDomains = true
+	_, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.ErrorIs(t, err, ErrNotAllowed)
+
+	// the domains of the rules follow their reloads
+	client.SetRules(ruleset.RuleSet{{Domains: []string{"127.0.0.1"}}})
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.NoError(t, err)
+	client.SetRules(ruleset.RuleSet{{Domain: "www.example.com"}})
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.ErrorIs(t, err, ErrNotAllowed)
+
+	// glob and regex domains match like they do for rules
+	client.SetRules(ruleset.RuleSet{{Domain: "127.0.0.*"}})
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.NoError(t, err)
+	client.SetRules(ruleset.RuleSet{{Domain: `~^127\.0\.0\.1$`}})
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.NoError(t, err)
+}
+
+func TestFetchTLSFingerprint(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	client := NewClient(nil)
+	client.TLSFingerprint = "netscape"
+	_, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.ErrorContains(t, err, "unknown TLS fingerprint 'netscape'")
+
+	// rules override the fingerprint of the client
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.TLS.Fingerprint = "chrome"
+	client.Rules = ruleset.RuleSet{rule}
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "chrome", result.Rule.TLS.Fingerprint)
+}
+
+func TestFetchProxyPool(t *testing.T) {
+	var proxied []string
+	var mu sync.Mutex
+	newProxy := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			proxied = append(proxied, name+" "+r.RequestURI)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>via " + name + "</p>"))
+		}))
+	}
+	first, second := newProxy("first"), newProxy("second")
+	defer first.Close()
+	defer second.Close()
+
+	pool, err := proxypool.New([]string{first.URL, second.URL}, proxypool.Options{})
+	require.NoError(t, err)
+	client := NewClient(nil)
+	client.Proxies = pool
+	client.Guard = &ssrf.Guard{}
+	for _, want := range []string{"<p>via first</p>", "<p>via second</p>"} {
+		result, err := client.Fetch(context.Background(), "http://www.example.com/article", FetchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, want, result.Content)
+	}
+	assert.Equal(t, []string{"first http://www.example.com/article", "second http://www.example.com/article"}, proxied)
+}
+
+func TestFetchTor(t *testing.T) {
+	client := NewClient(ruleset.RuleSet{{Domain: "www.example.com", Tor: true}})
+	_, err := client.Fetch(context.Background(), "http://www.example.com/article", FetchOptions{})
+	assert.ErrorContains(t, err, "through Tor, which is not configured")
+
+	// requests go to the SOCKS port of Tor, closed here
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l.Close()
+	client.Tor = tor.New(l.Addr().String(), "", "")
+	_, err = client.Fetch(context.Background(), "http://www.example.com/article", FetchOptions{})
+	assert.ErrorContains(t, err, "proxyconnect tcp: dial tcp "+l.Addr().String())
+}
+
+func TestFetchTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-header" {
+			<-release
+		}
+		w.Write([]byte("<p>start</p>"))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/slow-body" {
+			<-release
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, Paths: []string{"/slow-header"}}
+	rule.Timeouts.ResponseHeader = 50 * time.Millisecond
+	client := NewClient(ruleset.RuleSet{rule})
+	client.Timeouts.Body = 50 * time.Millisecond
+
+	_, err := client.Fetch(context.Background(), upstream.URL+"/slow-header", FetchOptions{})
+	assert.ErrorContains(t, err, "timeout awaiting response headers")
+
+	_, err = client.Fetch(context.Background(), upstream.URL+"/slow-body", FetchOptions{})
+	assert.ErrorContains(t, err, "reading response body timed out after 50ms")
+
+	result, err := client.Fetch(context.Background(), upstream.URL+"/fast", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>start</p>", result.Content)
+}
+
+func TestFetchPassthrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/image.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Write([]byte("page content"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: "article"}}}
+	client := NewClient(ruleset.RuleSet{rule})
+
+	result, err := client.Fetch(context.Background(), upstream.URL+"/image.png", FetchOptions{Passthrough: true})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, "page content", string(body))
+	assert.Empty(t, result.Content)
+
+	for _, path := range []string{"/image.svg", "/index.html"} {
+		result, err = client.Fetch(context.Background(), upstream.URL+path, FetchOptions{Passthrough: true})
+		require.NoError(t, err)
+		assert.Nil(t, result.Body, path)
+		assert.Equal(t, "article content", result.Content, path)
+	}
+
+	// response scripts may modify any body
+	client.Rules[0].Lua.Response = `response.body = response.body .. "!"`
+	result, err = client.Fetch(context.Background(), upstream.URL+"/image.png", FetchOptions{Passthrough: true})
+	require.NoError(t, err)
+	assert.Nil(t, result.Body)
+	assert.Equal(t, "page content!", result.Content)
+
+	// raw responses skip response modifiers and rules, and stream whatever their type
+	for _, path := range []string{"/image.png", "/index.html"} {
+		result, err = client.Fetch(context.Background(), upstream.URL+path, FetchOptions{Format: FormatRaw, Passthrough: true})
+		require.NoError(t, err)
+		require.NotNil(t, result.Body, path)
+		body, err = io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, "page content", string(body), path)
+	}
+	result, err = client.Fetch(context.Background(), upstream.URL+"/index.html", FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, "page content", result.Content)
+}
+
+func TestFetchBinaryByteExact(t *testing.T) {
+	// invalid UTF-8 and markup that rewriting would corrupt
+	binary := "\xff\xfe\x00<img src=\"/a\"> href=\"/b\" url(/c)\x80"
+	types := map[string]string{
+		"/multipart":    "multipart/byteranges; boundary=3d6b6a416f9b5",
+		"/octet-stream": "application/octet-stream",
+		"/pdf":          "application/pdf",
+		"/video":        "video/mp4",
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", types[r.URL.Path])
+		w.Write([]byte(binary))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "href", Replace: "corrupted"}}}
+	client := NewClient(ruleset.RuleSet{rule})
+
+	for path, contentType := range types {
+		t.Run(path, func(t *testing.T) {
+			result, err := client.Fetch(context.Background(), upstream.URL+path, FetchOptions{Passthrough: true})
+			require.NoError(t, err)
+			require.NotNil(t, result.Body)
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			assert.Equal(t, binary, string(body))
+			assert.Equal(t, contentType, result.Response.Header.Get("Content-Type"))
+
+			// buffered responses are not rewritten either
+			result, err = client.Fetch(context.Background(), upstream.URL+path, FetchOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, binary, result.Content)
+		})
+	}
+}
+
+func TestFetchStats(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<div class="paywall">Subscribe</div>`))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, Paths: []string{"/bypassed"}, RegexRules: []ruleset.Regex{{Match: `class="paywall"`, Replace: ""}}}
+	client := NewClient(ruleset.RuleSet{rule})
+	client.Stats = stats.NewRecorder()
+
+	_, err := client.Fetch(context.Background(), upstream.URL+"/bypassed", FetchOptions{})
+	require.NoError(t, err)
+	_, err = client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	_, err = client.Fetch(context.Background(), "http://127.0.0.1:1/article", FetchOptions{})
+	require.Error(t, err)
+
+	assert.Equal(t, []stats.DomainStats{
+		{Domain: "127.0.0.1:1", Total: 1, Error: 1},
+		{Domain: u.Host, Total: 2, Success: 1, Paywall: 1, SuccessRate: 0.5},
+	}, client.Stats.Snapshot(time.Hour))
+}
+
+func TestFetchMetrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/paywalled" {
+			w.Write([]byte(`<div class="paywall">Subscribe</div>`))
+			return
+		}
+		w.Write([]byte("<p>article</p>"))
+	}))
+	defer upstream.Close()
+
+	client := NewClient(nil)
+	client.Strategies = []string{StrategyDirect}
+	client.Metrics = metrics.New()
+	_, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	_, err = client.Fetch(context.Background(), upstream.URL+"/paywalled", FetchOptions{})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	client.Metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `ladder_upstream_duration_seconds_count{domain="127.0.0.1"} 2`)
+	assert.Contains(t, rec.Body.String(), `ladder_strategy_fetches_total{outcome="success",strategy="direct"} 1`)
+	assert.Contains(t, rec.Body.String(), `ladder_strategy_fetches_total{outcome="blocked",strategy="direct"} 1`)
+}
+
+func TestFetchGuard(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("internal"))
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	client := NewClient(nil)
+	client.Guard, _ = ssrf.NewGuard(nil)
+
+	for _, rawURL := range []string{upstream.URL, "http://localhost:" + port, "file:///etc/passwd"} {
+		_, err := client.Fetch(context.Background(), rawURL, FetchOptions{})
+		assert.ErrorIs(t, err, ssrf.ErrBlocked, rawURL)
+	}
+
+	client.Guard, _ = ssrf.NewGuard([]string{"127.0.0.1", "localhost"})
+	result, err := client.Fetch(context.Background(), "http://localhost:"+port, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "internal", result.Content)
+
+	// redirects are checked too
+	_, err = client.Fetch(context.Background(), upstream.URL+"/redirect", FetchOptions{})
+	assert.ErrorIs(t, err, ssrf.ErrBlocked)
+
+	// and so is ladder itself, whatever the guard allows
+	_, err = client.Fetch(context.Background(), "http://localhost:"+port, FetchOptions{ProxyOrigin: "http://LOCALHOST:" + port})
+	assert.ErrorContains(t, err, "destination blocked: localhost:"+port+" is ladder itself")
+}
+
+func TestFetchRedirects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/older", http.StatusMovedPermanently)
+		case "/older":
+			http.Redirect(w, r, "/new?page=2", http.StatusFound)
+		default:
+			w.Write([]byte("page " + r.URL.RequestURI()))
+		}
+	}))
+	defer upstream.Close()
+
+	client := NewClient(nil)
+	result, err := client.Fetch(context.Background(), upstream.URL+"/old", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, result.Response.StatusCode)
+	assert.Equal(t, "page /new?page=2", result.Content)
+
+	// redirects beyond the limit are returned, routed through the proxy
+	client.MaxRedirects = 1
+	result, err = client.Fetch(context.Background(), upstream.URL+"/old", FetchOptions{ProxyPrefix: "/ladder/"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, result.Response.StatusCode)
+	assert.Equal(t, "/ladder/"+upstream.URL+"/new?page=2", result.Response.Header.Get("Location"))
+
+	client.MaxRedirects = 0
+	result, err = client.Fetch(context.Background(), upstream.URL+"/old", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, result.Response.StatusCode)
+	assert.Equal(t, "/"+upstream.URL+"/older", result.Response.Header.Get("Location"))
+}
+
+func TestFetchRetry(t *testing.T) {
+	requests := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	// requests are sent once by default
+	client := NewClient(nil)
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, result.Response.StatusCode)
+
+	requests = 0
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Retry = ruleset.Retry{Attempts: 2, Backoff: time.Millisecond}
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result.Content)
+	assert.Equal(t, 2, requests)
+}
+
+func TestFetchRedirectPolicy(t *testing.T) {
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			if _, err := r.Cookie("consent"); err != nil {
+				http.Redirect(w, r, "/consent", http.StatusFound)
+				return
+			}
+			w.Write([]byte("article"))
+		case "/consent":
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes"})
+			http.Redirect(w, r, "/article", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, "http://localhost/", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/proxy":
+			http.Redirect(w, r, "https://ladder.example.com/"+upstream.URL+"/article", http.StatusFound)
+		}
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	client := NewClient(nil)
+	_, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{Format: FormatRaw})
+	assert.ErrorIs(t, err, ErrRedirectLoop)
+
+	// the cookie set by the consent page is sent back to the article and passed on
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Redirects.Cookies = true
+	client.Rules = ruleset.RuleSet{rule}
+	result, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, "article", result.Content)
+	assert.Equal(t, []string{"consent=yes"}, result.Response.Header.Values("Set-Cookie"))
+
+	rule.Redirects.SameOrigin = true
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL+"/elsewhere", FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, result.Response.StatusCode)
+	assert.Equal(t, "/http://localhost/", result.Response.Header.Get("Location"))
+
+	_, err = client.Fetch(context.Background(), upstream.URL+"/loop", FetchOptions{Format: FormatRaw})
+	assert.ErrorIs(t, err, ErrRedirectLoop)
+
+	rule.Redirects.Max = -1
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, result.Response.StatusCode)
+
+	_, err = NewClient(nil).Fetch(context.Background(), upstream.URL+"/proxy", FetchOptions{ProxyOrigin: "https://ladder.example.com"})
+	assert.ErrorContains(t, err, "redirects back into the proxy")
+}
+
+func TestFetchResolve(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	pageURL := "http://news.invalid:" + port + "/"
+
+	client := NewClient(nil)
+	client.Resolve = []string{"news.invalid:127.0.0.1"}
+	result, err := client.Fetch(context.Background(), pageURL, FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, "news.invalid:"+port, result.Content)
+
+	// the pins of a rule replace those of the client for the same host
+	client.Resolve = []string{"news.invalid:192.0.2.1"}
+	client.Rules = ruleset.RuleSet{{Domain: "news.invalid:" + port, Resolve: []string{"news.invalid:127.0.0.1"}}}
+	result, err = client.Fetch(context.Background(), pageURL, FetchOptions{Format: FormatRaw})
+	require.NoError(t, err)
+	assert.Equal(t, "news.invalid:"+port, result.Content)
+
+	client.Rules = ruleset.RuleSet{{Domain: "news.invalid:" + port, Resolve: []string{"news.invalid"}}}
+	_, err = client.Fetch(context.Background(), pageURL, FetchOptions{Format: FormatRaw})
+	assert.ErrorContains(t, err, "invalid host pin 'news.invalid'")
+}
+
+func TestFetchMethods(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>" + r.Method + " " + r.Header.Get("Origin") + " " + r.Header.Get("Content-Type") + " " + string(body) + "</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	// bodies are streamed, with the origin of the site
+	client := NewClient(nil)
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{
+		Format: FormatText, Method: http.MethodPut, Body: strings.NewReader(`{"q":"news"}`), ContentType: "application/json",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "PUT "+upstream.URL+" application/json {\"q\":\"news\"}", result.Content)
+
+	// form fields are rewritten by the modifiers of the rule
+	var rules ruleset.RuleSet
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- domain: `+u.Host+`
+  modifiers:
+    - name: setFormField
+      params: [lang, en]
+`), &rules))
+	client = NewClient(rules)
+	body := "q=news&lang=fr"
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{
+		Format: FormatText, Method: http.MethodPost, Body: strings.NewReader(body), ContentLength: int64(len(body)),
+		ContentType: "application/x-www-form-urlencoded",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "POST "+upstream.URL+" application/x-www-form-urlencoded lang=en&q=news", result.Content)
+
+	MaxRequestBodySize = 4
+	defer func() { MaxRequestBodySize = 10 << 20 }()
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{
+		Method: http.MethodPost, Body: strings.NewReader(body), ContentType: "application/x-www-form-urlencoded",
+	})
+	assert.ErrorContains(t, err, "request body larger than 4 bytes can't be rewritten by modifier setFormField")
+}
+
+func TestFetchEventStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: " + r.Header.Get("Accept") + "\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: page updated\n\n"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	// event streams are neither buffered, bounded by the body timeout nor modified
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: "article"}}}
+	rule.Lua.Response = `response.body = ""`
+	client := NewClient(ruleset.RuleSet{rule})
+	client.Timeouts.Body = 50 * time.Millisecond
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{Passthrough: true, Accept: "text/event-stream"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	defer result.Body.Close()
+
+	buf := make([]byte, 64)
+	n, err := result.Body.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data: text/event-stream\n\n", string(buf[:n]))
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "data: page updated\n\n", string(body))
+}
+
+func TestFetchRange(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "page.html", time.Time{}, strings.NewReader("<p>page content</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	// partial content is passed through, as rewriting it would break its byte ranges
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: "article"}}}
+	client := NewClient(ruleset.RuleSet{rule})
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{Passthrough: true, Range: "bytes=3-6", IfRange: `"v1"`})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusPartialContent, result.Response.StatusCode)
+	assert.Equal(t, "bytes 3-6/19", result.Response.Header.Get("Content-Range"))
+	assert.Equal(t, "page", string(body))
+
+	// the whole page is served if it changed
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{Passthrough: true, Range: "bytes=3-6", IfRange: `"v0"`})
+	require.NoError(t, err)
+	assert.Nil(t, result.Body)
+	assert.Equal(t, http.StatusOK, result.Response.StatusCode)
+	assert.Equal(t, "<p>article content</p>", result.Content)
+}
+
+func TestFetchHead(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/video.mp4" {
+			w.Header().Set("Content-Type", "video/mp4")
+		} else {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Header().Set("Content-Length", "1000")
+		if r.Method != http.MethodHead {
+			w.Write(make([]byte, 1000))
+		}
+	}))
+	defer upstream.Close()
+
+	// HEAD responses pass through with their headers, with the length of media only
+	client := NewClient(nil)
+	client.Strategies = DefaultStrategies
+	result, err := client.Fetch(context.Background(), upstream.URL+"/video.mp4", FetchOptions{Passthrough: true, Method: http.MethodHead})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.MethodHead, result.Request.Method)
+	assert.Equal(t, int64(1000), result.Response.ContentLength)
+	assert.Equal(t, "video/mp4", result.Response.Header.Get("Content-Type"))
+
+	result, err = client.Fetch(context.Background(), upstream.URL+"/index.html", FetchOptions{Passthrough: true, Method: http.MethodHead})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, int64(-1), result.Response.ContentLength)
+	assert.Equal(t, "text/html", result.Response.Header.Get("Content-Type"))
+}
+
+func TestFetchMaxBodySize(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/chunked":
+			// the length isn't known before reading the body
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>"))
+			w.(http.Flusher).Flush()
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer upstream.Close()
+
+	client := NewClient(nil)
+	client.MaxBodySize = 50
+	for _, path := range []string{"/page", "/chunked"} {
+		_, err := client.Fetch(context.Background(), upstream.URL+path, FetchOptions{})
+		assert.ErrorIs(t, err, ErrBodyTooLarge, path)
+		assert.Equal(t, http.StatusBadGateway, DefaultErrorStatuses.Status(err), path)
+	}
+
+	// streamed bodies are not bounded
+	result, err := client.Fetch(context.Background(), upstream.URL+"/image.png", FetchOptions{Passthrough: true})
+	require.NoError(t, err)
+	require.NotNil(t, result.Body)
+	require.NoError(t, result.Body.Close())
+
+	client.MaxBodySize = 200
+	result, err = client.Fetch(context.Background(), upstream.URL+"/chunked", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content, strings.Repeat("a", 100))
+}
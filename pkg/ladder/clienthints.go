@@ -0,0 +1,184 @@
+package ladder
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ClientHintsAuto as the client hints of the Client or of a rule picks the browser
+// from the User-Agent sent, see Client.ClientHints.
+const ClientHintsAuto = "auto"
+
+// browser is the navigation headers of a browser family.
+type browser struct {
+	// brand is the name of the browser in Sec-CH-UA, empty for browsers not sending client hints.
+	brand          string
+	accept         string
+	acceptLanguage string
+	acceptEncoding string
+	// version is the major version assumed when the User-Agent doesn't tell it.
+	version string
+}
+
+// browsers maps the client hints profiles usable in rules to the headers of their browser.
+var browsers = map[string]browser{
+	"chrome": {
+		brand:          "Google Chrome",
+		accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		acceptLanguage: "en-US,en;q=0.9",
+		acceptEncoding: "gzip, deflate, br, zstd",
+		version:        "140",
+	},
+	"edge": {
+		brand:          "Microsoft Edge",
+		accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		acceptLanguage: "en-US,en;q=0.9",
+		acceptEncoding: "gzip, deflate, br, zstd",
+		version:        "140",
+	},
+	"firefox": {
+		accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		acceptLanguage: "en-US,en;q=0.5",
+		acceptEncoding: "gzip, deflate, br, zstd",
+	},
+	"safari": {
+		accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		acceptLanguage: "en-US,en;q=0.9",
+		acceptEncoding: "gzip, deflate, br",
+	},
+}
+
+var (
+	chromeVersionRegex = regexp.MustCompile(`(?:Chrome|Edg)/(\d+)`)
+	botRegex           = regexp.MustCompile(`(?i)bot|crawler|spider|externalhit`)
+)
+
+// ClientHintsProfiles returns the sorted names of the client hints profiles, along with ClientHintsAuto.
+func ClientHintsProfiles() []string {
+	names := []string{ClientHintsAuto}
+	for name := range browsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateClientHints checks that the client hints profile exists.
+func ValidateClientHints(profile string) error {
+	profile = strings.ToLower(profile)
+	if profile == "" || profile == "none" || profile == ClientHintsAuto {
+		return nil
+	}
+	if _, ok := browsers[profile]; !ok {
+		return fmt.Errorf("unknown client hints profile '%s', available: %s", profile, strings.Join(ClientHintsProfiles(), ", "))
+	}
+	return nil
+}
+
+// browserOf returns the profile of the browser sending userAgent, or an empty string for crawlers and other clients.
+func browserOf(userAgent string) string {
+	switch {
+	case botRegex.MatchString(userAgent) || !strings.HasPrefix(userAgent, "Mozilla/5.0"):
+		return ""
+	case strings.Contains(userAgent, "Edg/"):
+		return "edge"
+	case strings.Contains(userAgent, "Chrome/"):
+		return "chrome"
+	case strings.Contains(userAgent, "Firefox/"):
+		return "firefox"
+	case strings.Contains(userAgent, "Safari/"):
+		return "safari"
+	}
+	return ""
+}
+
+// platformOf returns the platform of userAgent as named by Sec-CH-UA-Platform.
+func platformOf(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		return "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		return "iOS"
+	case strings.Contains(userAgent, "Mac OS X"):
+		return "macOS"
+	case strings.Contains(userAgent, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(userAgent, "Linux"):
+		return "Linux"
+	}
+	return "Windows"
+}
+
+// setClientHints sets the navigation headers a browser sends along with the User-Agent of
+// req, so that origins checking their consistency don't flag the request: Accept and
+// Accept-Language, the Sec-Fetch headers and, for Chromium browsers, the Sec-CH-UA client
+// hints. profile names the browser, or is ClientHintsAuto to pick it from the User-Agent.
+// Headers already set, eg: by the rule, are kept.
+func setClientHints(req *http.Request, profile string) {
+	profile = strings.ToLower(profile)
+	userAgent := req.Header.Get("User-Agent")
+	if profile == ClientHintsAuto {
+		profile = browserOf(userAgent)
+	}
+	b, ok := browsers[profile]
+	if !ok {
+		return
+	}
+
+	set := func(name, value string) {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	set("Accept", b.accept)
+	set("Accept-Language", b.acceptLanguage)
+	set("Accept-Encoding", b.acceptEncoding)
+	set("Upgrade-Insecure-Requests", "1")
+	set("Sec-Fetch-Site", fetchSite(req))
+	set("Sec-Fetch-Mode", "navigate")
+	set("Sec-Fetch-User", "?1")
+	set("Sec-Fetch-Dest", "document")
+	if b.brand == "" {
+		return
+	}
+
+	version := b.version
+	if m := chromeVersionRegex.FindStringSubmatch(userAgent); m != nil {
+		version = m[1]
+	}
+	mobile := "?0"
+	if strings.Contains(userAgent, "Mobile") {
+		mobile = "?1"
+	}
+	set("Sec-CH-UA", fmt.Sprintf(`"%s";v="%s", "Chromium";v="%s", "Not=A?Brand";v="24"`, b.brand, version, version))
+	set("Sec-CH-UA-Mobile", mobile)
+	set("Sec-CH-UA-Platform", `"`+platformOf(userAgent)+`"`)
+	set("Priority", "u=0, i")
+}
+
+// fetchSite returns the Sec-Fetch-Site of a navigation to req from its Referer.
+func fetchSite(req *http.Request) string {
+	referer, err := url.Parse(req.Header.Get("Referer"))
+	if err != nil || referer.Host == "" {
+		return "none"
+	}
+	if referer.Scheme == req.URL.Scheme && referer.Host == req.URL.Host {
+		return "same-origin"
+	}
+	site := func(host string) string {
+		if registrable, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			return registrable
+		}
+		return host
+	}
+	if referer.Scheme == req.URL.Scheme && site(referer.Hostname()) == site(req.URL.Hostname()) {
+		return "same-site"
+	}
+	return "cross-site"
+}
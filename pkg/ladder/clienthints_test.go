@@ -0,0 +1,81 @@
+package ladder
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetClientHints(t *testing.T) {
+	newRequest := func(userAgent, referer string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://www.example.com/article", nil)
+		req.Header.Set("User-Agent", userAgent)
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		return req
+	}
+
+	req := newRequest(DefaultUserAgents[1], "https://www.google.com/")
+	setClientHints(req, ClientHintsAuto)
+	assert.Equal(t, `"Google Chrome";v="140", "Chromium";v="140", "Not=A?Brand";v="24"`, req.Header.Get("Sec-CH-UA"))
+	assert.Equal(t, `"macOS"`, req.Header.Get("Sec-CH-UA-Platform"))
+	assert.Equal(t, "?0", req.Header.Get("Sec-CH-UA-Mobile"))
+	assert.Equal(t, "cross-site", req.Header.Get("Sec-Fetch-Site"))
+	assert.Equal(t, "navigate", req.Header.Get("Sec-Fetch-Mode"))
+	assert.Equal(t, "document", req.Header.Get("Sec-Fetch-Dest"))
+	assert.Equal(t, "en-US,en;q=0.9", req.Header.Get("Accept-Language"))
+
+	req = newRequest(DefaultUserAgents[4], "https://static.example.com/")
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	setClientHints(req, ClientHintsAuto)
+	assert.Empty(t, req.Header.Get("Sec-CH-UA"), "Firefox sends no client hints")
+	assert.Equal(t, "same-site", req.Header.Get("Sec-Fetch-Site"))
+	assert.Equal(t, "de-DE,de;q=0.9", req.Header.Get("Accept-Language"), "headers set already are kept")
+
+	req = newRequest(DefaultUserAgent, "")
+	setClientHints(req, ClientHintsAuto)
+	assert.Empty(t, req.Header.Get("Sec-Fetch-Mode"), "crawlers send no navigation headers")
+
+	req = newRequest(DefaultUserAgent, "")
+	setClientHints(req, "edge")
+	assert.Equal(t, `"Microsoft Edge";v="140", "Chromium";v="140", "Not=A?Brand";v="24"`, req.Header.Get("Sec-CH-UA"))
+	assert.Equal(t, "none", req.Header.Get("Sec-Fetch-Site"))
+
+	assert.ErrorContains(t, ValidateClientHints("opera"), "available: auto, chrome, edge, firefox, safari")
+	assert.NoError(t, ValidateClientHints("none"))
+}
+
+func TestFetchClientHints(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// browsers accept compressed responses, which are decoded before rules apply
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(r.Header.Get("Sec-CH-UA-Platform") + " " + r.Header.Get("Sec-Fetch-Site")))
+		gz.Close()
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Headers.UserAgent = DefaultUserAgents[0]
+	client := NewClient(ruleset.RuleSet{rule})
+	client.ClientHints = ClientHintsAuto
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, `"Windows" same-origin`, result.Content)
+
+	rule.Headers.ClientHints = "none"
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, " ", result.Content)
+}
@@ -0,0 +1,54 @@
+package ladder
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// rewriteSetCookies scopes the cookies set by resp, the response to the page u, to the
+// path of the site on the ladder instance serving under origin and prefix, eg: a session
+// cookie of www.example.com set for / is set for /https://www.example.com/ instead, so that
+// the browser sends it back with the requests of that site only, see FetchOptions.Cookie.
+// Their Domain is dropped, and so is their Secure attribute when origin is not HTTPS.
+// Cookies with the __Host- prefix can't be scoped to a path and are dropped.
+func rewriteSetCookies(resp *http.Response, u *url.URL, origin string, prefix string) {
+	cookies := resp.Cookies()
+	resp.Header.Del("Set-Cookie")
+	secure := !strings.HasPrefix(origin, "http://")
+	site := prefix + u.Scheme + "://" + u.Host
+	for _, cookie := range cookies {
+		if strings.HasPrefix(cookie.Name, "__Host-") {
+			continue
+		}
+		path := cookie.Path
+		if !strings.HasPrefix(path, "/") {
+			path = defaultCookiePath(u.EscapedPath())
+		}
+		cookie.Path = site + path
+		cookie.Domain = ""
+		if !secure {
+			cookie.Secure = false
+			if cookie.SameSite == http.SameSiteNoneMode {
+				// browsers reject cookies with SameSite=None that are not Secure
+				cookie.SameSite = http.SameSiteLaxMode
+			}
+			if strings.HasPrefix(cookie.Name, "__Secure-") {
+				continue
+			}
+		}
+		if value := cookie.String(); value != "" {
+			resp.Header.Add("Set-Cookie", value)
+		}
+	}
+}
+
+// defaultCookiePath returns the path of the cookies set without one by the page at path,
+// its directory, see RFC 6265 section 5.1.4.
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
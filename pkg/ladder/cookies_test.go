@@ -0,0 +1,177 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"ladder/pkg/jar"
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteSetCookies(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/news/article")
+	newResponse := func() *http.Response {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Add("Set-Cookie", "session=abc; Domain=.example.com; Path=/; Secure; HttpOnly")
+		resp.Header.Add("Set-Cookie", "consent=yes; SameSite=None; Secure")
+		resp.Header.Add("Set-Cookie", "__Host-token=1; Path=/; Secure")
+		resp.Header.Add("Set-Cookie", "__Secure-id=2; Path=/; Secure")
+		return resp
+	}
+
+	resp := newResponse()
+	rewriteSetCookies(resp, u, "https://ladder.example.org", "/")
+	assert.Equal(t, []string{
+		"session=abc; Path=/https://www.example.com/; HttpOnly; Secure",
+		"consent=yes; Path=/https://www.example.com/news; Secure; SameSite=None",
+		"__Secure-id=2; Path=/https://www.example.com/; Secure",
+	}, resp.Header.Values("Set-Cookie"))
+
+	resp = newResponse()
+	rewriteSetCookies(resp, u, "http://localhost:8080", "/")
+	assert.Equal(t, []string{
+		"session=abc; Path=/https://www.example.com/; HttpOnly",
+		"consent=yes; Path=/https://www.example.com/news; SameSite=Lax",
+	}, resp.Header.Values("Set-Cookie"))
+}
+
+func TestDefaultCookiePath(t *testing.T) {
+	for path, want := range map[string]string{"": "/", "/": "/", "/a": "/", "/a/b": "/a", "/a/b/": "/a/b"} {
+		assert.Equal(t, want, defaultCookiePath(path), path)
+	}
+}
+
+func TestFetchCookies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := r.Cookie("consent"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/"})
+			w.Write([]byte("<p>consent wall</p>"))
+			return
+		}
+		w.Write([]byte("<p>article " + r.Header.Get("Cookie") + "</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, Cookies: true}
+	rule.Headers.Cookie = "plan=free"
+	client := NewClient(ruleset.RuleSet{rule})
+
+	result, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{ProxyOrigin: "http://localhost:8080"})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>consent wall</p>", result.Content)
+	assert.Equal(t, []string{"consent=yes; Path=/" + upstream.URL + "/"}, result.ForwardedHeaders().Values("Set-Cookie"))
+
+	result, err = client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{Cookie: "consent=yes"})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>article plan=free; consent=yes</p>", result.Content)
+
+	// cookies are not forwarded unless the rule says so
+	result, err = NewClient(nil).Fetch(context.Background(), upstream.URL+"/article", FetchOptions{Cookie: "consent=yes"})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>consent wall</p>", result.Content)
+	assert.Empty(t, result.ForwardedHeaders().Values("Set-Cookie"))
+}
+
+func TestFetchCookieJar(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if _, err := r.Cookie("consent"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "consent", Value: "yes", Path: "/"})
+			w.Write([]byte("<p>consent wall</p>"))
+			return
+		}
+		w.Write([]byte("<p>article</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	client := NewClient(ruleset.RuleSet{{Domain: u.Host, CookieJar: true}})
+	result, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>consent wall</p>", result.Content)
+	result, err = client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>article</p>", result.Content)
+
+	// the jar is only used for the sites whose rule sets it
+	client = NewClient(nil)
+	for i := 0; i < 2; i++ {
+		result, err = client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "<p>consent wall</p>", result.Content)
+	}
+}
+
+func TestFetchImportedCookies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "subscriber" {
+			w.Write([]byte("<p>paywall</p>"))
+			return
+		}
+		w.Write([]byte("<p>article</p>"))
+	}))
+	defer upstream.Close()
+
+	j, err := jar.New("")
+	require.NoError(t, err)
+	_, err = j.Import(strings.NewReader("127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tsubscriber\n"))
+	require.NoError(t, err)
+
+	// imported cookies are sent whatever the rule of their site
+	client := NewClient(nil)
+	client.Jar = j
+	result, err := client.Fetch(context.Background(), upstream.URL+"/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>article</p>", result.Content)
+}
+
+// TestFetchImportedCookiesConcurrent checks, with -race, that concurrent fetches share the jar
+// of the client without racing on it.
+func TestFetchImportedCookiesConcurrent(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		http.SetCookie(w, &http.Cookie{Name: "visit", Value: r.URL.Path})
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "subscriber" {
+			w.Write([]byte("<p>paywall</p>"))
+			return
+		}
+		w.Write([]byte("<p>article</p>"))
+	}))
+	defer upstream.Close()
+
+	client := NewClient(ruleset.RuleSet{{Domain: "localhost", CookieJar: true}})
+	j, ok := client.Jar.(*jar.Jar)
+	require.True(t, ok)
+	_, err := j.Import(strings.NewReader("127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tsubscriber\n"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			host := upstream.URL
+			if i%2 == 1 {
+				// sites of a rule setting cookieJar, without imported cookies
+				host = strings.Replace(upstream.URL, "127.0.0.1", "localhost", 1)
+			}
+			result, err := client.Fetch(context.Background(), host+"/"+strconv.Itoa(i), FetchOptions{})
+			if assert.NoError(t, err) && i%2 == 0 {
+				assert.Equal(t, "<p>article</p>", result.Content)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,94 @@
+package ladder
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// cspNonceRegex matches the nonce sources of a Content-Security-Policy directive.
+	cspNonceRegex = regexp.MustCompile(`'nonce-([A-Za-z0-9+/=_-]+)'`)
+	// scriptEndRegex matches the end tags that would close an injected script early.
+	scriptEndRegex = regexp.MustCompile(`(?i)</(script)`)
+)
+
+// cspMetaSelector selects the Content-Security-Policy meta elements of a page.
+const cspMetaSelector = `meta[http-equiv="Content-Security-Policy" i]`
+
+// scriptDirective returns the sources of the directive of policy governing script
+// elements, and whether policy has one.
+func scriptDirective(policy string) (string, bool) {
+	directives := map[string]string{}
+	for _, directive := range strings.Split(policy, ";") {
+		name, sources, _ := strings.Cut(strings.TrimSpace(directive), " ")
+		name = strings.ToLower(name)
+		if _, ok := directives[name]; !ok && name != "" {
+			directives[name] = sources
+		}
+	}
+	for _, name := range []string{"script-src-elem", "script-src", "default-src"} {
+		if sources, ok := directives[name]; ok {
+			return sources, true
+		}
+	}
+	return "", false
+}
+
+// cspNonce returns the script nonce of policy, if any.
+func cspNonce(policy string) string {
+	sources, _ := scriptDirective(policy)
+	if m := cspNonceRegex.FindStringSubmatch(sources); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// allowsInlineScripts reports whether policy lets inline scripts without nonce run.
+// 'unsafe-inline' is ignored by browsers when nonces, hashes or 'strict-dynamic' are present.
+func allowsInlineScripts(policy string) bool {
+	sources, ok := scriptDirective(policy)
+	if !ok {
+		return true
+	}
+	sources = strings.ToLower(sources)
+	return strings.Contains(sources, "'unsafe-inline'") &&
+		!strings.Contains(sources, "'nonce-") && !strings.Contains(sources, "'sha") && !strings.Contains(sources, "'strict-dynamic'")
+}
+
+// injectScript appends js as a script element to the elements of doc matching position,
+// the body by default. The script carries the nonce of the Content-Security-Policy of the
+// page, from header or its meta elements, if there is one. Otherwise the policies blocking
+// inline scripts are removed: the meta elements, and the header if stripHeader is set.
+func injectScript(doc *goquery.Document, position, js string, header http.Header, stripHeader bool) {
+	if position == "" {
+		position = "body"
+	}
+	policies := header.Values("Content-Security-Policy")
+	doc.Find(cspMetaSelector).Each(func(_ int, s *goquery.Selection) {
+		policies = append(policies, s.AttrOr("content", ""))
+	})
+
+	nonce := ""
+	blocked := false
+	for _, policy := range policies {
+		if n := cspNonce(policy); n != "" && nonce == "" {
+			nonce = n
+		}
+		blocked = blocked || !allowsInlineScripts(policy)
+	}
+
+	script := "<script>"
+	if nonce != "" {
+		script = `<script nonce="` + html.EscapeString(nonce) + `">`
+	} else if blocked {
+		doc.Find(cspMetaSelector).Remove()
+		if stripHeader {
+			header.Del("Content-Security-Policy")
+		}
+	}
+	doc.Find(position).AppendHtml(script + scriptEndRegex.ReplaceAllString(js, `<\/$1`) + "</script>")
+}
@@ -0,0 +1,73 @@
+package ladder
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowsInlineScripts(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   bool
+	}{
+		{"", true},
+		{"img-src 'self'", true},
+		{"default-src 'self'", false},
+		{"default-src 'self'; script-src 'self' 'unsafe-inline'", true},
+		{"script-src 'unsafe-inline' 'nonce-abc'", false},
+		{"script-src 'unsafe-inline' 'strict-dynamic'", false},
+		{"script-src 'unsafe-inline'; script-src-elem 'self'", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, allowsInlineScripts(test.policy), test.policy)
+	}
+}
+
+func TestInjectScript(t *testing.T) {
+	inject := func(t *testing.T, page string, header http.Header, stripHeader bool) string {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		require.NoError(t, err)
+		injectScript(doc, "", `console.log("</script>")`, header, stripHeader)
+		html, err := doc.Html()
+		require.NoError(t, err)
+		return html
+	}
+
+	t.Run("without policy", func(t *testing.T) {
+		html := inject(t, `<html><body><p>article</p></body></html>`, http.Header{}, true)
+		assert.Contains(t, html, `<p>article</p><script>console.log("<\/script>")</script></body>`)
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		header := http.Header{"Content-Security-Policy": {"default-src 'self'; script-src 'nonce-r4nd0m+/=' 'strict-dynamic'"}}
+		html := inject(t, `<html><body><p>article</p></body></html>`, header, true)
+		assert.Contains(t, html, `<script nonce="r4nd0m+/=">`)
+		assert.NotEmpty(t, header.Get("Content-Security-Policy"))
+	})
+
+	t.Run("meta nonce", func(t *testing.T) {
+		page := `<html><head><meta http-equiv="content-security-policy" content="script-src 'nonce-abc'"></head><body></body></html>`
+		html := inject(t, page, http.Header{}, true)
+		assert.Contains(t, html, `<meta http-equiv="content-security-policy"`)
+		assert.Contains(t, html, `<script nonce="abc">`)
+	})
+
+	t.Run("blocking policies are stripped", func(t *testing.T) {
+		page := `<html><head><meta http-equiv="Content-Security-Policy" content="script-src 'self'"></head><body></body></html>`
+		header := http.Header{"Content-Security-Policy": {"default-src 'self'"}}
+		html := inject(t, page, header, true)
+		assert.NotContains(t, html, "<meta")
+		assert.Contains(t, html, `<script>console.log`)
+		assert.Empty(t, header.Get("Content-Security-Policy"))
+
+		// policies set by the rule are kept
+		header = http.Header{"Content-Security-Policy": {"default-src 'self'"}}
+		inject(t, page, header, false)
+		assert.Equal(t, "default-src 'self'", header.Get("Content-Security-Policy"))
+	})
+}
@@ -0,0 +1,61 @@
+package ladder
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// cssURLRegex matches the url() references of stylesheets, quoted or not.
+	cssURLRegex = regexp.MustCompile(`(?i)\burl\(\s*("[^"]*"|'[^']*'|[^'")\s]*)\s*\)`)
+	// cssImportRegex matches the @import rules with a plain string target, url() targets are matched by cssURLRegex.
+	cssImportRegex = regexp.MustCompile(`(?i)@import\s+("[^"]*"|'[^']*')`)
+)
+
+// isCSS reports whether resp is a stylesheet.
+func isCSS(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/css"
+}
+
+// rewriteCSS rewrites the url() references and @import targets of css, resolved against
+// base, to route through the ladder instance serving under prefix, so that fonts,
+// background images and imported stylesheets are loaded through the proxy as well.
+func rewriteCSS(css string, base *url.URL, prefix string) string {
+	css = replaceSubmatch(cssURLRegex, css, func(ref string) string {
+		return proxyCSSRef(ref, base, prefix)
+	})
+	return replaceSubmatch(cssImportRegex, css, func(ref string) string {
+		return proxyCSSRef(ref, base, prefix)
+	})
+}
+
+// proxyCSSRef routes ref, a CSS URL which may be quoted, through the proxy, keeping its quotes.
+func proxyCSSRef(ref string, base *url.URL, prefix string) string {
+	quote := ""
+	if len(ref) >= 2 && (ref[0] == '"' || ref[0] == '\'') {
+		quote, ref = ref[:1], ref[1:len(ref)-1]
+	}
+	return quote + proxyURL(ref, base, prefix) + quote
+}
+
+// replaceSubmatch replaces the first submatch of every match of re in s with the result of replace.
+func replaceSubmatch(re *regexp.Regexp, s string, replace func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(s[last:m[2]])
+		sb.WriteString(replace(s[m[2]:m[3]]))
+		last = m[3]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
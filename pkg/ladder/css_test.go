@@ -0,0 +1,39 @@
+package ladder
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteCSS(t *testing.T) {
+	base, _ := url.Parse("https://example.com/css/site.css")
+	tests := []struct {
+		name string
+		css  string
+		want string
+	}{
+		{"unquoted", `body { background: url(/bg.png) }`, `body { background: url(/https://example.com/bg.png) }`},
+		{"quoted", `@font-face { src: url("../fonts/a.woff2") format("woff2"), url( 'a.woff' ) }`, `@font-face { src: url("/https://example.com/fonts/a.woff2") format("woff2"), url( '/https://example.com/css/a.woff' ) }`},
+		{"other host", `.a { background-image: URL(https://cdn.example.net/a.png) }`, `.a { background-image: URL(/https://cdn.example.net/a.png) }`},
+		{"import", `@import "reset.css"; @import url('print.css') print;`, `@import "/https://example.com/css/reset.css"; @import url('/https://example.com/css/print.css') print;`},
+		{"unchanged", `.a { background: url(data:image/png;base64,AAAA) } .b { mask: url(#mask) } .c { content: "url" }`, ``},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := test.want
+			if want == "" {
+				want = test.css
+			}
+			assert.Equal(t, want, rewriteCSS(test.css, base, "/"))
+		})
+	}
+}
+
+func TestRewriteHtmlStyles(t *testing.T) {
+	u, _ := url.Parse("https://example.com/news/article")
+	body := `<style>@import "print.css"; .hero { background: url(hero.jpg) }</style><div style="background: url(&quot;/a.png&quot;)"></div>`
+	want := `<style>@import "/https://example.com/news/print.css"; .hero { background: url(/https://example.com/news/hero.jpg) }</style><div style="background: url(&quot;/https://example.com/a.png&quot;)"></div>`
+	assert.Equal(t, want, rewriteHtml([]byte(body), u, "/", imageRoute{}))
+}
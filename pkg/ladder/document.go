@@ -0,0 +1,44 @@
+package ladder
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxParseSize is the number of bytes of a body parsed into a document. The rest is
+	// dropped, bounding the CPU spent on a single extraction.
+	maxParseSize = 8 << 20
+	// maxParseDepth is the depth below which document nodes are pruned, as
+	// pathologically nested pages make every traversal expensive.
+	maxParseDepth = 256
+)
+
+// parseDocument parses the HTML body into a document shared by the extraction steps,
+// within the size and depth limits.
+func parseDocument(body string) (*goquery.Document, error) {
+	if len(body) > maxParseSize {
+		body = body[:maxParseSize]
+	}
+	root, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	pruneDepth(root, 0)
+	return goquery.NewDocumentFromNode(root), nil
+}
+
+// pruneDepth removes the descendants of n nested deeper than maxParseDepth.
+func pruneDepth(n *html.Node, depth int) {
+	if depth >= maxParseDepth {
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+		}
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		pruneDepth(c, depth+1)
+	}
+}
@@ -0,0 +1,24 @@
+package ladder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDocumentDepth(t *testing.T) {
+	body := "<p>shallow</p>" + strings.Repeat("<div>", 2*maxParseDepth) + "deep" + strings.Repeat("</div>", 2*maxParseDepth)
+	doc, err := parseDocument(body)
+	require.NoError(t, err)
+	assert.Equal(t, "shallow", doc.Text())
+}
+
+func TestParseDocumentSize(t *testing.T) {
+	body := "<p>" + strings.Repeat("a", maxParseSize) + "</p><p>dropped</p>"
+	doc, err := parseDocument(body)
+	require.NoError(t, err)
+	assert.Equal(t, 1, doc.Find("p").Length())
+	assert.NotContains(t, doc.Text(), "dropped")
+}
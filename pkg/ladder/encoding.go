@@ -0,0 +1,98 @@
+package ladder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decoders return readers decoding the content codings of upstream bodies, by name.
+var decoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": zlib.NewReader,
+	"br": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+// decodeBody decodes the body of resp, compressed with the content codings of its
+// Content-Encoding header, so that rules and modifiers see the body as sent by the
+// site whatever the Accept-Encoding of the request. It removes the Content-Encoding
+// and Content-Length headers, which no longer apply. Bodies compressed with unknown
+// codings are left as is.
+func decodeBody(resp *http.Response) error {
+	var codings []string
+	for _, value := range resp.Header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding == "" || coding == "identity" {
+				continue
+			}
+			if decoders[coding] == nil {
+				return nil
+			}
+			codings = append(codings, coding)
+		}
+	}
+	if len(codings) == 0 {
+		resp.Header.Del("Content-Encoding")
+		return nil
+	}
+
+	body := &decodedBody{closers: []io.Closer{resp.Body}}
+	buffered := bufio.NewReader(resp.Body)
+	body.Reader = buffered
+	// bodies of HEAD requests and of 204 and 304 responses are empty despite their coding
+	if _, err := buffered.Peek(1); err == nil {
+		// codings are listed in the order they were applied
+		for i := len(codings) - 1; i >= 0; i-- {
+			r, err := decoders[codings[i]](body.Reader)
+			if err != nil {
+				body.Close()
+				return fmt.Errorf("failed to decode %s response body: %w", codings[i], err)
+			}
+			body.Reader = r
+			body.closers = append(body.closers, r)
+		}
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody is a decoded response body. Closing it closes its decoders and the upstream body.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var errs []error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		errs = append(errs, b.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
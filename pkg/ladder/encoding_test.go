@@ -0,0 +1,109 @@
+package ladder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t *testing.T, coding string, body []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		var err error
+		w, err = zstd.NewWriter(&buf)
+		require.NoError(t, err)
+	default:
+		return body
+	}
+	_, err := w.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestFetchDecodesBody(t *testing.T) {
+	page := []byte(`<html><body><p>page</p><a href="/next">next</a></body></html>`)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		codings := r.URL.Query().Get("coding")
+		body := page
+		for _, coding := range strings.Split(codings, ",") {
+			body = encode(t, strings.TrimSpace(coding), body)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", codings)
+		if r.URL.Query().Has("empty") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write(body)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, RegexRules: []ruleset.Regex{{Match: "page", Replace: "article"}}}
+	rule.Lua.Request = `request.headers["Accept-Encoding"] = "gzip, deflate, br, zstd"`
+	client := NewClient(ruleset.RuleSet{rule})
+	want := `<html><body><p>article</p><a href="/` + upstream.URL + `/next">next</a></body></html>`
+
+	for _, coding := range []string{"gzip", "deflate", "br", "zstd", "gzip, br", "identity"} {
+		t.Run(coding, func(t *testing.T) {
+			result, err := client.Fetch(context.Background(), upstream.URL+"/?coding="+url.QueryEscape(coding), FetchOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, want, result.Content)
+			assert.Empty(t, result.Response.Header.Get("Content-Encoding"))
+			if coding != "identity" {
+				assert.Empty(t, result.Response.Header.Get("Content-Length"))
+			}
+
+			result, err = client.Fetch(context.Background(), upstream.URL+"/?coding="+url.QueryEscape(coding), FetchOptions{Format: FormatRaw})
+			require.NoError(t, err)
+			assert.Equal(t, string(page), result.Content)
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		result, err := client.Fetch(context.Background(), upstream.URL+"/?coding=gzip&empty", FetchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, result.Response.StatusCode)
+		assert.Empty(t, result.Response.Header.Get("Content-Encoding"))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		result, err := client.Fetch(context.Background(), upstream.URL+"/?coding=compress", FetchOptions{Format: FormatRaw})
+		require.NoError(t, err)
+		assert.Equal(t, "compress", result.Response.Header.Get("Content-Encoding"))
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("not brotli"))
+		}))
+		defer corrupt.Close()
+		_, err := NewClient(nil).Fetch(context.Background(), corrupt.URL, FetchOptions{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,120 @@
+package ladder
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ladder/pkg/events"
+)
+
+// requestCount numbers the untagged requests, to tag their debug events.
+var requestCount atomic.Uint64
+
+// tracer publishes the debug events of a single Fetch call to the bus and the
+// trace function of the call. A tracer without either does nothing.
+type tracer struct {
+	bus   *events.Bus
+	trace func(events.Event)
+	tag   string
+}
+
+// newTracer returns the tracer of a Fetch call tagged tag, calling trace with its events if set.
+// Untagged calls get a sequential tag.
+func (c *Client) newTracer(tag string, trace func(events.Event)) tracer {
+	t := tracer{trace: trace}
+	if c.Events != nil && c.Events.Active() {
+		t.bus = c.Events
+	}
+	if !t.active() {
+		return tracer{}
+	}
+	if tag == "" {
+		tag = "req-" + strconv.FormatUint(requestCount.Add(1), 10)
+	}
+	t.tag = tag
+	return t
+}
+
+// active reports whether the events of t are consumed.
+func (t tracer) active() bool {
+	return t.bus != nil || t.trace != nil
+}
+
+func (t tracer) emit(typ, message string, data map[string]string) {
+	if !t.active() {
+		return
+	}
+	e := events.Event{Time: time.Now(), Tag: t.tag, Type: typ, Message: message, Data: data}
+	if t.bus != nil {
+		t.bus.Publish(e)
+	}
+	if t.trace != nil {
+		t.trace(e)
+	}
+}
+
+// headers reports the headers of h, set by source.
+func (t tracer) headers(source string, h http.Header) {
+	t.headerChanges(source, nil, h)
+}
+
+// credentialHeaders are the headers whose values events redact, as they carry the sessions and
+// credentials of users, see redactHeader.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// redactHeader returns the value of the header k as reported by events, redacted for credentials.
+func redactHeader(k, value string) string {
+	if value != "" && credentialHeaders[http.CanonicalHeaderKey(k)] {
+		return "[redacted]"
+	}
+	return value
+}
+
+// headerChanges reports the headers that differ between before and after, changed by source.
+// The values of credential headers are redacted, see credentialHeaders.
+func (t tracer) headerChanges(source string, before, after http.Header) {
+	if !t.active() {
+		return
+	}
+
+	keys := map[string]struct{}{}
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		prev, next := strings.Join(before.Values(k), ", "), strings.Join(after.Values(k), ", ")
+		if prev == next {
+			continue
+		}
+
+		message := source + " set " + k
+		if len(after.Values(k)) == 0 {
+			message = source + " removed " + k
+		}
+		t.emit(events.TypeHeader, message, map[string]string{
+			"source": source,
+			"header": k,
+			"old":    redactHeader(k, prev),
+			"new":    redactHeader(k, next),
+		})
+	}
+}
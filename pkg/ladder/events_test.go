@@ -0,0 +1,95 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ladder/pkg/events"
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchEvents(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.Header.Get("X-Debug")))
+	}))
+	defer upstream.Close()
+	host, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: host.Host}
+	rule.Lua.Request = `request.headers["X-Debug"] = "lua"; request.headers["Referer"] = nil; request.headers["Cookie"] = "session=secret"`
+	client := NewClient(ruleset.RuleSet{rule})
+	client.Events = events.NewBus()
+
+	sub := client.Events.Subscribe("debug")
+	defer sub.Close()
+
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{Format: FormatRaw, Tag: "debug"})
+	require.NoError(t, err)
+	assert.Equal(t, "lua", result.Content)
+
+	_, err = client.Fetch(context.Background(), "http://127.0.0.1:1", FetchOptions{Tag: "debug"})
+	require.Error(t, err)
+
+	// untagged requests are not delivered to the subscription
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+
+	headers := map[string]events.Event{}
+	types := []string{}
+	for len(sub.Events()) > 0 {
+		e := <-sub.Events()
+		assert.Equal(t, "debug", e.Tag)
+		types = append(types, e.Type)
+		if e.Type == events.TypeHeader && e.Data["source"] == "lua" {
+			headers[e.Data["header"]] = e
+		}
+		if e.Type == events.TypeModifier {
+			assert.Equal(t, "lua", e.Data["modifier"])
+			_, err := time.ParseDuration(e.Data["duration"])
+			assert.NoError(t, err)
+		}
+	}
+
+	assert.Equal(t, events.TypeRule, types[0])
+	assert.Contains(t, types, events.TypeModifier)
+	assert.Contains(t, types, events.TypeRequest)
+	assert.Contains(t, types, events.TypeResponse)
+	assert.Equal(t, events.TypeError, types[len(types)-1])
+
+	assert.Equal(t, "lua set X-Debug", headers["X-Debug"].Message)
+	assert.Equal(t, "lua", headers["X-Debug"].Data["new"])
+	assert.Equal(t, "lua removed Referer", headers["Referer"].Message)
+	assert.Equal(t, upstream.URL+"/", headers["Referer"].Data["old"])
+	// credentials are redacted
+	assert.Equal(t, "lua set Cookie", headers["Cookie"].Message)
+	assert.Equal(t, "[redacted]", headers["Cookie"].Data["new"])
+	assert.Equal(t, "", headers["Cookie"].Data["old"])
+}
+
+func TestFetchTrace(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	// traces don't need an event bus
+	client := NewClient(nil)
+	var traced []events.Event
+	_, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{
+		Trace: func(e events.Event) { traced = append(traced, e) },
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, traced)
+	assert.Equal(t, events.TypeRule, traced[0].Type)
+	assert.Equal(t, events.TypeResponse, traced[len(traced)-1].Type)
+	assert.NotEmpty(t, traced[0].Tag)
+	assert.False(t, traced[0].Time.IsZero())
+}
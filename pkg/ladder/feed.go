@@ -0,0 +1,132 @@
+package ladder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// feedURLAttributeRegex matches the URL attributes of feed elements: the href of Atom
+// links, the src of Atom content and the url of RSS enclosures and Media RSS elements.
+var feedURLAttributeRegex = regexp.MustCompile(`\s(?:href|src|url)\s*=\s*("[^"]*"|'[^']*')`)
+
+// isFeed reports whether resp is a RSS or Atom feed, either declared as such or served
+// as generic XML with a rss, feed or rdf:RDF root element.
+func isFeed(resp *http.Response, body []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/rss+xml", "application/atom+xml", "application/rdf+xml":
+		return true
+	case "application/xml", "text/xml":
+		d := newFeedDecoder(body)
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return false
+			}
+			if start, ok := tok.(xml.StartElement); ok {
+				name := start.Name.Local
+				return name == "rss" || name == "feed" || name == "RDF"
+			}
+		}
+	}
+	return false
+}
+
+// rewriteFeed rewrites the item and feed links of the RSS or Atom feed body, fetched
+// from u, and the URLs of its enclosures to route through the ladder instance serving
+// under origin and prefix, so that subscribing to a feed through ladder opens every
+// article through ladder as well. The rest of the feed is kept as is, and so is the
+// remainder of feeds that fail to parse.
+func rewriteFeed(body []byte, u *url.URL, origin string, prefix string) string {
+	base := baseURL(u)
+	proxy := func(ref string) string {
+		if strings.HasPrefix(ref, origin+prefix) {
+			return ref
+		}
+		proxied := proxyURL(ref, &base, prefix)
+		if proxied == ref {
+			return ref
+		}
+		return origin + proxied
+	}
+
+	var sb strings.Builder
+	d := newFeedDecoder(body)
+	var offset int64
+	// inLink is set within the text links of RSS, whose URL is their content
+	inLink := false
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			if err != io.EOF {
+				sb.Write(body[offset:])
+			}
+			break
+		}
+		raw := string(body[offset:d.InputOffset()])
+		offset = d.InputOffset()
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "link" && !hasAttr(tok, "href") {
+				inLink = true
+				break
+			}
+			if isFeedURLElement(tok.Name.Local) {
+				raw = replaceSubmatch(feedURLAttributeRegex, raw, func(value string) string {
+					return value[:1] + html.EscapeString(proxy(html.UnescapeString(value[1:len(value)-1]))) + value[:1]
+				})
+			}
+		case xml.EndElement:
+			inLink = false
+		case xml.CharData:
+			if inLink {
+				if ref := strings.TrimSpace(string(tok)); ref != "" {
+					raw = html.EscapeString(proxy(ref))
+				}
+			}
+		}
+		sb.WriteString(raw)
+	}
+	return sb.String()
+}
+
+// newFeedDecoder returns a lenient decoder of body. Feeds in other charsets than UTF-8
+// are decoded as is, their URLs are ASCII.
+func newFeedDecoder(body []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) {
+		return r, nil
+	}
+	return d
+}
+
+// isFeedURLElement reports whether the URL attributes of the element with the local name
+// name point to a page or media of the feed: Atom links, RSS enclosures and Media RSS content.
+func isFeedURLElement(name string) bool {
+	switch name {
+	case "link", "enclosure", "content", "thumbnail":
+		return true
+	}
+	return false
+}
+
+func hasAttr(start xml.StartElement, name string) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
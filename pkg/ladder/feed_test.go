@@ -0,0 +1,95 @@
+package ladder
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFeed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"application/rss+xml; charset=utf-8", "", true},
+		{"application/atom+xml", "", true},
+		{"text/xml", `<?xml version="1.0" encoding="ISO-8859-1"?><!-- feed --><rss version="2.0"></rss>`, true},
+		{"application/xml", `<feed xmlns="http://www.w3.org/2005/Atom"></feed>`, true},
+		{"application/xml", `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>`, true},
+		{"application/xml", `<sitemap></sitemap>`, false},
+		{"text/html", `<rss></rss>`, false},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{"Content-Type": {test.contentType}}}
+		assert.Equal(t, test.want, isFeed(resp, []byte(test.body)), test.contentType+" "+test.body)
+	}
+}
+
+func TestRewriteFeed(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/feeds/news.xml")
+	tests := []struct {
+		name string
+		feed string
+		want string
+	}{
+		{
+			"rss",
+			`<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+  <title>News &amp; more</title>
+  <link>https://www.example.com/</link>
+  <atom:link href="https://www.example.com/feeds/news.xml" rel="self" type="application/rss+xml"/>
+  <item>
+    <title>Article</title>
+    <link> /news/article?a=1&amp;b=2 </link>
+    <guid>https://www.example.com/news/article</guid>
+    <description><![CDATA[<a href="https://www.example.com/news/article">Read</a>]]></description>
+    <enclosure url="https://cdn.example.com/a.mp3" length="1" type="audio/mpeg"/>
+    <media:content url='https://cdn.example.com/a.jpg' medium="image"/>
+  </item>
+  <item>
+    <link><![CDATA[https://www.example.com/news/other]]></link>
+  </item>
+</channel>
+</rss>`,
+			`<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+  <title>News &amp; more</title>
+  <link>https://ladder.example.org/https://www.example.com/</link>
+  <atom:link href="https://ladder.example.org/https://www.example.com/feeds/news.xml" rel="self" type="application/rss+xml"/>
+  <item>
+    <title>Article</title>
+    <link>https://ladder.example.org/https://www.example.com/news/article?a=1&amp;b=2</link>
+    <guid>https://www.example.com/news/article</guid>
+    <description><![CDATA[<a href="https://www.example.com/news/article">Read</a>]]></description>
+    <enclosure url="https://ladder.example.org/https://cdn.example.com/a.mp3" length="1" type="audio/mpeg"/>
+    <media:content url='https://ladder.example.org/https://cdn.example.com/a.jpg' medium="image"/>
+  </item>
+  <item>
+    <link>https://ladder.example.org/https://www.example.com/news/other</link>
+  </item>
+</channel>
+</rss>`,
+		},
+		{
+			"atom",
+			`<feed xmlns="http://www.w3.org/2005/Atom"><link href="/"/><entry><title>Article</title><link rel="alternate" href="https://www.example.com/news/article"/><link rel="enclosure" href="https://ladder.example.org/https://cdn.example.com/a.mp3"/><content type="html">&lt;p&gt;text&lt;/p&gt;</content></entry></feed>`,
+			`<feed xmlns="http://www.w3.org/2005/Atom"><link href="https://ladder.example.org/https://www.example.com/"/><entry><title>Article</title><link rel="alternate" href="https://ladder.example.org/https://www.example.com/news/article"/><link rel="enclosure" href="https://ladder.example.org/https://cdn.example.com/a.mp3"/><content type="html">&lt;p&gt;text&lt;/p&gt;</content></entry></feed>`,
+		},
+		{
+			"invalid",
+			`<rss><channel><link>https://www.example.com/</link><item =><link>https://www.example.com/a</link>`,
+			`<rss><channel><link>https://ladder.example.org/https://www.example.com/</link><item =><link>https://www.example.com/a</link>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, rewriteFeed([]byte(test.feed), u, "https://ladder.example.org", "/"))
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package ladder
+
+import (
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHeaderBytes caps the total size of the upstream response headers kept.
+	maxHeaderBytes = 64 << 10
+	// maxHeaderCount caps the number of upstream response header values kept.
+	maxHeaderCount = 128
+)
+
+// DefaultForwardHeaders are the upstream response headers forwarded to the client along
+// with rewritten bodies by the Clients returned by NewClient, see Client.ForwardHeaders.
+// ETags are left out, as they identify the upstream body rather than the rewritten one.
+var DefaultForwardHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Language",
+	"Expires",
+	"Last-Modified",
+	"X-Content-Type-Options",
+}
+
+// unforwardableHeaders are the headers that servers set themselves and that rules can't forward.
+var unforwardableHeaders = map[string]bool{
+	"Content-Encoding":          true,
+	"Content-Length":            true,
+	"Content-Security-Policy":   true,
+	"Content-Type":              true,
+	"Location":                  true,
+	"Set-Cookie":                true,
+	"Strict-Transport-Security": true,
+}
+
+// hopByHopHeaders are the headers that apply to a single connection and must not be forwarded, see RFC 7230 section 6.1.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// normalizeHeaders prepares the upstream response headers h for forwarding: it drops
+// hop-by-hop headers and values that are invalid or repeated, then keeps headers
+// within maxHeaderCount values and maxHeaderBytes, preferring the ones ladder forwards.
+func normalizeHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := forwarded(names[i]), forwarded(names[j]); pi != pj {
+			return pi
+		}
+		return names[i] < names[j]
+	})
+
+	count, size := 0, 0
+	for _, name := range names {
+		seen := map[string]bool{}
+		values := h[name][:0]
+		for _, value := range h[name] {
+			if seen[value] || !validHeaderValue(value) {
+				continue
+			}
+			seen[value] = true
+
+			// name: value\r\n
+			if count+1 > maxHeaderCount || size+len(name)+len(value)+4 > maxHeaderBytes {
+				break
+			}
+			count++
+			size += len(name) + len(value) + 4
+			values = append(values, value)
+		}
+
+		if len(values) == 0 {
+			delete(h, name)
+			continue
+		}
+		h[name] = values
+	}
+}
+
+// forwarded reports whether the header name is one the servers forward to clients.
+func forwarded(name string) bool {
+	switch textproto.CanonicalMIMEHeaderKey(name) {
+	case "Content-Type", "Content-Length", "Content-Security-Policy":
+		return true
+	}
+	for _, header := range PassthroughHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	for _, header := range DefaultForwardHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardedHeaders returns the headers of the upstream response that servers forward to
+// the client along with Content: those listed by Rule.Headers.Forward, which defaults to
+// Client.ForwardHeaders. Hop-by-hop headers and the headers describing the upstream body,
+// such as Content-Length, are never forwarded. Set-Cookie is forwarded when the rule
+// forwards cookies, see ruleset.Rule.Cookies.
+func (r *Result) ForwardedHeaders() http.Header {
+	h := http.Header{}
+	if cookies := r.Response.Header.Values("Set-Cookie"); r.Rule.Cookies && len(cookies) > 0 {
+		h["Set-Cookie"] = cookies
+	}
+	for _, name := range r.Rule.Headers.Forward {
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if unforwardableHeaders[name] || isHopByHop(name) {
+			continue
+		}
+		if values := r.Response.Header.Values(name); len(values) > 0 {
+			h[name] = values
+		}
+	}
+	return h
+}
+
+func isHopByHop(name string) bool {
+	for _, header := range hopByHopHeaders {
+		if header == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validHeaderValue reports whether value can be forwarded without breaking the response.
+func validHeaderValue(value string) bool {
+	return !strings.ContainsAny(value, "\r\n\x00")
+}
@@ -0,0 +1,78 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "text/html")
+	h.Set("Connection", "keep-alive, X-Hop")
+	h.Set("X-Hop", "1")
+	h.Set("Keep-Alive", "timeout=5")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Set("X-Injected", "a\r\nSet-Cookie: evil=1")
+
+	normalizeHeaders(h)
+	assert.Equal(t, http.Header{
+		"Content-Type": {"text/html"},
+		"Set-Cookie":   {"a=1", "b=2"},
+	}, h)
+}
+
+func TestNormalizeHeadersLimits(t *testing.T) {
+	h := http.Header{}
+	for i := 0; i < 2*maxHeaderCount; i++ {
+		h.Set("X-Header-"+strconv.Itoa(i), "value")
+	}
+	h.Set("Content-Type", "video/mp4")
+	normalizeHeaders(h)
+	assert.Len(t, h, maxHeaderCount)
+	assert.Equal(t, "video/mp4", h.Get("Content-Type"))
+
+	h = http.Header{}
+	h.Set("Content-Disposition", "attachment")
+	h.Set("X-Large", strings.Repeat("a", maxHeaderBytes))
+	normalizeHeaders(h)
+	assert.Equal(t, http.Header{"Content-Disposition": {"attachment"}}, h)
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Add("Set-Cookie", "session=1")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write([]byte("a { color: red }"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	result, err := NewClient(nil).Fetch(context.Background(), upstream.URL+"/a.css", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{
+		"Cache-Control":          {"max-age=3600"},
+		"X-Content-Type-Options": {"nosniff"},
+	}, result.ForwardedHeaders())
+
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Headers.Forward = []string{"etag", "Set-Cookie", "Content-Length", "Connection"}
+	result, err = NewClient(ruleset.RuleSet{rule}).Fetch(context.Background(), upstream.URL+"/a.css", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{"Etag": {`"abc"`}}, result.ForwardedHeaders())
+}
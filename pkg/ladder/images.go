@@ -0,0 +1,145 @@
+package ladder
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ladder/pkg/ruleset"
+)
+
+const (
+	// MaxImages bounds the number of images returned by Outline.ImageURLs.
+	MaxImages = 50
+	// MaxImageSize bounds the size of the images fetched by Client.FetchImages, larger images are left out.
+	MaxImageSize = 10 << 20
+	// imageFetchers is the number of images fetched concurrently.
+	imageFetchers = 4
+	// DefaultImagePrefix is the path prefix of the image route of the ladder server, see FetchOptions.ImagePrefix.
+	DefaultImagePrefix = "/img/"
+)
+
+// Image is an image of a page, eg: to embed into an export of an article.
+type Image struct {
+	MediaType string
+	Data      []byte
+}
+
+// CoverURL returns the absolute URL of the cover image of the page, which pages may declare relative to their URL.
+func (o Outline) CoverURL() string {
+	base, err := url.Parse(o.URL)
+	if err != nil || o.Metadata.Image == "" {
+		return o.Metadata.Image
+	}
+	cover, err := base.Parse(o.Metadata.Image)
+	if err != nil {
+		return o.Metadata.Image
+	}
+	return cover.String()
+}
+
+// ImageURLs returns the URLs of the cover and image blocks of the outline, in order and at most MaxImages.
+func (o Outline) ImageURLs() []string {
+	var urls []string
+	seen := map[string]bool{}
+	add := func(src string) {
+		if src != "" && !seen[src] && len(urls) < MaxImages {
+			seen[src] = true
+			urls = append(urls, src)
+		}
+	}
+	add(o.CoverURL())
+	for _, block := range o.Blocks {
+		if block.Type == BlockImage {
+			add(block.Src)
+		}
+	}
+	return urls
+}
+
+// FetchImages fetches the images at srcs, applying the rules of their sites, and returns
+// them by URL. Images that fail to load, are too large or are not images are left out.
+func (c *Client) FetchImages(ctx context.Context, srcs []string) map[string]Image {
+	images := map[string]Image{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < imageFetchers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for src := range queue {
+				image, ok := c.fetchImage(ctx, src)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				images[src] = image
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, src := range srcs {
+		queue <- src
+	}
+	close(queue)
+	wg.Wait()
+	return images
+}
+
+func (c *Client) fetchImage(ctx context.Context, src string) (Image, bool) {
+	result, err := c.Fetch(ctx, src, FetchOptions{Format: FormatRaw})
+	if err != nil || result.Response.StatusCode != http.StatusOK || len(result.Content) > MaxImageSize {
+		return Image{}, false
+	}
+	mediaType, _, _ := mime.ParseMediaType(result.Response.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		// servers often send images as application/octet-stream
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType([]byte(result.Content)))
+		if !strings.HasPrefix(mediaType, "image/") {
+			return Image{}, false
+		}
+	}
+	return Image{MediaType: mediaType, Data: []byte(result.Content)}, true
+}
+
+// imageRoute routes the images of pages through the image route serving under prefix,
+// with the query of the scaling of the rule, eg: w=800. The zero imageRoute routes
+// images like any other link.
+type imageRoute struct {
+	prefix string
+	query  string
+}
+
+func newImageRoute(prefix string, images ruleset.Images) imageRoute {
+	query := url.Values{}
+	if images.MaxWidth > 0 {
+		query.Set("w", strconv.Itoa(images.MaxWidth))
+	}
+	if images.Format != "" {
+		query.Set("format", images.Format)
+	}
+	if len(query) == 0 {
+		return imageRoute{}
+	}
+	return imageRoute{prefix: prefix, query: query.Encode()}
+}
+
+// url returns the URL of the image ref, resolved against base, routed through the image
+// route. Images that proxyURL leaves as is, eg: data: URLs, are returned as is.
+func (r imageRoute) url(ref string, base *url.URL, prefix string) string {
+	proxied := proxyURL(ref, base, prefix)
+	if proxied == ref || !strings.HasPrefix(proxied, prefix) {
+		return proxied
+	}
+	target := strings.TrimPrefix(proxied, prefix)
+	separator := "?"
+	if strings.Contains(target, "?") {
+		separator = "&"
+	}
+	return r.prefix + target + separator + r.query
+}
@@ -0,0 +1,69 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// png is a 1x1 transparent PNG.
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestOutlineImageURLs(t *testing.T) {
+	outline := Outline{
+		URL:      "https://www.example.com/news/article",
+		Metadata: Metadata{Image: "cover.jpg"},
+		Blocks: []Block{
+			{Type: BlockImage, Src: "https://www.example.com/news/cover.jpg"},
+			{Type: BlockParagraph, Text: "text"},
+			{Type: BlockImage, Src: "https://cdn.example.net/a.png"},
+		},
+	}
+	assert.Equal(t, "https://www.example.com/news/cover.jpg", outline.CoverURL())
+	assert.Equal(t, []string{"https://www.example.com/news/cover.jpg", "https://cdn.example.net/a.png"}, outline.ImageURLs())
+}
+
+func TestFetchImages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/octet":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/missing.png":
+			w.WriteHeader(http.StatusNotFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>not an image</p>"))
+			return
+		}
+		w.Write(png)
+	}))
+	defer upstream.Close()
+
+	images := NewClient(nil).FetchImages(context.Background(), []string{
+		upstream.URL + "/a.png", upstream.URL + "/octet", upstream.URL + "/missing.png", upstream.URL + "/page",
+	})
+	assert.Equal(t, map[string]Image{
+		upstream.URL + "/a.png": {MediaType: "image/png", Data: png},
+		upstream.URL + "/octet": {MediaType: "image/png", Data: png},
+	}, images)
+}
+
+func TestRewriteImages(t *testing.T) {
+	u, _ := url.Parse("https://example.com/news/article")
+	body := `<img src="a.jpg?v=2" srcset="a.jpg 1x, a@2x.jpg 2x"><img src="data:image/gif;base64,R0lGOD"><a href="b.jpg">b</a>`
+
+	images := newImageRoute("/img/", ruleset.Images{MaxWidth: 800, Format: "webp"})
+	want := `<img src="/img/https://example.com/news/a.jpg?v=2&amp;format=webp&amp;w=800" srcset="/img/https://example.com/news/a.jpg?format=webp&amp;w=800 1x, /img/https://example.com/news/a@2x.jpg?format=webp&amp;w=800 2x"><img src="data:image/gif;base64,R0lGOD"><a href="/https://example.com/news/b.jpg">b</a>`
+	assert.Equal(t, want, rewriteHtml([]byte(body), u, "/", images))
+
+	assert.Equal(t, imageRoute{}, newImageRoute("/img/", ruleset.Images{}))
+	assert.Contains(t, rewriteHtml([]byte(body), u, "/", imageRoute{}), `<img src="/https://example.com/news/a.jpg?v=2"`)
+}
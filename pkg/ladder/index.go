@@ -0,0 +1,185 @@
+package ladder
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MaxIndexEntries bounds the number of entries of an Index.
+const MaxIndexEntries = 50
+
+// Index lists the articles linked from an index page of a site, such as its front page
+// or a section page, eg: to follow sites without a feed.
+type Index struct {
+	URL      string       `json:"url"`
+	Metadata Metadata     `json:"metadata"`
+	Entries  []IndexEntry `json:"entries"`
+}
+
+// IndexEntry is an article linked from an index page.
+type IndexEntry struct {
+	// URL is the absolute URL of the article.
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Summary is the teaser shown next to the link, if any.
+	Summary string `json:"summary,omitempty"`
+	// PublishedTime is the datetime of the time element next to the link, if any.
+	PublishedTime string `json:"publishedTime,omitempty"`
+}
+
+// indexEntrySelector matches the containers of the teasers of index pages.
+const indexEntrySelector = "article, li, [class*=teaser], [class*=card], [class*=story], [class*=post]"
+
+// ExtractIndex extracts the Index of the HTML document body, fetched from pageURL.
+func ExtractIndex(body string, pageURL string) Index {
+	doc, err := parseDocument(body)
+	if err != nil {
+		return Index{URL: pageURL, Entries: []IndexEntry{}}
+	}
+	return indexFromDocument(doc, pageURL, metadataFromDocument(doc))
+}
+
+// indexFromDocument extracts the Index with the metadata md from doc, fetched from pageURL.
+// Articles are told from the other links by their text, a headline, and their location: in a
+// heading or an article element, on the site of the page. It removes the boilerplate elements of doc,
+// but for the headers and footers of articles, which often hold their headline and date.
+func indexFromDocument(doc *goquery.Document, pageURL string, md Metadata) Index {
+	index := Index{URL: pageURL, Metadata: md, Entries: []IndexEntry{}}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return index
+	}
+	doc.Find(boilerplateSelector).Not("article header, article footer").Remove()
+
+	seen := map[string]bool{pageURL: true}
+	doc.Find("a[href]").EachWithBreak(func(_ int, a *goquery.Selection) bool {
+		link, err := base.Parse(strings.TrimSpace(a.AttrOr("href", "")))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || !sameSite(link.Hostname(), base.Hostname()) {
+			return true
+		}
+		link.Fragment = ""
+		if seen[link.String()] || strings.Trim(link.Path, "/") == "" {
+			return true
+		}
+
+		heading := a.Closest("h1, h2, h3, h4, h5, h6")
+		if heading.Length() == 0 {
+			heading = a.Find("h1, h2, h3, h4, h5, h6").First()
+		}
+		title := cleanText(heading.Text())
+		if title == "" {
+			title = cleanText(a.Text())
+		}
+		words := len(strings.Fields(title))
+		headline := heading.Length() > 0 || a.Closest("article").Length() > 0
+		if words < 3 || (!headline && words < 5) {
+			return true
+		}
+
+		seen[link.String()] = true
+		entry := IndexEntry{URL: link.String(), Title: title}
+		if container := a.Closest(indexEntrySelector); container.Length() > 0 {
+			container.Find("p").EachWithBreak(func(_ int, p *goquery.Selection) bool {
+				if text := cleanText(p.Text()); text != "" && !strings.Contains(text, title) {
+					entry.Summary = text
+					return false
+				}
+				return true
+			})
+			entry.PublishedTime = container.Find("time[datetime]").First().AttrOr("datetime", "")
+		}
+		index.Entries = append(index.Entries, entry)
+		return len(index.Entries) < MaxIndexEntries
+	})
+	return index
+}
+
+// sameSite reports whether host belongs to the site of the index page hosted on pageHost,
+// ignoring a leading www, eg: news.example.com belongs to www.example.com.
+func sameSite(host string, pageHost string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	pageHost = strings.TrimPrefix(strings.ToLower(pageHost), "www.")
+	return host == pageHost || strings.HasSuffix(host, "."+pageHost) || strings.HasSuffix(pageHost, "."+host)
+}
+
+// rss is the root element of a RSS 2.0 feed.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Language    string    `xml:"language,omitempty"`
+	Generator   string    `xml:"generator"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders the index as a RSS 2.0 feed, with the links of the page and its
+// articles prefixed with prefix, eg: https://ladder.example.com/ to open them
+// through ladder. The items are identified by the URL of their article.
+func (i Index) RSS(prefix string) (string, error) {
+	title := i.Metadata.Title
+	if title == "" {
+		title = i.URL
+	}
+	description := i.Metadata.Description
+	if description == "" {
+		description = "Articles of " + i.URL
+	}
+	feed := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        prefix + i.URL,
+			Description: description,
+			Language:    i.Metadata.Language,
+			Generator:   "ladder",
+			Items:       []rssItem{},
+		},
+	}
+	for _, entry := range i.Entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       entry.Title,
+			Link:        prefix + entry.URL,
+			Description: entry.Summary,
+			PubDate:     rssDate(entry.PublishedTime),
+			GUID:        rssGUID{Value: entry.URL},
+		})
+	}
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(b) + "\n", nil
+}
+
+// rssDate formats datetime, a HTML datetime, as a RSS date. It returns "" for unknown formats.
+func rssDate(datetime string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(datetime)); err == nil {
+			return t.Format(time.RFC1123Z)
+		}
+	}
+	return ""
+}
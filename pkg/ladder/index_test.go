@@ -0,0 +1,66 @@
+package ladder
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const indexPage = `<html lang="en"><head><title>Example News</title></head><body>
+<header><nav><a href="/politics/">Politics and government news today</a></nav></header>
+<main>
+  <article class="teaser">
+    <header><h2><a href="/2024/01/02/first-article">The first article of the day</a></h2></header>
+    <p>A summary of the first article.</p>
+    <footer><time datetime="2024-01-02T08:00:00Z">Jan 2</time></footer>
+  </article>
+  <div class="card">
+    <a href="https://news.example.com/second#comments"><h3>Second article on a subdomain</h3></a>
+    <p>Second article on a subdomain</p>
+    <p>Its teaser.</p>
+    <time datetime="2024-01-01">Jan 1</time>
+  </div>
+  <a href="/2024/01/02/first-article">The first article of the day, again</a>
+  <ul>
+    <li><a href="/third-article">A long link text to the third article</a></li>
+    <li><a href="/about">About us</a></li>
+    <li><a href="https://other.example.net/article">An article on another site entirely</a></li>
+  </ul>
+  <a href="/">Back to the front page of the site</a>
+</main>
+<footer><a href="/imprint">Imprint and legal notices of the site</a></footer>
+</body></html>`
+
+func TestExtractIndex(t *testing.T) {
+	index := ExtractIndex(indexPage, "https://www.example.com/")
+	assert.Equal(t, "Example News", index.Metadata.Title)
+	assert.Equal(t, []IndexEntry{
+		{URL: "https://www.example.com/2024/01/02/first-article", Title: "The first article of the day", Summary: "A summary of the first article.", PublishedTime: "2024-01-02T08:00:00Z"},
+		{URL: "https://news.example.com/second", Title: "Second article on a subdomain", Summary: "Its teaser.", PublishedTime: "2024-01-01"},
+		{URL: "https://www.example.com/third-article", Title: "A long link text to the third article"},
+	}, index.Entries)
+}
+
+func TestIndexRSS(t *testing.T) {
+	index := ExtractIndex(indexPage, "https://www.example.com/")
+	feed, err := index.RSS("https://ladder.example.org/")
+	require.NoError(t, err)
+
+	var parsed rss
+	require.NoError(t, xml.Unmarshal([]byte(feed), &parsed))
+	assert.Equal(t, "Example News", parsed.Channel.Title)
+	assert.Equal(t, "https://ladder.example.org/https://www.example.com/", parsed.Channel.Link)
+	assert.Equal(t, "en", parsed.Channel.Language)
+	require.Len(t, parsed.Channel.Items, 3)
+	assert.Equal(t, rssItem{
+		Title:       "The first article of the day",
+		Link:        "https://ladder.example.org/https://www.example.com/2024/01/02/first-article",
+		Description: "A summary of the first article.",
+		PubDate:     "Tue, 02 Jan 2024 08:00:00 +0000",
+		GUID:        rssGUID{Value: "https://www.example.com/2024/01/02/first-article"},
+	}, parsed.Channel.Items[0])
+	assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 +0000", parsed.Channel.Items[1].PubDate)
+	assert.Contains(t, feed, `<guid isPermaLink="false">`)
+}
@@ -0,0 +1,198 @@
+// Package laddertest provides utilities to unit test rules and modifiers
+// against canned upstream requests and responses, without network access
+// or a running ladder server.
+//
+//	func TestStripCookies(t *testing.T) {
+//		chain := laddertest.NewChain(ruleset.Rule{Domain: "example.com", Plugins: []string{"strip"}},
+//			laddertest.Response{Body: "<p>article</p>"})
+//		chain.Client.Plugins = map[string]ladder.Modifier{"strip": plugin.Wrap("strip", stripCookies{})}
+//
+//		result := chain.Fetch(t, "https://example.com/article", ladder.FormatHTML)
+//		laddertest.AssertNoHeader(t, chain.Upstream.LastRequest().Header, "Cookie")
+//		laddertest.AssertBodyContains(t, result.Content, "article")
+//	}
+package laddertest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/ruleset"
+)
+
+// Response is a canned upstream response.
+type Response struct {
+	// StatusCode defaults to http.StatusOK.
+	StatusCode int
+	// Header defaults to a text/html Content-Type.
+	Header http.Header
+	Body   string
+}
+
+// toHTTP returns resp as the response to req.
+func (resp Response) toHTTP(req *http.Request) *http.Response {
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
+
+// Upstream is an http.RoundTripper serving canned responses and recording the requests it receives.
+// It is safe for concurrent use.
+type Upstream struct {
+	// Responses holds the responses served by URL, without query string.
+	Responses map[string]Response
+	// Default is served for URLs missing from Responses.
+	Default Response
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+// NewUpstream returns an Upstream serving resp for every URL.
+func NewUpstream(resp Response) *Upstream {
+	return &Upstream{Responses: map[string]Response{}, Default: resp}
+}
+
+// RoundTrip records req and returns its canned response.
+func (u *Upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	u.requests = append(u.requests, req.Clone(context.Background()))
+	u.mu.Unlock()
+
+	key := *req.URL
+	key.RawQuery = ""
+	resp, ok := u.Responses[key.String()]
+	if !ok {
+		resp = u.Default
+	}
+	return resp.toHTTP(req), nil
+}
+
+// Requests returns the requests received so far.
+func (u *Upstream) Requests() []*http.Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]*http.Request{}, u.requests...)
+}
+
+// LastRequest returns the last request received, or nil if there was none.
+func (u *Upstream) LastRequest() *http.Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.requests) == 0 {
+		return nil
+	}
+	return u.requests[len(u.requests)-1]
+}
+
+// Chain is a ladder.Client fetching from an Upstream.
+type Chain struct {
+	Client   *ladder.Client
+	Upstream *Upstream
+}
+
+// NewChain returns a Chain applying rule to requests answered with resp.
+// The rule's plugins must be registered in Client.Plugins before fetching.
+func NewChain(rule ruleset.Rule, resp Response) *Chain {
+	upstream := NewUpstream(resp)
+	client := ladder.NewClient(ruleset.RuleSet{rule})
+	client.Transport = upstream
+	return &Chain{Client: client, Upstream: upstream}
+}
+
+// Fetch fetches rawURL in format, failing the test on error.
+func (c *Chain) Fetch(t testing.TB, rawURL string, format ladder.Format) *ladder.Result {
+	t.Helper()
+	result, err := c.Client.Fetch(context.Background(), rawURL, ladder.FetchOptions{Format: format})
+	if err != nil {
+		t.Fatalf("fetching %s: %v", rawURL, err)
+	}
+	return result
+}
+
+// NewRequest returns a GET request for rawURL, as sent upstream to modifiers.
+func NewRequest(t testing.TB, rawURL string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatalf("creating request for %s: %v", rawURL, err)
+	}
+	return req
+}
+
+// ModifyRequest applies m to req, failing the test on error.
+func ModifyRequest(t testing.TB, m ladder.Modifier, req *http.Request) {
+	t.Helper()
+	if err := m.ModifyRequest(req); err != nil {
+		t.Fatalf("modifying request: %v", err)
+	}
+}
+
+// ModifyResponse applies m to resp, answering a request for rawURL, and returns
+// the modified response and body. It fails the test on error.
+func ModifyResponse(t testing.TB, m ladder.Modifier, rawURL string, resp Response) (*http.Response, string) {
+	t.Helper()
+	r := resp.toHTTP(NewRequest(t, rawURL))
+	body, err := m.ModifyResponse(r, []byte(resp.Body))
+	if err != nil {
+		t.Fatalf("modifying response: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return r, string(body)
+}
+
+// AssertHeader checks that h holds want for key.
+func AssertHeader(t testing.TB, h http.Header, key string, want string) {
+	t.Helper()
+	if got := strings.Join(h.Values(key), ", "); got != want {
+		t.Errorf("header %s = %q, want %q", key, got, want)
+	}
+}
+
+// AssertNoHeader checks that h holds no value for key.
+func AssertNoHeader(t testing.TB, h http.Header, key string) {
+	t.Helper()
+	if values := h.Values(key); len(values) > 0 {
+		t.Errorf("header %s = %q, want none", key, strings.Join(values, ", "))
+	}
+}
+
+// AssertBodyContains checks that body contains substr.
+func AssertBodyContains(t testing.TB, body string, substr string) {
+	t.Helper()
+	if !strings.Contains(body, substr) {
+		t.Errorf("body does not contain %q:\n%s", substr, body)
+	}
+}
+
+// AssertBodyNotContains checks that body does not contain substr.
+func AssertBodyNotContains(t testing.TB, body string, substr string) {
+	t.Helper()
+	if strings.Contains(body, substr) {
+		t.Errorf("body contains %q:\n%s", substr, body)
+	}
+}
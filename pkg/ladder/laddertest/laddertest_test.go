@@ -0,0 +1,82 @@
+package laddertest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/plugin"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/scripting"
+)
+
+type stripCookies struct{}
+
+func (stripCookies) ModifyRequest(_ context.Context, req *plugin.Request) error {
+	req.Header.Del("Cookie")
+	return nil
+}
+
+func (stripCookies) ModifyResponse(_ context.Context, resp *plugin.Response) error {
+	resp.Header.Del("Set-Cookie")
+	return nil
+}
+
+func TestChain(t *testing.T) {
+	rule := ruleset.Rule{
+		Domain:     "example.com",
+		Plugins:    []string{"strip"},
+		RegexRules: []ruleset.Regex{{Match: "paywall", Replace: "free"}},
+	}
+	rule.Headers.Cookie = "session=1"
+
+	chain := NewChain(rule, Response{
+		Header: http.Header{"Content-Type": {"text/html"}, "Set-Cookie": {"tracking=1"}},
+		Body:   "<p>paywall article</p>",
+	})
+	chain.Upstream.Responses["https://example.com/other"] = Response{StatusCode: http.StatusNotFound}
+	chain.Client.Plugins = map[string]ladder.Modifier{"strip": plugin.Wrap("strip", stripCookies{})}
+
+	result := chain.Fetch(t, "https://example.com/article?page=2", ladder.FormatHTML)
+	AssertBodyContains(t, result.Content, "free article")
+	AssertBodyNotContains(t, result.Content, "paywall")
+	AssertNoHeader(t, result.Response.Header, "Set-Cookie")
+	AssertHeader(t, result.Response.Header, "Content-Type", "text/html")
+
+	req := chain.Upstream.LastRequest()
+	AssertNoHeader(t, req.Header, "Cookie")
+	AssertHeader(t, req.Header, "User-Agent", ladder.DefaultUserAgent)
+	if req.URL.String() != "https://example.com/article?page=2" {
+		t.Errorf("upstream URL = %s", req.URL)
+	}
+
+	result = chain.Fetch(t, "https://example.com/other", ladder.FormatRaw)
+	if result.Response.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", result.Response.StatusCode, http.StatusNotFound)
+	}
+	if n := len(chain.Upstream.Requests()); n != 2 {
+		t.Errorf("upstream received %d requests, want 2", n)
+	}
+}
+
+func TestModifier(t *testing.T) {
+	m, err := scripting.Lua(
+		`request.headers["X-Test"] = "1"`,
+		`response.headers["X-Test"] = nil; response.body = string.upper(response.body)`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewRequest(t, "https://example.com")
+	ModifyRequest(t, m, req)
+	AssertHeader(t, req.Header, "X-Test", "1")
+
+	resp, body := ModifyResponse(t, m, "https://example.com", Response{
+		Header: http.Header{"X-Test": {"1"}},
+		Body:   "article",
+	})
+	AssertNoHeader(t, resp.Header, "X-Test")
+	AssertBodyContains(t, body, "ARTICLE")
+}
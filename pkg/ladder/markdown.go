@@ -0,0 +1,82 @@
+package ladder
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// markdownEscaper escapes the characters with an inline meaning in Markdown.
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+	// blockMarkerRegex matches the starts of text that Markdown would take for a block marker.
+	blockMarkerRegex = regexp.MustCompile(`^(#{1,6}\s|[-+>]\s|=+$|-+$|(\d+)([.)])\s)`)
+	// backticksRegex matches runs of backticks, which code fences must be longer than.
+	backticksRegex = regexp.MustCompile("`{3,}")
+)
+
+// Markdown renders the outline as a Markdown document, titled after the page and
+// linking to its URL, eg: to save articles into note-taking tools.
+func (o Outline) Markdown() string {
+	var sb strings.Builder
+	blocks := o.Blocks
+	if title := o.Metadata.Title; title != "" {
+		sb.WriteString("# " + escapeMarkdown(title) + "\n\n")
+		if len(blocks) > 0 && blocks[0].Type == BlockHeading && blocks[0].Level == 1 && blocks[0].Text == title {
+			blocks = blocks[1:]
+		}
+	}
+	if o.URL != "" {
+		sb.WriteString("<" + o.URL + ">\n\n")
+	}
+
+	for _, block := range blocks {
+		switch block.Type {
+		case BlockHeading:
+			level := min(max(block.Level, 1), 6)
+			sb.WriteString(strings.Repeat("#", level) + " " + escapeMarkdown(block.Text))
+		case BlockParagraph:
+			sb.WriteString(escapeMarkdown(block.Text))
+		case BlockList:
+			for i, item := range block.Items {
+				marker := "- "
+				if block.Ordered {
+					marker = strconv.Itoa(i+1) + ". "
+				}
+				if i > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(marker + escapeMarkdown(item))
+			}
+		case BlockQuote:
+			sb.WriteString("> " + strings.ReplaceAll(escapeMarkdown(block.Text), "\n", "\n> "))
+		case BlockCode:
+			fence := "```"
+			for _, run := range backticksRegex.FindAllString(block.Text, -1) {
+				if len(run) >= len(fence) {
+					fence = strings.Repeat("`", len(run)+1)
+				}
+			}
+			sb.WriteString(fence + "\n" + strings.TrimSuffix(block.Text, "\n") + "\n" + fence)
+		case BlockImage:
+			sb.WriteString("![" + escapeMarkdown(block.Text) + "](<" + block.Src + ">)")
+		default:
+			continue
+		}
+		sb.WriteString("\n\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// escapeMarkdown escapes text so that Markdown renders it as is.
+func escapeMarkdown(text string) string {
+	text = markdownEscaper.Replace(text)
+	if m := blockMarkerRegex.FindStringSubmatchIndex(text); m != nil {
+		if m[4] >= 0 {
+			// ordered list markers, eg: 1. or 1)
+			return text[:m[6]] + `\` + text[m[6]:]
+		}
+		return `\` + text
+	}
+	return text
+}
@@ -0,0 +1,36 @@
+package ladder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlineMarkdown(t *testing.T) {
+	outline := Outline{
+		URL:      "https://www.example.com/news/article",
+		Metadata: Metadata{Title: "Ladder *released*"},
+		Blocks: []Block{
+			{Type: BlockHeading, Level: 1, Text: "Ladder *released*"},
+			{Type: BlockParagraph, Text: "Ladder 1.0 is out, see [notes] and <changes>."},
+			{Type: BlockParagraph, Text: "1. not a list"},
+			{Type: BlockHeading, Level: 2, Text: "Install"},
+			{Type: BlockList, Items: []string{"Download", "Run"}, Ordered: true},
+			{Type: BlockList, Items: []string{"fast", "small"}},
+			{Type: BlockCode, Text: "```\nladder --port 8080\n"},
+			{Type: BlockQuote, Text: "# It works"},
+			{Type: BlockImage, Text: "Screenshot", Src: "https://www.example.com/a b.png"},
+		},
+	}
+
+	assert.Equal(t, "# Ladder \\*released\\*\n\n"+
+		"<https://www.example.com/news/article>\n\n"+
+		"Ladder 1.0 is out, see \\[notes\\] and \\<changes>.\n\n"+
+		"1\\. not a list\n\n"+
+		"## Install\n\n"+
+		"1. Download\n2. Run\n\n"+
+		"- fast\n- small\n\n"+
+		"````\n```\nladder --port 8080\n````\n\n"+
+		"> \\# It works\n\n"+
+		"![Screenshot](<https://www.example.com/a b.png>)\n", outline.Markdown())
+}
@@ -0,0 +1,65 @@
+package ladder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// masquerade is the request headers of a crawler many paywalls let through, so that
+// their articles show up in search results and social previews.
+type masquerade struct {
+	userAgent string
+	// referer is sent instead of the URL of the page, empty keeps it.
+	referer string
+	// forwardedFor is the crawler whose addresses are sent as X-Forwarded-For, see botips.Get.
+	forwardedFor string
+}
+
+// masquerades maps the crawler names usable as Client.Masquerade and in rules to their headers.
+var masquerades = map[string]masquerade{
+	"googlebot": {
+		userAgent:    DefaultUserAgent,
+		forwardedFor: "googlebot",
+	},
+	"bingbot": {
+		userAgent:    "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		forwardedFor: "bingbot",
+	},
+	"facebookbot": {
+		userAgent:    "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		referer:      "https://www.facebook.com/",
+		forwardedFor: "facebookbot",
+	},
+	"twitterbot": {
+		userAgent:    "Twitterbot/1.0",
+		referer:      "https://t.co/",
+		forwardedFor: "twitterbot",
+	},
+	"linkedinbot": {
+		userAgent:    "LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)",
+		referer:      "https://www.linkedin.com/",
+		forwardedFor: "linkedinbot",
+	},
+}
+
+// Masquerades returns the sorted names of the crawlers that requests can masquerade as.
+func Masquerades() []string {
+	names := make([]string, 0, len(masquerades))
+	for name := range masquerades {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateMasquerade checks that requests can masquerade as the crawler name.
+func ValidateMasquerade(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := masquerades[strings.ToLower(name)]; !ok {
+		return fmt.Errorf("unknown masquerade '%s', available: %s", name, strings.Join(Masquerades(), ", "))
+	}
+	return nil
+}
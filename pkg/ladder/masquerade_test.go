@@ -0,0 +1,61 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ladder/pkg/botips"
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMasquerade(t *testing.T) {
+	assert.NoError(t, ValidateMasquerade(""))
+	assert.NoError(t, ValidateMasquerade("FacebookBot"))
+	assert.ErrorContains(t, ValidateMasquerade("yahoo"), "available: bingbot, facebookbot, googlebot, linkedinbot, twitterbot")
+}
+
+func TestFetchMasquerade(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join([]string{r.UserAgent(), r.Referer(), r.Header.Get("X-Forwarded-For")}, "|")))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Headers.Masquerade = "twitterbot"
+	client := NewClient(ruleset.RuleSet{rule})
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	headers := strings.Split(result.Content, "|")
+	assert.Equal(t, "Twitterbot/1.0", headers[0])
+	assert.Equal(t, "https://t.co/", headers[1])
+	assert.True(t, botips.Get("twitterbot").Contains(headers[2]), headers[2])
+
+	// the headers of the rule override those of the crawler
+	rule.Headers.UserAgent = "custom/1.0"
+	rule.Headers.Referer = "none"
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	headers = strings.Split(result.Content, "|")
+	assert.Equal(t, []string{"custom/1.0", ""}, headers[:2])
+	assert.True(t, botips.Get("twitterbot").Contains(headers[2]), headers[2])
+
+	// the masquerade of the Client applies to the sites whose rule doesn't set one
+	client = NewClient(nil)
+	client.Masquerade = "linkedinbot"
+	result, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result.Content, "LinkedInBot/1.0"), result.Content)
+
+	client.Masquerade = "yahoo"
+	_, err = client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	assert.ErrorContains(t, err, "unknown masquerade 'yahoo'")
+}
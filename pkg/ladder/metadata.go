@@ -0,0 +1,159 @@
+package ladder
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// openGraphPrefixes are the prefixes of the OpenGraph properties, those of the object types included.
+var openGraphPrefixes = []string{"og:", "article:", "book:", "profile:", "video:", "music:"}
+
+// PageMetadata is the metadata of a page for link previews and bookmarks: its Metadata,
+// with the image and canonical URL resolved, along with its raw OpenGraph and Twitter
+// card properties and JSON-LD documents.
+type PageMetadata struct {
+	URL string `json:"url"`
+	Metadata
+	// Icon is the absolute URL of the icon declared by the page, if any.
+	Icon string `json:"icon,omitempty"`
+	// OpenGraph holds the OpenGraph properties of the page, eg: og:title. Repeated properties keep their first value.
+	OpenGraph map[string]string `json:"openGraph"`
+	// Twitter holds the Twitter card properties of the page, eg: twitter:card.
+	Twitter map[string]string `json:"twitter"`
+	// JSONLD are the valid JSON-LD documents of the page, eg: its schema.org NewsArticle.
+	JSONLD []json.RawMessage `json:"jsonLd"`
+}
+
+// ExtractPageMetadata extracts the PageMetadata of the HTML document body, fetched from pageURL.
+func ExtractPageMetadata(body string, pageURL string) PageMetadata {
+	doc, err := parseDocument(body)
+	if err != nil {
+		return newPageMetadata(pageURL)
+	}
+	return pageMetadataFromDocument(doc, pageURL)
+}
+
+// newPageMetadata returns the empty PageMetadata of pageURL.
+func newPageMetadata(pageURL string) PageMetadata {
+	return PageMetadata{URL: pageURL, OpenGraph: map[string]string{}, Twitter: map[string]string{}, JSONLD: []json.RawMessage{}}
+}
+
+// pageMetadataFromDocument extracts the PageMetadata of doc, fetched from pageURL. The author
+// and publication date missing from the meta tags are taken from the JSON-LD documents.
+func pageMetadataFromDocument(doc *goquery.Document, pageURL string) PageMetadata {
+	md := newPageMetadata(pageURL)
+	md.Metadata = metadataFromDocument(doc)
+
+	doc.Find("meta[property], meta[name]").Each(func(_ int, s *goquery.Selection) {
+		key := strings.ToLower(strings.TrimSpace(s.AttrOr("property", s.AttrOr("name", ""))))
+		content := strings.TrimSpace(s.AttrOr("content", ""))
+		if content == "" {
+			return
+		}
+		properties := md.OpenGraph
+		if strings.HasPrefix(key, "twitter:") {
+			properties = md.Twitter
+		} else if !hasAnyPrefix(key, openGraphPrefixes) {
+			return
+		}
+		if _, ok := properties[key]; !ok {
+			properties[key] = content
+		}
+	})
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, s *goquery.Selection) {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(strings.TrimSpace(s.Text()))); err != nil {
+			return
+		}
+		md.JSONLD = append(md.JSONLD, buf.Bytes())
+		author, published := jsonLDArticle(buf.Bytes())
+		if md.Author == "" {
+			md.Author = author
+		}
+		if md.PublishedTime == "" {
+			md.PublishedTime = published
+		}
+	})
+
+	if base, err := url.Parse(pageURL); err == nil {
+		resolve := func(ref string) string {
+			if ref == "" {
+				return ""
+			}
+			if u, err := base.Parse(ref); err == nil {
+				return u.String()
+			}
+			return ref
+		}
+		md.Image = resolve(md.Image)
+		md.Canonical = resolve(md.Canonical)
+		md.Icon = resolve(doc.Find(`link[rel~="icon"], link[rel="apple-touch-icon"]`).First().AttrOr("href", ""))
+	}
+	return md
+}
+
+// jsonLDArticle returns the author and publication date of the first object of the JSON-LD
+// document doc, or of its @graph, that has them.
+func jsonLDArticle(doc []byte) (author string, published string) {
+	var v any
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return "", ""
+	}
+	var objects []any
+	switch v := v.(type) {
+	case []any:
+		objects = v
+	case map[string]any:
+		objects = []any{v}
+		if graph, ok := v["@graph"].([]any); ok {
+			objects = append(objects, graph...)
+		}
+	}
+	for _, o := range objects {
+		object, ok := o.(map[string]any)
+		if !ok {
+			continue
+		}
+		if author == "" {
+			author = jsonLDName(object["author"])
+		}
+		if date, ok := object["datePublished"].(string); ok && published == "" {
+			published = date
+		}
+	}
+	return author, published
+}
+
+// jsonLDName returns the name of v, a JSON-LD person or organization, a list of them or a plain name.
+func jsonLDName(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any:
+		name, _ := v["name"].(string)
+		return name
+	case []any:
+		var names []string
+		for _, item := range v {
+			if name := jsonLDName(item); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package ladder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractPageMetadata(t *testing.T) {
+	body := `<html lang="en"><head>
+<title>Fallback</title>
+<meta property="og:title" content="Ladder and friends">
+<meta property="og:image" content="/cover.jpg">
+<meta property="og:image" content="/second.jpg">
+<meta property="og:type" content="article">
+<meta property="article:section" content="Tech">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="viewport" content="width=device-width">
+<link rel="shortcut icon" href="/favicon.ico">
+<link rel="canonical" href="/news/article">
+<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [{"@type": "WebSite"}, {"@type": "NewsArticle", "author": [{"@type": "Person", "name": "Jane Doe"}, {"name": "John Doe"}], "datePublished": "2024-01-02T15:04:05Z"}]}</script>
+<script type="application/ld+json">{invalid</script>
+</head><body><p>text</p></body></html>`
+
+	md := ExtractPageMetadata(body, "https://www.example.com/news/article?utm=1")
+	assert.Equal(t, "https://www.example.com/news/article?utm=1", md.URL)
+	assert.Equal(t, "Ladder and friends", md.Title)
+	assert.Equal(t, "Jane Doe, John Doe", md.Author)
+	assert.Equal(t, "2024-01-02T15:04:05Z", md.PublishedTime)
+	assert.Equal(t, "https://www.example.com/cover.jpg", md.Image)
+	assert.Equal(t, "https://www.example.com/news/article", md.Canonical)
+	assert.Equal(t, "https://www.example.com/favicon.ico", md.Icon)
+	assert.Equal(t, map[string]string{
+		"og:title":        "Ladder and friends",
+		"og:image":        "/cover.jpg",
+		"og:type":         "article",
+		"article:section": "Tech",
+	}, md.OpenGraph)
+	assert.Equal(t, map[string]string{"twitter:card": "summary_large_image"}, md.Twitter)
+	assert.Len(t, md.JSONLD, 1)
+
+	b, err := json.Marshal(md)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"title":"Ladder and friends"`)
+	assert.Contains(t, string(b), `"jsonLd":[{"@context":"https://schema.org","@graph":[{"@type":"WebSite"}`)
+}
+
+func TestExtractPageMetadataEmpty(t *testing.T) {
+	b, err := json.Marshal(ExtractPageMetadata("", "https://www.example.com/"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"url":"https://www.example.com/","openGraph":{},"twitter":{},"jsonLd":[]}`, string(b))
+}
@@ -0,0 +1,208 @@
+package ladder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"ladder/pkg/events"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/scripting"
+	"ladder/pkg/tracing"
+	"ladder/pkg/wasm"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Modifier is implemented by custom request and response modifiers, such as plugins.
+// Modifiers run in the order they are referenced by a rule: ModifyRequest right
+// before the upstream request is sent, ModifyResponse on the upstream body before
+// the rule's regex rules and injections are applied.
+type Modifier interface {
+	// ModifyRequest modifies the request sent upstream.
+	ModifyRequest(req *http.Request) error
+	// ModifyResponse modifies the upstream response and returns the modified body.
+	// body is backed by a pooled buffer and must not be retained after ModifyResponse returns.
+	ModifyResponse(resp *http.Response, body []byte) ([]byte, error)
+}
+
+// RequestBodyModifier is implemented by the Modifiers rewriting the bodies of the requests
+// sent upstream, eg: the fields of search forms. Request bodies are buffered, up to
+// MaxRequestBodySize, to be rewritten after every ModifyRequest ran.
+type RequestBodyModifier interface {
+	// ModifyRequestBody modifies the body of the request sent upstream and returns the modified body.
+	ModifyRequestBody(req *http.Request, body []byte) ([]byte, error)
+}
+
+// MaxRequestBodySize bounds the size of the request bodies rewritten by RequestBodyModifiers.
+var MaxRequestBodySize int64 = 10 << 20
+
+// namedModifier is a Modifier along with the name it is reported under in debug events.
+type namedModifier struct {
+	Modifier
+	name string
+}
+
+// observeModifier starts tracing and timing the modifier name applied to target, in phase,
+// request or response, and returns the func ending it with the error of the modifier, which
+// reports it to t along with its duration.
+func (c *Client) observeModifier(ctx context.Context, t tracer, name, phase, target string) func(error) {
+	start := time.Now()
+	_, span := c.startSpan(ctx, "modifier "+name, trace.WithAttributes(attribute.String("ladder.phase", phase)))
+	return func(err error) {
+		d := time.Since(start)
+		tracing.RecordError(span, err)
+		span.End()
+		c.Metrics.Modifier(name, phase, d)
+		if t.active() {
+			data := map[string]string{"modifier": name, "phase": phase, "duration": d.String()}
+			if err != nil {
+				data["error"] = err.Error()
+			}
+			t.emit(events.TypeModifier, "applied "+name+" to "+target, data)
+		}
+	}
+}
+
+// modifyRequestBody buffers the body of req and rewrites it with the RequestBodyModifiers of
+// modifiers, if any.
+func (c *Client) modifyRequestBody(ctx context.Context, req *http.Request, modifiers []namedModifier, t tracer) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	var body []byte
+	buffered := false
+	for _, m := range modifiers {
+		bm, ok := m.Modifier.(RequestBodyModifier)
+		if !ok {
+			continue
+		}
+		if !buffered {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(req.Body, MaxRequestBodySize+1))
+			if err != nil {
+				return err
+			}
+			if int64(len(body)) > MaxRequestBodySize {
+				return fmt.Errorf("request body larger than %d bytes can't be rewritten by %s", MaxRequestBodySize, m.name)
+			}
+			buffered = true
+		}
+		var err error
+		done := c.observeModifier(ctx, t, m.name, "request", "request body")
+		body, err = bm.ModifyRequestBody(req, body)
+		done(err)
+		if err != nil {
+			return err
+		}
+	}
+	if buffered {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		// buffered bodies can be sent again on 307 and 308 redirects
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	return nil
+}
+
+// modifierLists pools the per-fetch lists of modifiers, so that concurrent fetches
+// through a shared Client don't allocate a new list every time.
+var modifierLists = sync.Pool{
+	New: func() any {
+		return &modifierList{}
+	},
+}
+
+// modifierList holds the modifiers of one fetch.
+type modifierList struct {
+	modifiers []namedModifier
+}
+
+// release clears l and returns it to the pool. l must not be used afterwards.
+func (l *modifierList) release() {
+	clear(l.modifiers)
+	l.modifiers = l.modifiers[:0]
+	modifierLists.Put(l)
+}
+
+// modifiers returns the Modifiers referenced by rule: the AMP rewrite first, then registered
+// modifiers, plugins, WASM modules and scripts.
+// The list must be released once the fetch is done with it.
+func (c *Client) modifiers(rule ruleset.Rule) (*modifierList, error) {
+	l := modifierLists.Get().(*modifierList)
+	if err := c.appendModifiers(l, rule); err != nil {
+		l.release()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *Client) appendModifiers(l *modifierList, rule ruleset.Rule) error {
+	modifiers := l.modifiers
+	defer func() { l.modifiers = modifiers }()
+
+	switch rule.AMP {
+	case "":
+	case AMPCanonical:
+		modifiers = append(modifiers, namedModifier{ResolveCanonicalFromAMP(), "amp canonical"})
+	default:
+		m, err := RequestAMPVersion(rule.AMP)
+		if err != nil {
+			return err
+		}
+		modifiers = append(modifiers, namedModifier{m, "amp " + rule.AMP})
+	}
+
+	for _, ref := range rule.Modifiers {
+		m, err := NewModifier(ref.Name, ref.Params...)
+		if err != nil {
+			return err
+		}
+		modifiers = append(modifiers, namedModifier{m, "modifier " + ref.Name})
+	}
+
+	for _, name := range rule.Plugins {
+		m, ok := c.Plugins[name]
+		if !ok {
+			return fmt.Errorf("plugin '%s' referenced by ruleset is not loaded", name)
+		}
+		modifiers = append(modifiers, namedModifier{m, "plugin " + name})
+	}
+
+	if len(rule.Wasm) > 0 {
+		c.wasmOnce.Do(func() {
+			if c.Wasm == nil {
+				c.Wasm = wasm.NewRuntime(wasm.DefaultLimits)
+			}
+		})
+	}
+	for _, path := range rule.Wasm {
+		m, err := c.Wasm.Load(path)
+		if err != nil {
+			return err
+		}
+		modifiers = append(modifiers, namedModifier{m, "wasm " + path})
+	}
+
+	if rule.Lua != (ruleset.Script{}) {
+		m, err := scripting.Lua(rule.Lua.Request, rule.Lua.Response)
+		if err != nil {
+			return err
+		}
+		modifiers = append(modifiers, namedModifier{m, "lua"})
+	}
+
+	if rule.JS != (ruleset.Script{}) {
+		m, err := scripting.JS(rule.JS.Request, rule.JS.Response)
+		if err != nil {
+			return err
+		}
+		modifiers = append(modifiers, namedModifier{m, "js"})
+	}
+	return nil
+}
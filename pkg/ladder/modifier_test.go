@@ -0,0 +1,38 @@
+package ladder
+
+import (
+	"net/http"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopModifier struct{}
+
+func (nopModifier) ModifyRequest(*http.Request) error { return nil }
+
+func (nopModifier) ModifyResponse(_ *http.Response, body []byte) ([]byte, error) { return body, nil }
+
+func TestModifiers(t *testing.T) {
+	client := NewClient(nil)
+	client.Plugins = map[string]Modifier{"a": nopModifier{}, "b": nopModifier{}}
+
+	list, err := client.modifiers(ruleset.Rule{Plugins: []string{"a", "b"}})
+	require.NoError(t, err)
+	require.Len(t, list.modifiers, 2)
+	assert.Equal(t, "plugin a", list.modifiers[0].name)
+	assert.Equal(t, "plugin b", list.modifiers[1].name)
+
+	// released lists drop their modifiers but keep their capacity
+	modifiers := list.modifiers
+	list.release()
+	assert.Empty(t, list.modifiers)
+	assert.Equal(t, namedModifier{}, modifiers[0])
+	assert.GreaterOrEqual(t, cap(list.modifiers), 2)
+
+	_, err = client.modifiers(ruleset.Rule{Plugins: []string{"a", "missing"}})
+	assert.ErrorContains(t, err, "plugin 'missing' referenced by ruleset is not loaded")
+}
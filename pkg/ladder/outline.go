@@ -0,0 +1,158 @@
+package ladder
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// BlockType is the kind of a content Block.
+type BlockType string
+
+const (
+	BlockHeading   BlockType = "heading"
+	BlockParagraph BlockType = "paragraph"
+	BlockList      BlockType = "list"
+	BlockQuote     BlockType = "quote"
+	BlockCode      BlockType = "code"
+	BlockImage     BlockType = "image"
+)
+
+// Outline is the structured representation of the main content of a page,
+// stripped of navigation, ads and other boilerplate.
+type Outline struct {
+	URL      string   `json:"url"`
+	Metadata Metadata `json:"metadata"`
+	Blocks   []Block  `json:"blocks"`
+}
+
+// Block is a single element of the content of an Outline.
+type Block struct {
+	Type BlockType `json:"type"`
+	// Level is the level of a heading, from 1 to 6.
+	Level int `json:"level,omitempty"`
+	// Text is the text of a heading, paragraph, quote or code block, or the alt text of an image.
+	Text string `json:"text,omitempty"`
+	// Items are the entries of a list.
+	Items []string `json:"items,omitempty"`
+	// Ordered is set for numbered lists.
+	Ordered bool `json:"ordered,omitempty"`
+	// Src is the absolute URL of an image.
+	Src string `json:"src,omitempty"`
+}
+
+// boilerplateSelector matches elements that never contain the main content.
+const boilerplateSelector = "script, style, noscript, template, svg, iframe, form, nav, header, footer, aside, " +
+	`[role="navigation"], [role="banner"], [role="contentinfo"], [aria-hidden="true"]`
+
+// blockSelector matches the elements converted into blocks.
+const blockSelector = "h1, h2, h3, h4, h5, h6, p, ul, ol, blockquote, pre, img"
+
+var spaceRegex = regexp.MustCompile(`\s+`)
+
+// ExtractOutline extracts the Outline of the HTML document body, fetched from pageURL.
+func ExtractOutline(body string, pageURL string) Outline {
+	doc, err := parseDocument(body)
+	if err != nil {
+		return Outline{URL: pageURL, Blocks: []Block{}}
+	}
+	return outlineFromDocument(doc, pageURL, metadataFromDocument(doc))
+}
+
+// outlineFromDocument extracts the Outline with the metadata md from doc, fetched from pageURL.
+// It removes the boilerplate elements of doc.
+func outlineFromDocument(doc *goquery.Document, pageURL string, md Metadata) Outline {
+	outline := Outline{URL: pageURL, Metadata: md, Blocks: []Block{}}
+
+	base, _ := url.Parse(pageURL)
+	doc.Find(boilerplateSelector).Remove()
+
+	content := mainContent(doc)
+	content.Find(blockSelector).Each(func(_ int, s *goquery.Selection) {
+		// nested elements are part of the text of their container block
+		if s.ParentsFiltered("ul, ol, blockquote, pre").Length() > 0 {
+			return
+		}
+		if block, ok := toBlock(s, base); ok {
+			outline.Blocks = append(outline.Blocks, block)
+		}
+	})
+
+	return outline
+}
+
+// mainContent returns the element holding the main content of doc: the article or
+// main element if there is exactly one, otherwise the element with the most paragraph text.
+func mainContent(doc *goquery.Document) *goquery.Selection {
+	for _, selector := range []string{"article", "main", `[role="main"]`} {
+		if s := doc.Find(selector); s.Length() == 1 {
+			return s
+		}
+	}
+
+	scores := map[*html.Node]int{}
+	var best *html.Node
+	doc.Find("p").Each(func(_ int, p *goquery.Selection) {
+		parent := p.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		node := parent.Get(0)
+		scores[node] += len(strings.TrimSpace(p.Text()))
+		if best == nil || scores[node] > scores[best] {
+			best = node
+		}
+	})
+
+	if best == nil {
+		return doc.Find("body")
+	}
+	return doc.FindNodes(best)
+}
+
+// toBlock converts s into a Block. It reports false for elements without content.
+func toBlock(s *goquery.Selection, base *url.URL) (Block, bool) {
+	tag := goquery.NodeName(s)
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := cleanText(s.Text())
+		return Block{Type: BlockHeading, Level: int(tag[1] - '0'), Text: text}, text != ""
+	case "p":
+		text := cleanText(s.Text())
+		return Block{Type: BlockParagraph, Text: text}, text != ""
+	case "blockquote":
+		text := cleanText(s.Text())
+		return Block{Type: BlockQuote, Text: text}, text != ""
+	case "pre":
+		text := strings.Trim(s.Text(), "\n")
+		return Block{Type: BlockCode, Text: text}, strings.TrimSpace(text) != ""
+	case "ul", "ol":
+		items := []string{}
+		s.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+			if text := cleanText(li.Text()); text != "" {
+				items = append(items, text)
+			}
+		})
+		return Block{Type: BlockList, Items: items, Ordered: tag == "ol"}, len(items) > 0
+	case "img":
+		src := s.AttrOr("src", s.AttrOr("data-src", ""))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return Block{}, false
+		}
+		if base != nil {
+			if u, err := base.Parse(src); err == nil {
+				src = u.String()
+			}
+		}
+		return Block{Type: BlockImage, Src: src, Text: cleanText(s.AttrOr("alt", ""))}, true
+	}
+	return Block{}, false
+}
+
+// cleanText collapses all whitespace of text into single spaces.
+func cleanText(text string) string {
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(text, " "))
+}
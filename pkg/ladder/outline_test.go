@@ -0,0 +1,47 @@
+package ladder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractOutline(t *testing.T) {
+	body := `
+		<html lang="en">
+			<head>
+				<title>Fallback Title</title>
+				<meta property="og:title" content="Article Title">
+				<meta name="author" content="Jane Doe">
+			</head>
+			<body>
+				<nav><p>Home | News | Sports</p></nav>
+				<div class="sidebar"><p>Ad</p></div>
+				<div class="content">
+					<h1>Article   Title</h1>
+					<p>First paragraph of the article.</p>
+					<img src="/images/photo.jpg" alt="A photo">
+					<ul><li>One</li><li>Two <p>nested</p></li></ul>
+					<blockquote><p>A quote.</p></blockquote>
+					<p>Second paragraph of the article.</p>
+					<script>var paywall = true;</script>
+				</div>
+				<footer><p>Copyright</p></footer>
+			</body>
+		</html>`
+
+	outline := ExtractOutline(body, "https://example.com/news/article")
+
+	assert.Equal(t, "https://example.com/news/article", outline.URL)
+	assert.Equal(t, "Article Title", outline.Metadata.Title)
+	assert.Equal(t, "Jane Doe", outline.Metadata.Author)
+	assert.Equal(t, "en", outline.Metadata.Language)
+	assert.Equal(t, []Block{
+		{Type: BlockHeading, Level: 1, Text: "Article Title"},
+		{Type: BlockParagraph, Text: "First paragraph of the article."},
+		{Type: BlockImage, Src: "https://example.com/images/photo.jpg", Text: "A photo"},
+		{Type: BlockList, Items: []string{"One", "Two nested"}},
+		{Type: BlockQuote, Text: "A quote."},
+		{Type: BlockParagraph, Text: "Second paragraph of the article."},
+	}, outline.Blocks)
+}
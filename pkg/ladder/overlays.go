@@ -0,0 +1,67 @@
+package ladder
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// paywallNameRegex matches the class names and ids commonly used by paywall and
+	// registration wall elements and their backdrops.
+	paywallNameRegex = regexp.MustCompile(`(?i)(^|[\s_-])(paywall|pay-wall|regwall|reg-wall|piano-offer|tp-modal|tp-backdrop|tp-container-inner|subscribe-wall|subscription-wall|meter-?wall|premium-overlay|article-gate|fc-ab-root)([\s_-]|$)`)
+	// fixedRegex matches fixed positioning in inline styles.
+	fixedRegex = regexp.MustCompile(`(?i)position\s*:\s*fixed`)
+	// fullViewportRegex matches inline styles stretching an element over the viewport.
+	fullViewportRegex = regexp.MustCompile(`(?i)(inset\s*:\s*0|(width\s*:\s*(100%|100vw)|right\s*:\s*0).*(height\s*:\s*(100%|100vh)|bottom\s*:\s*0)|(height\s*:\s*(100%|100vh)|bottom\s*:\s*0).*(width\s*:\s*(100%|100vw)|right\s*:\s*0))`)
+	// overflowHiddenRegex matches the inline declarations preventing a page from scrolling.
+	overflowHiddenRegex = regexp.MustCompile(`(?i)overflow(-y)?\s*:\s*hidden\s*(!important)?\s*;?`)
+	// scrollLockClasses are the classes sites set on html or body to prevent scrolling behind a modal.
+	scrollLockClasses = []string{"modal-open", "no-scroll", "noscroll", "overflow-hidden", "scroll-lock", "tp-modal-open", "is-locked"}
+)
+
+// unlockScrollStyle restores scrolling of pages locked by stylesheets.
+const unlockScrollStyle = `<style>html, body { overflow: auto !important; }</style>`
+
+// maxOverlayText is the length of text above which an element is taken for content
+// rather than an overlay, so that articles wrapped in a paywall container are kept.
+const maxOverlayText = 1000
+
+// stripPaywallOverlays removes the elements of doc that look like paywall overlays:
+// elements named like paywalls and fixed elements covering the viewport, unless they
+// hold the content of the page. It also lets the page scroll again.
+func stripPaywallOverlays(doc *goquery.Document) {
+	doc.Find("body *").Each(func(_ int, s *goquery.Selection) {
+		if isOverlay(s) && !isContent(s) {
+			s.Remove()
+		}
+	})
+
+	doc.Find("html, body").Each(func(_ int, s *goquery.Selection) {
+		if style, ok := s.Attr("style"); ok {
+			s.SetAttr("style", strings.TrimSpace(overflowHiddenRegex.ReplaceAllString(style, "")))
+		}
+		for _, class := range scrollLockClasses {
+			s.RemoveClass(class)
+		}
+	})
+	doc.Find("head").AppendHtml(unlockScrollStyle)
+}
+
+// isOverlay reports whether s is named like a paywall or is a fixed element covering the viewport.
+func isOverlay(s *goquery.Selection) bool {
+	if paywallNameRegex.MatchString(s.AttrOr("class", "")) || paywallNameRegex.MatchString(s.AttrOr("id", "")) {
+		return true
+	}
+	style := s.AttrOr("style", "")
+	return fixedRegex.MatchString(style) && fullViewportRegex.MatchString(style)
+}
+
+// isContent reports whether s holds the content of the page.
+func isContent(s *goquery.Selection) bool {
+	if s.Is("article, main") || s.Find("article, main").Length() > 0 {
+		return true
+	}
+	return len(strings.TrimSpace(s.Text())) > maxOverlayText
+}
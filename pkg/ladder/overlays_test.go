@@ -0,0 +1,45 @@
+package ladder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripPaywallOverlays(t *testing.T) {
+	article := strings.Repeat("<p>Lorem ipsum dolor sit amet, consectetur adipiscing elit.</p>", 30)
+	page := `<html style="overflow: hidden;"><head></head><body class="article tp-modal-open" style="overflow-y:hidden !important; margin: 0">
+<div class="paywall-content">` + article + `</div>
+<div class="tp-modal"><p>Subscribe to continue reading</p></div>
+<div id="regwall"><p>Register for free</p></div>
+<div style="position: fixed; top: 0; left: 0; width: 100%; height: 100vh; z-index: 9999"><p>Please disable your ad blocker</p></div>
+<div style="position:fixed; inset:0; background: rgba(0,0,0,.5)"></div>
+<header style="position: fixed; top: 0; width: 100%; height: 60px">Site</header>
+<div class="wallpaper">Nice wallpaper</div>
+<main class="paywall"><p>main content</p></main>
+</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	require.NoError(t, err)
+	stripPaywallOverlays(doc)
+	html, err := doc.Html()
+	require.NoError(t, err)
+
+	assert.NotContains(t, html, "Subscribe to continue reading")
+	assert.NotContains(t, html, "Register for free")
+	assert.NotContains(t, html, "ad blocker")
+	assert.NotContains(t, html, "rgba(0,0,0,.5)")
+	assert.NotContains(t, html, "overflow: hidden")
+	assert.NotContains(t, html, "tp-modal-open")
+
+	// content, headers and lookalike names are kept
+	assert.Contains(t, html, article)
+	assert.Contains(t, html, "main content")
+	assert.Contains(t, html, ">Site</header>")
+	assert.Contains(t, html, "Nice wallpaper")
+	assert.Contains(t, html, `<body class="article" style="margin: 0">`)
+	assert.Contains(t, html, unlockScrollStyle)
+}
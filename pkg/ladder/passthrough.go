@@ -0,0 +1,121 @@
+package ladder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ladder/pkg/ruleset"
+)
+
+// PassthroughHeaders are the upstream response headers that servers forward to
+// the client along with passthrough bodies, besides Content-Type and Content-Length.
+var PassthroughHeaders = []string{
+	"Accept-Ranges",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Range",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+}
+
+// textTypes are the media types, besides text, XML and JSON types, whose bodies
+// ladder may rewrite.
+var textTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"application/json":         true,
+	"application/xml":          true,
+	"application/xhtml+xml":    true,
+}
+
+// isBinary reports whether resp declares a content type that ladder never rewrites,
+// such as images, video, fonts, PDFs, archives and multipart bodies.
+// Responses without a content type may be HTML and are not binary.
+func isBinary(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"),
+		textTypes[mediaType]:
+		return false
+	}
+	return true
+}
+
+// isEventStream reports whether resp is a stream of Server-Sent Events, eg: the updates of a
+// liveblog, which is passed through as it arrives.
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// modifiesBody reports whether rule references modifiers that may process response bodies.
+func modifiesBody(rule ruleset.Rule) bool {
+	return len(rule.Plugins) > 0 || len(rule.Wasm) > 0 || rule.Lua.Response != "" || rule.JS.Response != ""
+}
+
+// canPassthrough reports whether resp can be returned unbuffered according to opts and rule.
+// Raw responses and event streams always can, as they skip the response modifiers, and so do
+// partial content responses, whose byte ranges rewriting them would break, and HEAD responses,
+// which have no body.
+func canPassthrough(opts FetchOptions, rule ruleset.Rule, resp *http.Response) bool {
+	if !opts.Passthrough || (opts.Format != FormatHTML && opts.Format != FormatRaw) {
+		return false
+	}
+	return opts.Format == FormatRaw || opts.Method == http.MethodHead || isEventStream(resp) ||
+		resp.StatusCode == http.StatusPartialContent || (!modifiesBody(rule) && isBinary(resp))
+}
+
+// streamBody is a passthrough response body. Reading it is bounded by the body
+// timeout, and closing it releases the upstream request.
+type streamBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+	cancel  context.CancelFunc
+}
+
+// newStreamBody wraps body, cancelling its request with cancel once timeout elapses.
+func newStreamBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *streamBody {
+	b := &streamBody{ReadCloser: body, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.expired.Store(true)
+			cancel()
+		})
+	}
+	return b
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && b.expired.Load() {
+		return n, fmt.Errorf("reading response body timed out after %s", b.timeout)
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
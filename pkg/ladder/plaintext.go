@@ -0,0 +1,66 @@
+package ladder
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PlainText renders the outline as plain text, starting with the title and byline
+// of the page, eg: for scripts or text-to-speech. Images are left out.
+func (o Outline) PlainText() string {
+	var sb strings.Builder
+	blocks := o.Blocks
+	if title := o.Metadata.Title; title != "" {
+		sb.WriteString(title + "\n")
+		if len(blocks) > 0 && blocks[0].Type == BlockHeading && blocks[0].Level == 1 && blocks[0].Text == title {
+			blocks = blocks[1:]
+		}
+	}
+	if byline := o.Byline(); byline != "" {
+		sb.WriteString(byline + "\n")
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+
+	for _, block := range blocks {
+		switch block.Type {
+		case BlockHeading, BlockParagraph, BlockQuote:
+			sb.WriteString(block.Text)
+		case BlockCode:
+			sb.WriteString(strings.TrimSuffix(block.Text, "\n"))
+		case BlockList:
+			for i, item := range block.Items {
+				marker := "- "
+				if block.Ordered {
+					marker = strconv.Itoa(i+1) + ". "
+				}
+				if i > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(marker + item)
+			}
+		default:
+			continue
+		}
+		sb.WriteString("\n\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Byline returns the author, site and publication date of the page, those known.
+func (o Outline) Byline() string {
+	var parts []string
+	if o.Metadata.Author != "" {
+		parts = append(parts, "By "+o.Metadata.Author)
+	}
+	if o.Metadata.SiteName != "" {
+		parts = append(parts, o.Metadata.SiteName)
+	}
+	if published := o.Metadata.PublishedTime; published != "" {
+		// dates are shown without their time, eg: 2024-01-02T15:04:05Z
+		date, _, _ := strings.Cut(published, "T")
+		parts = append(parts, date)
+	}
+	return strings.Join(parts, " · ")
+}
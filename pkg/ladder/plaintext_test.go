@@ -0,0 +1,38 @@
+package ladder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlinePlainText(t *testing.T) {
+	outline := Outline{
+		URL: "https://www.example.com/news/article",
+		Metadata: Metadata{
+			Title:         "Ladder released",
+			Author:        "Jane Doe",
+			SiteName:      "Example News",
+			PublishedTime: "2024-01-02T15:04:05Z",
+		},
+		Blocks: []Block{
+			{Type: BlockHeading, Level: 1, Text: "Ladder released"},
+			{Type: BlockParagraph, Text: "Ladder 1.0 is *out*."},
+			{Type: BlockImage, Text: "Screenshot", Src: "https://www.example.com/a.png"},
+			{Type: BlockHeading, Level: 2, Text: "Install"},
+			{Type: BlockList, Items: []string{"Download", "Run"}, Ordered: true},
+			{Type: BlockCode, Text: "ladder --port 8080\n"},
+			{Type: BlockQuote, Text: "It works"},
+		},
+	}
+
+	assert.Equal(t, "Ladder released\n"+
+		"By Jane Doe · Example News · 2024-01-02\n\n"+
+		"Ladder 1.0 is *out*.\n\n"+
+		"Install\n\n"+
+		"1. Download\n2. Run\n\n"+
+		"ladder --port 8080\n\n"+
+		"It works\n", outline.PlainText())
+
+	assert.Equal(t, "article\n", Outline{Blocks: []Block{{Type: BlockParagraph, Text: "article"}}}.PlainText())
+}
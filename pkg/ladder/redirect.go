@@ -0,0 +1,120 @@
+package ladder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ladder/pkg/events"
+	"ladder/pkg/ssrf"
+)
+
+// ErrRedirectLoop is wrapped by the errors of fetches whose upstream redirects loop, or lead
+// back into the ladder instance.
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// maxRedirectVisits is the number of times a redirect chain may request the same URL, as sites
+// checking cookies redirect back to the page once they're set.
+const maxRedirectVisits = 2
+
+// redirectPolicy decides which upstream redirects of a fetch are followed.
+type redirectPolicy struct {
+	// max is the number of redirects followed.
+	max int
+	// sameOrigin follows the redirects to the origin of the fetched URL only.
+	sameOrigin bool
+	// cookies sends the cookies set by the redirects along with the next requests of the chain,
+	// and captures them in captured.
+	cookies  bool
+	captured []string
+	// proxyHost is the host of the ladder instance, which redirects must not lead back into.
+	proxyHost string
+	guard     *ssrf.Guard
+	t         tracer
+}
+
+// check is the CheckRedirect function of the http.Client of the fetch. Redirects it doesn't
+// follow are returned as the response of the fetch.
+func (p *redirectPolicy) check(req *http.Request, via []*http.Request) error {
+	from := via[len(via)-1].URL
+	if p.proxyHost != "" && strings.EqualFold(req.URL.Host, p.proxyHost) {
+		return fmt.Errorf("%w: %s redirects back into the proxy", ErrRedirectLoop, from)
+	}
+	visits := 0
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			visits++
+		}
+	}
+	if visits >= maxRedirectVisits {
+		return fmt.Errorf("%w: %s redirects to %s again", ErrRedirectLoop, from, req.URL)
+	}
+	if len(via) > p.max {
+		return http.ErrUseLastResponse
+	}
+	if p.sameOrigin && (req.URL.Scheme != via[0].URL.Scheme || !strings.EqualFold(req.URL.Host, via[0].URL.Host)) {
+		p.t.emit(events.TypeRequest, "not following redirect to another origin "+req.URL.String(), nil)
+		return http.ErrUseLastResponse
+	}
+	if p.cookies && req.Response != nil {
+		p.captured = append(p.captured, req.Response.Header.Values("Set-Cookie")...)
+		for _, cookie := range req.Response.Cookies() {
+			if cookieMatches(cookie, from, req.URL) {
+				req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			}
+		}
+	}
+	p.t.emit(events.TypeRequest, "following redirect to "+req.URL.String(), nil)
+	if p.guard != nil {
+		return p.guard.CheckURL(req.URL)
+	}
+	return nil
+}
+
+// cookieMatches reports whether cookie, set by the response to from, is sent to to.
+func cookieMatches(cookie *http.Cookie, from, to *url.URL) bool {
+	if cookie.MaxAge < 0 {
+		return false
+	}
+	host := strings.ToLower(to.Hostname())
+	if cookie.Domain == "" {
+		return host == strings.ToLower(from.Hostname())
+	}
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// isRedirect reports whether resp redirects to its Location.
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// rewriteLocation rewrites the Location of a redirect that wasn't followed upstream,
+// resolved against the URL of the request that got resp, to route back through the
+// ladder instance serving under prefix, so that clients following it don't leave the proxy.
+func rewriteLocation(resp *http.Response, req *http.Request, prefix string) {
+	if !isRedirect(resp) {
+		return
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		resp.Header.Del("Location")
+		return
+	}
+	if resp.Request != nil {
+		req = resp.Request
+	}
+	location = req.URL.ResolveReference(location)
+	if location.Scheme != "http" && location.Scheme != "https" {
+		resp.Header.Del("Location")
+		return
+	}
+	resp.Header.Set("Location", prefix+location.String())
+}
@@ -0,0 +1,188 @@
+package ladder
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModifierFactory returns the Modifier configured with params, the parameters a rule references it with.
+type ModifierFactory func(params ...string) (Modifier, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ModifierFactory{
+		"spoofReferrer":           headerModifier("Referer"),
+		"spoofUserAgent":          headerModifier("User-Agent"),
+		"spoofOrigin":             headerModifier("Origin"),
+		"spoofXForwardedFor":      headerModifier("X-Forwarded-For"),
+		"setRequestHeader":        setHeaderModifier(false),
+		"setResponseHeader":       setHeaderModifier(true),
+		"deleteRequestHeaders":    deleteHeadersModifier(false),
+		"deleteResponseHeaders":   deleteHeadersModifier(true),
+		"setFormField":            setFormFieldModifier,
+		"requestAMPVersion":       requestAMPVersionModifier,
+		"resolveCanonicalFromAMP": resolveCanonicalFromAMPModifier,
+	}
+)
+
+// RegisterModifier registers factory under name, so that rules can reference the Modifiers it
+// returns in their modifiers, replacing the factory registered under name, if any.
+func RegisterModifier(name string, factory ModifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// RegisteredModifiers returns the sorted names of the registered modifiers.
+func RegisteredModifiers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewModifier returns the Modifier registered under name, configured with params.
+func NewModifier(name string, params ...string) (Modifier, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("modifier '%s' referenced by ruleset is not registered, available: %s", name, strings.Join(RegisteredModifiers(), ", "))
+	}
+	m, err := factory(params...)
+	if err != nil {
+		return nil, fmt.Errorf("modifier '%s': %w", name, err)
+	}
+	return m, nil
+}
+
+// wantParams checks that params holds n parameters.
+func wantParams(params []string, n int) error {
+	if len(params) != n {
+		return fmt.Errorf("takes %d parameter(s), got %d", n, len(params))
+	}
+	return nil
+}
+
+// headerFuncs modifies the headers of upstream requests with request and of responses with
+// response, when set.
+type headerFuncs struct {
+	request  func(h http.Header)
+	response func(h http.Header)
+}
+
+func (m headerFuncs) ModifyRequest(req *http.Request) error {
+	if m.request != nil {
+		m.request(req.Header)
+	}
+	return nil
+}
+
+func (m headerFuncs) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	if m.response != nil {
+		m.response(resp.Header)
+	}
+	return body, nil
+}
+
+// headerModifier returns the factory of the Modifiers setting the request header key to their parameter.
+func headerModifier(key string) ModifierFactory {
+	return func(params ...string) (Modifier, error) {
+		if err := wantParams(params, 1); err != nil {
+			return nil, err
+		}
+		return headerFuncs{request: func(h http.Header) { h.Set(key, params[0]) }}, nil
+	}
+}
+
+// setHeaderModifier returns the factory of the Modifiers setting the header named by their
+// first parameter to their second, of responses or else of requests.
+func setHeaderModifier(response bool) ModifierFactory {
+	return func(params ...string) (Modifier, error) {
+		if err := wantParams(params, 2); err != nil {
+			return nil, err
+		}
+		set := func(h http.Header) { h.Set(params[0], params[1]) }
+		if response {
+			return headerFuncs{response: set}, nil
+		}
+		return headerFuncs{request: set}, nil
+	}
+}
+
+// deleteHeadersModifier returns the factory of the Modifiers deleting the headers named by
+// their parameters, of responses or else of requests.
+func deleteHeadersModifier(response bool) ModifierFactory {
+	return func(params ...string) (Modifier, error) {
+		if len(params) == 0 {
+			return nil, errors.New("takes the names of the headers, got none")
+		}
+		del := func(h http.Header) {
+			for _, key := range params {
+				h.Del(key)
+			}
+		}
+		if response {
+			return headerFuncs{response: del}, nil
+		}
+		return headerFuncs{request: del}, nil
+	}
+}
+
+// formField sets the field name of the urlencoded forms submitted upstream to value.
+type formField struct {
+	name, value string
+}
+
+func (m formField) ModifyRequest(req *http.Request) error {
+	return nil
+}
+
+func (m formField) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (m formField) ModifyRequestBody(req *http.Request, body []byte) ([]byte, error) {
+	mediaType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";")
+	if !strings.EqualFold(strings.TrimSpace(mediaType), "application/x-www-form-urlencoded") {
+		return body, nil
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form: %w", err)
+	}
+	form.Set(m.name, m.value)
+	return []byte(form.Encode()), nil
+}
+
+// setFormFieldModifier returns the Modifier setting the form field named by its first
+// parameter to its second.
+func setFormFieldModifier(params ...string) (Modifier, error) {
+	if err := wantParams(params, 2); err != nil {
+		return nil, err
+	}
+	return formField{params[0], params[1]}, nil
+}
+
+func requestAMPVersionModifier(params ...string) (Modifier, error) {
+	if err := wantParams(params, 1); err != nil {
+		return nil, err
+	}
+	return RequestAMPVersion(params[0])
+}
+
+func resolveCanonicalFromAMPModifier(params ...string) (Modifier, error) {
+	if err := wantParams(params, 0); err != nil {
+		return nil, err
+	}
+	return ResolveCanonicalFromAMP(), nil
+}
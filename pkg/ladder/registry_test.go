@@ -0,0 +1,63 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewModifier(t *testing.T) {
+	_, err := NewModifier("spoofReferrer")
+	assert.EqualError(t, err, "modifier 'spoofReferrer': takes 1 parameter(s), got 0")
+	_, err = NewModifier("deleteResponseHeaders")
+	assert.ErrorContains(t, err, "takes the names of the headers")
+	_, err = NewModifier("requestAMPVersion", "fragment")
+	assert.ErrorContains(t, err, "unknown amp 'fragment'")
+	_, err = NewModifier("spoofCookies")
+	assert.ErrorContains(t, err, "modifier 'spoofCookies' referenced by ruleset is not registered, available: deleteRequestHeaders")
+
+	RegisterModifier("nop", func(params ...string) (Modifier, error) { return nopModifier{}, nil })
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "nop")
+		registryMu.Unlock()
+	}()
+	m, err := NewModifier("nop")
+	require.NoError(t, err)
+	assert.Equal(t, nopModifier{}, m)
+	assert.Contains(t, RegisteredModifiers(), "nop")
+}
+
+func TestFetchRegisteredModifiers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Write([]byte("<p>" + r.Referer() + " " + r.Header.Get("X-Requested-With") + "</p>"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	var rules ruleset.RuleSet
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- domain: `+u.Host+`
+  modifiers:
+    - name: spoofReferrer
+      params: ["https://www.google.com/"]
+    - name: setRequestHeader
+      params: [X-Requested-With, XMLHttpRequest]
+    - name: deleteResponseHeaders
+      params: [X-Frame-Options]
+`), &rules))
+	result, err := NewClient(rules).Fetch(context.Background(), upstream.URL, FetchOptions{Format: FormatText})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.google.com/ XMLHttpRequest", result.Content)
+	assert.Empty(t, result.Response.Header.Get("X-Frame-Options"))
+}
@@ -0,0 +1,200 @@
+package ladder
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"ladder/pkg/events"
+	"ladder/pkg/ruleset"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Format selects the representation of the fetched content returned in Result.Content.
+type Format string
+
+const (
+	// FormatHTML returns the modified body, with links rewritten to route through a ladder instance.
+	FormatHTML Format = "html"
+	// FormatRaw returns the upstream body as received, but decompressed, without response modifiers, rules or link rewriting applied.
+	FormatRaw Format = "raw"
+	// FormatText returns the visible text of the modified body.
+	FormatText Format = "text"
+	// FormatOutline returns the Outline of the modified body, encoded as JSON.
+	FormatOutline Format = "outline"
+	// FormatMarkdown returns the Outline of the modified body, rendered as Markdown.
+	FormatMarkdown Format = "markdown"
+	// FormatArticleText returns the Outline of the modified body as plain text, with its title and byline.
+	FormatArticleText Format = "article-text"
+	// FormatArticleHTML returns the Outline of the modified body as a standalone HTML document.
+	FormatArticleHTML Format = "article-html"
+	// FormatMetadata returns the PageMetadata of the unmodified body, encoded as JSON, without extracting its content.
+	FormatMetadata Format = "metadata"
+	// FormatFeed returns the Index of the modified body, the articles it links to, rendered as a RSS feed.
+	FormatFeed Format = "feed"
+)
+
+// FetchOptions configures a single Client.Fetch call.
+type FetchOptions struct {
+	// Query holds additional query parameters appended to the fetched URL.
+	Query map[string]string
+	// Format of Result.Content. Defaults to FormatHTML.
+	Format Format
+	// ProxyPrefix is the path prefix of the ladder instance that FormatHTML links are rewritten to. Defaults to "/".
+	ProxyPrefix string
+	// ImagePrefix is the path prefix of the image route that FormatHTML images are rewritten to
+	// when the rule scales them down, see ruleset.Rule.Images. Defaults to DefaultImagePrefix.
+	ImagePrefix string
+	// ProxyOrigin is the scheme and host of the ladder instance, eg: https://ladder.example.com,
+	// prepended to the links of feeds as feed readers don't resolve relative links.
+	ProxyOrigin string
+	// Passthrough returns binary responses, such as images, video and fonts, unbuffered
+	// in Result.Body, unless the rule references modifiers processing response bodies.
+	// It applies to FormatHTML and FormatRaw only, and to all FormatRaw responses.
+	Passthrough bool
+	// Cookie is the Cookie header of the client, sent upstream when the rule forwards cookies,
+	// see ruleset.Rule.Cookies.
+	Cookie string
+	// Range is the Range header sent upstream, eg: to seek in passthrough videos.
+	Range string
+	// IfRange is the If-Range header sent upstream along with Range, so that downloads resume
+	// only if the resource didn't change since, eg: its ETag.
+	IfRange string
+	// Accept is the Accept header sent upstream, eg: text/event-stream for the EventSource
+	// requests of live pages, whose event streams are passed through.
+	Accept string
+	// Method is the method of the request sent upstream, eg: POST to submit a search form.
+	// Defaults to GET. Requests with other methods are not fetched with strategies.
+	Method string
+	// Body is the body of the request sent upstream, streamed unless a modifier of the rule
+	// rewrites request bodies, see RequestBodyModifier. It is not closed.
+	Body io.Reader
+	// ContentLength is the length of Body, 0 or -1 if unknown.
+	ContentLength int64
+	// ContentType is the Content-Type of Body, eg: application/x-www-form-urlencoded.
+	ContentType string
+	// Tag identifies the debug events of the call on Client.Events. Defaults to a sequential tag.
+	Tag string
+	// Trace is called with every debug event of the call as it happens, whether or not
+	// Client.Events is set, eg: to debug a single request.
+	Trace func(events.Event)
+	// ArchiveTime selects the archived copy fetched by the archive strategies, the one closest
+	// to it, instead of the newest, see Client.Strategies.
+	ArchiveTime time.Time
+	// Preset fetches the page the way of a preset of the strategies package, eg: archive,
+	// instead of the preset of its rule, see ruleset.Rule.Preset.
+	Preset string
+
+	// strategy is the strategy the page is fetched with, see Client.Strategies.
+	strategy string
+}
+
+// Result is the outcome of a Client.Fetch call.
+type Result struct {
+	// URL is the URL that was fetched, after the URL modifications of the rule.
+	URL string
+	// Request is the request sent upstream.
+	Request *http.Request
+	// Response is the upstream response. Its body has already been consumed into Content or Body.
+	Response *http.Response
+	// Rule is a copy of the rule that was applied. It is empty if no rule matched.
+	Rule ruleset.Rule
+	// Format is the format of Content.
+	Format Format
+	// Content is the response body in the requested format.
+	Content string
+	// Body streams the upstream body of passthrough responses, see FetchOptions.Passthrough.
+	// Content is empty if Body is set, and the caller must close Body.
+	Body io.ReadCloser
+	// Metadata describes the fetched page. It is only populated for HTML responses.
+	Metadata Metadata
+	// Outline is the structured main content of the page. It is only populated for FormatOutline, FormatMarkdown, FormatArticleText and FormatArticleHTML.
+	Outline *Outline
+	// Index lists the articles linked from the page. It is only populated for FormatFeed.
+	Index *Index
+	// PageMetadata is the metadata of the page for link previews. It is only populated for FormatMetadata.
+	PageMetadata *PageMetadata
+	// Blockage classifies what the upstream response, as modified by the modifiers of the rule,
+	// shows instead of the page, see DetectBlockage. It is empty for passthrough responses.
+	Blockage Blockage
+	// Strategy is the strategy that got the page, if fetched with strategies, see Client.Strategies.
+	Strategy string
+
+	// failure is why the response doesn't get the page, when fetched with a strategy, see strategyFailure.
+	failure string
+}
+
+// Metadata holds the descriptive information of a page, taken from its
+// <title>, <html lang>, canonical link and common meta / OpenGraph tags.
+type Metadata struct {
+	Title         string `json:"title,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Author        string `json:"author,omitempty"`
+	SiteName      string `json:"siteName,omitempty"`
+	Image         string `json:"image,omitempty"`
+	PublishedTime string `json:"publishedTime,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Canonical     string `json:"canonical,omitempty"`
+}
+
+// isHTML reports whether resp declares a HTML content type.
+func isHTML(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// extractMetadata collects the Metadata of a HTML document.
+func extractMetadata(body string) Metadata {
+	doc, err := parseDocument(body)
+	if err != nil {
+		return Metadata{}
+	}
+	return metadataFromDocument(doc)
+}
+
+// metadataFromDocument collects the Metadata of a parsed HTML document.
+func metadataFromDocument(doc *goquery.Document) Metadata {
+	meta := func(selectors ...string) string {
+		for _, selector := range selectors {
+			if content, ok := doc.Find(selector).First().Attr("content"); ok && strings.TrimSpace(content) != "" {
+				return strings.TrimSpace(content)
+			}
+		}
+		return ""
+	}
+
+	md := Metadata{
+		Title:         meta(`meta[property="og:title"]`, `meta[name="twitter:title"]`),
+		Description:   meta(`meta[property="og:description"]`, `meta[name="description"]`, `meta[name="twitter:description"]`),
+		Author:        meta(`meta[name="author"]`, `meta[property="article:author"]`),
+		SiteName:      meta(`meta[property="og:site_name"]`),
+		Image:         meta(`meta[property="og:image"]`, `meta[name="twitter:image"]`),
+		PublishedTime: meta(`meta[property="article:published_time"]`, `meta[name="date"]`),
+		Language:      strings.TrimSpace(doc.Find("html").AttrOr("lang", "")),
+		Canonical:     strings.TrimSpace(doc.Find(`link[rel="canonical"]`).AttrOr("href", "")),
+	}
+	if md.Title == "" {
+		md.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	return md
+}
+
+var whitespaceRegex = regexp.MustCompile(`\s*\n\s*`)
+
+// textFromDocument returns the visible text of doc, one block per line. It removes the scripts and styles of doc.
+func textFromDocument(doc *goquery.Document) string {
+	doc.Find("script, style, noscript, template, svg").Remove()
+
+	text := doc.Find("body").Text()
+	if strings.TrimSpace(text) == "" {
+		text = doc.Text()
+	}
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(text, "\n"))
+}
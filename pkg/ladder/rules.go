@@ -0,0 +1,315 @@
+package ladder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"ladder/pkg/resolver"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/transport"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ValidateRules checks the rules of rules that would otherwise fail the fetches of their sites,
+// eg: their regular expressions, strategies and crawler names, so that a broken RuleSet can be
+// rejected when loaded rather than when its sites are visited.
+func ValidateRules(rules ruleset.RuleSet) error {
+	var errs []error
+	for _, rule := range rules {
+		var ruleErrs []error
+		for _, domain := range rule.AllDomains() {
+			ruleErrs = append(ruleErrs, ruleset.ValidateDomain(domain))
+		}
+		for _, regexes := range [][]ruleset.Regex{rule.RegexRules, rule.UrlMods.Domain, rule.UrlMods.Path} {
+			for _, regex := range regexes {
+				if _, err := regexp.Compile(regex.Match); err != nil {
+					ruleErrs = append(ruleErrs, err)
+				}
+			}
+		}
+		ruleErrs = append(ruleErrs,
+			ValidateStrategies(rule.Strategies),
+			ValidateMasquerade(rule.Headers.Masquerade),
+			ValidateClientHints(rule.Headers.ClientHints),
+			transport.ValidateHTTP2(rule.TLS.HTTP2),
+			transport.ValidateHeaderOrder(rule.TLS.HeaderOrder),
+			resolver.Validate(rule.Resolver),
+		)
+		if err := errors.Join(ruleErrs...); err != nil {
+			errs = append(errs, fmt.Errorf("invalid rule for %s: %w", strings.Join(rule.AllDomains(), ", "), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// modifyURL applies the URL modifications of rule to uri.
+func modifyURL(uri string, rule ruleset.Rule) (string, error) {
+	newUrl, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	for _, urlMod := range rule.UrlMods.Domain {
+		re := regexp.MustCompile(urlMod.Match)
+		newUrl.Host = re.ReplaceAllString(newUrl.Host, urlMod.Replace)
+	}
+
+	for _, urlMod := range rule.UrlMods.Path {
+		re := regexp.MustCompile(urlMod.Match)
+		newUrl.Path = re.ReplaceAllString(newUrl.Path, urlMod.Replace)
+	}
+
+	removeTrackingParams(newUrl, rule.TrackingParams)
+	v := newUrl.Query()
+	for _, query := range rule.UrlMods.Query {
+		if query.Value == "" {
+			v.Del(query.Key)
+			continue
+		}
+		v.Set(query.Key, query.Value)
+	}
+	newUrl.RawQuery = v.Encode()
+
+	if rule.GoogleCache {
+		newUrl, err = url.Parse("https://webcache.googleusercontent.com/search?q=cache:" + newUrl.String())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return newUrl.String(), nil
+}
+
+// urlAttributes are the attributes holding URLs that rewriteHtml routes through the proxy.
+var urlAttributes = map[string]bool{
+	"action":      true,
+	"data-src":    true,
+	"data-srcset": true,
+	"formaction":  true,
+	"href":        true,
+	"imagesrcset": true,
+	"poster":      true,
+	"src":         true,
+	"srcset":      true,
+}
+
+var attributeEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;")
+
+// rewriteHtml rewrites the URLs of the href, src, action and similar attributes of
+// the body, resolved against the page URL u, so that links and subresources such as
+// stylesheets, images and scripts are routed through the ladder instance serving under
+// prefix. Images are routed through images instead, unless it is the zero imageRoute.
+// The CSS of style elements and attributes is rewritten with rewriteCSS.
+// The rest of the body is copied as is.
+func rewriteHtml(bodyB []byte, u *url.URL, prefix string, images imageRoute) string {
+	base := baseURL(u)
+
+	var sb strings.Builder
+	sb.Grow(len(bodyB) + len(bodyB)/8)
+	z := html.NewTokenizer(bytes.NewReader(bodyB))
+	inStyle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// the tokenizer stops on io.EOF and keeps unterminated tags in its buffer
+			sb.Write(z.Raw())
+			break
+		}
+		if tt == html.TextToken && inStyle {
+			// the text of style elements is left unescaped by the tokenizer
+			sb.WriteString(rewriteCSS(string(z.Raw()), &base, prefix))
+			continue
+		}
+		inStyle = false
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			sb.Write(z.Raw())
+			continue
+		}
+
+		raw := z.Raw()
+		token := z.Token()
+		inStyle = token.DataAtom == atom.Style && tt == html.StartTagToken
+		if token.DataAtom == atom.Base {
+			// <base href> changes the URL relative references are resolved against
+			for _, attr := range token.Attr {
+				if attr.Key == "href" {
+					if ref, err := base.Parse(attr.Val); err == nil {
+						base = *ref
+					}
+				}
+			}
+		}
+		proxy := func(ref string) string {
+			return proxyURL(ref, &base, prefix)
+		}
+		if images.prefix != "" && token.DataAtom == atom.Img {
+			proxy = func(ref string) string {
+				return images.url(ref, &base, prefix)
+			}
+		}
+		rewritten := false
+		for i, attr := range token.Attr {
+			if attr.Namespace != "" || (!urlAttributes[attr.Key] && attr.Key != "style") {
+				continue
+			}
+			var val string
+			switch {
+			case attr.Key == "style":
+				val = rewriteCSS(attr.Val, &base, prefix)
+			case strings.HasSuffix(attr.Key, "srcset"):
+				val = rewriteSrcset(attr.Val, proxy)
+			default:
+				val = proxy(attr.Val)
+			}
+			if val != attr.Val {
+				token.Attr[i].Val = val
+				rewritten = true
+			}
+		}
+		if !rewritten {
+			sb.Write(raw)
+			continue
+		}
+		sb.WriteString("<" + token.Data)
+		for _, attr := range token.Attr {
+			sb.WriteString(" " + attr.Key + `="` + attributeEscaper.Replace(attr.Val) + `"`)
+		}
+		if tt == html.SelfClosingTagToken {
+			sb.WriteString("/")
+		}
+		sb.WriteString(">")
+	}
+	return sb.String()
+}
+
+// baseURL returns the URL relative references of the page u are resolved against,
+// which is https when u has no scheme.
+func baseURL(u *url.URL) url.URL {
+	base := *u
+	if base.Scheme == "" {
+		base.Scheme = "https"
+	}
+	return base
+}
+
+// proxyURL returns the URL ref, resolved against base, routed through the ladder instance
+// serving under prefix. References that are not HTTP(S), such as fragments, data: or
+// javascript: URLs, and references routed already are returned as is.
+func proxyURL(ref string, base *url.URL, prefix string) string {
+	trimmed := strings.TrimSpace(ref)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, prefix+"http:") || strings.HasPrefix(trimmed, prefix+"https:") {
+		return ref
+	}
+	abs, err := base.Parse(trimmed)
+	if err != nil || (abs.Scheme != "http" && abs.Scheme != "https") {
+		return ref
+	}
+	return prefix + abs.String()
+}
+
+// applyRules applies the regex rules and injections of rule to body, the body of
+// a response with header.
+func applyRules(body string, rule ruleset.Rule, header http.Header) string {
+	body = applyRegexRules(body, rule)
+	if len(rule.Injections) == 0 && len(rule.BlockScripts) == 0 && len(rule.RemoveElements) == 0 && !rule.StripOverlays {
+		return body
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		slog.Error("failed to parse body for injection", "error", err)
+		return body
+	}
+	applyDocumentRules(doc, rule, header)
+	html, err := doc.Html()
+	if err != nil {
+		slog.Error("failed to render body after injection", "error", err)
+		return body
+	}
+	return html
+}
+
+// applyRegexRules applies the regex rules of rule to body.
+func applyRegexRules(body string, rule ruleset.Rule) string {
+	for _, regexRule := range rule.RegexRules {
+		re := regexp.MustCompile(regexRule.Match)
+		body = re.ReplaceAllString(body, regexRule.Replace)
+	}
+	return body
+}
+
+// applyDocumentRules applies the rules of rule operating on the parsed document doc,
+// the body of a response with header: removals first, then injections.
+func applyDocumentRules(doc *goquery.Document, rule ruleset.Rule, header http.Header) {
+	blockScripts(doc, rule.BlockScripts)
+	for _, selector := range rule.RemoveElements {
+		doc.Find(selector).Remove()
+	}
+	if rule.StripOverlays {
+		stripPaywallOverlays(doc)
+	}
+	applyInjections(doc, rule, header)
+}
+
+// blockScripts removes the script elements of doc loaded from domains or their subdomains.
+func blockScripts(doc *goquery.Document, domains []string) {
+	if len(domains) == 0 {
+		return
+	}
+	doc.Find("script[src]").Each(func(_ int, s *goquery.Selection) {
+		host := scriptHost(s.AttrOr("src", ""))
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				s.Remove()
+				return
+			}
+		}
+	})
+}
+
+// scriptHost returns the host of the script src, which may be routed through the proxy
+// already, eg: /https://cdn.piano.io/api/tinypass.min.js. Relative sources have no host.
+func scriptHost(src string) string {
+	start := -1
+	for _, scheme := range []string{"https://", "http://"} {
+		if i := strings.Index(src, scheme); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	u, err := url.Parse(src[start:])
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+}
+
+// applyInjections applies the injections of rule to doc, the body of a response with header.
+func applyInjections(doc *goquery.Document, rule ruleset.Rule, header http.Header) {
+	for _, injection := range rule.Injections {
+		if injection.Script != "" {
+			injectScript(doc, injection.Position, injection.Script, header, rule.Headers.CSP == "")
+		}
+		if injection.Replace != "" {
+			doc.Find(injection.Position).ReplaceWithHtml(injection.Replace)
+		}
+		if injection.Append != "" {
+			doc.Find(injection.Position).AppendHtml(injection.Append)
+		}
+		if injection.Prepend != "" {
+			doc.Find(injection.Position).PrependHtml(injection.Prepend)
+		}
+	}
+}
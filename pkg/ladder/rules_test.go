@@ -0,0 +1,120 @@
+package ladder
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteHtml(t *testing.T) {
+	bodyB := []byte(`
+		<html>
+			<head>
+				<title>Test Page</title>
+			</head>
+			<body>
+				<img src="/image.jpg">
+				<script src="/script.js"></script>
+				<a href="/about">About Us</a>
+				<div style="background-image: url('/background.jpg')"></div>
+			</body>
+		</html>
+	`)
+	u := &url.URL{Host: "example.com"}
+
+	expected := `
+		<html>
+			<head>
+				<title>Test Page</title>
+			</head>
+			<body>
+				<img src="/https://example.com/image.jpg">
+				<script src="/https://example.com/script.js"></script>
+				<a href="/https://example.com/about">About Us</a>
+				<div style="background-image: url('/https://example.com/background.jpg')"></div>
+			</body>
+		</html>
+	`
+
+	actual := rewriteHtml(bodyB, u, "/", imageRoute{})
+	assert.Equal(t, expected, actual)
+}
+
+func TestRewriteHtmlAttributes(t *testing.T) {
+	u, _ := url.Parse("http://example.com/news/article")
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"relative", `<link rel="stylesheet" href="style.css">`, `<link rel="stylesheet" href="/ladder/http://example.com/news/style.css">`},
+		{"other host", `<img src="https://cdn.example.net/a.png" alt="A">`, `<img src="/ladder/https://cdn.example.net/a.png" alt="A">`},
+		{"protocol relative", `<script src="//cdn.example.net/a.js"></script>`, `<script src="/ladder/http://cdn.example.net/a.js"></script>`},
+		{"form", `<form action="/search?q=a&amp;page=2"><button formaction="/go">`, `<form action="/ladder/http://example.com/search?q=a&amp;page=2"><button formaction="/ladder/http://example.com/go">`},
+		{"srcset", `<img srcset="/a.jpg 1x, b.jpg 2x"/>`, `<img srcset="/ladder/http://example.com/a.jpg 1x, /ladder/http://example.com/news/b.jpg 2x"/>`},
+		{"base", `<base href="https://www.example.com/"><a href="about">`, `<base href="/ladder/https://www.example.com/"><a href="/ladder/https://www.example.com/about">`},
+		{"unchanged", `<a href="#top">Top</a><a href="javascript:void(0)">JS</a><a href="mailto:a@example.com">Mail</a><img src="data:image/png;base64,AAAA">`, ``},
+		{"routed already", `<a href="/ladder/https://example.com/">Home</a>`, ``},
+		{"script content", `<script>var a = '<a href="/b">';</script>`, ``},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := test.want
+			if want == "" {
+				want = test.body
+			}
+			assert.Equal(t, want, rewriteHtml([]byte(test.body), u, "/ladder/", imageRoute{}))
+		})
+	}
+}
+
+func TestBlockScripts(t *testing.T) {
+	body := `<html><head>
+<script src="/https://cdn.piano.io/api/tinypass.min.js"></script>
+<script src="https://scdn.cxense.com/cx.js"></script>
+<script src="/https://www.example.com/app.js"></script>
+<script src="/https://notpiano.io/a.js"></script>
+<script>var inline = true;</script>
+</head><body></body></html>`
+	rule := ruleset.Rule{BlockScripts: []string{"piano.io", ".cxense.com"}}
+
+	html := applyRules(body, rule, http.Header{})
+	assert.NotContains(t, html, "tinypass")
+	assert.NotContains(t, html, "cx.js")
+	assert.Contains(t, html, "app.js")
+	assert.Contains(t, html, "notpiano.io")
+	assert.Contains(t, html, "var inline = true;")
+}
+
+func TestRemoveElements(t *testing.T) {
+	body := `<html><body>
+<div class="overlay paywall"><p>Subscribe now</p></div>
+<article><p>article</p><aside id="newsletter">Sign up</aside></article>
+<div class="cookie-banner">Cookies</div>
+</body></html>`
+	rule := ruleset.Rule{RemoveElements: []string{".paywall", "article #newsletter", "div.cookie-banner", "[invalid"}}
+
+	html := applyRules(body, rule, http.Header{})
+	assert.Contains(t, html, "<p>article</p>")
+	assert.NotContains(t, html, "Subscribe now")
+	assert.NotContains(t, html, "Sign up")
+	assert.NotContains(t, html, "Cookies")
+}
+
+func TestValidateRules(t *testing.T) {
+	valid := ruleset.Rule{Domain: "example.com", RegexRules: []ruleset.Regex{{Match: `<div class="paywall">`, Replace: ""}}, Strategies: []string{StrategyDirect}}
+	assert.NoError(t, ValidateRules(ruleset.RuleSet{valid}))
+
+	regex := ruleset.Rule{Domains: []string{"example.org", "example.net"}, RegexRules: []ruleset.Regex{{Match: `(unclosed`}}}
+	strategy := ruleset.Rule{Domain: "example.com", Strategies: []string{"teleport"}}
+	domain := ruleset.Rule{Domain: "~news[0-9+.example.com"}
+	err := ValidateRules(ruleset.RuleSet{valid, regex, strategy, domain})
+	assert.ErrorContains(t, err, "invalid rule for example.org, example.net")
+	assert.ErrorContains(t, err, "missing closing )")
+	assert.ErrorContains(t, err, "unknown strategy 'teleport'")
+	assert.ErrorContains(t, err, "invalid domain regex '~news[0-9+.example.com'")
+}
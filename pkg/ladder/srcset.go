@@ -0,0 +1,78 @@
+package ladder
+
+import "strings"
+
+// imageCandidate is an image candidate of a srcset attribute: a URL and its
+// optional width or density descriptor, eg: /a.jpg 2x.
+type imageCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset parses the image candidates of a srcset attribute following the
+// HTML parsing rules, under which URLs end at whitespace, so that commas within
+// URLs, eg: of data: URLs or of image CDN parameters, are not taken for separators.
+func parseSrcset(srcset string) []imageCandidate {
+	var candidates []imageCandidate
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, " \t\n\f\r,")
+		if s == "" {
+			return candidates
+		}
+		end := strings.IndexAny(s, " \t\n\f\r")
+		if end < 0 {
+			end = len(s)
+		}
+		candidate := imageCandidate{url: s[:end]}
+		s = s[end:]
+
+		if trimmed := strings.TrimRight(candidate.url, ","); trimmed != candidate.url {
+			// commas after a URL end the candidate, which has no descriptor
+			candidate.url = trimmed
+			candidates = append(candidates, candidate)
+			continue
+		}
+
+		// the descriptor runs until the next comma outside of parentheses
+		depth, i := 0, 0
+	descriptor:
+		for ; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				if depth > 0 {
+					depth--
+				}
+			case ',':
+				if depth == 0 {
+					break descriptor
+				}
+			}
+		}
+		candidate.descriptor = strings.Join(strings.Fields(s[:i]), " ")
+		s = s[i:]
+		candidates = append(candidates, candidate)
+	}
+}
+
+// rewriteSrcset rewrites the URLs of the image candidates of a srcset attribute,
+// eg: /a.jpg 1x, /b.jpg 2x, with proxy, eg: to route them through the ladder instance.
+func rewriteSrcset(srcset string, proxy func(string) string) string {
+	candidates := parseSrcset(srcset)
+	if len(candidates) == 0 {
+		return srcset
+	}
+	var sb strings.Builder
+	for i, candidate := range candidates {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(proxy(candidate.url))
+		if candidate.descriptor != "" {
+			sb.WriteString(" " + candidate.descriptor)
+		}
+	}
+	return sb.String()
+}
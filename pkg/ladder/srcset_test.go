@@ -0,0 +1,47 @@
+package ladder
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []imageCandidate
+	}{
+		{"", nil},
+		{"a.jpg", []imageCandidate{{url: "a.jpg"}}},
+		{" a.jpg 1x,\n b.jpg  2x ", []imageCandidate{{"a.jpg", "1x"}, {"b.jpg", "2x"}}},
+		{"a.jpg, b.jpg 640w,", []imageCandidate{{url: "a.jpg"}, {"b.jpg", "640w"}}},
+		{"/img/w_400,h_300/a.jpg 400w, /img/w_800,h_600/a.jpg 800w", []imageCandidate{{"/img/w_400,h_300/a.jpg", "400w"}, {"/img/w_800,h_600/a.jpg", "800w"}}},
+		{"data:image/png;base64,AAAA 1x, b.jpg 2x", []imageCandidate{{"data:image/png;base64,AAAA", "1x"}, {"b.jpg", "2x"}}},
+		{"a.jpg future(1, 2), b.jpg", []imageCandidate{{"a.jpg", "future(1, 2)"}, {url: "b.jpg"}}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, parseSrcset(test.srcset), test.srcset)
+	}
+}
+
+func TestRewritePicture(t *testing.T) {
+	u, _ := url.Parse("https://example.com/news/article")
+	body := `<picture>
+	<source type="image/webp" srcset="/a.webp 1x, /a@2x.webp 2x" sizes="(min-width: 800px) 50vw, 100vw">
+	<source media="(max-width: 600px)" srcset="https://cdn.example.net/w_600,q_80/a.jpg 600w">
+	<img src="a.jpg" srcset="data:image/gif;base64,R0lGOD 1x, a@2x.jpg 2x" alt="A">
+</picture>
+<link rel="preload" as="image" imagesrcset="/hero.jpg 1x, /hero@2x.jpg 2x">
+<img data-src="/lazy.jpg" data-srcset="/lazy.jpg 1x, /lazy@2x.jpg 2x">`
+
+	want := `<picture>
+	<source type="image/webp" srcset="/https://example.com/a.webp 1x, /https://example.com/a@2x.webp 2x" sizes="(min-width: 800px) 50vw, 100vw">
+	<source media="(max-width: 600px)" srcset="/https://cdn.example.net/w_600,q_80/a.jpg 600w">
+	<img src="/https://example.com/news/a.jpg" srcset="data:image/gif;base64,R0lGOD 1x, /https://example.com/news/a@2x.jpg 2x" alt="A">
+</picture>
+<link rel="preload" as="image" imagesrcset="/https://example.com/hero.jpg 1x, /https://example.com/hero@2x.jpg 2x">
+<img data-src="/https://example.com/lazy.jpg" data-srcset="/https://example.com/lazy.jpg 1x, /https://example.com/lazy@2x.jpg 2x">`
+
+	assert.Equal(t, want, rewriteHtml([]byte(body), u, "/", imageRoute{}))
+}
@@ -0,0 +1,102 @@
+package ladder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ladder/pkg/ssrf"
+)
+
+// ErrNotAllowed is wrapped by the errors of fetches outside of Client.AllowedDomains.
+var ErrNotAllowed = errors.New("domain not allowed")
+
+// ErrBodyTooLarge is wrapped by the errors of fetches whose body exceeds Client.MaxBodySize.
+var ErrBodyTooLarge = errors.New("upstream response too large")
+
+// ErrorStatuses maps the kinds of fetch errors to the status answered to clients.
+// Upstream responses, including errors such as 404 or 429, keep their own status.
+// Zero fields default to DefaultErrorStatuses.
+type ErrorStatuses struct {
+	// Timeout is answered when the upstream didn't respond in time.
+	Timeout int
+	// Unreachable is answered when the upstream couldn't be resolved or connected to.
+	Unreachable int
+	// Blocked is answered for destinations blocked by the Guard or AllowedDomains.
+	Blocked int
+	// TooLarge is answered for upstream responses larger than Client.MaxBodySize.
+	TooLarge int
+	// Other is answered for all other errors.
+	Other int
+}
+
+// DefaultErrorStatuses are the statuses a gateway answers for failed upstream requests.
+var DefaultErrorStatuses = ErrorStatuses{
+	Timeout:     http.StatusGatewayTimeout,
+	Unreachable: http.StatusBadGateway,
+	Blocked:     http.StatusForbidden,
+	TooLarge:    http.StatusBadGateway,
+	Other:       http.StatusInternalServerError,
+}
+
+// ParseErrorStatuses parses a comma separated list of error kinds and statuses overriding
+// DefaultErrorStatuses, eg: timeout=503,unreachable=503. Kinds are timeout, unreachable, blocked,
+// tooLarge and other.
+func ParseErrorStatuses(spec string) (ErrorStatuses, error) {
+	statuses := DefaultErrorStatuses
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, value, _ := strings.Cut(entry, "=")
+		status, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || status < 400 || status > 599 {
+			return statuses, fmt.Errorf("invalid status '%s' for '%s', must be between 400 and 599", value, kind)
+		}
+		switch strings.TrimSpace(kind) {
+		case "timeout":
+			statuses.Timeout = status
+		case "unreachable":
+			statuses.Unreachable = status
+		case "blocked":
+			statuses.Blocked = status
+		case "tooLarge":
+			statuses.TooLarge = status
+		case "other":
+			statuses.Other = status
+		default:
+			return statuses, fmt.Errorf("unknown error kind '%s', must be one of timeout, unreachable, blocked, tooLarge, other", kind)
+		}
+	}
+	return statuses, nil
+}
+
+// Status returns the status to answer for err, an error returned by Client.Fetch.
+func (s ErrorStatuses) Status(err error) int {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, ssrf.ErrBlocked), errors.Is(err, ErrNotAllowed):
+		return orDefault(s.Blocked, DefaultErrorStatuses.Blocked)
+	case errors.Is(err, ErrBodyTooLarge):
+		return orDefault(s.TooLarge, DefaultErrorStatuses.TooLarge)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return orDefault(s.Timeout, DefaultErrorStatuses.Timeout)
+	case errors.As(err, &dnsErr), errors.As(err, &opErr):
+		return orDefault(s.Unreachable, DefaultErrorStatuses.Unreachable)
+	}
+	return orDefault(s.Other, DefaultErrorStatuses.Other)
+}
+
+func orDefault(status, fallback int) int {
+	if status == 0 {
+		return fallback
+	}
+	return status
+}
@@ -0,0 +1,63 @@
+package ladder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ssrf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"deadline", fmt.Errorf("reading body: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"net timeout", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: timeoutError{}}}, http.StatusGatewayTimeout},
+		{"refused", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, http.StatusBadGateway},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, http.StatusBadGateway},
+		{"ssrf", fmt.Errorf("%w: 127.0.0.1 is internal", ssrf.ErrBlocked), http.StatusForbidden},
+		{"allowed domains", fmt.Errorf("%w. example.com not in []", ErrNotAllowed), http.StatusForbidden},
+		{"too large", fmt.Errorf("%w: over 1MB", ErrBodyTooLarge), http.StatusBadGateway},
+		{"other", errors.New("plugin failed"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, DefaultErrorStatuses.Status(test.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestParseErrorStatuses(t *testing.T) {
+	statuses, err := ParseErrorStatuses("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultErrorStatuses, statuses)
+
+	statuses, err = ParseErrorStatuses("timeout=503, unreachable=503")
+	require.NoError(t, err)
+	assert.Equal(t, ErrorStatuses{Timeout: 503, Unreachable: 503, Blocked: 403, TooLarge: 502, Other: 500}, statuses)
+
+	// zero fields fall back to the defaults
+	assert.Equal(t, http.StatusBadGateway, ErrorStatuses{Timeout: 503}.Status(&net.DNSError{Err: "no such host"}))
+
+	_, err = ParseErrorStatuses("timeout=200")
+	assert.ErrorContains(t, err, "invalid status '200' for 'timeout'")
+
+	_, err = ParseErrorStatuses("dns=502")
+	assert.ErrorContains(t, err, "unknown error kind 'dns'")
+}
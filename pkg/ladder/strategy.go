@@ -0,0 +1,230 @@
+package ladder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ladder/pkg/events"
+	"ladder/pkg/ruleset"
+	"ladder/pkg/strategies"
+	"ladder/pkg/tracing"
+	"ladder/pkg/urls"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The strategies of fetching a page, which Client.Strategies tries in order until one gets it.
+const (
+	// StrategyDirect fetches the page according to its rule.
+	StrategyDirect = "direct"
+	// StrategyGooglebot fetches the page with the headers of Googlebot, see Client.Masquerade.
+	StrategyGooglebot = "googlebot"
+	// StrategyGoogleCache fetches the page from the Google cache, see ruleset.Rule.GoogleCache.
+	StrategyGoogleCache = "googlecache"
+	// StrategyArchiveOrg fetches the latest copy of the page archived by the Wayback Machine,
+	// or the copy closest to FetchOptions.ArchiveTime, capturing it first if Client.WaybackSave is set.
+	StrategyArchiveOrg = "archive.org"
+	// StrategyArchiveIs fetches the latest copy of the page archived by archive.today, or the copy
+	// closest to FetchOptions.ArchiveTime, from the first reachable of ArchiveIsMirrors.
+	StrategyArchiveIs = "archive.is"
+	// StrategyBrowser renders the page in the headless browser of Client.Browser, for pages
+	// assembling their content with JavaScript. It is not part of DefaultStrategies.
+	StrategyBrowser = "browser"
+)
+
+// DefaultStrategies tries the page itself first, then the copies crawlers and archives got.
+var DefaultStrategies = []string{StrategyDirect, StrategyGooglebot, StrategyGoogleCache, StrategyArchiveOrg, StrategyArchiveIs}
+
+// ArchiveIsMirrors are the domains of archive.today, tried in turn when one is unreachable.
+var ArchiveIsMirrors = []string{"archive.is", "archive.ph", "archive.md", "archive.li"}
+
+// archiveIsMirror is the index in ArchiveIsMirrors of the mirror tried first, the last one reachable.
+var archiveIsMirror atomic.Int32
+
+// archiveIsURL returns the URL of the newest copy of pageURL archived by archive.today on mirror,
+// or if at is set, of its Memento TimeGate, which redirects to the copy closest to the Accept-Datetime.
+func archiveIsURL(mirror, pageURL string, at time.Time) string {
+	if at.IsZero() {
+		return "https://" + mirror + "/newest/" + pageURL
+	}
+	return "https://" + mirror + "/timegate/" + pageURL
+}
+
+// minArticleWords is the length of the text of articles under which they are deemed truncated.
+const minArticleWords = 150
+
+// ValidateStrategies checks that the strategies exist.
+func ValidateStrategies(strategies []string) error {
+	for _, strategy := range strategies {
+		switch strategy {
+		case StrategyDirect, StrategyGooglebot, StrategyGoogleCache, StrategyArchiveOrg, StrategyArchiveIs, StrategyBrowser:
+		default:
+			return fmt.Errorf("unknown strategy '%s', available: %s, %s", strategy, strings.Join(DefaultStrategies, ", "), StrategyBrowser)
+		}
+	}
+	return nil
+}
+
+// fetchStrategies fetches rawURL with the strategies of its rule, or else of c, in order until
+// one gets the page, and returns the result of the first that succeeded. Responses showing a
+// paywall, captcha or bot challenge, error responses and truncated articles fall through to the next
+// strategy. If none succeeds, the first result of a strategy is returned, or the first error.
+func (c *Client) fetchStrategies(ctx context.Context, rawURL string, opts FetchOptions, t tracer) (*Result, error) {
+	strategies := c.Strategies
+	if u, err := url.Parse(rawURL); err == nil {
+		u = urls.Normalize(u)
+		rules := c.RuleSet()
+		rule := rules.Match(u.Host, u.Path)
+		if err := applyPreset(&rule, opts.Preset); err != nil {
+			return nil, err
+		}
+		if len(rule.Strategies) > 0 {
+			strategies = rule.Strategies
+		}
+	}
+	// requests with bodies can be sent only once, HEAD responses show no paywall, and archives
+	// serve neither other methods nor event streams
+	if len(strategies) == 0 || (opts.Method != "" && opts.Method != http.MethodGet) || opts.Accept == "text/event-stream" {
+		return c.fetch(ctx, rawURL, opts, t)
+	}
+	if err := ValidateStrategies(strategies); err != nil {
+		return nil, err
+	}
+	pageURL, err := urls.WithQuery(rawURL, opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	opts.Query = nil
+
+	var first *Result
+	var firstErr error
+	for _, strategy := range strategies {
+		t.emit(events.TypeRule, "trying strategy "+strategy, map[string]string{"strategy": strategy})
+		opts.strategy = strategy
+		strategyCtx, span := c.startSpan(ctx, "strategy "+strategy)
+		var result *Result
+		var err error
+		switch strategy {
+		case StrategyArchiveOrg:
+			result, err = c.fetchArchiveOrg(strategyCtx, pageURL, opts, t)
+		case StrategyArchiveIs:
+			result, err = c.fetchArchiveIs(strategyCtx, pageURL, opts, t)
+		default:
+			result, err = c.fetch(strategyCtx, pageURL, opts, t)
+		}
+		tracing.RecordError(span, err)
+		if err == nil && result.failure != "" {
+			span.SetAttributes(attribute.String("ladder.blockage", result.failure))
+		}
+		span.End()
+		if err == nil && result.failure == "" {
+			c.Metrics.Strategy(strategy, "success")
+			result.Strategy = strategy
+			return result, nil
+		}
+
+		if err != nil {
+			c.Metrics.Strategy(strategy, "error")
+			t.emit(events.TypeError, "strategy "+strategy+" failed: "+err.Error(), map[string]string{"strategy": strategy})
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			c.Metrics.Strategy(strategy, "blocked")
+			t.emit(events.TypeResponse, "strategy "+strategy+" got a "+result.failure+" page", map[string]string{"strategy": strategy})
+			if first == nil {
+				result.Strategy = strategy
+				first = result
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if first != nil {
+		return first, nil
+	}
+	return nil, firstErr
+}
+
+// fetchArchiveIs fetches the copy of pageURL archived by archive.today from the mirror that was
+// reachable last, trying the next ones in turn while they are unreachable.
+func (c *Client) fetchArchiveIs(ctx context.Context, pageURL string, opts FetchOptions, t tracer) (*Result, error) {
+	first := int(archiveIsMirror.Load())
+	var err error
+	for i := range ArchiveIsMirrors {
+		n := (first + i) % len(ArchiveIsMirrors)
+		var result *Result
+		if result, err = c.fetch(ctx, archiveIsURL(ArchiveIsMirrors[n], pageURL, opts.ArchiveTime), opts, t); err == nil {
+			archiveIsMirror.Store(int32(n))
+			return result, nil
+		}
+		if status := DefaultErrorStatuses.Status(err); ctx.Err() != nil || (status != DefaultErrorStatuses.Unreachable && status != DefaultErrorStatuses.Timeout) {
+			return nil, err
+		}
+		t.emit(events.TypeError, ArchiveIsMirrors[n]+" is unreachable: "+err.Error(), map[string]string{"strategy": StrategyArchiveIs})
+	}
+	return nil, err
+}
+
+// applyPreset adapts rule with preset, or else with the preset of the rule, see strategies.Apply.
+func applyPreset(rule *ruleset.Rule, preset string) error {
+	if preset == "" {
+		preset = rule.Preset
+	}
+	if preset == "" {
+		return nil
+	}
+	return strategies.Apply(preset, rule)
+}
+
+// applyStrategy adapts rule to fetch the page with strategy.
+func applyStrategy(rule *ruleset.Rule, strategy string) {
+	switch strategy {
+	case StrategyGooglebot:
+		rule.Headers.Masquerade = "googlebot"
+		rule.Headers.UserAgent, rule.Headers.Referer, rule.Headers.XForwardedFor = "", "", ""
+		rule.Headers.ClientHints = "none"
+	case StrategyGoogleCache:
+		rule.GoogleCache = true
+	case StrategyBrowser:
+		rule.Browser.Render = true
+	}
+}
+
+// strategyFailure returns why resp, with the modified body, doesn't get the page: its blockage,
+// or truncated for articles cut short. It returns an empty string for responses that got the page.
+func strategyFailure(blockage Blockage, resp *http.Response, body []byte) string {
+	if blockage != BlockageNone {
+		return string(blockage)
+	}
+	if isHTML(resp) && truncated(body) {
+		return "truncated"
+	}
+	return ""
+}
+
+// truncated reports whether the HTML document body is an article whose text is too short
+// to be complete, as paywalls leave the first paragraphs only.
+func truncated(body []byte) bool {
+	doc, err := parseDocument(string(body))
+	if err != nil {
+		return false
+	}
+	md := metadataFromDocument(doc)
+	if md.PublishedTime == "" && doc.Find(`meta[property="og:type"][content="article"]`).Length() == 0 {
+		return false
+	}
+	words := 0
+	for _, block := range outlineFromDocument(doc, "", md).Blocks {
+		if block.Type == BlockParagraph {
+			words += len(strings.Fields(block.Text))
+		}
+	}
+	return words < minArticleWords
+}
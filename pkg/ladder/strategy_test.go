@@ -0,0 +1,206 @@
+package ladder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// article returns an HTML article with words words of text.
+func article(words int) string {
+	return `<html><head><meta property="og:type" content="article"></head><body><article><p>` +
+		strings.Repeat("word ", words) + `</p></article></body></html>`
+}
+
+func TestStrategyFailure(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html"}}
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{http.StatusOK, article(300), ""},
+		{http.StatusOK, article(40), "truncated"},
+		{http.StatusOK, `<div class="paywall">Subscribe</div>`, "hard-paywall"},
+		{http.StatusNotFound, "<p>Not found</p>", "error"},
+		// pages that are no articles are never truncated
+		{http.StatusOK, "<p>Contact us</p>", ""},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: html}
+		blockage := DetectBlockage(resp.StatusCode, resp.Header, test.body)
+		assert.Equal(t, test.want, strategyFailure(blockage, resp, []byte(test.body)), test.body)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFetchStrategies(t *testing.T) {
+	var requested []string
+	client := NewClient(nil)
+	client.UserAgent = DefaultUserAgents[0]
+	client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		if req.URL.Host == "archive.org" {
+			return waybackAvailable(req, "20240501120000"), nil
+		}
+		body := article(40)
+		switch {
+		case strings.Contains(req.UserAgent(), "Googlebot") && req.URL.Host == "www.example.com":
+			body = `<div class="paywall">Subscribe to continue</div>`
+		case req.URL.Host == "web.archive.org":
+			body = article(300)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	client.Strategies = []string{StrategyDirect, StrategyGooglebot, StrategyArchiveOrg}
+
+	result, err := client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{Query: map[string]string{"id": "1"}})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyArchiveOrg, result.Strategy)
+	assert.Equal(t, []string{
+		"https://www.example.com/article?id=1",
+		"https://www.example.com/article?id=1",
+		"https://archive.org/wayback/available?url=https%3A%2F%2Fwww.example.com%2Farticle%3Fid%3D1",
+		"https://web.archive.org/web/20240501120000/https://www.example.com/article?id=1",
+	}, requested)
+
+	// without a strategy getting the page, the result of the first one is returned
+	rule := ruleset.Rule{Domain: "www.example.com", Strategies: []string{StrategyDirect, StrategyGooglebot}}
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyDirect, result.Strategy)
+	assert.Contains(t, result.Content, "word word")
+
+	rule.Strategies = []string{"bing"}
+	client.Rules = ruleset.RuleSet{rule}
+	_, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	assert.ErrorContains(t, err, "unknown strategy 'bing'")
+
+	rule.Strategies = []string{StrategyBrowser}
+	client.Rules = ruleset.RuleSet{rule}
+	_, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	assert.ErrorContains(t, err, "renders it in a browser, which is not configured")
+}
+
+func TestFetchStrategiesGooglebot(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if !strings.Contains(r.UserAgent(), "Googlebot") {
+			w.Write([]byte(`<div class="paywall">Subscribe to continue</div>`))
+			return
+		}
+		w.Write([]byte(article(300)))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host, Strategies: []string{StrategyDirect, StrategyGooglebot}}
+	rule.Headers.UserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0"
+	client := NewClient(ruleset.RuleSet{rule})
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyGooglebot, result.Strategy)
+	assert.NotContains(t, result.Content, "paywall")
+}
+
+func TestFetchArchives(t *testing.T) {
+	defer archiveIsMirror.Store(0)
+	var requested []string
+	client := NewClient(nil)
+	client.Strategies = []string{StrategyArchiveIs, StrategyArchiveOrg}
+	client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String()+" "+req.Header.Get("Accept-Datetime"))
+		if req.URL.Host == "archive.is" {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		}
+		if req.URL.Host == "archive.org" {
+			return waybackAvailable(req, "20240501120000"), nil
+		}
+		body := article(40)
+		if req.URL.Host == "web.archive.org" {
+			body = article(300)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	result, err := client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyArchiveOrg, result.Strategy)
+	assert.Equal(t, []string{
+		"https://archive.is/newest/https://www.example.com/article ",
+		"https://archive.ph/newest/https://www.example.com/article ",
+		"https://archive.org/wayback/available?url=https%3A%2F%2Fwww.example.com%2Farticle ",
+		"https://web.archive.org/web/20240501120000/https://www.example.com/article ",
+	}, requested)
+
+	// the reachable mirror is tried first, and copies are selected by date
+	requested = nil
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{ArchiveTime: at})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://archive.ph/timegate/https://www.example.com/article Wed, 01 May 2024 12:00:00 GMT",
+		"https://archive.org/wayback/available?timestamp=20240501120000&url=https%3A%2F%2Fwww.example.com%2Farticle ",
+		"https://web.archive.org/web/20240501120000/https://www.example.com/article ",
+	}, requested)
+}
+
+func TestFetchPreset(t *testing.T) {
+	var requested []string
+	client := NewClient(ruleset.RuleSet{{Domain: "www.example.com", Preset: "cache-first"}})
+	client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Host)
+		if req.URL.Host == "archive.org" {
+			return waybackAvailable(req, "20240501120000"), nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(`<p>Story</p><script>track()</script>`)),
+			Request:    req,
+		}, nil
+	})
+
+	result, err := client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyGoogleCache, result.Strategy)
+	assert.Equal(t, []string{"webcache.googleusercontent.com"}, requested)
+
+	// the preset of the request replaces the preset of the rule
+	requested = nil
+	result, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{Preset: "noscript"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com"}, requested)
+	assert.NotContains(t, result.Content, "track()")
+
+	_, err = client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{Preset: "bing"})
+	assert.ErrorContains(t, err, "unknown preset 'bing'")
+}
@@ -0,0 +1,69 @@
+package ladder
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultTrackingParams are the query parameters of campaign and click tracking stripped from
+// the fetched URLs by the Clients returned by NewClient, see Client.TrackingParams.
+// Parameters ending with * match the parameters starting with the rest, eg: utm_* matches utm_source.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"twclid",
+	"ttclid",
+	"igshid",
+	"li_fat_id",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+	"oly_anon_id",
+	"oly_enc_id",
+	"vero_id",
+	"_ga",
+	"_gl",
+}
+
+// removeTrackingParams deletes the query parameters of u matching params, see DefaultTrackingParams.
+// Parameter names are matched case-insensitively.
+func removeTrackingParams(u *url.URL, params []string) {
+	if len(params) == 0 || u.RawQuery == "" {
+		return
+	}
+	query := u.Query()
+	removed := false
+	for name := range query {
+		if isTrackingParam(name, params) {
+			query.Del(name)
+			removed = true
+		}
+	}
+	if removed {
+		u.RawQuery = query.Encode()
+	}
+}
+
+func isTrackingParam(name string, params []string) bool {
+	name = strings.ToLower(name)
+	for _, param := range params {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
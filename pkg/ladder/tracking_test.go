@@ -0,0 +1,54 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveTrackingParams(t *testing.T) {
+	tests := []struct {
+		url    string
+		params []string
+		want   string
+	}{
+		{"https://example.com/a?id=1&utm_source=x&UTM_Medium=y&fbclid=z", DefaultTrackingParams, "https://example.com/a?id=1"},
+		{"https://example.com/a?utm_source=x", DefaultTrackingParams, "https://example.com/a"},
+		// untouched queries keep their order and encoding
+		{"https://example.com/a?b=2&a=%2F", DefaultTrackingParams, "https://example.com/a?b=2&a=%2F"},
+		{"https://example.com/a?ref=x&gclid=y", []string{"ref"}, "https://example.com/a?gclid=y"},
+		{"https://example.com/a?utm_source=x", []string{"none"}, "https://example.com/a?utm_source=x"},
+		{"https://example.com/a?utm_source=x", nil, "https://example.com/a?utm_source=x"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		removeTrackingParams(u, test.params)
+		assert.Equal(t, test.want, u.String(), test.url)
+	}
+}
+
+func TestFetchTrackingParams(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	client := NewClient(nil)
+	result, err := client.Fetch(context.Background(), upstream.URL+"/?id=1&utm_campaign=x&gclid=y", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "id=1", result.Content)
+
+	rule := ruleset.Rule{Domain: u.Host, TrackingParams: []string{"none"}}
+	client.Rules = ruleset.RuleSet{rule}
+	result, err = client.Fetch(context.Background(), upstream.URL+"/?id=1&utm_campaign=x", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "id=1&utm_campaign=x", result.Content)
+}
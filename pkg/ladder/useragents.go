@@ -0,0 +1,45 @@
+package ladder
+
+import (
+	"hash/maphash"
+	"net/url"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// UserAgentRotate as the User-Agent of the Client or of a rule picks one from the
+// User-Agent pool for each site, see Client.UserAgents.
+const UserAgentRotate = "rotate"
+
+// DefaultUserAgents is the pool of current desktop browser User-Agents rotated by default.
+var DefaultUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36 Edg/140.0.0.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:143.0) Gecko/20100101 Firefox/143.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:143.0) Gecko/20100101 Firefox/143.0",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:143.0) Gecko/20100101 Firefox/143.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/26.0 Safari/605.1.15",
+}
+
+// userAgentSeed assigns User-Agents to sites, differently on every start.
+var userAgentSeed = maphash.MakeSeed()
+
+// userAgent returns the User-Agent ua to send to u, or if it is UserAgentRotate, the
+// User-Agent of the pool assigned to its registrable domain, so that all the requests
+// of a session on the site, including to its subdomains, carry the same one.
+func (c *Client) userAgent(ua string, u *url.URL) string {
+	if ua != UserAgentRotate {
+		return ua
+	}
+	pool := c.UserAgents
+	if len(pool) == 0 {
+		pool = DefaultUserAgents
+	}
+	domain := u.Hostname()
+	if registrable, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		domain = registrable
+	}
+	return pool[maphash.String(userAgentSeed, domain)%uint64(len(pool))]
+}
@@ -0,0 +1,55 @@
+package ladder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgentRotate(t *testing.T) {
+	c := NewClient(nil)
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+	assert.Equal(t, DefaultUserAgent, c.userAgent(DefaultUserAgent, parse("https://www.example.com/")))
+
+	ua := c.userAgent(UserAgentRotate, parse("https://www.example.com/a"))
+	assert.Contains(t, DefaultUserAgents, ua)
+	// sites keep their User-Agent across pages and subdomains
+	assert.Equal(t, ua, c.userAgent(UserAgentRotate, parse("https://www.example.com/b")))
+	assert.Equal(t, ua, c.userAgent(UserAgentRotate, parse("https://static.example.com/c.js")))
+
+	// sites are spread across the pool
+	seen := map[string]bool{}
+	for _, host := range []string{"a.com", "b.com", "c.com", "d.com", "e.com", "f.com", "g.com", "h.com", "i.com", "j.com"} {
+		seen[c.userAgent(UserAgentRotate, parse("https://"+host+"/"))] = true
+	}
+	assert.Greater(t, len(seen), 1)
+
+	c.UserAgents = []string{"custom/1.0"}
+	assert.Equal(t, "custom/1.0", c.userAgent(UserAgentRotate, parse("https://www.example.com/")))
+}
+
+func TestFetchUserAgentRotate(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent()))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rule := ruleset.Rule{Domain: u.Host}
+	rule.Headers.UserAgent = UserAgentRotate
+	client := NewClient(ruleset.RuleSet{rule})
+	client.UserAgents = []string{"rotated/1.0"}
+	result, err := client.Fetch(context.Background(), upstream.URL, FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "rotated/1.0", result.Content)
+}
@@ -0,0 +1,122 @@
+package ladder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ladder/pkg/events"
+)
+
+// waybackTimestamp is the layout of the timestamps of Wayback Machine snapshots.
+const waybackTimestamp = "20060102150405"
+
+var (
+	// waybackPollInterval is the delay between the checks for the capture of Save Page Now.
+	waybackPollInterval = 5 * time.Second
+	// waybackSaveTimeout bounds the wait for the capture of Save Page Now.
+	waybackSaveTimeout = 2 * time.Minute
+)
+
+// waybackAvailability is the response of the availability API of the Wayback Machine.
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// archiveOrgURL returns the URL of the copy of pageURL archived by the Wayback Machine closest
+// to at, or the newest if at is zero.
+func archiveOrgURL(pageURL string, at time.Time) string {
+	if at.IsZero() {
+		return "https://web.archive.org/web/" + pageURL
+	}
+	return "https://web.archive.org/web/" + at.UTC().Format(waybackTimestamp) + "/" + pageURL
+}
+
+// fetchArchiveOrg fetches the snapshot of pageURL the availability API of the Wayback Machine finds
+// closest to FetchOptions.ArchiveTime, or the newest. If none exists and Client.WaybackSave is set,
+// it captures the page with Save Page Now and fetches the capture once the API lists it.
+func (c *Client) fetchArchiveOrg(ctx context.Context, pageURL string, opts FetchOptions, t tracer) (*Result, error) {
+	snapshot, _, err := c.waybackSnapshot(ctx, pageURL, opts.ArchiveTime, t)
+	if err != nil {
+		// the snapshots remain reachable when the API is down
+		t.emit(events.TypeError, "wayback availability API failed: "+err.Error(), map[string]string{"strategy": StrategyArchiveOrg})
+		return c.fetch(ctx, archiveOrgURL(pageURL, opts.ArchiveTime), opts, t)
+	}
+	if snapshot == "" && c.WaybackSave {
+		snapshot, err = c.waybackSave(ctx, pageURL, t)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if snapshot == "" {
+		return nil, fmt.Errorf("no snapshot of %s in the Wayback Machine", pageURL)
+	}
+	return c.fetch(ctx, snapshot, opts, t)
+}
+
+// waybackSnapshot returns the URL and timestamp of the available snapshot of pageURL closest
+// to at, or the newest if at is zero, or empty strings if the Wayback Machine has none.
+func (c *Client) waybackSnapshot(ctx context.Context, pageURL string, at time.Time, t tracer) (string, string, error) {
+	query := url.Values{"url": {pageURL}}
+	if !at.IsZero() {
+		query.Set("timestamp", at.UTC().Format(waybackTimestamp))
+	}
+	result, err := c.fetch(ctx, "https://archive.org/wayback/available?"+query.Encode(), FetchOptions{Format: FormatRaw}, t)
+	if err != nil {
+		return "", "", err
+	}
+	if result.Response.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("wayback availability API answered %s", result.Response.Status)
+	}
+	var availability waybackAvailability
+	if err := json.Unmarshal([]byte(result.Content), &availability); err != nil {
+		return "", "", fmt.Errorf("wayback availability API: %w", err)
+	}
+	closest := availability.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.URL == "" {
+		return "", "", nil
+	}
+	return strings.Replace(closest.URL, "http://", "https://", 1), closest.Timestamp, nil
+}
+
+// waybackSave requests Save Page Now to capture pageURL, then polls the availability API until it
+// lists a snapshot taken since, and returns its URL, or an empty string if none came in time.
+func (c *Client) waybackSave(ctx context.Context, pageURL string, t tracer) (string, error) {
+	t.emit(events.TypeRequest, "saving "+pageURL+" to the Wayback Machine", map[string]string{"strategy": StrategyArchiveOrg})
+	started := time.Now().UTC()
+	ctx, cancel := context.WithTimeout(ctx, waybackSaveTimeout)
+	defer cancel()
+
+	result, err := c.fetch(ctx, "https://web.archive.org/save/"+pageURL, FetchOptions{Format: FormatRaw}, t)
+	if err != nil {
+		return "", fmt.Errorf("save page now: %w", err)
+	}
+	if result.Response.StatusCode >= 400 {
+		return "", fmt.Errorf("save page now answered %s", result.Response.Status)
+	}
+
+	ticker := time.NewTicker(waybackPollInterval)
+	defer ticker.Stop()
+	for {
+		snapshot, timestamp, err := c.waybackSnapshot(ctx, pageURL, started, t)
+		if err == nil && snapshot != "" && timestamp >= started.Format(waybackTimestamp) {
+			return snapshot, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ladder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waybackAvailable answers the availability API request req with a snapshot of its url taken
+// at timestamp, or with no snapshot if timestamp is empty.
+func waybackAvailable(req *http.Request, timestamp string) *http.Response {
+	body := `{"archived_snapshots":{}}`
+	if timestamp != "" {
+		body = `{"archived_snapshots":{"closest":{"status":"200","available":true,"timestamp":"` + timestamp +
+			`","url":"http://web.archive.org/web/` + timestamp + `/` + req.URL.Query().Get("url") + `"}}}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestFetchArchiveOrg(t *testing.T) {
+	defer func(interval time.Duration) { waybackPollInterval = interval }(waybackPollInterval)
+	waybackPollInterval = time.Millisecond
+
+	var requested []string
+	saved, polls := "", 0
+	client := NewClient(nil)
+	client.Strategies = []string{StrategyArchiveOrg}
+	client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Host+req.URL.Path)
+		switch {
+		case req.URL.Host == "archive.org":
+			// the capture shows up in the availability API after a while
+			if polls++; client.WaybackSave && polls == 3 {
+				saved = time.Now().UTC().Format(waybackTimestamp)
+			}
+			return waybackAvailable(req, saved), nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(article(300))),
+			Request:    req,
+		}, nil
+	})
+
+	// without a snapshot, pages are not fetched from the Wayback Machine
+	_, err := client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	assert.ErrorContains(t, err, "no snapshot")
+
+	// unless they are saved first
+	requested = nil
+	client.WaybackSave = true
+	result, err := client.Fetch(context.Background(), "https://www.example.com/article", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyArchiveOrg, result.Strategy)
+	assert.Equal(t, "web.archive.org/save/https://www.example.com/article", requested[1])
+	assert.Equal(t, "web.archive.org/web/"+saved+"/https://www.example.com/article", requested[len(requested)-1])
+}
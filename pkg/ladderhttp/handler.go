@@ -0,0 +1,134 @@
+// Package ladderhttp adapts the ladder proxy pipeline to the standard net/http
+// interfaces, so it can be mounted inside existing chi, echo or net/http servers
+// instead of running the fiber based ladder server.
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/ladder/", ladderhttp.NewHandler(ladderhttp.Config{
+//		Client: ladder.NewClient(rules),
+//		Prefix: "/ladder/",
+//	}))
+//
+// http.ServeMux redirects the proxied URLs to a cleaned path (https:/www.example.com),
+// which the handler accepts as well.
+package ladderhttp
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/urls"
+)
+
+// Config configures the handler returned by NewHandler.
+type Config struct {
+	// Client fetches and modifies the proxied sites. Defaults to a Client without rules.
+	Client *ladder.Client
+	// Prefix is the path the handler is mounted under. Defaults to "/".
+	Prefix string
+	// ErrorStatuses are the statuses answered for failed fetches, see ladder.ErrorStatuses.
+	ErrorStatuses ladder.ErrorStatuses
+}
+
+// handler serves proxied sites below its prefix, e.g. /prefix/https://www.example.com.
+type handler struct {
+	client   *ladder.Client
+	prefix   string
+	statuses ladder.ErrorStatuses
+}
+
+// NewHandler returns a http.Handler serving sites through the ladder proxy pipeline.
+func NewHandler(config Config) http.Handler {
+	h := &handler{
+		client:   config.Client,
+		prefix:   config.Prefix,
+		statuses: config.ErrorStatuses,
+	}
+	if h.client == nil {
+		h.client = ladder.NewClient(nil)
+	}
+	if h.prefix == "" {
+		h.prefix = "/"
+	}
+	if !strings.HasSuffix(h.prefix, "/") {
+		h.prefix += "/"
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, err := h.extractUrl(r)
+	if err != nil {
+		slog.Error("failed to extract URL", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := map[string]string{}
+	for k, v := range r.URL.Query() {
+		query[k] = v[0]
+	}
+
+	result, err := h.client.Fetch(r.Context(), target, ladder.FetchOptions{
+		Query:       query,
+		ProxyPrefix: h.prefix,
+		ProxyOrigin: origin(r),
+		Passthrough: true,
+		Range:       r.Header.Get("Range"),
+		IfRange:     r.Header.Get("If-Range"),
+	})
+	if err != nil {
+		slog.Error("failed to fetch", "error", err)
+		http.Error(w, err.Error(), h.statuses.Status(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", result.Response.Header.Get("Content-Type"))
+	w.Header().Set("Content-Security-Policy", result.Response.Header.Get("Content-Security-Policy"))
+	if location := result.Response.Header.Get("Location"); location != "" {
+		w.Header().Set("Location", location)
+	}
+	if result.Body != nil {
+		defer result.Body.Close()
+		for _, header := range ladder.PassthroughHeaders {
+			if value := result.Response.Header.Get(header); value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+		if result.Response.ContentLength >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(result.Response.ContentLength, 10))
+		}
+		w.WriteHeader(result.Response.StatusCode)
+		// io.Copy lets the ResponseWriter use its ReaderFrom, eg: sendfile or splice where supported
+		if _, err := io.Copy(w, result.Body); err != nil {
+			slog.Error("failed to stream body", "error", err)
+		}
+		return
+	}
+	w.WriteHeader(result.Response.StatusCode)
+	_, _ = w.Write([]byte(result.Content))
+}
+
+// extractUrl extracts the proxied URL from the request path. If it is a relative path,
+// it reconstructs the full URL using the referer header.
+func (h *handler) extractUrl(r *http.Request) (string, error) {
+	target := strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(h.prefix, "/"))
+	return urls.Extract(target, r.Referer(), h.prefix)
+}
+
+// origin returns the scheme and host r was sent to.
+func origin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
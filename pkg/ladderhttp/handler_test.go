@@ -0,0 +1,116 @@
+package ladderhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ladder/pkg/ladder"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/video.mp4" {
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Header().Set("Content-Range", "bytes 2-5/10")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = io.WriteString(w, r.Header.Get("Range"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = io.WriteString(w, `<a href="/about">About `+r.URL.Path+`</a>`)
+	}))
+	defer upstream.Close()
+
+	h := NewHandler(Config{Prefix: "/ladder/"})
+
+	t.Run("absolute URL", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ladder/"+upstream.URL+"/article", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `href="/ladder/`+upstream.URL+`/about"`)
+		assert.Contains(t, rec.Body.String(), "About /article")
+	})
+
+	t.Run("cleaned URL", func(t *testing.T) {
+		// http.ServeMux cleans double slashes, eg: /ladder/http:/127.0.0.1/article
+		req := httptest.NewRequest(http.MethodGet, "/ladder/http:/"+upstream.Listener.Addr().String()+"/article", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "About /article")
+	})
+
+	t.Run("relative URL", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ladder/about", nil)
+		req.Header.Set("Referer", "http://localhost/ladder/"+upstream.URL+"/article")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "About /about")
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ladder/"+upstream.URL+"/video.mp4", nil)
+		req.Header.Set("Range", "bytes=2-5")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "video/mp4", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "9", rec.Header().Get("Content-Length"))
+		assert.Equal(t, "bytes=2-5", rec.Body.String())
+	})
+
+	t.Run("upstream status", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ladder/"+upstream.URL+"/missing", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), "About /missing")
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		client := ladder.NewClient(nil)
+		client.MaxRedirects = 0
+		req := httptest.NewRequest(http.MethodGet, "/ladder/"+upstream.URL+"/moved", nil)
+		rec := httptest.NewRecorder()
+		NewHandler(Config{Client: client, Prefix: "/ladder/"}).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, "/ladder/"+upstream.URL+"/article", rec.Header().Get("Location"))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/ladder/"+closed.URL, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+		rec = httptest.NewRecorder()
+		NewHandler(Config{Prefix: "/ladder/", ErrorStatuses: ladder.ErrorStatuses{Unreachable: http.StatusServiceUnavailable}}).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
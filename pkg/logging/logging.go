@@ -0,0 +1,123 @@
+// Package logging configures the structured logger of ladder, and carries the request ID and
+// the fields of the access log of each request in its context, so that the steps of serving a
+// request, such as the upstream fetch, are logged along with the request.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+func init() {
+	// flags may override the environment once parsed, but the logs of the initialization of the
+	// packages importing logging are formatted already
+	Setup(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+}
+
+// Setup makes the default logger, which the log package writes through too, write to w in
+// format, text or json, the records of level, debug, info, warn or error, and above.
+// Empty format and level default to text and info.
+func Setup(w io.Writer, format, level string) error {
+	var l slog.Level
+	if level == "" {
+		level = "info"
+	}
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level '%s', expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format '%s', expected text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// entryKey is the key of the Entry of a request in contexts.
+type entryKey struct{}
+
+// ContextKey is the key of the Entry of a request in contexts, for contexts storing values
+// themselves, eg: with fasthttp.RequestCtx.SetUserValue.
+var ContextKey any = entryKey{}
+
+// Entry is the access log entry of a request, which the steps of serving it annotate.
+// It is safe for concurrent use.
+type Entry struct {
+	// RequestID identifies the request in the logs.
+	RequestID string
+
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// requestIDRegex matches the request IDs accepted from clients, eg: in X-Request-Id.
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewEntry returns the Entry of a request identified by requestID, if valid, or by a new ID.
+func NewEntry(requestID string) *Entry {
+	if !requestIDRegex.MatchString(requestID) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		requestID = hex.EncodeToString(b)
+	}
+	return &Entry{RequestID: requestID}
+}
+
+// FromContext returns the Entry of the request of ctx, or nil.
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(ContextKey).(*Entry)
+	return e
+}
+
+// Annotate adds args, alternating keys and values as in slog.Logger.Info, to the access log
+// entry of the request of ctx, if any. Later values replace earlier ones of the same key, eg:
+// the strategy of the last fetch.
+func Annotate(ctx context.Context, args ...any) {
+	e := FromContext(ctx)
+	if e == nil {
+		return
+	}
+	r := slog.Record{}
+	r.Add(args...)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	r.Attrs(func(a slog.Attr) bool {
+		for i := range e.attrs {
+			if e.attrs[i].Key == a.Key {
+				e.attrs[i] = a
+				return true
+			}
+		}
+		e.attrs = append(e.attrs, a)
+		return true
+	})
+}
+
+// Attrs returns the request ID and the annotations of e.
+func (e *Entry) Attrs() []slog.Attr {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]slog.Attr{slog.String("request_id", e.RequestID)}, e.attrs...)
+}
+
+// Logger returns the default logger, with the request ID of the request of ctx, if any.
+func Logger(ctx context.Context) *slog.Logger {
+	if e := FromContext(ctx); e != nil {
+		return slog.Default().With("request_id", e.RequestID)
+	}
+	return slog.Default()
+}
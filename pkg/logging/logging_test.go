@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, "json", "warn"))
+	slog.Info("ignored")
+	slog.Warn("blocked", "status", 403)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "blocked", record["msg"])
+	assert.Equal(t, float64(403), record["status"])
+
+	assert.NoError(t, Setup(&buf, "", ""))
+	assert.Error(t, Setup(&buf, "xml", "info"))
+	assert.Error(t, Setup(&buf, "text", "verbose"))
+}
+
+func TestNewEntry(t *testing.T) {
+	assert.Equal(t, "req-42.a:b_c", NewEntry("req-42.a:b_c").RequestID)
+	for _, id := range []string{"", "has space", "new\nline", string(bytes.Repeat([]byte("a"), 129))} {
+		generated := NewEntry(id).RequestID
+		assert.Len(t, generated, 16, id)
+		assert.NotEqual(t, id, generated)
+	}
+	assert.NotEqual(t, NewEntry("").RequestID, NewEntry("").RequestID)
+}
+
+func TestAnnotate(t *testing.T) {
+	// without an entry, annotations are dropped
+	Annotate(context.Background(), "rule", "example.com")
+
+	e := NewEntry("abc")
+	ctx := context.WithValue(context.Background(), ContextKey, e)
+	assert.Same(t, e, FromContext(ctx))
+	Annotate(ctx, "strategy", "direct", "upstream_status", 403)
+	Annotate(ctx, "strategy", "archive", "upstream_status", 200)
+	assert.Equal(t, []slog.Attr{
+		slog.String("request_id", "abc"),
+		slog.String("strategy", "archive"),
+		slog.Int("upstream_status", 200),
+	}, e.Attrs())
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	require.NoError(t, Setup(&buf, "text", "info"))
+	Logger(ctx).Info("fetching")
+	assert.Contains(t, buf.String(), "request_id=abc")
+}
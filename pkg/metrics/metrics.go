@@ -0,0 +1,168 @@
+// Package metrics exposes the metrics of ladder to Prometheus, such as the requests served per
+// route, the latency of upstreams and the success of strategies, so that operators can monitor
+// their instances.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MaxSeries caps the label values tracked per metric, eg: the domains requested. The
+// observations of further label values are counted under the label value "other".
+const MaxSeries = 10000
+
+var (
+	// durationBuckets are the upper bounds of the histograms of request durations, in seconds.
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	// modifierBuckets are the upper bounds of the histogram of modifier durations, in seconds.
+	modifierBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+)
+
+// Metrics are the metrics of a ladder instance. A nil Metrics records nothing.
+type Metrics struct {
+	// Registry holds the metrics below, along with the metrics of the Go runtime and of the
+	// process, and those other packages register.
+	Registry *prometheus.Registry
+
+	requests         *counterVec
+	requestDurations *histogramVec
+	upstream         *histogramVec
+	modifiers        *histogramVec
+	strategies       *counterVec
+}
+
+// New returns Metrics registered in a new Registry.
+func New() *Metrics {
+	r := prometheus.NewRegistry()
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return &Metrics{
+		Registry: r,
+		requests: newCounterVec(r, prometheus.CounterOpts{
+			Name: "ladder_http_requests_total",
+			Help: "Requests served, by route, status and proxied domain.",
+		}, "route", "status", "domain"),
+		requestDurations: newHistogramVec(r, prometheus.HistogramOpts{
+			Name:    "ladder_http_request_duration_seconds",
+			Help:    "Time to serve requests, by route.",
+			Buckets: durationBuckets,
+		}, "route"),
+		upstream: newHistogramVec(r, prometheus.HistogramOpts{
+			Name:    "ladder_upstream_duration_seconds",
+			Help:    "Time until upstreams answered with their headers, by domain.",
+			Buckets: durationBuckets,
+		}, "domain"),
+		modifiers: newHistogramVec(r, prometheus.HistogramOpts{
+			Name:    "ladder_modifier_duration_seconds",
+			Help:    "Time spent in modifiers, by modifier and phase.",
+			Buckets: modifierBuckets,
+		}, "modifier", "phase"),
+		strategies: newCounterVec(r, prometheus.CounterOpts{
+			Name: "ladder_strategy_fetches_total",
+			Help: "Fetches of pages with strategies, by strategy and outcome: success, blocked or error.",
+		}, "strategy", "outcome"),
+	}
+}
+
+// Handler serves the metrics of the Registry, in the format Prometheus asks for.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// Request records a request to route, eg: /api/v1/fetch/*, served with status in d, for domain
+// if it proxied one.
+func (m *Metrics) Request(route string, status int, domain string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.inc(route, strconv.Itoa(status), domain)
+	m.requestDurations.observe(d.Seconds(), route)
+}
+
+// Upstream records that the upstream of domain answered with its headers in d.
+func (m *Metrics) Upstream(domain string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstream.observe(d.Seconds(), domain)
+}
+
+// Modifier records that modifier ran for d in phase, request or response.
+func (m *Metrics) Modifier(modifier, phase string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.modifiers.observe(d.Seconds(), modifier, phase)
+}
+
+// Strategy records the outcome of fetching a page with strategy.
+func (m *Metrics) Strategy(strategy, outcome string) {
+	if m == nil {
+		return
+	}
+	m.strategies.inc(strategy, outcome)
+}
+
+// limit caps the label values of a metric at MaxSeries.
+type limit struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// values returns labelValues, or "other" for each label once MaxSeries other values were seen.
+func (l *limit) values(labelValues []string) []string {
+	key := strings.Join(labelValues, "\x00")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[key] {
+		return labelValues
+	}
+	if len(l.seen) >= MaxSeries {
+		other := make([]string, len(labelValues))
+		for i := range other {
+			other[i] = "other"
+		}
+		return other
+	}
+	l.seen[key] = true
+	return labelValues
+}
+
+// counterVec is a counter partitioned by labels, capped at MaxSeries.
+type counterVec struct {
+	vec *prometheus.CounterVec
+	limit
+}
+
+func newCounterVec(r prometheus.Registerer, opts prometheus.CounterOpts, labels ...string) *counterVec {
+	c := &counterVec{vec: prometheus.NewCounterVec(opts, labels), limit: limit{seen: map[string]bool{}}}
+	r.MustRegister(c.vec)
+	return c
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.vec.WithLabelValues(c.values(labelValues)...).Inc()
+}
+
+// histogramVec is a histogram partitioned by labels, capped at MaxSeries.
+type histogramVec struct {
+	vec *prometheus.HistogramVec
+	limit
+}
+
+func newHistogramVec(r prometheus.Registerer, opts prometheus.HistogramOpts, labels ...string) *histogramVec {
+	h := &histogramVec{vec: prometheus.NewHistogramVec(opts, labels), limit: limit{seen: map[string]bool{}}}
+	r.MustRegister(h.vec)
+	return h
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	h.vec.WithLabelValues(h.values(labelValues)...).Observe(v)
+}
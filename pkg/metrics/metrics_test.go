@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.Request("/api/v1/fetch/*", 200, "www.example.com", 30*time.Millisecond)
+	m.Request("/api/v1/fetch/*", 200, "www.example.com", 3*time.Second)
+	m.Request("/", 429, "", time.Millisecond)
+	m.Strategy("direct", "blocked")
+	m.Modifier(`say "hi"`, "response", time.Millisecond)
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "ladder_up", Help: "Whether ladder is up."}, func() float64 { return 1 }))
+	var nilMetrics *Metrics
+	nilMetrics.Upstream("www.example.com", time.Second)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	out := string(body)
+	for _, line := range []string{
+		"# TYPE ladder_http_requests_total counter",
+		`ladder_http_requests_total{domain="",route="/",status="429"} 1`,
+		`ladder_http_requests_total{domain="www.example.com",route="/api/v1/fetch/*",status="200"} 2`,
+		"# TYPE ladder_http_request_duration_seconds histogram",
+		`ladder_http_request_duration_seconds_bucket{route="/api/v1/fetch/*",le="0.025"} 0`,
+		`ladder_http_request_duration_seconds_bucket{route="/api/v1/fetch/*",le="0.05"} 1`,
+		`ladder_http_request_duration_seconds_bucket{route="/api/v1/fetch/*",le="5"} 2`,
+		`ladder_http_request_duration_seconds_bucket{route="/api/v1/fetch/*",le="+Inf"} 2`,
+		`ladder_http_request_duration_seconds_sum{route="/api/v1/fetch/*"} 3.03`,
+		`ladder_http_request_duration_seconds_count{route="/api/v1/fetch/*"} 2`,
+		`ladder_strategy_fetches_total{outcome="blocked",strategy="direct"} 1`,
+		`ladder_modifier_duration_seconds_count{modifier="say \"hi\"",phase="response"} 1`,
+		"ladder_up 1",
+		"# TYPE go_goroutines gauge",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	r := prometheus.NewRegistry()
+	c := newCounterVec(r, prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, "domain")
+	for i := 0; i < MaxSeries+5; i++ {
+		c.inc("domain" + strconv.Itoa(i))
+	}
+	assert.Equal(t, MaxSeries+1, testutil.CollectAndCount(c.vec))
+	assert.EqualValues(t, 5, testutil.ToFloat64(c.vec.WithLabelValues("other")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(c.vec.WithLabelValues("domain0")))
+}
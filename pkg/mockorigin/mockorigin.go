@@ -0,0 +1,228 @@
+// Package mockorigin serves recorded pages from disk with simulated paywalls,
+// so rulesets can be developed and demonstrated without network access.
+//
+// Fixtures are stored by host and path: a request for https://example.com/news/article
+// is answered with <dir>/example.com/news/article, or with .html appended if that
+// file does not exist. Paths ending in / are answered with their index.html.
+// Ladder is pointed at the mock origin with the MOCK_ORIGIN environment variable,
+// which sends every upstream request to it with the original Host header.
+package mockorigin
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Paywall variants simulated on HTML fixtures.
+const (
+	// VariantNone serves fixtures unmodified.
+	VariantNone = "none"
+	// VariantOverlay covers the page with a subscription overlay, leaving the article in the markup.
+	VariantOverlay = "overlay"
+	// VariantTruncate removes all but the first paragraphs of the article, except for search engine crawlers.
+	VariantTruncate = "truncate"
+	// VariantMeter counts visits in a cookie and truncates the article once MeterLimit is exceeded.
+	VariantMeter = "meter"
+)
+
+// Variants lists the supported paywall variants.
+var Variants = []string{VariantNone, VariantOverlay, VariantTruncate, VariantMeter}
+
+const (
+	// meterCookie is the cookie counting the visits of VariantMeter.
+	meterCookie = "mock_meter"
+	// freeParagraphs is the number of paragraphs left by truncation.
+	freeParagraphs = 2
+	// paywallMessage is shown in place of the hidden content.
+	paywallMessage = `<div class="paywall">Subscribe to continue reading.</div>`
+	overlayStyle   = `<style>body{overflow:hidden}.paywall-overlay{position:fixed;inset:0;z-index:9999;background:#fff}</style>`
+	overlay        = `<div class="paywall-overlay">` + paywallMessage + `</div>`
+)
+
+// Server is an http.Handler serving the fixtures of Dir.
+type Server struct {
+	// Dir is the fixture directory.
+	Dir string
+	// Variant is the paywall simulated by default. Requests can select
+	// another variant with the paywall query parameter.
+	Variant string
+	// MeterLimit is the number of free visits of VariantMeter.
+	MeterLimit int
+}
+
+// NewServer returns a Server serving the fixtures of dir behind the variant paywall.
+func NewServer(dir string, variant string) (*Server, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("fixture directory '%s' does not exist", dir)
+	}
+	if !validVariant(variant) {
+		return nil, fmt.Errorf("unknown paywall variant '%s', must be one of %s", variant, strings.Join(Variants, ", "))
+	}
+	return &Server{Dir: dir, Variant: variant, MeterLimit: 3}, nil
+}
+
+func validVariant(variant string) bool {
+	for _, v := range Variants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves the fixture of the requested host and path.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	variant := s.Variant
+	if v := r.URL.Query().Get("paywall"); v != "" {
+		if !validVariant(v) {
+			http.Error(w, "unknown paywall variant "+v, http.StatusBadRequest)
+			return
+		}
+		variant = v
+	}
+
+	file, err := s.fixture(r.Host, r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err := os.ReadFile(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(file))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	if strings.HasPrefix(contentType, "text/html") {
+		body, err = s.paywall(w, r, variant, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write(body)
+}
+
+// fixture returns the file answering requests for host and urlPath.
+func (s *Server) fixture(host string, urlPath string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, `/\`) || strings.HasPrefix(host, ".") {
+		return "", errors.New("invalid host " + host)
+	}
+
+	urlPath = path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") {
+		urlPath += "index.html"
+	}
+	file := filepath.Join(s.Dir, host, filepath.FromSlash(urlPath))
+
+	candidates := []string{file, file + ".html", filepath.Join(file, "index.html")}
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			return c, nil
+		}
+	}
+	return "", errors.New("no fixture for " + host + urlPath)
+}
+
+// paywall applies variant to the HTML body, answering r.
+func (s *Server) paywall(w http.ResponseWriter, r *http.Request, variant string, body []byte) ([]byte, error) {
+	switch variant {
+	case VariantOverlay:
+		html := string(body)
+		html = strings.Replace(html, "</head>", overlayStyle+"</head>", 1)
+		html = strings.Replace(html, "</body>", overlay+"</body>", 1)
+		return []byte(html), nil
+	case VariantTruncate:
+		if isCrawler(r) {
+			return body, nil
+		}
+		return truncate(body)
+	case VariantMeter:
+		visits := 0
+		if c, err := r.Cookie(meterCookie); err == nil {
+			visits, _ = strconv.Atoi(c.Value)
+		}
+		visits++
+		http.SetCookie(w, &http.Cookie{Name: meterCookie, Value: strconv.Itoa(visits), Path: "/"})
+		if visits <= s.MeterLimit {
+			return body, nil
+		}
+		return truncate(body)
+	}
+	return body, nil
+}
+
+// isCrawler reports whether r claims to come from a search engine crawler, which paywalls let through.
+func isCrawler(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	return strings.Contains(ua, "googlebot") || strings.Contains(ua, "bingbot")
+}
+
+// truncate removes all but the first paragraphs of body and appends the paywall message.
+func truncate(body []byte) ([]byte, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	paragraphs := doc.Find("p")
+	if paragraphs.Length() <= freeParagraphs {
+		return body, nil
+	}
+	last := paragraphs.Eq(freeParagraphs - 1)
+	paragraphs.Slice(freeParagraphs, paragraphs.Length()).Remove()
+	last.AfterHtml(paywallMessage)
+
+	html, err := doc.Html()
+	return []byte(html), err
+}
+
+// Transport returns an http.RoundTripper sending every request to the mock
+// origin at origin, keeping the original Host header.
+func Transport(origin string) (http.RoundTripper, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("mock origin '%s' must be an absolute URL", origin)
+	}
+	return &transport{origin: u}, nil
+}
+
+type transport struct {
+	origin *url.URL
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Host = req.URL.Host
+	r.URL.Scheme = t.origin.Scheme
+	r.URL.Host = t.origin.Host
+
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
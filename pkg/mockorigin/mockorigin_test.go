@@ -0,0 +1,123 @@
+package mockorigin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const article = `<html><head><title>Article</title></head><body>` +
+	`<p>First</p><p>Second</p><p>Third</p><p>Fourth</p></body></html>`
+
+func newServer(t *testing.T, variant string) *Server {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "example.com", "news"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.com", "news", "article.html"), []byte(article), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.com", "index.html"), []byte(article), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example.com", "style.css"), []byte("p{}"), 0o644))
+
+	s, err := NewServer(dir, variant)
+	require.NoError(t, err)
+	return s
+}
+
+func get(s *Server, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewServer(t *testing.T) {
+	_, err := NewServer(t.TempDir(), "unknown")
+	assert.ErrorContains(t, err, "unknown paywall variant")
+
+	_, err = NewServer(filepath.Join(t.TempDir(), "missing"), VariantNone)
+	assert.ErrorContains(t, err, "does not exist")
+}
+
+func TestFixtures(t *testing.T) {
+	s := newServer(t, VariantNone)
+
+	rec := get(s, "http://example.com/news/article", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, article, rec.Body.String())
+
+	rec = get(s, "http://example.com:8080/", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, article, rec.Body.String())
+
+	rec = get(s, "http://example.com/style.css", nil)
+	assert.Equal(t, "text/css; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	rec = get(s, "http://example.com/../../etc/passwd", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = get(s, "http://other.com/news/article", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestVariants(t *testing.T) {
+	s := newServer(t, VariantTruncate)
+
+	t.Run("truncate", func(t *testing.T) {
+		body := get(s, "http://example.com/news/article", nil).Body.String()
+		assert.Contains(t, body, "Second")
+		assert.NotContains(t, body, "Third")
+		assert.Contains(t, body, "Subscribe to continue reading.")
+
+		body = get(s, "http://example.com/news/article", http.Header{"User-Agent": {"Googlebot/2.1"}}).Body.String()
+		assert.Equal(t, article, body)
+	})
+
+	t.Run("overlay", func(t *testing.T) {
+		body := get(s, "http://example.com/news/article?paywall=overlay", nil).Body.String()
+		assert.Contains(t, body, "Fourth")
+		assert.Contains(t, body, `<div class="paywall-overlay">`)
+		assert.Contains(t, body, "overflow:hidden")
+	})
+
+	t.Run("meter", func(t *testing.T) {
+		rec := get(s, "http://example.com/news/article?paywall=meter", nil)
+		assert.Contains(t, rec.Body.String(), "Fourth")
+		assert.Contains(t, rec.Header().Get("Set-Cookie"), "mock_meter=1")
+
+		rec = get(s, "http://example.com/news/article?paywall=meter", http.Header{"Cookie": {"mock_meter=3"}})
+		assert.NotContains(t, rec.Body.String(), "Fourth")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(s, "http://example.com/?paywall=hard", nil).Code)
+	})
+}
+
+func TestTransport(t *testing.T) {
+	s := newServer(t, VariantNone)
+	origin := httptest.NewServer(s)
+	defer origin.Close()
+
+	rt, err := Transport(origin.URL)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: rt}
+	resp, err := client.Get("https://example.com/news/article")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, article, string(body))
+	assert.Equal(t, "https://example.com/news/article", resp.Request.URL.String())
+
+	_, err = Transport("localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+// Package oidc logs the users of ladder in with an OpenID Connect provider, such as Authentik,
+// Keycloak or Google, with the authorization code flow and PKCE, and keeps them logged in with
+// signed session cookies.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// DefaultScopes are the scopes requested when Config.Scopes is empty.
+var DefaultScopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+
+// Config configures the client of an OpenID Connect provider.
+type Config struct {
+	// Issuer is the URL of the provider, whose configuration is discovered at
+	// Issuer/.well-known/openid-configuration, eg: https://accounts.google.com.
+	Issuer string
+	// ClientID and ClientSecret are those of ladder, registered with the provider.
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL of ladder registered with the provider,
+	// eg: https://ladder.example.com/auth/callback.
+	RedirectURL string
+	// Scopes are the scopes requested. Defaults to DefaultScopes.
+	Scopes []string
+}
+
+// Provider is an OpenID Connect provider, once discovered.
+type Provider struct {
+	client   *http.Client
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// Claims are the claims of an ID token identifying the user logged in.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Discover fetches the configuration of the provider of config, with client if set.
+func Discover(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("the issuer, client ID and redirect URL of the OpenID Connect provider are required")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	// the provider fetches its signing keys with the client of ctx, also once discovered
+	provider, err := gooidc.NewProvider(gooidc.ClientContext(ctx, client), config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OpenID Connect provider '%s': %w", config.Issuer, err)
+	}
+	endpoint := provider.Endpoint()
+	// public clients, without secret, identify themselves in the form rather than with Basic Auth
+	endpoint.AuthStyle = oauth2.AuthStyleInHeader
+	if config.ClientSecret == "" {
+		endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+	return &Provider{
+		client: client,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     endpoint,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       config.Scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// Login is the state of a login in progress, kept by the browser until the provider redirects
+// it back to the callback.
+type Login struct {
+	// State and Nonce bind the callback and the ID token to the login.
+	State string `json:"state"`
+	Nonce string `json:"nonce"`
+	// Verifier is the PKCE code verifier.
+	Verifier string `json:"verifier"`
+	// Next is the path the user is sent back to once logged in.
+	Next string `json:"next"`
+}
+
+// NewLogin starts a login returning to next once done.
+func NewLogin(next string) Login {
+	return Login{State: random(), Nonce: random(), Verifier: random(), Next: next}
+}
+
+// AuthCodeURL returns the URL of the provider the user logs in at.
+func (p *Provider) AuthCodeURL(login Login) string {
+	return p.oauth2.AuthCodeURL(login.State, gooidc.Nonce(login.Nonce), oauth2.S256ChallengeOption(login.Verifier))
+}
+
+// Exchange exchanges code, the authorization code the provider redirected the user back with,
+// for an ID token, and returns its claims once verified against login.
+func (p *Provider) Exchange(ctx context.Context, code string, login Login) (*Claims, error) {
+	token, err := p.oauth2.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	rawToken, _ := token.Extra("id_token").(string)
+	if rawToken == "" {
+		return nil, errors.New("failed to exchange authorization code: no ID token")
+	}
+	return p.Verify(ctx, rawToken, login.Nonce)
+}
+
+// Verify verifies the signature, issuer, audience, expiry and nonce of the ID token rawToken,
+// and returns its claims.
+func (p *Provider) Verify(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	token, err := p.verifier.Verify(gooidc.ClientContext(ctx, p.client), rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if token.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if token.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+	var claims Claims
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	return &claims, nil
+}
+
+// random returns a random URL-safe string of 256 bits.
+func random() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
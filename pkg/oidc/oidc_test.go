@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// provider is a fake OpenID Connect provider issuing ID tokens with claims.
+type provider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+	form   url.Values
+}
+
+func newProvider(t *testing.T) *provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &provider{key: key}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 p.URL,
+				"authorization_endpoint": p.URL + "/authorize",
+				"token_endpoint":         p.URL + "/token",
+				"jwks_uri":               p.URL + "/jwks",
+			})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "k1",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		case "/token":
+			r.ParseForm()
+			p.form = r.PostForm
+			if user, secret, _ := r.BasicAuth(); user != "ladder" || secret != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "a1", "token_type": "Bearer", "id_token": p.sign(t, "k1")})
+		}
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) sign(t *testing.T, kid string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(p.claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// hs256 returns a token of claims signed with secret.
+func hs256(t *testing.T, claims map[string]any, secret string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256"})
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestLogin(t *testing.T) {
+	p := newProvider(t)
+	ctx := context.Background()
+	provider, err := Discover(ctx, Config{Issuer: p.URL, ClientID: "ladder", ClientSecret: "s3cret", RedirectURL: "https://ladder.example.com/auth/callback"}, nil)
+	require.NoError(t, err)
+
+	login := NewLogin("/https://www.example.com/")
+	authURL, err := url.Parse(provider.AuthCodeURL(login))
+	require.NoError(t, err)
+	assert.Equal(t, p.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "openid email profile", authURL.Query().Get("scope"))
+	assert.Equal(t, login.State, authURL.Query().Get("state"))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+
+	p.claims = map[string]any{"iss": p.URL, "sub": "u1", "aud": []string{"ladder"}, "exp": time.Now().Add(time.Hour).Unix(),
+		"nonce": login.Nonce, "email": "alice@example.com", "email_verified": true, "preferred_username": "alice"}
+	claims, err := provider.Exchange(ctx, "code", login)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.Subject)
+	assert.Equal(t, "alice@example.com", claims.Email)
+	assert.Equal(t, login.Verifier, p.form.Get("code_verifier"))
+	assert.Equal(t, "code", p.form.Get("code"))
+
+	assert.True(t, Allowed(claims, nil))
+	assert.True(t, Allowed(claims, []string{"bob@example.com", "@Example.com"}))
+	assert.False(t, Allowed(claims, []string{"alice@example.org", "@ample.com"}))
+
+	// tokens are checked against the login, the client and the keys of the provider
+	tests := map[string]func(){
+		"nonce mismatch":    func() { p.claims["nonce"] = "other" },
+		"expected audience": func() { p.claims["aud"] = "other" },
+		"expired":           func() { p.claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"issued by":         func() { p.claims["iss"] = "https://evil.example.com" },
+	}
+	for want, change := range tests {
+		saved := map[string]any{}
+		for k, v := range p.claims {
+			saved[k] = v
+		}
+		change()
+		_, err := provider.Exchange(ctx, "code", login)
+		assert.ErrorContains(t, err, want)
+		p.claims = saved
+	}
+	_, err = provider.Verify(ctx, p.sign(t, "k2"), login.Nonce)
+	assert.ErrorContains(t, err, "failed to verify signature")
+	token := p.sign(t, "k1")
+	_, err = provider.Verify(ctx, token[:len(token)-4]+"AAAA", login.Nonce)
+	assert.ErrorContains(t, err, "failed to verify signature")
+	// nor are tokens signed with the client secret accepted
+	_, err = provider.Verify(ctx, hs256(t, p.claims, "s3cret"), login.Nonce)
+	assert.Error(t, err)
+}
+
+func TestSealer(t *testing.T) {
+	s := NewSealer("secret")
+	sealed, err := s.Seal("session", Session{Subject: "u1", Expiry: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	var session Session
+	require.NoError(t, NewSealer("secret").Open("session", sealed, &session))
+	assert.Equal(t, "u1", session.Subject)
+	assert.True(t, session.Valid())
+
+	assert.Error(t, NewSealer("other").Open("session", sealed, &session))
+	assert.Error(t, s.Open("login", sealed, &session))
+	assert.Error(t, s.Open("session", "e30."+sealed[len(sealed)-10:], &session))
+	assert.False(t, Session{Subject: "u1", Expiry: time.Now().Add(-time.Second).Unix()}.Valid())
+}
@@ -0,0 +1,99 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Session identifies a user logged in.
+type Session struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// Expiry is when the session ends, in seconds since the epoch.
+	Expiry int64 `json:"exp"`
+}
+
+// Sealer signs values, eg: sessions and logins in progress, so that they can be kept in cookies
+// without the browser being able to forge them.
+type Sealer struct {
+	key []byte
+}
+
+// NewSealer returns a Sealer signing with secret, or with a random secret if empty, in which
+// case the values it sealed can't be opened once ladder restarts.
+func NewSealer(secret string) *Sealer {
+	if secret == "" {
+		secret = random()
+	}
+	key := sha256.Sum256([]byte(secret))
+	return &Sealer{key: key[:]}
+}
+
+// Seal returns v encoded as JSON and signed, for purpose, eg: session.
+func (s *Sealer) Seal(purpose string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + s.sign(purpose, payload), nil
+}
+
+// Open decodes into v the value sealed for purpose.
+func (s *Sealer) Open(purpose, sealed string, v any) error {
+	payload, signature, ok := strings.Cut(sealed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(purpose, payload))) {
+		return errors.New("invalid signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *Sealer) sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose + "\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewSession returns the session of the user of claims, lasting ttl.
+func NewSession(claims *Claims, ttl time.Duration) Session {
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	return Session{Subject: claims.Subject, Email: claims.Email, Name: name, Expiry: time.Now().Add(ttl).Unix()}
+}
+
+// Valid reports whether s hasn't expired.
+func (s Session) Valid() bool {
+	return s.Subject != "" && time.Now().Before(time.Unix(s.Expiry, 0))
+}
+
+// Allowed reports whether the user of claims may log in, according to allowed, a list of
+// email addresses and of domains starting with @, eg: @example.com. Everyone is allowed if
+// allowed is empty. Emails the provider reports unverified are never allowed.
+func Allowed(claims *Claims, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if claims.Email == "" || (claims.EmailVerified != nil && !*claims.EmailVerified) {
+		return false
+	}
+	email := strings.ToLower(claims.Email)
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == email || (strings.HasPrefix(entry, "@") && strings.HasSuffix(email, entry)) {
+			return true
+		}
+	}
+	return false
+}
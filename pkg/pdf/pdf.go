@@ -0,0 +1,217 @@
+// Package pdf renders the articles extracted by ladder as PDF documents, with
+// their metadata and images, so they can be printed or archived.
+//
+//	result, _ := client.Fetch(ctx, url, ladder.FetchOptions{Format: ladder.FormatOutline})
+//	doc := pdf.Document{Outline: *result.Outline, Images: client.FetchImages(ctx, result.Outline.ImageURLs())}
+//	err := doc.Write(w, time.Now())
+//
+// Documents use the standard PDF fonts, which only cover Windows-1252: other
+// characters are replaced with dots.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"time"
+
+	"ladder/pkg/ladder"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// MediaType is the media type of PDF files.
+const MediaType = "application/pdf"
+
+// imageTypes are the image types that can be embedded.
+var imageTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+const (
+	// margin is the page margin, in millimeters.
+	margin = 20.0
+	// lineHeight is the height of the lines of body text, in millimeters.
+	lineHeight = 6.0
+	// maxImageHeight bounds the height of images, in millimeters, so that they don't fill whole pages.
+	maxImageHeight = 120.0
+	// maxImagePixels bounds the dimensions of the images decoded, larger images are replaced with their alt text.
+	maxImagePixels = 40_000_000
+)
+
+// headingSizes are the font sizes of headings by level, from 1 to 6.
+var headingSizes = [...]float64{20, 16, 14, 12, 11, 11}
+
+// Document is an article to render as a PDF.
+type Document struct {
+	// Outline is the content and metadata of the article.
+	Outline ladder.Outline
+	// Images holds the images of the article by their URL, along with the cover, see ladder.Outline.ImageURLs.
+	// Images missing from it or that can't be embedded, eg: WebP or SVG, are replaced with their alt text.
+	Images map[string]ladder.Image
+}
+
+// Write writes the document as a PDF to w. modified is the creation time recorded in the PDF.
+func (d Document) Write(w io.Writer, modified time.Time) error {
+	md := d.Outline.Metadata
+	title := md.Title
+	if title == "" {
+		title = d.Outline.URL
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin)
+	pdf.SetTitle(title, true)
+	pdf.SetAuthor(md.Author, true)
+	pdf.SetSubject(d.Outline.URL, true)
+	pdf.SetCreator("ladder", true)
+	pdf.SetCreationDate(modified)
+	pdf.SetModificationDate(modified)
+	if md.Language != "" {
+		pdf.SetLang(md.Language)
+	}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin / 2)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 4, strconv.Itoa(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+	width, _ := pdf.GetPageSize()
+	contentWidth := width - 2*margin
+
+	pdf.SetFont("Helvetica", "B", headingSizes[0])
+	pdf.Bookmark(tr(title), 0, -1)
+	pdf.MultiCell(0, 9, tr(title), "", "L", false)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.SetTextColor(96, 96, 96)
+	if byline := d.Outline.Byline(); byline != "" {
+		pdf.MultiCell(0, 5, tr(byline), "", "L", false)
+	}
+	pdf.SetTextColor(0, 0, 238)
+	pdf.WriteLinkString(5, tr(d.Outline.URL), d.Outline.URL)
+	pdf.Ln(10)
+	pdf.SetTextColor(0, 0, 0)
+
+	blocks := d.Outline.Blocks
+	if len(blocks) > 0 && blocks[0].Type == ladder.BlockHeading && blocks[0].Level == 1 && blocks[0].Text == title {
+		blocks = blocks[1:]
+	}
+	// the cover is shown under the title unless the article shows it already
+	cover := d.Outline.CoverURL()
+	for _, block := range blocks {
+		if block.Type == ladder.BlockImage && block.Src == cover {
+			cover = ""
+		}
+	}
+	if cover != "" {
+		d.image(pdf, cover, contentWidth)
+	}
+
+	for _, block := range blocks {
+		switch block.Type {
+		case ladder.BlockHeading:
+			level := min(max(block.Level, 1), 6)
+			pdf.SetFont("Helvetica", "B", headingSizes[level-1])
+			pdf.Ln(2)
+			pdf.Bookmark(tr(block.Text), 1, -1)
+			pdf.MultiCell(0, headingSizes[level-1]*0.45, tr(block.Text), "", "L", false)
+		case ladder.BlockParagraph:
+			pdf.SetFont("Times", "", 12)
+			pdf.MultiCell(0, lineHeight, tr(block.Text), "", "L", false)
+		case ladder.BlockList:
+			pdf.SetFont("Times", "", 12)
+			for i, item := range block.Items {
+				marker := "•"
+				if block.Ordered {
+					marker = strconv.Itoa(i+1) + "."
+				}
+				pdf.SetX(margin + 2)
+				pdf.CellFormat(6, lineHeight, tr(marker), "", 0, "L", false, 0, "")
+				pdf.MultiCell(0, lineHeight, tr(item), "", "L", false)
+			}
+		case ladder.BlockQuote:
+			pdf.SetFont("Times", "I", 12)
+			pdf.SetLeftMargin(margin + 8)
+			pdf.SetX(margin + 8)
+			pdf.MultiCell(0, lineHeight, tr(block.Text), "", "L", false)
+			pdf.SetLeftMargin(margin)
+		case ladder.BlockCode:
+			pdf.SetFont("Courier", "", 9)
+			pdf.SetFillColor(240, 240, 240)
+			pdf.MultiCell(0, 4.5, tr(block.Text), "", "L", true)
+		case ladder.BlockImage:
+			if !d.image(pdf, block.Src, contentWidth) && block.Text != "" {
+				pdf.SetFont("Times", "I", 12)
+				pdf.MultiCell(0, lineHeight, tr("["+block.Text+"]"), "", "L", false)
+			}
+		default:
+			continue
+		}
+		pdf.Ln(3)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return fmt.Errorf("failed to render pdf: %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// image draws the image at src scaled to the content width, and reports whether it could.
+func (d Document) image(pdf *fpdf.Fpdf, src string, contentWidth float64) bool {
+	imageType, data, ok := d.embeddable(src)
+	if !ok {
+		return false
+	}
+	options := fpdf.ImageOptions{ImageType: imageType, ReadDpi: true}
+	info := pdf.RegisterImageOptionsReader(src, options, bytes.NewReader(data))
+	if !pdf.Ok() || info == nil || info.Width() == 0 || info.Height() == 0 {
+		pdf.ClearError()
+		return false
+	}
+	w := min(info.Width(), contentWidth)
+	h := info.Height() * w / info.Width()
+	if h > maxImageHeight {
+		w, h = w*maxImageHeight/h, maxImageHeight
+	}
+	pdf.ImageOptions(src, margin+(contentWidth-w)/2, -1, w, h, true, options, 0, "")
+	pdf.Ln(2)
+	return true
+}
+
+// embeddable returns the fpdf type and data of the image at src. The images are
+// decoded first, as fpdf trusts their structure, and PNGs and GIFs are re-encoded
+// into the non-interlaced PNGs it supports.
+func (d Document) embeddable(src string) (string, []byte, bool) {
+	img, ok := d.Images[src]
+	if !ok || !imageTypes[img.MediaType] {
+		return "", nil, false
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil || config.Width*config.Height > maxImagePixels {
+		return "", nil, false
+	}
+	if format == "jpeg" {
+		return "JPG", img.Data, true
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return "", nil, false
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, decoded); err != nil {
+		return "", nil, false
+	}
+	return "PNG", buf.Bytes(), true
+}
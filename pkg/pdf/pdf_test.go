@@ -0,0 +1,84 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"ladder/pkg/ladder"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodePNG returns a transparent PNG of width x 1 pixels.
+func encodePNG(t *testing.T, width int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, 1))))
+	return buf.Bytes()
+}
+
+// utf16BE encodes s like the text strings of PDF metadata.
+func utf16BE(s string) []byte {
+	b := []byte{0xfe, 0xff}
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
+
+func TestWrite(t *testing.T) {
+	doc := Document{
+		Outline: ladder.Outline{
+			URL: "https://www.example.com/article",
+			Metadata: ladder.Metadata{
+				Title:         "Ladder and friends",
+				Author:        "Jane Doe",
+				SiteName:      "Example",
+				PublishedTime: "2024-01-02T15:04:05Z",
+				Language:      "en",
+				Image:         "/cover.png",
+			},
+			Blocks: []ladder.Block{
+				{Type: ladder.BlockHeading, Level: 1, Text: "Ladder and friends"},
+				{Type: ladder.BlockParagraph, Text: "“Quoted” text with unsupported characters: 日本"},
+				{Type: ladder.BlockHeading, Level: 2, Text: "Section"},
+				{Type: ladder.BlockImage, Text: "Diagram", Src: "https://www.example.com/diagram.png"},
+				{Type: ladder.BlockImage, Text: "Icon", Src: "https://www.example.com/icon.webp"},
+				{Type: ladder.BlockImage, Text: "Broken", Src: "https://www.example.com/broken.png"},
+				{Type: ladder.BlockList, Items: []string{"one", "two"}, Ordered: true},
+				{Type: ladder.BlockQuote, Text: "quote"},
+				{Type: ladder.BlockCode, Text: "if a < b {}"},
+			},
+		},
+		Images: map[string]ladder.Image{
+			"https://www.example.com/cover.png":   {MediaType: "image/png", Data: encodePNG(t, 1)},
+			"https://www.example.com/diagram.png": {MediaType: "image/png", Data: encodePNG(t, 2)},
+			"https://www.example.com/icon.webp":   {MediaType: "image/webp", Data: []byte("RIFF")},
+			"https://www.example.com/broken.png":  {MediaType: "image/png", Data: []byte("\x89PNG\r\n\x1a\nnot a png")},
+		},
+	}
+	modified := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	require.NoError(t, doc.Write(&buf, modified))
+	b := buf.Bytes()
+
+	assert.True(t, bytes.HasPrefix(b, []byte("%PDF-")))
+	assert.Contains(t, string(b), string(utf16BE("Ladder and friends")))
+	assert.Contains(t, string(b), string(utf16BE("Jane Doe")))
+	assert.Contains(t, string(b), string(utf16BE("https://www.example.com/article")))
+	assert.Contains(t, string(b), "/CreationDate (D:20240103000000")
+	assert.Contains(t, string(b), "/Lang (en)")
+	// the cover and the diagram are embedded with their alpha channel, the other images are replaced with their alt text
+	assert.Equal(t, 2, bytes.Count(b, []byte("/SMask")))
+	assert.Contains(t, string(b), "/Width 1\n")
+	assert.Contains(t, string(b), "/Width 2\n")
+	// the title and the sections are bookmarked
+	assert.Contains(t, string(b), "/Title (Ladder and friends)")
+	assert.Contains(t, string(b), "/Title (Section)")
+
+}
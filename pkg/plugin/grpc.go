@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// The Modifier service is declared by hand instead of being generated from a
+// .proto file, with messages encoded as JSON, so plugins only need the Go types
+// of this package. The JSON codec is set on the plugin server and the calls of
+// ladder only, rather than registered globally, where the other gRPC servers of
+// the process would accept it too:
+//
+//	service Modifier {
+//	  rpc ModifyRequest(Request) returns (Request);
+//	  rpc ModifyResponse(Response) returns (Response);
+//	}
+const serviceName = "ladder.plugin.Modifier"
+
+// jsonCodec is a gRPC codec encoding messages as JSON, except protobuf messages,
+// eg: of the health and controller services go-plugin serves along with the
+// Modifier service, which are encoded as protobuf.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string { return "json" }
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*modifierServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ModifyRequest",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &Request{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(modifierServer).ModifyRequest(ctx, req)
+			},
+		},
+		{
+			MethodName: "ModifyResponse",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				resp := &Response{}
+				if err := dec(resp); err != nil {
+					return nil, err
+				}
+				return srv.(modifierServer).ModifyResponse(ctx, resp)
+			},
+		},
+	},
+}
+
+// modifierServer is the server API of the Modifier service.
+type modifierServer interface {
+	ModifyRequest(ctx context.Context, req *Request) (*Request, error)
+	ModifyResponse(ctx context.Context, resp *Response) (*Response, error)
+}
+
+// grpcServer runs in the plugin process and forwards calls to the plugin's Modifier.
+type grpcServer struct {
+	impl Modifier
+}
+
+func (s *grpcServer) ModifyRequest(ctx context.Context, req *Request) (*Request, error) {
+	if err := s.impl.ModifyRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *grpcServer) ModifyResponse(ctx context.Context, resp *Response) (*Response, error) {
+	if err := s.impl.ModifyResponse(ctx, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// grpcClient runs in the ladder process and implements Modifier by calling the plugin.
+type grpcClient struct {
+	conn *grpc.ClientConn
+}
+
+func (c *grpcClient) invoke(ctx context.Context, method string, in, out interface{}) error {
+	return c.conn.Invoke(ctx, "/"+serviceName+"/"+method, in, out,
+		grpc.ForceCodec(jsonCodec{}),
+		grpc.MaxCallRecvMsgSize(maxMsgSize),
+		grpc.MaxCallSendMsgSize(maxMsgSize),
+	)
+}
+
+func (c *grpcClient) ModifyRequest(ctx context.Context, req *Request) error {
+	out := &Request{}
+	if err := c.invoke(ctx, "ModifyRequest", req, out); err != nil {
+		return err
+	}
+	*req = *out
+	return nil
+}
+
+func (c *grpcClient) ModifyResponse(ctx context.Context, resp *Response) error {
+	out := &Response{}
+	if err := c.invoke(ctx, "ModifyResponse", resp, out); err != nil {
+		return err
+	}
+	*resp = *out
+	return nil
+}
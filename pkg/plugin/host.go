@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+)
+
+// Plugin is a loaded plugin binary. It implements ladder.Modifier
+// by forwarding requests and responses to the plugin process.
+type Plugin struct {
+	Name     string
+	client   *goplugin.Client
+	modifier Modifier
+}
+
+// Load starts every executable in dir as a plugin and returns them keyed by file name,
+// without extension. It returns an error if any of the plugins fails to start.
+func Load(dir string) (map[string]*Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory '%s': %w", dir, err)
+	}
+
+	plugins := map[string]*Plugin{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.Mode()&0o111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		p, err := Open(path)
+		if err != nil {
+			Cleanup()
+			return nil, err
+		}
+		plugins[p.Name] = p
+		slog.Info("loaded plugin", "path", path)
+	}
+	return plugins, nil
+}
+
+// Open starts the plugin binary at path.
+func Open(path string) (*Plugin, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          map[string]goplugin.Plugin{pluginName: &modifierPlugin{}},
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Managed:          true,
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:  "plugin." + name,
+			Level: hclog.Warn,
+		}),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to start plugin '%s': %w", path, err)
+	}
+
+	raw, err := rpcClient.Dispense(pluginName)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("failed to dispense plugin '%s': %w", path, err)
+	}
+
+	modifier, ok := raw.(Modifier)
+	if !ok {
+		client.Kill()
+		return nil, errors.New("plugin '" + path + "' does not implement Modifier")
+	}
+
+	return &Plugin{Name: name, client: client, modifier: modifier}, nil
+}
+
+// Wrap returns a Plugin named name running m in-process, eg: to test a
+// plugin's Modifier without building its binary.
+func Wrap(name string, m Modifier) *Plugin {
+	return &Plugin{Name: name, modifier: m}
+}
+
+// Cleanup stops all running plugins.
+func Cleanup() {
+	goplugin.CleanupClients()
+}
+
+// ModifyRequest sends req to the plugin and applies the returned URL and headers to it.
+func (p *Plugin) ModifyRequest(req *http.Request) error {
+	pr := &Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+	}
+	if err := p.modifier.ModifyRequest(req.Context(), pr); err != nil {
+		return fmt.Errorf("plugin '%s' failed to modify request: %w", p.Name, err)
+	}
+
+	u, err := url.Parse(pr.URL)
+	if err != nil {
+		return fmt.Errorf("plugin '%s' returned an invalid URL: %w", p.Name, err)
+	}
+	req.URL = u
+	req.Host = u.Host
+	req.Header = pr.Header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	return nil
+}
+
+// ModifyResponse sends resp and body to the plugin, applies the returned status and
+// headers to resp and returns the modified body.
+func (p *Plugin) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+
+	pr := &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	if resp.Request != nil {
+		pr.URL = resp.Request.URL.String()
+	}
+	if err := p.modifier.ModifyResponse(ctx, pr); err != nil {
+		return nil, fmt.Errorf("plugin '%s' failed to modify response: %w", p.Name, err)
+	}
+
+	resp.StatusCode = pr.StatusCode
+	resp.Header = pr.Header
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	return pr.Body, nil
+}
@@ -0,0 +1,100 @@
+// Package plugin lets third parties ship request and response modifiers as
+// separate binaries, which ladder loads at startup and talks to over gRPC
+// using hashicorp/go-plugin.
+//
+// A plugin is a regular Go program calling Serve:
+//
+//	type stripCookies struct{}
+//
+//	func (stripCookies) ModifyRequest(ctx context.Context, req *plugin.Request) error {
+//		req.Header.Del("Cookie")
+//		return nil
+//	}
+//
+//	func (stripCookies) ModifyResponse(ctx context.Context, resp *plugin.Response) error {
+//		return nil
+//	}
+//
+//	func main() {
+//		plugin.Serve(stripCookies{})
+//	}
+//
+// Rules then reference the plugin by the file name of its binary in their `plugins` list.
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Handshake is shared by ladder and its plugins. Bumping ProtocolVersion
+// makes ladder refuse plugins built against an incompatible version.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "LADDER_PLUGIN",
+	MagicCookieValue: "ladder-modifier",
+}
+
+// maxMsgSize bounds the size of the bodies exchanged with plugins.
+const maxMsgSize = 64 << 20
+
+// pluginName is the name a Modifier is dispensed under.
+const pluginName = "modifier"
+
+// Request is the upstream request as seen by a plugin.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+}
+
+// Response is the upstream response as seen by a plugin.
+type Response struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Modifier is implemented by plugins. Changes made to the Request and Response
+// are applied to the upstream request and response by ladder.
+type Modifier interface {
+	ModifyRequest(ctx context.Context, req *Request) error
+	ModifyResponse(ctx context.Context, resp *Response) error
+}
+
+// Serve serves impl as a ladder plugin. It is meant to be called from the main
+// function of the plugin binary and blocks until ladder disconnects.
+func Serve(impl Modifier) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins: map[string]goplugin.Plugin{
+			pluginName: &modifierPlugin{impl: impl},
+		},
+		GRPCServer: newServer,
+	})
+}
+
+// newServer returns the gRPC server of a plugin, decoding the calls of ladder with the JSON codec.
+func newServer(opts []grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ForceServerCodec(jsonCodec{}), grpc.MaxRecvMsgSize(maxMsgSize), grpc.MaxSendMsgSize(maxMsgSize))
+	return grpc.NewServer(opts...)
+}
+
+// modifierPlugin is the go-plugin glue between a Modifier and its gRPC service.
+type modifierPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	impl Modifier
+}
+
+func (p *modifierPlugin) GRPCServer(_ *goplugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&serviceDesc, &grpcServer{impl: p.impl})
+	return nil
+}
+
+func (p *modifierPlugin) GRPCClient(_ context.Context, _ *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &grpcClient{conn: conn}, nil
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testModifier struct{}
+
+func (testModifier) ModifyRequest(_ context.Context, req *Request) error {
+	req.Header.Set("X-Plugin", "1")
+	req.Header.Del("Cookie")
+	req.URL += "?plugin=1"
+	return nil
+}
+
+func (testModifier) ModifyResponse(_ context.Context, resp *Response) error {
+	resp.Body = []byte(strings.ToUpper(string(resp.Body)))
+	resp.StatusCode = http.StatusTeapot
+	return nil
+}
+
+func TestModifierPlugin(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := newServer(nil)
+	plugin := &modifierPlugin{impl: testModifier{}}
+	require.NoError(t, plugin.GRPCServer(nil, server))
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := plugin.GRPCClient(context.Background(), nil, conn)
+	require.NoError(t, err)
+	p := &Plugin{Name: "test", modifier: raw.(Modifier)}
+
+	// the JSON codec is not registered for the other gRPC servers of the process, and the
+	// protobuf services go-plugin serves along with the plugin still work
+	assert.Nil(t, encoding.GetCodec("json"))
+	check, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/article", nil)
+	req.Header.Set("Cookie", "session=1")
+	assert.NoError(t, p.ModifyRequest(req))
+	assert.Equal(t, "https://example.com/article?plugin=1", req.URL.String())
+	assert.Equal(t, "1", req.Header.Get("X-Plugin"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	body, err := p.ModifyResponse(resp, []byte("<p>hello</p>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<P>HELLO</P>", string(body))
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+}
@@ -0,0 +1,82 @@
+// Package ratelimit limits the rate of requests per client with token buckets, so that a
+// client can send bursts of requests, eg: the assets of a page, but not hammer a shared ladder.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the buckets of clients idle long enough to be full again are dropped.
+const sweepInterval = time.Minute
+
+// bucket holds the tokens of a client, one spent per request.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter limits the requests of each client to a rate, with bursts. It is safe for concurrent use.
+type Limiter struct {
+	// rate is the number of tokens added per second, and burst the capacity of the buckets.
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// New returns a Limiter allowing perMinute requests per minute to each client, and bursts of up
+// to burst requests. burst defaults to perMinute if less than 1.
+func New(perMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = max(1, int(math.Ceil(perMinute)))
+	}
+	return &Limiter{rate: perMinute / 60, burst: float64(burst), buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow spends a token of client, and reports whether it had one left. Otherwise, it returns
+// the delay until the client has one again, eg: for the Retry-After header.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that are full again at now, as they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Len returns the number of clients tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(60, 3)
+	l.now = func() time.Time { return now }
+
+	// a burst is allowed, then one request per second
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("203.0.113.7")
+		assert.True(t, ok, i)
+	}
+	ok, retry := l.Allow("203.0.113.7")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retry)
+	ok, _ = l.Allow("198.51.100.1")
+	assert.True(t, ok, "clients are limited separately")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, retry = l.Allow("203.0.113.7")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retry)
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("203.0.113.7")
+	assert.True(t, ok)
+	ok, _ = l.Allow("203.0.113.7")
+	assert.False(t, ok)
+
+	// idle clients are forgotten once their bucket is full again
+	assert.Equal(t, 2, l.Len())
+	now = now.Add(time.Hour)
+	ok, _ = l.Allow("192.0.2.1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Len())
+
+	assert.Equal(t, 30.0, New(30, 0).burst)
+}
@@ -0,0 +1,53 @@
+// Package reader embeds the reader-mode frontend of ladder: a static HTML
+// shell with CSS themes and a small script rendering articles fetched from
+// the /api/v1/article endpoint, with their images scaled down to the width of the
+// page by the /img/<url>?w=<pixels> endpoint. It has no Go dependencies on the rest
+// of ladder, so it can be served by any server exposing those endpoints, and
+// alternative frontends can be built against the same JSON contract instead.
+//
+// GET /api/v1/article/<url> answers with the outline of the article at <url>:
+//
+//	{
+//	  "url": "https://www.example.com/article",
+//	  "metadata": {
+//	    "title": "", "description": "", "author": "", "siteName": "",
+//	    "image": "", "publishedTime": "", "language": "", "canonical": ""
+//	  },
+//	  "blocks": [
+//	    {"type": "heading", "level": 1, "text": "Title"},
+//	    {"type": "paragraph", "text": "..."},
+//	    {"type": "list", "items": ["...", "..."], "ordered": true},
+//	    {"type": "quote", "text": "..."},
+//	    {"type": "code", "text": "..."},
+//	    {"type": "image", "src": "https://www.example.com/image.jpg", "text": "alt text"}
+//	  ]
+//	}
+//
+// Empty fields are omitted. Errors are answered with a non 2xx
+// status and a plain text message.
+package reader
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Assets holds the files of the frontend, with index.html at its root.
+var Assets fs.FS
+
+func init() {
+	var err error
+	if Assets, err = fs.Sub(static, "static"); err != nil {
+		panic(err)
+	}
+}
+
+// Handler returns an http.Handler serving the frontend. Mount it with
+// http.StripPrefix when serving it below the root path.
+func Handler() http.Handler {
+	return http.FileServer(http.FS(Assets))
+}
@@ -0,0 +1,28 @@
+package reader
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	h := http.StripPrefix("/reader", Handler())
+
+	for path, contentType := range map[string]string{
+		"/reader/":           "text/html",
+		"/reader/reader.css": "text/css",
+		"/reader/reader.js":  "javascript",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Contains(t, rec.Header().Get("Content-Type"), contentType, path)
+		body, _ := io.ReadAll(rec.Body)
+		assert.NotEmpty(t, body, path)
+	}
+}
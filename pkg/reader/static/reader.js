@@ -0,0 +1,105 @@
+// Renders the article outline returned by /api/v1/article, see the documentation of the reader package.
+(function () {
+    var form = document.getElementById("urlForm");
+    var input = document.getElementById("urlInput");
+    var themeSelect = document.getElementById("themeSelect");
+    var main = document.getElementById("article");
+
+    function el(tag, text, className) {
+        var node = document.createElement(tag);
+        if (text) node.textContent = text;
+        if (className) node.className = className;
+        return node;
+    }
+
+    // imageWidth is the width images are scaled down to: the width of the article in
+    // device pixels, rounded up to hundreds so that caches share images across devices.
+    function imageWidth() {
+        var width = main.clientWidth * (window.devicePixelRatio || 1);
+        return Math.min(Math.max(Math.ceil(width / 100) * 100, 100), 4096);
+    }
+
+    function setTheme(theme) {
+        document.body.className = "theme-" + theme;
+        themeSelect.value = theme;
+        localStorage.setItem("ladder-reader-theme", theme);
+    }
+
+    function renderBlock(block) {
+        switch (block.type) {
+            case "heading":
+                return el("h" + Math.min(Math.max(block.level || 2, 1), 6), block.text);
+            case "paragraph":
+                return el("p", block.text);
+            case "quote":
+                return el("blockquote", block.text);
+            case "code":
+                var pre = el("pre");
+                pre.appendChild(el("code", block.text));
+                return pre;
+            case "list":
+                var list = el(block.ordered ? "ol" : "ul");
+                (block.items || []).forEach(function (item) { list.appendChild(el("li", item)); });
+                return list;
+            case "image":
+                var figure = el("figure");
+                var img = el("img");
+                img.src = "/img/" + block.src + (block.src.indexOf("?") < 0 ? "?" : "&") + "w=" + imageWidth();
+                img.alt = block.text || "";
+                img.loading = "lazy";
+                figure.appendChild(img);
+                if (block.text) figure.appendChild(el("figcaption", block.text));
+                return figure;
+        }
+        return null;
+    }
+
+    function render(outline) {
+        var md = outline.metadata || {};
+        main.replaceChildren();
+        document.title = md.title || "ladder reader";
+        if (md.language) document.documentElement.lang = md.language;
+
+        var blocks = outline.blocks || [];
+        if (md.title && !(blocks[0] && blocks[0].type === "heading" && blocks[0].level === 1)) {
+            main.appendChild(el("h1", md.title));
+        }
+
+        var byline = [md.author, md.siteName, md.publishedTime].filter(Boolean).join(" · ");
+        var meta = el("p", byline, "byline");
+        var original = el("a", " Original");
+        original.href = outline.url;
+        meta.appendChild(original);
+        main.appendChild(meta);
+
+        blocks.forEach(function (block) {
+            var node = renderBlock(block);
+            if (node) main.appendChild(node);
+        });
+    }
+
+    function load(url) {
+        input.value = url;
+        main.replaceChildren(el("p", "Loading " + url + "…", "status"));
+        fetch("/api/v1/article/" + url)
+            .then(function (resp) {
+                if (!resp.ok) return resp.text().then(function (text) { throw new Error(text || resp.statusText); });
+                return resp.json();
+            })
+            .then(render)
+            .catch(function (err) {
+                main.replaceChildren(el("p", "Could not load " + url + ": " + err.message, "status"));
+            });
+    }
+
+    form.addEventListener("submit", function (e) {
+        e.preventDefault();
+        location.hash = input.value;
+    });
+    themeSelect.addEventListener("change", function () { setTheme(themeSelect.value); });
+    window.addEventListener("hashchange", function () { load(location.hash.slice(1)); });
+
+    setTheme(localStorage.getItem("ladder-reader-theme") || "light");
+    var url = location.hash.slice(1) || new URLSearchParams(location.search).get("url");
+    if (url) load(url);
+})();
@@ -0,0 +1,40 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ParseHosts parses the pins of hosts to addresses given as host:ip, eg: www.example.com:203.0.113.7
+// or www.example.com:2001:db8::7, as a map of the addresses of hosts. Pins of a host accumulate.
+func ParseHosts(pins []string) (map[string][]net.IP, error) {
+	hosts := map[string][]net.IP{}
+	for _, pin := range pins {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		host, addr, _ := strings.Cut(pin, ":")
+		ip := net.ParseIP(strings.Trim(addr, "[]"))
+		if host == "" || ip == nil {
+			return nil, fmt.Errorf("invalid host pin '%s', expected host:ip", pin)
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		hosts[host] = append(hosts[host], ip)
+	}
+	return hosts, nil
+}
+
+// FormatHosts formats hosts as the sorted, comma separated pins ParseHosts parses.
+func FormatHosts(hosts map[string][]net.IP) string {
+	pins := make([]string, 0, len(hosts))
+	for host, ips := range hosts {
+		for _, ip := range ips {
+			pins = append(pins, host+":"+ip.String())
+		}
+	}
+	sort.Strings(pins)
+	return strings.Join(pins, ",")
+}
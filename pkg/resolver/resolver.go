@@ -0,0 +1,303 @@
+// Package resolver resolves the hosts of upstream requests with DNS-over-HTTPS resolvers, such as
+// those of Google, Cloudflare and Quad9, or plain DNS servers, caching their answers for their TTL.
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver looks up the addresses of hosts. network is ip, ip4 or ip6, see net.Resolver.LookupIP.
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// System is the name of the resolver of the operating system.
+const System = "system"
+
+// DoHResolvers are the DNS-over-HTTPS (RFC 8484) endpoints of the well-known resolvers, by name.
+var DoHResolvers = map[string]string{
+	"google":     "https://dns.google/dns-query",
+	"cloudflare": "https://cloudflare-dns.com/dns-query",
+	"quad9":      "https://dns.quad9.net/dns-query",
+}
+
+// DefaultTTL is the time the addresses looked up by resolvers that don't report TTLs are cached.
+var DefaultTTL = time.Minute
+
+// negativeTTL is the time hosts that don't exist are cached.
+const negativeTTL = 30 * time.Second
+
+// maxCacheEntries bounds the hosts cached by a Cache, beyond which expired entries are evicted.
+const maxCacheEntries = 10000
+
+var (
+	resolversMu sync.Mutex
+	resolvers   = map[string]Resolver{}
+
+	// cacheHits and cacheMisses count the lookups of all Caches.
+	cacheHits, cacheMisses atomic.Uint64
+)
+
+// CacheStats returns the number of lookups answered from the cache of the resolvers, and of those
+// sent to the resolvers.
+func CacheStats() (hits, misses uint64) {
+	return cacheHits.Load(), cacheMisses.Load()
+}
+
+// Validate checks that name is a resolver Get can return.
+func Validate(name string) error {
+	_, err := newResolver(name)
+	return err
+}
+
+// Get returns the caching resolver named name: empty or system for the resolver of the operating
+// system, google, cloudflare or quad9 for their DNS-over-HTTPS endpoints, the https:// URL of any
+// other DNS-over-HTTPS endpoint, or dns://host[:port] for a plain DNS server.
+// The resolvers of a name are shared, along with their cache.
+func Get(name string) (Resolver, error) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	if r, ok := resolvers[name]; ok {
+		return r, nil
+	}
+	r, err := newResolver(name)
+	if err != nil {
+		return nil, err
+	}
+	r = NewCache(r)
+	resolvers[name] = r
+	return r, nil
+}
+
+func newResolver(name string) (Resolver, error) {
+	switch {
+	case name == "" || name == System:
+		return net.DefaultResolver, nil
+	case DoHResolvers[name] != "":
+		return &DoH{URL: DoHResolvers[name]}, nil
+	case strings.HasPrefix(name, "https://"):
+		return &DoH{URL: name}, nil
+	case strings.HasPrefix(name, "dns://"):
+		server := strings.TrimPrefix(name, "dns://")
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown resolver '%s', expected system, google, cloudflare, quad9, an https:// DoH URL or dns://host", name)
+}
+
+// DoH resolves hosts with the DNS-over-HTTPS endpoint at URL, in the wire format of RFC 8484.
+type DoH struct {
+	URL string
+	// Client sends the queries. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// LookupIP looks up the addresses of host.
+func (r *DoH) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, _, err := r.lookupIPTTL(ctx, network, host)
+	return ips, err
+}
+
+// lookupIPTTL looks up the addresses of host, along with the time they can be cached.
+func (r *DoH) lookupIPTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, 0, nil
+	}
+	var types []dnsmessage.Type
+	switch network {
+	case "ip4":
+		types = []dnsmessage.Type{dnsmessage.TypeA}
+	case "ip6":
+		types = []dnsmessage.Type{dnsmessage.TypeAAAA}
+	default:
+		types = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	}
+
+	var ips []net.IP
+	ttl := time.Duration(-1)
+	var err error
+	for _, typ := range types {
+		answers, answersTTL, qErr := r.query(ctx, host, typ)
+		if qErr != nil {
+			err = qErr
+			continue
+		}
+		ips = append(ips, answers...)
+		if ttl < 0 || answersTTL < ttl {
+			ttl = answersTTL
+		}
+	}
+	if len(ips) == 0 {
+		if err == nil {
+			err = &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+		}
+		return nil, 0, err
+	}
+	return ips, ttl, nil
+}
+
+// query asks the endpoint for the records of type typ of host, and returns their addresses and
+// the shortest of their TTLs.
+func (r *DoH) query(ctx context.Context, host string, typ dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.ToLower(strings.TrimSuffix(host, ".")) + ".")
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+	// the ID is 0 so that responses can be cached by HTTP caches, as RFC 8484 recommends
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL, IsTimeout: errors.Is(err, context.DeadlineExceeded)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, &net.DNSError{Err: "resolver answered " + resp.Status, Name: host, Server: r.URL, IsTemporary: true}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(body); err != nil {
+		return nil, 0, &net.DNSError{Err: "invalid response: " + err.Error(), Name: host, Server: r.URL}
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+	default:
+		return nil, 0, &net.DNSError{Err: "resolver answered " + msg.RCode.String(), Name: host, Server: r.URL, IsTemporary: true}
+	}
+
+	var ips []net.IP
+	ttl := DefaultTTL
+	for _, answer := range msg.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			// CNAMEs are followed by the resolver
+			continue
+		}
+		if d := time.Duration(answer.Header.TTL) * time.Second; len(ips) == 1 || d < ttl {
+			ttl = d
+		}
+	}
+	return ips, ttl, nil
+}
+
+// ttlResolver is implemented by the resolvers reporting the time their answers can be cached.
+type ttlResolver interface {
+	lookupIPTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error)
+}
+
+type cacheEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+}
+
+// Cache caches the addresses looked up by a Resolver for their TTL, or DefaultTTL, and the hosts
+// that don't exist for 30 seconds. It is safe for concurrent use.
+type Cache struct {
+	resolver Resolver
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+}
+
+// NewCache returns a Cache of the lookups of r.
+func NewCache(r Resolver) *Cache {
+	return &Cache{resolver: r, entries: map[string]cacheEntry{}}
+}
+
+// LookupIP looks up the addresses of host, unless they are cached.
+func (c *Cache) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	key := network + " " + strings.ToLower(host)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		cacheHits.Add(1)
+		return entry.ips, entry.err
+	}
+	cacheMisses.Add(1)
+
+	var ips []net.IP
+	var err error
+	ttl := DefaultTTL
+	if r, ok := c.resolver.(ttlResolver); ok {
+		ips, ttl, err = r.lookupIPTTL(ctx, network, host)
+	} else {
+		ips, err = c.resolver.LookupIP(ctx, network, host)
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		ttl = negativeTTL
+	default:
+		// failed lookups are not cached
+		return nil, err
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		if len(c.entries) >= maxCacheEntries {
+			c.evict()
+		}
+		c.entries[key] = cacheEntry{ips: ips, err: err, expires: time.Now().Add(ttl)}
+		c.mu.Unlock()
+	}
+	return ips, err
+}
+
+// evict removes the expired entries, or all of them if none expired. c.mu must be held.
+func (c *Cache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		clear(c.entries)
+	}
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohServer answers the DoH queries for www.example.com with 93.184.215.14 and 2606:2800:21f:cb07:6820:80da:af6b:8b2c,
+// and the others with NXDOMAIN.
+func dohServer(t *testing.T, queries *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		assert.Equal(t, "application/dns-message", r.Header.Get("Accept"))
+		packed, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		require.NoError(t, err)
+		var query dnsmessage.Message
+		require.NoError(t, query.Unpack(packed))
+
+		question := query.Questions[0]
+		answer := dnsmessage.Message{Header: dnsmessage.Header{Response: true}, Questions: query.Questions}
+		header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 300}
+		switch {
+		case question.Name.String() != "www.example.com.":
+			answer.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			answer.Answers = []dnsmessage.Resource{{Header: header, Body: &dnsmessage.AResource{A: [4]byte{93, 184, 215, 14}}}}
+		case question.Type == dnsmessage.TypeAAAA:
+			ip := net.ParseIP("2606:2800:21f:cb07:6820:80da:af6b:8b2c")
+			answer.Answers = []dnsmessage.Resource{{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}}}
+		}
+		packed, err = answer.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+}
+
+func TestDoH(t *testing.T) {
+	var queries atomic.Int32
+	server := dohServer(t, &queries)
+	defer server.Close()
+	r := &DoH{URL: server.URL}
+
+	ips, err := r.LookupIP(context.Background(), "ip", "www.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "[93.184.215.14 2606:2800:21f:cb07:6820:80da:af6b:8b2c]", ipsString(ips))
+
+	ips, ttl, err := r.lookupIPTTL(context.Background(), "ip4", "www.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "[93.184.215.14]", ipsString(ips))
+	assert.Equal(t, 5*time.Minute, ttl)
+
+	_, err = r.LookupIP(context.Background(), "ip", "missing.example.com")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsNotFound)
+}
+
+func TestCache(t *testing.T) {
+	var queries atomic.Int32
+	server := dohServer(t, &queries)
+	defer server.Close()
+	cache := NewCache(&DoH{URL: server.URL})
+
+	for i := 0; i < 3; i++ {
+		ips, err := cache.LookupIP(context.Background(), "ip4", "WWW.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "[93.184.215.14]", ipsString(ips))
+	}
+	assert.EqualValues(t, 1, queries.Load())
+
+	// hosts that don't exist are cached too
+	for i := 0; i < 2; i++ {
+		_, err := cache.LookupIP(context.Background(), "ip4", "missing.example.com")
+		assert.Error(t, err)
+	}
+	assert.EqualValues(t, 2, queries.Load())
+
+	// expired entries are looked up again
+	cache.entries["ip4 www.example.com"] = cacheEntry{expires: time.Now().Add(-time.Second)}
+	_, err := cache.LookupIP(context.Background(), "ip4", "www.example.com")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, queries.Load())
+}
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{"", System, "google", "cloudflare", "quad9", "https://doh.example.com/dns-query", "dns://9.9.9.9", "dns://[2620:fe::fe]:53"} {
+		assert.NoError(t, Validate(name), name)
+	}
+	assert.ErrorContains(t, Validate("opendns"), "unknown resolver 'opendns'")
+
+	r, err := Get("google")
+	require.NoError(t, err)
+	assert.Equal(t, DoHResolvers["google"], r.(*Cache).resolver.(*DoH).URL)
+	shared, _ := Get("google")
+	assert.Same(t, r, shared)
+}
+
+func ipsString(ips []net.IP) string {
+	s := "["
+	for i, ip := range ips {
+		if i > 0 {
+			s += " "
+		}
+		s += ip.String()
+	}
+	return s + "]"
+}
+
+func TestParseHosts(t *testing.T) {
+	hosts, err := ParseHosts([]string{"WWW.example.com.:203.0.113.7", " www.example.com:2001:db8::7", "", "cdn.example.com:[2001:db8::8]"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]net.IP{
+		"www.example.com": {net.ParseIP("203.0.113.7"), net.ParseIP("2001:db8::7")},
+		"cdn.example.com": {net.ParseIP("2001:db8::8")},
+	}, hosts)
+	assert.Equal(t, "cdn.example.com:2001:db8::8,www.example.com:2001:db8::7,www.example.com:203.0.113.7", FormatHosts(hosts))
+
+	reparsed, err := ParseHosts(strings.Split(FormatHosts(hosts), ","))
+	require.NoError(t, err)
+	assert.Equal(t, len(hosts), len(reparsed))
+
+	for _, pin := range []string{"www.example.com", "www.example.com:", ":203.0.113.7", "www.example.com:example.org"} {
+		_, err := ParseHosts([]string{pin})
+		assert.ErrorContains(t, err, "invalid host pin", pin)
+	}
+}
@@ -0,0 +1,4 @@
+// Package ladderpb holds the protobuf definitions of the ladder gRPC API.
+package ladderpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ladder.proto
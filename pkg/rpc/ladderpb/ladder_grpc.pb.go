@@ -0,0 +1,258 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ladder.proto
+
+package ladderpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Ladder_Fetch_FullMethodName     = "/ladder.v1.Ladder/Fetch"
+	Ladder_Extract_FullMethodName   = "/ladder.v1.Ladder/Extract"
+	Ladder_Outline_FullMethodName   = "/ladder.v1.Ladder/Outline"
+	Ladder_ListRules_FullMethodName = "/ladder.v1.Ladder/ListRules"
+)
+
+// LadderClient is the client API for Ladder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LadderClient interface {
+	// Fetch fetches a URL through the proxy pipeline. The first message holds the
+	// response information, the following ones the body in chunks.
+	Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Ladder_FetchClient, error)
+	// Extract returns the metadata and visible text of a page.
+	Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error)
+	// Outline returns the structured main content of a page.
+	Outline(ctx context.Context, in *OutlineRequest, opts ...grpc.CallOption) (*OutlineResponse, error)
+	// ListRules returns the rules of the running ruleset.
+	ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error)
+}
+
+type ladderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLadderClient(cc grpc.ClientConnInterface) LadderClient {
+	return &ladderClient{cc}
+}
+
+func (c *ladderClient) Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Ladder_FetchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ladder_ServiceDesc.Streams[0], Ladder_Fetch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ladderFetchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Ladder_FetchClient interface {
+	Recv() (*FetchResponse, error)
+	grpc.ClientStream
+}
+
+type ladderFetchClient struct {
+	grpc.ClientStream
+}
+
+func (x *ladderFetchClient) Recv() (*FetchResponse, error) {
+	m := new(FetchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ladderClient) Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error) {
+	out := new(ExtractResponse)
+	err := c.cc.Invoke(ctx, Ladder_Extract_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ladderClient) Outline(ctx context.Context, in *OutlineRequest, opts ...grpc.CallOption) (*OutlineResponse, error) {
+	out := new(OutlineResponse)
+	err := c.cc.Invoke(ctx, Ladder_Outline_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ladderClient) ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error) {
+	out := new(ListRulesResponse)
+	err := c.cc.Invoke(ctx, Ladder_ListRules_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LadderServer is the server API for Ladder service.
+// All implementations must embed UnimplementedLadderServer
+// for forward compatibility
+type LadderServer interface {
+	// Fetch fetches a URL through the proxy pipeline. The first message holds the
+	// response information, the following ones the body in chunks.
+	Fetch(*FetchRequest, Ladder_FetchServer) error
+	// Extract returns the metadata and visible text of a page.
+	Extract(context.Context, *ExtractRequest) (*ExtractResponse, error)
+	// Outline returns the structured main content of a page.
+	Outline(context.Context, *OutlineRequest) (*OutlineResponse, error)
+	// ListRules returns the rules of the running ruleset.
+	ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error)
+	mustEmbedUnimplementedLadderServer()
+}
+
+// UnimplementedLadderServer must be embedded to have forward compatible implementations.
+type UnimplementedLadderServer struct {
+}
+
+func (UnimplementedLadderServer) Fetch(*FetchRequest, Ladder_FetchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Fetch not implemented")
+}
+func (UnimplementedLadderServer) Extract(context.Context, *ExtractRequest) (*ExtractResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Extract not implemented")
+}
+func (UnimplementedLadderServer) Outline(context.Context, *OutlineRequest) (*OutlineResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Outline not implemented")
+}
+func (UnimplementedLadderServer) ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRules not implemented")
+}
+func (UnimplementedLadderServer) mustEmbedUnimplementedLadderServer() {}
+
+// UnsafeLadderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LadderServer will
+// result in compilation errors.
+type UnsafeLadderServer interface {
+	mustEmbedUnimplementedLadderServer()
+}
+
+func RegisterLadderServer(s grpc.ServiceRegistrar, srv LadderServer) {
+	s.RegisterService(&Ladder_ServiceDesc, srv)
+}
+
+func _Ladder_Fetch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LadderServer).Fetch(m, &ladderFetchServer{stream})
+}
+
+type Ladder_FetchServer interface {
+	Send(*FetchResponse) error
+	grpc.ServerStream
+}
+
+type ladderFetchServer struct {
+	grpc.ServerStream
+}
+
+func (x *ladderFetchServer) Send(m *FetchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Ladder_Extract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExtractRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LadderServer).Extract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ladder_Extract_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LadderServer).Extract(ctx, req.(*ExtractRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ladder_Outline_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutlineRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LadderServer).Outline(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ladder_Outline_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LadderServer).Outline(ctx, req.(*OutlineRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ladder_ListRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LadderServer).ListRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ladder_ListRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LadderServer).ListRules(ctx, req.(*ListRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Ladder_ServiceDesc is the grpc.ServiceDesc for Ladder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ladder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ladder.v1.Ladder",
+	HandlerType: (*LadderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Extract",
+			Handler:    _Ladder_Extract_Handler,
+		},
+		{
+			MethodName: "Outline",
+			Handler:    _Ladder_Outline_Handler,
+		},
+		{
+			MethodName: "ListRules",
+			Handler:    _Ladder_ListRules_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Fetch",
+			Handler:       _Ladder_Fetch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ladder.proto",
+}
@@ -0,0 +1,197 @@
+// Package rpc implements the ladder gRPC API defined in ladderpb, for
+// services that prefer typed RPC over the REST endpoints.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/rpc/ladderpb"
+	"ladder/pkg/ruleset"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// chunkSize is the size of the body chunks streamed by Fetch.
+const chunkSize = 64 << 10
+
+// Server implements ladderpb.LadderServer on top of a ladder.Client.
+type Server struct {
+	ladderpb.UnimplementedLadderServer
+	client    *ladder.Client
+	hideRules bool
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// HideRules makes ListRules fail with codes.PermissionDenied, for ladders
+// that do not expose their ruleset.
+func HideRules() Option {
+	return func(s *Server) { s.hideRules = true }
+}
+
+// NewServer returns a Server fetching with client.
+func NewServer(client *ladder.Client, opts ...Option) *Server {
+	s := &Server{client: client}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers a Server fetching with client on s.
+func Register(s *grpc.Server, client *ladder.Client, opts ...Option) {
+	ladderpb.RegisterLadderServer(s, NewServer(client, opts...))
+}
+
+var formats = map[ladderpb.Format]ladder.Format{
+	ladderpb.Format_FORMAT_UNSPECIFIED: ladder.FormatHTML,
+	ladderpb.Format_FORMAT_HTML:        ladder.FormatHTML,
+	ladderpb.Format_FORMAT_RAW:         ladder.FormatRaw,
+	ladderpb.Format_FORMAT_TEXT:        ladder.FormatText,
+}
+
+// Fetch fetches a URL and streams the response information followed by the body in chunks.
+func (s *Server) Fetch(req *ladderpb.FetchRequest, stream ladderpb.Ladder_FetchServer) error {
+	format, ok := formats[req.GetFormat()]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown format %s", req.GetFormat())
+	}
+
+	result, err := s.fetch(stream.Context(), req.GetUrl(), ladder.FetchOptions{Query: req.GetQuery(), Format: format})
+	if err != nil {
+		return err
+	}
+
+	info := &ladderpb.ResponseInfo{
+		Url:        result.URL,
+		StatusCode: int32(result.Response.StatusCode),
+		Headers:    toHeaders(result.Response.Header),
+		Metadata:   toMetadata(result.Metadata),
+	}
+	if err := stream.Send(&ladderpb.FetchResponse{Payload: &ladderpb.FetchResponse_Info{Info: info}}); err != nil {
+		return err
+	}
+
+	content := []byte(result.Content)
+	for len(content) > 0 {
+		n := min(chunkSize, len(content))
+		if err := stream.Send(&ladderpb.FetchResponse{Payload: &ladderpb.FetchResponse_Chunk{Chunk: content[:n]}}); err != nil {
+			return err
+		}
+		content = content[n:]
+	}
+	return nil
+}
+
+// Extract returns the metadata and visible text of a page.
+func (s *Server) Extract(ctx context.Context, req *ladderpb.ExtractRequest) (*ladderpb.ExtractResponse, error) {
+	result, err := s.fetch(ctx, req.GetUrl(), ladder.FetchOptions{Format: ladder.FormatText})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ladderpb.ExtractResponse{
+		Url:      req.GetUrl(),
+		Metadata: toMetadata(result.Metadata),
+		Text:     result.Content,
+	}, nil
+}
+
+// Outline returns the structured main content of a page.
+func (s *Server) Outline(ctx context.Context, req *ladderpb.OutlineRequest) (*ladderpb.OutlineResponse, error) {
+	result, err := s.fetch(ctx, req.GetUrl(), ladder.FetchOptions{Format: ladder.FormatOutline})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ladderpb.OutlineResponse{
+		Url:      result.Outline.URL,
+		Metadata: toMetadata(result.Outline.Metadata),
+		Blocks:   make([]*ladderpb.Block, 0, len(result.Outline.Blocks)),
+	}
+	for _, block := range result.Outline.Blocks {
+		resp.Blocks = append(resp.Blocks, &ladderpb.Block{
+			Type:    string(block.Type),
+			Level:   int32(block.Level),
+			Text:    block.Text,
+			Items:   block.Items,
+			Ordered: block.Ordered,
+			Src:     block.Src,
+		})
+	}
+	return resp, nil
+}
+
+// ListRules returns the rules of the ruleset of the client.
+func (s *Server) ListRules(_ context.Context, _ *ladderpb.ListRulesRequest) (*ladderpb.ListRulesResponse, error) {
+	if s.hideRules {
+		return nil, status.Error(codes.PermissionDenied, "the ruleset is not exposed")
+	}
+
+	rules := s.client.RuleSet()
+	resp := &ladderpb.ListRulesResponse{
+		Rules: make([]*ladderpb.Rule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		y, err := yaml.Marshal(ruleset.RuleSet{rule})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		resp.Rules = append(resp.Rules, &ladderpb.Rule{
+			Domains: rule.AllDomains(),
+			Paths:   rule.Paths,
+			Yaml:    string(y),
+		})
+	}
+	return resp, nil
+}
+
+// fetch fetches url with the client, converting errors into gRPC status errors.
+func (s *Server) fetch(ctx context.Context, url string, opts ladder.FetchOptions) (*ladder.Result, error) {
+	if url == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is required")
+	}
+
+	result, err := s.client.Fetch(ctx, url, opts)
+	switch {
+	case err == nil:
+		return result, nil
+	case errors.Is(err, context.Canceled):
+		return nil, status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+// toHeaders converts h into its protobuf representation.
+func toHeaders(h http.Header) []*ladderpb.Header {
+	headers := make([]*ladderpb.Header, 0, len(h))
+	for k, v := range h {
+		headers = append(headers, &ladderpb.Header{Key: k, Values: v})
+	}
+	return headers
+}
+
+// toMetadata converts md into its protobuf representation.
+func toMetadata(md ladder.Metadata) *ladderpb.Metadata {
+	return &ladderpb.Metadata{
+		Title:         md.Title,
+		Description:   md.Description,
+		Author:        md.Author,
+		SiteName:      md.SiteName,
+		Image:         md.Image,
+		PublishedTime: md.PublishedTime,
+		Language:      md.Language,
+		Canonical:     md.Canonical,
+	}
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/rpc/ladderpb"
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const page = `<html lang="en"><head><title>Title</title></head>
+<body><nav>Menu</nav><article><h1>Heading</h1><p>First paragraph.</p></article></body></html>`
+
+func newClient(t *testing.T, rules ruleset.RuleSet, opts ...Option) ladderpb.LadderClient {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	Register(s, ladder.NewClient(rules), opts...)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return ladderpb.NewLadderClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, page)
+	}))
+	defer upstream.Close()
+
+	client := newClient(t, ruleset.RuleSet{{Domain: "example.com", Paths: []string{"/news"}}})
+	ctx := context.Background()
+
+	t.Run("fetch", func(t *testing.T) {
+		stream, err := client.Fetch(ctx, &ladderpb.FetchRequest{Url: upstream.URL, Format: ladderpb.Format_FORMAT_RAW})
+		require.NoError(t, err)
+
+		first, err := stream.Recv()
+		require.NoError(t, err)
+		info := first.GetInfo()
+		require.NotNil(t, info)
+		assert.Equal(t, int32(http.StatusOK), info.StatusCode)
+		assert.Equal(t, "Title", info.Metadata.Title)
+
+		body := []byte{}
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			body = append(body, msg.GetChunk()...)
+		}
+		assert.Equal(t, page, string(body))
+	})
+
+	t.Run("extract", func(t *testing.T) {
+		resp, err := client.Extract(ctx, &ladderpb.ExtractRequest{Url: upstream.URL})
+		require.NoError(t, err)
+		assert.Equal(t, "en", resp.Metadata.Language)
+		assert.Contains(t, resp.Text, "First paragraph.")
+	})
+
+	t.Run("outline", func(t *testing.T) {
+		resp, err := client.Outline(ctx, &ladderpb.OutlineRequest{Url: upstream.URL})
+		require.NoError(t, err)
+		require.Len(t, resp.Blocks, 2)
+		assert.Equal(t, "heading", resp.Blocks[0].Type)
+		assert.Equal(t, int32(1), resp.Blocks[0].Level)
+		assert.Equal(t, "First paragraph.", resp.Blocks[1].Text)
+	})
+
+	t.Run("missing url", func(t *testing.T) {
+		_, err := client.Extract(ctx, &ladderpb.ExtractRequest{})
+		assert.ErrorContains(t, err, "url is required")
+	})
+
+	t.Run("list rules", func(t *testing.T) {
+		resp, err := client.ListRules(ctx, &ladderpb.ListRulesRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Rules, 1)
+		assert.Equal(t, []string{"example.com"}, resp.Rules[0].Domains)
+		assert.Equal(t, []string{"/news"}, resp.Rules[0].Paths)
+		assert.Contains(t, resp.Rules[0].Yaml, "domain: example.com")
+	})
+}
+
+func TestHideRules(t *testing.T) {
+	client := newClient(t, ruleset.RuleSet{{Domain: "example.com"}}, HideRules())
+
+	_, err := client.ListRules(context.Background(), &ladderpb.ListRulesRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,152 @@
+package ruleset
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ladder/pkg/urls"
+)
+
+// domainKind is the kind of a rule domain, from the most to the least specific.
+type domainKind int
+
+const (
+	// domainExact domains, eg: `example.com`, match the domain and its subdomains.
+	domainExact domainKind = iota
+	// domainGlob domains, eg: `*.example.com` or `news-*.example.com`, match hosts with `*` standing
+	// for one or more characters of a label, not matching the domain itself nor deeper subdomains.
+	domainGlob
+	// domainRegex domains, eg: `~^news[0-9]+\.example\.(com|org)$`, match hosts with the regular
+	// expression following the `~`.
+	domainRegex
+)
+
+// domainPattern is a rule domain compiled for matching.
+type domainPattern struct {
+	kind domainKind
+	// host is the normalized domain of exact domains.
+	host string
+	re   *regexp.Regexp
+	// specificity orders the matches of a kind, higher first: the length of exact domains and
+	// the number of literal characters of globs. Regexes are ordered by the ruleset only.
+	specificity int
+	err         error
+}
+
+// maxDomainPatterns bounds domainPatterns, which is emptied once full.
+const maxDomainPatterns = 4096
+
+var (
+	// domainPatterns caches the compiled rule domains, as rules are matched on every request.
+	domainPatterns   = map[string]*domainPattern{}
+	domainPatternsMu sync.RWMutex
+)
+
+// compileDomain returns the compiled rule domain.
+func compileDomain(domain string) *domainPattern {
+	domainPatternsMu.RLock()
+	p, ok := domainPatterns[domain]
+	domainPatternsMu.RUnlock()
+	if ok {
+		return p
+	}
+
+	p = newDomainPattern(domain)
+	domainPatternsMu.Lock()
+	defer domainPatternsMu.Unlock()
+	if len(domainPatterns) >= maxDomainPatterns {
+		domainPatterns = map[string]*domainPattern{}
+	}
+	domainPatterns[domain] = p
+	return p
+}
+
+// newDomainPattern compiles the rule domain.
+func newDomainPattern(domain string) *domainPattern {
+	p := &domainPattern{kind: domainExact, host: urls.NormalizeHost(domain)}
+	switch {
+	case strings.HasPrefix(domain, "~"):
+		p.kind = domainRegex
+		p.re, p.err = regexp.Compile(strings.TrimPrefix(domain, "~"))
+		if p.err != nil {
+			p.err = fmt.Errorf("invalid domain regex '%s': %w", domain, p.err)
+		}
+	case strings.Contains(domain, "*"):
+		p.kind = domainGlob
+		literals := strings.Split(p.host, "*")
+		for i, literal := range literals {
+			p.specificity += len(literal)
+			literals[i] = regexp.QuoteMeta(literal)
+		}
+		p.re = regexp.MustCompile("^" + strings.Join(literals, "[^.]+") + "$")
+	default:
+		p.specificity = len(p.host)
+	}
+	return p
+}
+
+// match reports whether the normalized host matches the rule domain.
+func (p *domainPattern) match(host string) bool {
+	switch {
+	case p.err != nil:
+		return false
+	case p.kind == domainExact:
+		return host == p.host || strings.HasSuffix(host, "."+p.host)
+	default:
+		return p.re.MatchString(host)
+	}
+}
+
+// sample returns a host matching the rule domain, with `x` for the `*` of globs, or "" for
+// regexes.
+func (p *domainPattern) sample() string {
+	switch {
+	case p.err != nil || p.kind == domainRegex:
+		return ""
+	case p.kind == domainGlob:
+		return strings.ReplaceAll(p.host, "*", "x")
+	}
+	return p.host
+}
+
+// overlaps reports whether a host may match both p and q: whether either matches a host of the
+// other. Two regexes never overlap, as there is no telling.
+func (p *domainPattern) overlaps(q *domainPattern) bool {
+	if host := q.sample(); host != "" && p.match(host) {
+		return true
+	}
+	host := p.sample()
+	return host != "" && q.match(host)
+}
+
+// ValidateDomain returns an error if the rule domain is an invalid regular expression.
+func ValidateDomain(domain string) error {
+	return compileDomain(domain).err
+}
+
+// MatchDomain reports whether host matches one of the domains of the rule.
+func (r Rule) MatchDomain(host string) bool {
+	_, ok := r.matchDomain(urls.NormalizeHost(host))
+	return ok
+}
+
+// matchDomain returns the most specific domain of the rule matching the normalized host.
+func (r Rule) matchDomain(host string) (*domainPattern, bool) {
+	var best *domainPattern
+	for _, domain := range r.AllDomains() {
+		if p := compileDomain(domain); p.match(host) && (best == nil || p.moreSpecific(best)) {
+			best = p
+		}
+	}
+	return best, best != nil
+}
+
+// moreSpecific reports whether p is more specific than q.
+func (p *domainPattern) moreSpecific(q *domainPattern) bool {
+	if p.kind != q.kind {
+		return p.kind < q.kind
+	}
+	return p.specificity > q.specificity
+}
@@ -0,0 +1,268 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names is a list of names, written in YAML as a list or as a single name, eg: `extends: piano`.
+type Names []string
+
+// UnmarshalYAML decodes a list of names or a single name.
+func (n *Names) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*n = Names{value.Value}
+		return nil
+	}
+	var names []string
+	if err := value.Decode(&names); err != nil {
+		return err
+	}
+	*n = names
+	return nil
+}
+
+// IsProfile reports whether the rule is a profile, named for other rules to extend it, but
+// applying to no site itself.
+func (r Rule) IsProfile() bool {
+	return r.Name != "" && len(r.AllDomains()) == 0
+}
+
+// UnmarshalYAML decodes the rule, recording the fields it sets.
+func (r *Rule) UnmarshalYAML(value *yaml.Node) error {
+	type plain Rule
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.fields = map[string]bool{}
+	collectFields(value, "", r.fields)
+	return nil
+}
+
+// collectFields adds the paths of the keys of the mapping node to fields, and of their nested
+// mappings, eg: headers.user-agent.
+func collectFields(node *yaml.Node, prefix string, fields map[string]bool) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		path := prefix + node.Content[i].Value
+		fields[path] = true
+		collectFields(node.Content[i+1], path+".", fields)
+	}
+}
+
+// present returns the YAML paths of the fields the rule sets: the fields of its YAML, or else,
+// for rules built in code, its non-zero fields.
+func (r Rule) present() map[string]bool {
+	if r.fields != nil {
+		return r.fields
+	}
+	fields := map[string]bool{}
+	walkFields(reflect.ValueOf(r), "", nil, func(path string, _ []int, v reflect.Value) {
+		if !v.IsZero() {
+			fields[path] = true
+		}
+	})
+	return fields
+}
+
+// walkFields calls fn with the YAML path, index and value of every exported field of the struct
+// v, descending into nested structs. The paths and indexes of nested fields start with prefix
+// and index.
+func walkFields(v reflect.Value, prefix string, index []int, fn func(path string, index []int, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		path, fieldIndex := prefix+yamlName(f), append(slices.Clip(index), i)
+		if v.Field(i).Kind() == reflect.Struct {
+			walkFields(v.Field(i), path+".", fieldIndex, fn)
+			continue
+		}
+		fn(path, fieldIndex, v.Field(i))
+	}
+}
+
+// notInherited are the fields of the bases of a rule it doesn't inherit.
+var notInherited = []string{"name", "domain", "domains", "paths", "testUrls", "extends", "include"}
+
+// Inherit returns rule applied over base: the fields set in rule replace those of base, even
+// to false or empty values, the fields of nested structs, eg: headers, are replaced one by one,
+// and lists are appended to those of base. The name, domains, paths and tests of base aren't
+// inherited.
+func Inherit(base, rule Rule) Rule {
+	base.Name, base.Domain, base.Domains, base.Paths, base.TestUrls = "", "", nil, nil, nil
+	base.Extends, base.Include = nil, nil
+	basePresent, rulePresent := base.present(), rule.present()
+
+	merged := reflect.New(reflect.TypeOf(base)).Elem()
+	mergeValue(merged, reflect.ValueOf(base), basePresent)
+	mergeValue(merged, reflect.ValueOf(rule), rulePresent)
+	result := merged.Interface().(Rule)
+
+	result.fields = make(map[string]bool, len(basePresent)+len(rulePresent))
+	for path := range basePresent {
+		if !slices.Contains(notInherited, path) {
+			result.fields[path] = true
+		}
+	}
+	for path := range rulePresent {
+		result.fields[path] = true
+	}
+	return result
+}
+
+// mergeValue sets the fields of the struct dst that are present in src, appending the lists of
+// src to those of dst. Lists and maps are deep copied, so that dst shares no array with src.
+func mergeValue(dst, src reflect.Value, present map[string]bool) {
+	walkFields(src, "", nil, func(path string, index []int, s reflect.Value) {
+		d := dst.FieldByIndex(index)
+		switch {
+		case s.Kind() == reflect.Slice:
+			if s.Len() == 0 {
+				return
+			}
+			merged := reflect.MakeSlice(s.Type(), 0, d.Len()+s.Len())
+			d.Set(reflect.AppendSlice(reflect.AppendSlice(merged, d), deepCopy(s)))
+		case present[path]:
+			d.Set(deepCopy(s))
+		}
+	})
+}
+
+// deepCopy returns a copy of v sharing no slice, map or pointer with it. The unexported fields
+// of structs are copied as they are.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			c.SetMapIndex(it.Key(), deepCopy(it.Value()))
+		}
+		return c
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	}
+	return v
+}
+
+// Conflicts returns the fields, by their YAML paths, eg: headers.user-agent, that rule and
+// other both set to different values, including false or empty ones. Lists don't conflict,
+// as they are merged, see Inherit.
+func Conflicts(rule, other Rule) []string {
+	rulePresent, otherPresent := rule.present(), other.present()
+	otherValue := reflect.ValueOf(other)
+	var fields []string
+	walkFields(reflect.ValueOf(rule), "", nil, func(path string, index []int, v reflect.Value) {
+		if v.Kind() == reflect.Slice || path == "name" || path == "domain" || !rulePresent[path] || !otherPresent[path] {
+			return
+		}
+		if !v.Equal(otherValue.FieldByIndex(index)) {
+			fields = append(fields, path)
+		}
+	})
+	return fields
+}
+
+// yamlName returns the YAML name of the struct field f.
+func yamlName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+// resolve returns the rules of rs inheriting from the rules they extend, without the profiles,
+// see Rule.Extends. It fails if a rule extends an unknown rule, or itself through its bases.
+func (rs RuleSet) resolve() (RuleSet, error) {
+	named := map[string]Rule{}
+	var errs []error
+	for _, rule := range rs {
+		if rule.Name == "" {
+			continue
+		}
+		// files included several times define their profiles several times
+		if prev, ok := named[rule.Name]; ok && !reflect.DeepEqual(prev, rule) {
+			errs = append(errs, fmt.Errorf("rule '%s' is defined twice", rule.Name))
+		}
+		named[rule.Name] = rule
+	}
+
+	resolved := map[string]Rule{}
+	var inherit func(rule Rule, extending []string) (Rule, error)
+	inherit = func(rule Rule, extending []string) (Rule, error) {
+		var merged Rule
+		for _, name := range rule.Extends {
+			if r, ok := resolved[name]; ok {
+				merged = Inherit(merged, r)
+				continue
+			}
+			base, ok := named[name]
+			if !ok {
+				return Rule{}, fmt.Errorf("rule extends unknown rule '%s'", name)
+			}
+			if slices.Contains(extending, name) {
+				return Rule{}, fmt.Errorf("rule '%s' extends itself through %s", name, strings.Join(append(slices.Clip(extending), name), " -> "))
+			}
+			r, err := inherit(base, append(slices.Clip(extending), name))
+			if err != nil {
+				return Rule{}, err
+			}
+			resolved[name] = r
+			merged = Inherit(merged, r)
+		}
+		if len(rule.Extends) == 0 {
+			return rule, nil
+		}
+		merged = Inherit(merged, rule)
+		merged.Name, merged.Extends = rule.Name, nil
+		return merged, nil
+	}
+
+	rules := make(RuleSet, 0, len(rs))
+	for _, rule := range rs {
+		if rule.IsProfile() {
+			continue
+		}
+		r, err := inherit(rule, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid rule for %s: %w", strings.Join(rule.AllDomains(), ", "), err))
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, errors.Join(errs...)
+}
@@ -0,0 +1,188 @@
+package ruleset
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInherit(t *testing.T) {
+	base := Rule{Name: "piano", Domain: "example.org", BlockScripts: []string{"piano.io"}, Strategies: []string{"direct"}}
+	base.Headers.Referer = "https://www.google.com/"
+	base.Headers.UserAgent = "googlebot"
+	base.Timeouts.Body = time.Minute
+	rule := Rule{Domain: "example.com", Extends: Names{"piano"}, BlockScripts: []string{"tinypass.com"}}
+	rule.Headers.UserAgent = "bingbot"
+
+	merged := Inherit(base, rule)
+	assert.Equal(t, "example.com", merged.Domain)
+	assert.Equal(t, "", merged.Name)
+	assert.Equal(t, []string{"piano.io", "tinypass.com"}, merged.BlockScripts)
+	assert.Equal(t, []string{"direct"}, merged.Strategies)
+	assert.Equal(t, "https://www.google.com/", merged.Headers.Referer)
+	assert.Equal(t, "bingbot", merged.Headers.UserAgent)
+	assert.Equal(t, time.Minute, merged.Timeouts.Body)
+
+	// the lists of merged rules share no array with their bases
+	merged.BlockScripts[0] = "changed"
+	assert.Equal(t, "piano.io", base.BlockScripts[0])
+}
+
+func TestResolve(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- name: paywall
+  removeElements: [.paywall]
+- name: piano
+  extends: paywall
+  blockScripts: [piano.io]
+- name: example
+  domain: example.org
+  extends: piano
+  stripOverlays: true
+- domain: example.com
+  extends: [example]
+  removeElements: [.banner]`)
+	require.NoError(t, err)
+	rs, err = rs.resolve()
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+
+	assert.Equal(t, "example.org", rs[0].Domain)
+	assert.Equal(t, []string{"piano.io"}, rs[0].BlockScripts)
+	assert.Nil(t, rs[0].Extends)
+	assert.Equal(t, "example.com", rs[1].Domain)
+	assert.Equal(t, []string{".paywall", ".banner"}, rs[1].RemoveElements)
+	assert.Equal(t, []string{"piano.io"}, rs[1].BlockScripts)
+	assert.True(t, rs[1].StripOverlays)
+
+	_, err = RuleSet{{Domain: "example.com", Extends: Names{"missing"}}}.resolve()
+	assert.ErrorContains(t, err, "invalid rule for example.com: rule extends unknown rule 'missing'")
+	_, err = RuleSet{{Name: "a", Extends: Names{"b"}}, {Name: "b", Extends: Names{"a"}}, {Domain: "example.com", Extends: Names{"a"}}}.resolve()
+	assert.ErrorContains(t, err, "rule 'a' extends itself through a -> b -> a")
+	_, err = RuleSet{{Name: "a", StripOverlays: true}, {Name: "a"}}.resolve()
+	assert.ErrorContains(t, err, "rule 'a' is defined twice")
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "profiles"), 0o755))
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	write("profiles/piano.yaml", "- name: piano\n  blockScripts: [piano.io]\n")
+	write("profiles/paywall.yaml", "- name: paywall\n  removeElements: [.paywall]\n")
+	write("sites.yaml", "- include: profiles/*.yaml\n- domain: example.com\n  extends: [piano, paywall]\n")
+
+	rs, err := LoadRuleset(filepath.Join(dir, "sites.yaml"))
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+	assert.Equal(t, []string{"piano.io"}, rs[0].BlockScripts)
+	assert.Equal(t, []string{".paywall"}, rs[0].RemoveElements)
+
+	// profiles both included and in the directory are loaded twice, but are the same
+	rs, err = LoadRuleset(dir)
+	require.NoError(t, err)
+	assert.Len(t, rs, 1)
+
+	write("profiles/loop.yaml", "- include: ../sites.yaml\n")
+	_, err = LoadRuleset(filepath.Join(dir, "sites.yaml"))
+	assert.ErrorContains(t, err, "includes itself")
+
+	write("missing.yaml", "- include: nothing.yaml\n")
+	_, err = LoadRuleset(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "nothing.yaml' not found")
+}
+
+func TestIncludeRemote(t *testing.T) {
+	defer func(dir string) { CacheDir = dir }(CacheDir)
+	CacheDir = t.TempDir()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rules/sites.yaml":
+			w.Write([]byte("- include: profiles/piano.yaml\n- domain: example.com\n  extends: piano\n"))
+		case "/rules/profiles/piano.yaml":
+			w.Write([]byte("- name: piano\n  blockScripts: [piano.io]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rs, err := LoadRuleset(server.URL + "/rules/sites.yaml")
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+	assert.Equal(t, []string{"piano.io"}, rs[0].BlockScripts)
+}
+
+func TestConflicts(t *testing.T) {
+	rule := Rule{Domain: "example.com", StripOverlays: true, RemoveElements: []string{".paywall"}}
+	rule.Headers.UserAgent = "googlebot"
+	rule.Timeouts.Body = time.Minute
+	other := Rule{Domain: "www.example.com", StripOverlays: true, RemoveElements: []string{".banner"}}
+	other.Headers.UserAgent = "bingbot"
+	other.Headers.Referer = "https://t.co/"
+	other.Timeouts.Body = time.Second
+
+	assert.Equal(t, []string{"headers.user-agent", "timeouts.body"}, Conflicts(rule, other))
+	assert.Empty(t, Conflicts(rule, rule))
+}
+
+// TestInheritUnset checks that rules set the fields of their bases back to false or empty.
+func TestInheritUnset(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- name: piano
+  googleCache: true
+  stripOverlays: true
+  preset: stealth
+  headers:
+    referer: https://www.google.com/
+    user-agent: googlebot
+- domain: example.com
+  extends: piano
+  stripOverlays: false
+  preset: ""
+  headers:
+    referer: ""`)
+	require.NoError(t, err)
+	rs, err = rs.resolve()
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+
+	assert.True(t, rs[0].GoogleCache)
+	assert.False(t, rs[0].StripOverlays)
+	assert.Equal(t, "", rs[0].Preset)
+	assert.Equal(t, "", rs[0].Headers.Referer)
+	assert.Equal(t, "googlebot", rs[0].Headers.UserAgent)
+
+	// rules set to false conflict with rules set to true
+	assert.Equal(t, []string{"stripOverlays"}, Conflicts(rs[0], Rule{StripOverlays: true, Headers: rs[0].Headers}))
+}
+
+func TestClone(t *testing.T) {
+	rule := Rule{Domain: "example.com", Modifiers: []ModifierRef{{Name: "replace", Params: []string{"a", "b"}}}}
+	rule.Headers.Forward = []string{"Content-Type"}
+	rule.fields = map[string]bool{"domain": true}
+
+	clone := rule.Clone()
+	assert.Equal(t, rule, clone)
+
+	// changing the clone, eg: the rule returned by Match, doesn't change the ruleset
+	clone.Headers.Forward[0] = "Set-Cookie"
+	clone.Modifiers[0].Params[0] = "changed"
+	clone.fields["headers.forward"] = true
+	assert.Equal(t, "Content-Type", rule.Headers.Forward[0])
+	assert.Equal(t, "a", rule.Modifiers[0].Params[0])
+	assert.False(t, rule.fields["headers.forward"])
+
+	// nor do the changes of merged rules change their bases
+	merged := Inherit(rule, Rule{Domain: "example.org"})
+	merged.Modifiers[0].Params[0] = "changed"
+	assert.Equal(t, "a", rule.Modifiers[0].Params[0])
+}
@@ -0,0 +1,258 @@
+package ruleset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CacheDir is the directory caching remote rulesets, so that ladder starts with the last copy
+// of a ruleset whose server is unreachable, and fetches it again only once it changed, with
+// ETag and Last-Modified. It is RULESET_CACHE_DIR, or else the ladder directory of the user
+// cache directory. Empty disables the cache.
+var CacheDir = cacheDir()
+
+// cacheDir returns the default CacheDir.
+func cacheDir() string {
+	if dir, ok := os.LookupEnv("RULESET_CACHE_DIR"); ok {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ladder", "rulesets")
+}
+
+// remoteClient fetches remote rulesets.
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// remoteRegex matches the rule paths of remote rulesets.
+var remoteRegex = regexp.MustCompile(`^https?:\/\/(www\.)?[-a-zA-Z0-9@:%._\+~#=]{1,256}\.[a-zA-Z0-9()]{1,6}\b([-a-zA-Z0-9()!@:%_\+.~#?&\/\/=]*)`)
+
+// isRemote reports whether rulePath is the URL of a remote ruleset.
+func isRemote(rulePath string) bool {
+	return remoteRegex.MatchString(rulePath)
+}
+
+// remoteMeta is the metadata of a cached remote ruleset.
+type remoteMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// remoteCache is the cached copy of the remote ruleset at a URL, in CacheDir.
+type remoteCache struct {
+	meta remoteMeta
+	// cached reports whether the ruleset is cached, as its metadata is.
+	cached bool
+	// path is the path of the cached ruleset, without extension: the YAML is stored in path.yaml
+	// and its metadata in path.json.
+	path string
+}
+
+// openRemoteCache returns the cache of the remote ruleset at rulesUrl, or nil without CacheDir.
+func openRemoteCache(rulesUrl string) *remoteCache {
+	if CacheDir == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(rulesUrl))
+	c := &remoteCache{path: filepath.Join(CacheDir, hex.EncodeToString(sum[:8]))}
+	data, err := os.ReadFile(c.path + ".json")
+	c.cached = err == nil && json.Unmarshal(data, &c.meta) == nil && c.meta.URL == rulesUrl
+	if !c.cached {
+		c.meta = remoteMeta{URL: rulesUrl}
+	}
+	return c
+}
+
+// read returns the cached ruleset and its YAML, if any.
+func (c *remoteCache) read() (RuleSet, []byte, bool) {
+	if c == nil || !c.cached {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(c.path + ".yaml")
+	if err != nil {
+		return nil, nil, false
+	}
+	var rs RuleSet
+	if err := yaml.Unmarshal(data, &rs); err != nil {
+		return nil, nil, false
+	}
+	return rs, data, true
+}
+
+// write caches the ruleset data, served with the validators of resp.
+func (c *remoteCache) write(data []byte, resp *http.Response) error {
+	if c == nil {
+		return nil
+	}
+	c.meta.ETag = resp.Header.Get("ETag")
+	c.meta.LastModified = resp.Header.Get("Last-Modified")
+	meta, err := json.Marshal(c.meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(CacheDir, 0o755); err != nil {
+		return err
+	}
+	// the metadata is written last, so that it never describes another copy of the ruleset
+	if err := writeFileAtomic(c.path+".yaml", data); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path+".json", meta)
+}
+
+// writeFileAtomic replaces the file at path with data, without exposing a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fetchRemote returns the remote ruleset at rulesUrl, and whether it changed since it was
+// cached. It is downloaded only if it changed since it was cached, and read from the cache if
+// its server fails.
+func fetchRemote(rulesUrl string) (RuleSet, bool, error) {
+	cache := openRemoteCache(rulesUrl)
+	cached, cachedData, ok := cache.read()
+	fallback := func(err error) (RuleSet, bool, error) {
+		if !ok {
+			return nil, false, err
+		}
+		slog.Warn("failed to fetch remote ruleset, using the cached copy", "url", rulesUrl, "error", err)
+		return cached, false, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rulesUrl, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		if cache.meta.ETag != "" {
+			req.Header.Set("If-None-Match", cache.meta.ETag)
+		}
+		if cache.meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.meta.LastModified)
+		}
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		e := errors.New(fmt.Sprintf("failed to load rules from remote url '%s'", rulesUrl))
+		return fallback(errors.Join(e, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && ok {
+		return cached, false, nil
+	}
+	if resp.StatusCode >= 400 {
+		return fallback(errors.New(fmt.Sprintf("failed to load rules from remote url (%s) on '%s'", resp.Status, rulesUrl)))
+	}
+
+	var reader io.Reader = resp.Body
+	isGzip := strings.HasSuffix(rulesUrl, ".gz") || strings.HasSuffix(rulesUrl, ".gzip") || resp.Header.Get("content-encoding") == "gzip"
+	if isGzip {
+		reader, err = gzip.NewReader(resp.Body)
+		if err != nil {
+			return fallback(fmt.Errorf("failed to create gzip reader for URL '%s' with status code '%s': %w", rulesUrl, resp.Status, err))
+		}
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fallback(fmt.Errorf("failed to read rules from remote url '%s': %w", rulesUrl, err))
+	}
+
+	var r RuleSet
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&r); err != nil && err != io.EOF {
+		e := errors.New(fmt.Sprintf("failed to load rules from remote url '%s' with status code '%s' and possible syntax error", rulesUrl, resp.Status))
+		return fallback(errors.Join(e, err))
+	}
+	if err := cache.write(data, resp); err != nil {
+		slog.Warn("failed to cache remote ruleset", "url", rulesUrl, "error", err)
+	}
+	// servers without ETag nor Last-Modified send the ruleset every time
+	return r, !ok || !bytes.Equal(data, cachedData), nil
+}
+
+// Refresher reloads a RuleSet when its remote rulesets change.
+type Refresher struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+// Refresh checks the remote rulesets of rulePaths, see NewRuleset, every interval, and loads
+// the RuleSet again with LoadRuleset once one of them changed, like Watch does with local files.
+// Checks send the ETag and Last-Modified of the cached rulesets, so that unchanged rulesets
+// aren't downloaded again.
+func Refresh(rulePaths string, interval time.Duration, validate func(RuleSet) error, onLoad func(RuleSet)) (*Refresher, error) {
+	var remotes []string
+	for _, rulePath := range strings.Split(rulePaths, ";") {
+		if rulePath = strings.TrimSpace(rulePath); isRemote(rulePath) {
+			remotes = append(remotes, rulePath)
+		}
+	}
+	if len(remotes) == 0 {
+		return nil, errors.New("no remote ruleset to refresh")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid ruleset refresh interval %s", interval)
+	}
+
+	r := &Refresher{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+			changed := false
+			for _, remote := range remotes {
+				_, fresh, err := fetchRemote(remote)
+				if err != nil {
+					slog.Error("failed to refresh remote ruleset", "url", remote, "error", err)
+				}
+				changed = changed || fresh
+			}
+			if changed {
+				reload(rulePaths, validate, onLoad)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Close stops refreshing the RuleSet.
+func (r *Refresher) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	return nil
+}
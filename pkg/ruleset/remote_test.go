@@ -0,0 +1,123 @@
+package ruleset
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchRemote(t *testing.T) {
+	defer func(dir string) { CacheDir = dir }(CacheDir)
+	CacheDir = t.TempDir()
+
+	var body atomic.Value
+	body.Store(validYAML)
+	// version is the version of body, served as its ETag
+	var version, requests, downloads atomic.Int32
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		etag := `"v` + strconv.Itoa(int(version.Load())) + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+
+	rs, changed, err := fetchRemote(server.URL + "/ruleset.yaml")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "example.com", rs[0].Domain)
+
+	// unchanged rulesets are revalidated, not downloaded
+	rs, changed, err = fetchRemote(server.URL + "/ruleset.yaml")
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, "example.com", rs[0].Domain)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, int32(1), downloads.Load())
+
+	body.Store(validYAML + "\n- domain: example.org")
+	version.Add(1)
+	rs, changed, err = fetchRemote(server.URL + "/ruleset.yaml")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, rs, 2)
+
+	// failing servers and broken rulesets fall back to the cached copy
+	down.Store(true)
+	rs, changed, err = fetchRemote(server.URL + "/ruleset.yaml")
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, rs, 2)
+	down.Store(false)
+	body.Store(invalidYAML)
+	version.Add(1)
+	rs, err = NewRuleset(server.URL + "/ruleset.yaml")
+	require.NoError(t, err)
+	assert.Len(t, rs, 2)
+
+	// without cached copy, failures are errors
+	_, _, err = fetchRemote(server.URL + "/other.yaml")
+	assert.Error(t, err)
+	CacheDir = ""
+	_, _, err = fetchRemote(server.URL + "/ruleset.yaml")
+	assert.Error(t, err)
+}
+
+func TestRefresh(t *testing.T) {
+	defer func(dir string) { CacheDir = dir }(CacheDir)
+	CacheDir = t.TempDir()
+
+	var body atomic.Value
+	body.Store(validYAML)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+
+	local, err := os.CreateTemp(t.TempDir(), "*.yaml")
+	require.NoError(t, err)
+	local.WriteString("- domain: example.net")
+	local.Close()
+
+	_, err = Refresh(local.Name(), time.Second, nil, func(RuleSet) {})
+	assert.Error(t, err)
+
+	rulePaths := server.URL + "/ruleset.yaml;" + local.Name()
+	_, err = NewRuleset(rulePaths)
+	require.NoError(t, err)
+	loaded := make(chan RuleSet, 10)
+	r, err := Refresh(rulePaths, 20*time.Millisecond, nil, func(rs RuleSet) { loaded <- rs })
+	require.NoError(t, err)
+	defer r.Close()
+
+	// servers without ETag nor Last-Modified are compared with the cached copy
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, loaded)
+
+	body.Store(validYAML + "\n- domain: example.org")
+	select {
+	case rs := <-loaded:
+		assert.Equal(t, []string{"example.com", "example.org", "example.net"}, rs.Domains())
+	case <-time.After(5 * time.Second):
+		t.Fatal("ruleset not refreshed")
+	}
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+}
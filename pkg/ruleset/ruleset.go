@@ -5,14 +5,22 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"compress/gzip"
 
+	"ladder/pkg/urls"
+
 	"gopkg.in/yaml.v3"
 )
 
@@ -25,21 +33,110 @@ type KV struct {
 	Value string `yaml:"value"`
 }
 
+// Script holds the source of the request and response scripts of a rule.
+type Script struct {
+	Request  string `yaml:"request,omitempty"`
+	Response string `yaml:"response,omitempty"`
+}
+
+// ModifierRef references a modifier registered by name, configured with its parameters,
+// see ladder.RegisterModifier.
+type ModifierRef struct {
+	Name   string   `yaml:"name"`
+	Params []string `yaml:"params,omitempty"`
+}
+
 type RuleSet []Rule
 
 type Rule struct {
+	// Name names the rule for other rules to extend it. Rules with a name but no domain are
+	// profiles, applied to the sites of the rules extending them only.
+	Name    string   `yaml:"name,omitempty"`
 	Domain  string   `yaml:"domain,omitempty"`
 	Domains []string `yaml:"domains,omitempty"`
 	Paths   []string `yaml:"paths,omitempty"`
+	// Priority orders the rules matching a URL, which are merged, see RuleSet.Match. Rules of
+	// higher priority take precedence over the others.
+	Priority int `yaml:"priority,omitempty"`
+	// Extends lists the names of the rules the rule inherits from, in order, see Inherit.
+	Extends Names `yaml:"extends,omitempty"`
+	// Include lists the rule files loaded along with the file of the rule, relative to it, eg:
+	// shared profiles. Rules with an include are only loading directives.
+	Include Names `yaml:"include,omitempty"`
 	Headers struct {
 		UserAgent     string `yaml:"user-agent,omitempty"`
 		XForwardedFor string `yaml:"x-forwarded-for,omitempty"`
 		Referer       string `yaml:"referer,omitempty"`
 		Cookie        string `yaml:"cookie,omitempty"`
 		CSP           string `yaml:"content-security-policy,omitempty"`
+		// Forward lists the upstream response headers forwarded to the client, replacing
+		// the allowlist of the ladder instance, eg: Cache-Control or ETag.
+		Forward []string `yaml:"forward,omitempty"`
+		// Masquerade sends the User-Agent, Referer and X-Forwarded-For of a crawler, eg: facebookbot,
+		// unless the headers above override them.
+		Masquerade string `yaml:"masquerade,omitempty"`
+		// ClientHints sends the Accept, Sec-Fetch and Sec-CH-UA headers of a browser, eg: chrome,
+		// or of the browser of the User-Agent with auto. none sends none of them.
+		ClientHints string `yaml:"client-hints,omitempty"`
 	} `yaml:"headers,omitempty"`
-	GoogleCache bool    `yaml:"googleCache,omitempty"`
-	RegexRules  []Regex `yaml:"regexRules"`
+	TLS struct {
+		ECH         bool   `yaml:"ech,omitempty"`
+		Fingerprint string `yaml:"fingerprint,omitempty"`
+		ClientHello string `yaml:"clientHello,omitempty"`
+		// HTTP2 impersonates the HTTP/2 fingerprint of a browser, eg: chrome, see transport.HTTP2Profiles.
+		HTTP2 string `yaml:"http2,omitempty"`
+		// HTTP3 fetches the site over HTTP/3 (QUIC) if its origin supports it.
+		HTTP3 bool `yaml:"http3,omitempty"`
+		// HeaderOrder sends HTTP/1.1 headers in the order and casing of a browser, eg: chrome,
+		// see transport.HeaderOrders.
+		HeaderOrder string `yaml:"headerOrder,omitempty"`
+	} `yaml:"tls,omitempty"`
+	Timeouts    Timeouts `yaml:"timeouts,omitempty"`
+	Retry       Retry    `yaml:"retry,omitempty"`
+	GoogleCache bool     `yaml:"googleCache,omitempty"`
+	RegexRules  []Regex  `yaml:"regexRules"`
+	// Resolver looks up the addresses of the site, eg: cloudflare, replacing the resolver of the
+	// ladder instance, see resolver.Get.
+	Resolver string `yaml:"resolver,omitempty"`
+	// Resolve pins hosts to addresses as host:ip, eg: www.example.com:203.0.113.7, which are dialed
+	// without looking them up, replacing the pins of the same hosts of the ladder instance.
+	Resolve []string `yaml:"resolve,omitempty"`
+	// Tor fetches the site through Tor, switching circuits when it blocks the exit node.
+	Tor bool `yaml:"tor,omitempty"`
+	// BlockScripts removes the script elements loaded from these domains or their subdomains,
+	// eg: the paywall vendors piano.io or tinypass.com.
+	BlockScripts []string `yaml:"blockScripts,omitempty"`
+	// TrackingParams lists the query parameters stripped from the URLs of the site, eg: utm_* or fbclid,
+	// replacing those of the ladder instance. none keeps all of them.
+	TrackingParams []string `yaml:"trackingParams,omitempty"`
+	// RemoveElements removes the elements matching these CSS selectors, eg: paywall modals or banners.
+	RemoveElements []string `yaml:"removeElements,omitempty"`
+	// StripOverlays removes the elements that look like paywall overlays and lets the page scroll again.
+	StripOverlays bool `yaml:"stripOverlays,omitempty"`
+	// Cookies forwards the cookies set by the site to the client, scoped to the path of the site
+	// on the ladder instance, and the cookies sent back by the client upstream, eg: for sites
+	// rendering their content only once a consent or session cookie is set.
+	Cookies bool `yaml:"cookies,omitempty"`
+	// CookieJar stores the cookies set by the site server-side and sends them back with the later
+	// requests to the site, eg: to get past consent walls whatever the client does with cookies.
+	CookieJar bool `yaml:"cookieJar,omitempty"`
+	// Images routes the images of the pages through the image route to scale them down, eg: for mobile readers.
+	Images Images `yaml:"images,omitempty"`
+	// Redirects configures the upstream redirects followed for the site, see ladder.Client.MaxRedirects.
+	Redirects Redirects `yaml:"redirects,omitempty"`
+	// Browser renders the pages of the site in a headless browser, for sites assembling their
+	// content with JavaScript, see ladder.Client.Browser.
+	Browser Browser `yaml:"browser,omitempty"`
+
+	// Preset fetches the site the way of a preset of the strategies package, eg: googlebot or stealth,
+	// adapting the settings of the rule, see strategies.Names.
+	Preset string `yaml:"preset,omitempty"`
+	// Strategies lists the strategies tried in order until one gets the pages of the site, eg:
+	// direct and archive.org, replacing those of the ladder instance, see ladder.Client.Strategies.
+	Strategies []string `yaml:"strategies,omitempty"`
+	// AMP fetches the AMP version of the pages of the site, whose URL follows path, subdomain
+	// or query, or with canonical the canonical version of AMP URLs, see ladder.RequestAMPVersion.
+	AMP string `yaml:"amp,omitempty"`
 
 	UrlMods struct {
 		Domain []Regex `yaml:"domain"`
@@ -47,12 +144,44 @@ type Rule struct {
 		Query  []KV    `yaml:"query"`
 	} `yaml:"urlMods"`
 
+	// Modifiers lists the registered modifiers applied to the requests and responses of the site,
+	// eg: spoofReferrer with the parameter https://www.google.com/, see ladder.RegisteredModifiers.
+	Modifiers []ModifierRef `yaml:"modifiers,omitempty"`
+
+	Plugins []string `yaml:"plugins,omitempty"`
+	Wasm    []string `yaml:"wasm,omitempty"`
+	Lua     Script   `yaml:"lua,omitempty"`
+	JS      Script   `yaml:"js,omitempty"`
+
 	Injections []struct {
 		Position string `yaml:"position"`
 		Append   string `yaml:"append"`
 		Prepend  string `yaml:"prepend"`
 		Replace  string `yaml:"replace"`
+		// Script is JavaScript appended to Position, the body by default, as a script
+		// element allowed by the Content-Security-Policy of the page.
+		Script string `yaml:"script,omitempty"`
 	} `yaml:"injections"`
+
+	// TestUrls are pages of the site checked by `ladder rules test`, eg: in the CI of a ruleset
+	// repository, to detect rules that stopped working.
+	TestUrls []RuleTest `yaml:"testUrls,omitempty"`
+
+	// fields holds the YAML paths of the fields set by the rule, eg: headers.user-agent, once
+	// decoded from YAML, so that merged rules can set fields back to false or empty, see Inherit.
+	fields map[string]bool
+}
+
+// RuleTest is a page of the site of a rule, with the expectations the page served through
+// ladder must meet, besides being served without error, paywall or challenge.
+type RuleTest struct {
+	URL string `yaml:"url"`
+	// Selector is a CSS selector matching elements of the page, eg: the paragraphs of the article.
+	Selector string `yaml:"selector,omitempty"`
+	// Contains is a phrase of the page, eg: from the end of the article.
+	Contains string `yaml:"contains,omitempty"`
+	// MinLength is the length of the page in bytes under which it is deemed truncated.
+	MinLength int `yaml:"minLength,omitempty"`
 }
 
 // NewRulesetFromEnv creates a new RuleSet based on the RULESET environment variable.
@@ -61,7 +190,7 @@ type Rule struct {
 func NewRulesetFromEnv() RuleSet {
 	rulesPath, ok := os.LookupEnv("RULESET")
 	if !ok {
-		log.Printf("WARN: No ruleset specified. Set the `RULESET` environment variable to load one for a better success rate.")
+		slog.Warn("No ruleset specified. Set the `RULESET` environment variable to load one for a better success rate.")
 		return RuleSet{}
 	}
 	ruleSet, err := NewRuleset(rulesPath)
@@ -75,6 +204,18 @@ func NewRulesetFromEnv() RuleSet {
 // It supports loading rules from both local file paths and remote URLs.
 // Returns a RuleSet and an error if any issues occur during loading.
 func NewRuleset(rulePaths string) (RuleSet, error) {
+	return newRuleset(rulePaths, false)
+}
+
+// LoadRuleset loads a RuleSet like NewRuleset, but fails if any file of a directory fails to
+// load, rather than skipping it, eg: to keep the previous RuleSet when reloading a broken one.
+func LoadRuleset(rulePaths string) (RuleSet, error) {
+	return newRuleset(rulePaths, true)
+}
+
+// newRuleset loads the RuleSet of rulePaths, skipping the files of directories failing to load
+// unless strict.
+func newRuleset(rulePaths string, strict bool) (RuleSet, error) {
 	ruleSet := RuleSet{}
 	errs := []error{}
 
@@ -83,11 +224,10 @@ func NewRuleset(rulePaths string) (RuleSet, error) {
 		rulePath := strings.Trim(rule, " ")
 		var err error
 
-		isRemote, _ := regexp.MatchString(`^https?:\/\/(www\.)?[-a-zA-Z0-9@:%._\+~#=]{1,256}\.[a-zA-Z0-9()]{1,6}\b([-a-zA-Z0-9()!@:%_\+.~#?&\/\/=]*)`, rulePath)
-		if isRemote {
+		if isRemote(rulePath) {
 			err = ruleSet.loadRulesFromRemoteFile(rulePath)
 		} else {
-			err = ruleSet.loadRulesFromLocalDir(rulePath)
+			err = ruleSet.loadRulesFromLocalDir(rulePath, strict)
 		}
 
 		if err != nil {
@@ -97,6 +237,12 @@ func NewRuleset(rulePaths string) (RuleSet, error) {
 		}
 	}
 
+	ruleSet, err := ruleSet.resolve()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	ruleSet.LogConflicts()
+
 	if len(errs) != 0 {
 		e := errors.New(fmt.Sprintf("WARN: failed to load %d rulesets", len(rp)))
 		errs = append(errs, e)
@@ -120,8 +266,8 @@ func NewRuleset(rulePaths string) (RuleSet, error) {
 // loadRulesFromLocalDir loads rules from a local directory specified by the path.
 // It walks through the directory, loading rules from YAML files.
 // Returns an error if the directory cannot be accessed
-// If there is an issue loading any file, it will be skipped
-func (rs *RuleSet) loadRulesFromLocalDir(path string) error {
+// If there is an issue loading any file, it will be skipped, unless strict
+func (rs *RuleSet) loadRulesFromLocalDir(path string, strict bool) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -141,11 +287,14 @@ func (rs *RuleSet) loadRulesFromLocalDir(path string) error {
 		}
 
 		err = rs.loadRulesFromLocalFile(path)
+		if err != nil && strict {
+			return err
+		}
 		if err != nil {
-			log.Printf("WARN: failed to load directory ruleset '%s': %s, skipping", path, err)
+			slog.Warn("failed to load directory ruleset, skipping", "path", path, "error", err)
 			return nil
 		}
-		log.Printf("INFO: loaded ruleset %s\n", path)
+		slog.Info("loaded ruleset", "path", path)
 		return nil
 	})
 
@@ -155,9 +304,15 @@ func (rs *RuleSet) loadRulesFromLocalDir(path string) error {
 	return nil
 }
 
-// loadRulesFromLocalFile loads rules from a local YAML file specified by the path.
+// loadRulesFromLocalFile loads rules from a local YAML file specified by the path, along with
+// the files it includes, see Rule.Include.
 // Returns an error if the file cannot be read or if there's a syntax error in the YAML.
 func (rs *RuleSet) loadRulesFromLocalFile(path string) error {
+	return rs.loadLocalFile(path, nil)
+}
+
+// loadLocalFile loads the rules of the local file at path, included by the files of including.
+func (rs *RuleSet) loadLocalFile(path string, including []string) error {
 	yamlFile, err := os.ReadFile(path)
 	if err != nil {
 		e := errors.New(fmt.Sprintf("failed to read rules from local file: '%s'", path))
@@ -174,48 +329,84 @@ func (rs *RuleSet) loadRulesFromLocalFile(path string) error {
 		}
 		return ee
 	}
-	*rs = append(*rs, r...)
-	return nil
+
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	including = append(slices.Clip(including), path)
+	return rs.appendRules(r, func(include string) error {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		files, err := filepath.Glob(include)
+		if err != nil {
+			return fmt.Errorf("invalid include '%s' in '%s': %w", include, path, err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("included rule file '%s' not found in '%s'", include, path)
+		}
+		for _, file := range files {
+			if slices.Contains(including, file) {
+				return fmt.Errorf("rule file '%s' includes itself through %s", file, strings.Join(including, " -> "))
+			}
+			if err := rs.loadLocalFile(file, including); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// loadRulesFromRemoteFile loads rules from a remote URL.
+// loadRulesFromRemoteFile loads rules from a remote URL, or else from its cached copy, see CacheDir,
+// along with the URLs it includes, relative to it.
 // It supports plain and gzip compressed content.
 // Returns an error if there's an issue accessing the URL or if there's a syntax error in the YAML.
 func (rs *RuleSet) loadRulesFromRemoteFile(rulesUrl string) error {
-	var r RuleSet
-	resp, err := http.Get(rulesUrl)
+	return rs.loadRemoteFile(rulesUrl, nil)
+}
+
+// loadRemoteFile loads the rules of the remote ruleset at rulesUrl, included by the rulesets of
+// including.
+func (rs *RuleSet) loadRemoteFile(rulesUrl string, including []string) error {
+	r, _, err := fetchRemote(rulesUrl)
 	if err != nil {
-		e := errors.New(fmt.Sprintf("failed to load rules from remote url '%s'", rulesUrl))
-		return errors.Join(e, err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		e := errors.New(fmt.Sprintf("failed to load rules from remote url (%s) on '%s'", resp.Status, rulesUrl))
-		return errors.Join(e, err)
+	base, err := url.Parse(rulesUrl)
+	if err != nil {
+		return err
 	}
-
-	var reader io.Reader
-	isGzip := strings.HasSuffix(rulesUrl, ".gz") || strings.HasSuffix(rulesUrl, ".gzip") || resp.Header.Get("content-encoding") == "gzip"
-
-	if isGzip {
-		reader, err = gzip.NewReader(resp.Body)
+	including = append(slices.Clip(including), rulesUrl)
+	return rs.appendRules(r, func(include string) error {
+		ref, err := url.Parse(include)
 		if err != nil {
-			return fmt.Errorf("failed to create gzip reader for URL '%s' with status code '%s': %w", rulesUrl, resp.Status, err)
+			return fmt.Errorf("invalid include '%s' in '%s': %w", include, rulesUrl, err)
 		}
-	} else {
-		reader = resp.Body
-	}
-
-	err = yaml.NewDecoder(reader).Decode(&r)
+		includeUrl := base.ResolveReference(ref).String()
+		if !isRemote(includeUrl) {
+			return fmt.Errorf("invalid include '%s' in '%s': remote rulesets include remote rulesets only", include, rulesUrl)
+		}
+		if slices.Contains(including, includeUrl) {
+			return fmt.Errorf("ruleset '%s' includes itself through %s", includeUrl, strings.Join(including, " -> "))
+		}
+		return rs.loadRemoteFile(includeUrl, including)
+	})
+}
 
-	if err != nil {
-		e := errors.New(fmt.Sprintf("failed to load rules from remote url '%s' with status code '%s' and possible syntax error", rulesUrl, resp.Status))
-		ee := errors.Join(e, err)
-		return ee
+// appendRules appends the rules of r to rs, loading the rule files of their includes with load
+// in place of them.
+func (rs *RuleSet) appendRules(r RuleSet, load func(include string) error) error {
+	for _, rule := range r {
+		if len(rule.Include) == 0 {
+			*rs = append(*rs, rule)
+			continue
+		}
+		for _, include := range rule.Include {
+			if err := load(include); err != nil {
+				return err
+			}
+		}
 	}
-
-	*rs = append(*rs, r...)
 	return nil
 }
 
@@ -260,6 +451,275 @@ func (rs *RuleSet) Domains() []string {
 	return domains
 }
 
+// Timeouts bounds the phases of an upstream request, eg: `5s`.
+// Zero values fall back to the timeouts of the ladder instance.
+type Timeouts struct {
+	DNS            time.Duration `yaml:"dns,omitempty"`
+	Connect        time.Duration `yaml:"connect,omitempty"`
+	TLSHandshake   time.Duration `yaml:"tlsHandshake,omitempty"`
+	ResponseHeader time.Duration `yaml:"responseHeader,omitempty"`
+	Body           time.Duration `yaml:"body,omitempty"`
+}
+
+// Retry configures the retries of the upstream requests answered with 429 Too Many Requests
+// or a server error, or timing out, eg: `attempts: 3`, with exponential backoff and jitter.
+// Zero values fall back to the retries of the ladder instance.
+type Retry struct {
+	// Attempts is the number of times a request is sent at most, 1 never retrying it.
+	Attempts int `yaml:"attempts,omitempty"`
+	// Backoff is the delay before the first retry, doubled before each following one.
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxBackoff bounds the delay before a retry, including the one asked by a Retry-After header.
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+}
+
+// Redirects configures the upstream redirects followed by ladder. Redirects it doesn't follow
+// are passed to the client, routed back through ladder.
+type Redirects struct {
+	// Max is the number of redirects followed, replacing that of the ladder instance, -1 following none.
+	Max int `yaml:"max,omitempty"`
+	// SameOrigin follows the redirects to the origin of the fetched URL only.
+	SameOrigin bool `yaml:"sameOrigin,omitempty"`
+	// Cookies sends the cookies set by redirects along with the next requests of the redirect chain,
+	// and passes them to the client with the response, eg: for sites redirecting through a login
+	// or consent page setting a cookie.
+	Cookies bool `yaml:"cookies,omitempty"`
+}
+
+// Browser configures the rendering of the pages of a site in a headless browser.
+type Browser struct {
+	// Render fetches the pages with the browser, and passes their DOM on once rendered.
+	Render bool `yaml:"render,omitempty"`
+	// WaitFor waits for an element matching this CSS selector to be rendered, eg: article .body.
+	WaitFor string `yaml:"waitFor,omitempty"`
+	// Idle waits for the page to send no network request for this long, eg: 1s.
+	Idle time.Duration `yaml:"idle,omitempty"`
+}
+
+// Images configures the scaling of the images of a page by the image route.
+// The zero Images leaves images as they are.
+type Images struct {
+	// MaxWidth is the width images are scaled down to, in pixels.
+	MaxWidth int `yaml:"maxWidth,omitempty"`
+	// Format is the format images are converted to: jpeg, png or webp.
+	Format string `yaml:"format,omitempty"`
+}
+
+// Or returns t with its zero values replaced by those of fallback.
+func (t Timeouts) Or(fallback Timeouts) Timeouts {
+	or := func(d, fallback time.Duration) time.Duration {
+		if d == 0 {
+			return fallback
+		}
+		return d
+	}
+	return Timeouts{
+		DNS:            or(t.DNS, fallback.DNS),
+		Connect:        or(t.Connect, fallback.Connect),
+		TLSHandshake:   or(t.TLSHandshake, fallback.TLSHandshake),
+		ResponseHeader: or(t.ResponseHeader, fallback.ResponseHeader),
+		Body:           or(t.Body, fallback.Body),
+	}
+}
+
+// Or returns r with its zero values replaced by those of fallback.
+func (r Retry) Or(fallback Retry) Retry {
+	if r.Attempts == 0 {
+		r.Attempts = fallback.Attempts
+	}
+	if r.Backoff == 0 {
+		r.Backoff = fallback.Backoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = fallback.MaxBackoff
+	}
+	return r
+}
+
+// ParseRetry parses retries given as a comma separated list of setting=value pairs,
+// eg: `attempts=3,backoff=200ms,maxBackoff=5s`.
+func ParseRetry(s string) (Retry, error) {
+	r := Retry{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		setting, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		var err error
+		switch setting {
+		case "attempts":
+			r.Attempts, err = strconv.Atoi(value)
+			if err == nil && r.Attempts < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "backoff":
+			r.Backoff, err = time.ParseDuration(value)
+		case "maxBackoff":
+			r.MaxBackoff, err = time.ParseDuration(value)
+		default:
+			return Retry{}, fmt.Errorf("invalid retry '%s', expected setting=value with setting one of attempts, backoff, maxBackoff", pair)
+		}
+		if err != nil {
+			return Retry{}, fmt.Errorf("invalid retry %s: %w", setting, err)
+		}
+	}
+	return r, nil
+}
+
+// ParseTimeouts parses timeouts given as a comma separated list of phase=duration
+// pairs, eg: `dns=5s,connect=5s,tlsHandshake=5s,responseHeader=20s,body=1m`.
+func ParseTimeouts(s string) (Timeouts, error) {
+	t := Timeouts{}
+	fields := map[string]*time.Duration{
+		"dns":            &t.DNS,
+		"connect":        &t.Connect,
+		"tlsHandshake":   &t.TLSHandshake,
+		"responseHeader": &t.ResponseHeader,
+		"body":           &t.Body,
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		phase, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		field, known := fields[phase]
+		if !ok || !known {
+			return Timeouts{}, fmt.Errorf("invalid timeout '%s', expected phase=duration with phase one of dns, connect, tlsHandshake, responseHeader, body", pair)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("invalid %s timeout: %w", phase, err)
+		}
+		if d <= 0 {
+			return Timeouts{}, fmt.Errorf("invalid duration '%s' for '%s', must be positive", value, phase)
+		}
+		*field = d
+	}
+	return t, nil
+}
+
+// AllDomains returns the domain and domains of the rule.
+func (r Rule) AllDomains() []string {
+	domains := make([]string, 0, len(r.Domains)+1)
+	if r.Domain != "" {
+		domains = append(domains, r.Domain)
+	}
+	return append(domains, r.Domains...)
+}
+
+// Match returns the rules whose domains match domain and whose paths match path, merged into
+// one from the rule of lowest precedence up, see Inherit: the fields set by rules of higher
+// precedence replace the others, and lists are appended. Rules of higher priority take
+// precedence, then rules of more specific domains, see domainKind, where longer exact domains
+// and globs with more literal characters are more specific, then rules with paths, and then
+// the first rules of the RuleSet, see LogConflicts for rules of the same priority. It returns a copy of the rules, or an empty Rule if no rule
+// matches.
+func (rs *RuleSet) Match(domain string, path string) Rule {
+	domain = urls.NormalizeHost(domain)
+	var matches []ruleMatch
+	for i, rule := range *rs {
+		if len(rule.Paths) > 0 && !hasPathPrefix(path, rule.Paths) {
+			continue
+		}
+		if p, ok := rule.matchDomain(domain); ok {
+			matches = append(matches, ruleMatch{rule: rule, index: i, domain: p})
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Rule{}
+	case 1:
+		// return a copy of the match, so requests can't modify the RuleSet
+		return matches[0].rule.Clone()
+	}
+
+	slices.SortFunc(matches, func(a, b ruleMatch) int {
+		switch {
+		case a.precedes(b):
+			return 1
+		case b.precedes(a):
+			return -1
+		}
+		return 0
+	})
+	merged := matches[0].rule.Clone()
+	for _, m := range matches[1:] {
+		merged = Inherit(merged, m.rule)
+	}
+	return merged
+}
+
+// ruleMatch is a rule matching a URL, see RuleSet.Match.
+type ruleMatch struct {
+	rule Rule
+	// index is the index of the rule in the RuleSet.
+	index int
+	// domain is the most specific domain of the rule matching the URL.
+	domain *domainPattern
+}
+
+// precedes reports whether the rule of m takes precedence over the rule of n.
+func (m ruleMatch) precedes(n ruleMatch) bool {
+	switch {
+	case m.rule.Priority != n.rule.Priority:
+		return m.rule.Priority > n.rule.Priority
+	case m.domain.moreSpecific(n.domain) || n.domain.moreSpecific(m.domain):
+		return m.domain.moreSpecific(n.domain)
+	case (len(m.rule.Paths) > 0) != (len(n.rule.Paths) > 0):
+		return len(m.rule.Paths) > 0
+	}
+	return m.index < n.index
+}
+
+// LogConflicts logs the fields set to different values by rules of the same priority whose
+// domains overlap, see Conflicts, as Match merges them by domain specificity and order only.
+// It is called once the rules are loaded, rather than on every Match.
+func (rs RuleSet) LogConflicts() {
+	for i, rule := range rs {
+		for _, other := range rs[i+1:] {
+			if rule.Priority != other.Priority || !rule.overlaps(other) {
+				continue
+			}
+			if fields := Conflicts(rule, other); len(fields) > 0 {
+				slog.Warn("rules of the same priority conflict, set a priority to choose",
+					"rule", strings.Join(rule.AllDomains(), ", "), "other", strings.Join(other.AllDomains(), ", "), "fields", fields)
+			}
+		}
+	}
+}
+
+// overlaps reports whether a host may match a domain of both r and other.
+func (r Rule) overlaps(other Rule) bool {
+	for _, domain := range r.AllDomains() {
+		p := compileDomain(domain)
+		for _, otherDomain := range other.AllDomains() {
+			if p.overlaps(compileDomain(otherDomain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of the rule, sharing no list, map or pointer with it, so that the
+// rules returned by Match can be changed without changing the ruleset.
+func (r Rule) Clone() Rule {
+	c := deepCopy(reflect.ValueOf(r)).Interface().(Rule)
+	c.fields = maps.Clone(r.fields)
+	return c
+}
+
+// hasPathPrefix reports whether path starts with any of the paths.
+func hasPathPrefix(path string, paths []string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
 // DomainCount returns the count of unique domains present in the RuleSet.
 func (rs *RuleSet) DomainCount() int {
 	return len(rs.Domains())
@@ -272,7 +732,7 @@ func (rs *RuleSet) Count() int {
 
 // PrintStats logs the number of rules and domains loaded in the RuleSet.
 func (rs *RuleSet) PrintStats() {
-	log.Printf("INFO: Loaded %d rules for %d domains\n", rs.Count(), rs.DomainCount())
+	slog.Info("loaded rules", "rules", rs.Count(), "domains", rs.DomainCount())
 }
 
 // debugPrintRule is a utility function for printing a rule and associated error for debugging purposes.
@@ -1,13 +1,16 @@
 package ruleset
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -26,6 +29,9 @@ var (
 )
 
 func TestLoadRulesFromRemoteFile(t *testing.T) {
+	defer func(dir string) { CacheDir = dir }(CacheDir)
+	CacheDir = t.TempDir()
+
 	app := fiber.New()
 	defer app.Shutdown()
 
@@ -141,7 +147,7 @@ func TestLoadRulesFromLocalDir(t *testing.T) {
 		os.WriteFile(filePath, []byte(validYAML), 0644)
 	}
 	rs := RuleSet{}
-	err = rs.loadRulesFromLocalDir(baseDir)
+	err = rs.loadRulesFromLocalDir(baseDir, false)
 	assert.NoError(t, err)
 	assert.Equal(t, rs.Count(), len(testCases)*3)
 
@@ -151,3 +157,194 @@ func TestLoadRulesFromLocalDir(t *testing.T) {
 		assert.Equal(t, rule.RegexRules[0].Replace, "https:")
 	}
 }
+
+// TestMatchIsolation checks that concurrent matches don't share state with
+// the RuleSet, which would leak modifications from one request into the next.
+func TestMatchIsolation(t *testing.T) {
+	domains := make([]string, 1, 4)
+	domains[0] = "example.org"
+	rs := RuleSet{{Domain: "example.com", Domains: domains, RegexRules: []Regex{{Match: "a", Replace: "b"}}}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rule := rs.Match("www.example.org", "/")
+			rule.RegexRules[0].Replace = "c"
+			rule.Domains = append(rule.Domains, "example.net")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "b", rs[0].RegexRules[0].Replace)
+	assert.Equal(t, []string{"example.org"}, rs[0].Domains)
+	assert.Equal(t, "example.org", domains[:2][0])
+	assert.Equal(t, "", domains[:2][1])
+}
+
+func TestTimeouts(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- domain: example.com
+  timeouts:
+    dns: 2s
+    body: 1m30s`)
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{DNS: 2 * time.Second, Body: 90 * time.Second}, rs[0].Timeouts)
+
+	fallback := Timeouts{DNS: time.Second, Connect: 5 * time.Second}
+	assert.Equal(t, Timeouts{DNS: 2 * time.Second, Connect: 5 * time.Second, Body: 90 * time.Second}, rs[0].Timeouts.Or(fallback))
+
+	parsed, err := ParseTimeouts("dns=1s, connect=5s,tlsHandshake=3s,responseHeader=20s,body=1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{DNS: time.Second, Connect: 5 * time.Second, TLSHandshake: 3 * time.Second, ResponseHeader: 20 * time.Second, Body: time.Minute}, parsed)
+
+	_, err = ParseTimeouts("read=1s")
+	assert.ErrorContains(t, err, "invalid timeout")
+	_, err = ParseTimeouts("dns=fast")
+	assert.ErrorContains(t, err, "invalid dns timeout")
+	_, err = ParseTimeouts("connect=-5s")
+	assert.ErrorContains(t, err, "invalid duration '-5s' for 'connect', must be positive")
+	_, err = ParseTimeouts("body=0s")
+	assert.ErrorContains(t, err, "must be positive")
+}
+
+func TestRetry(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- domain: example.com
+  retry:
+    attempts: 3
+    backoff: 500ms`)
+	assert.NoError(t, err)
+	assert.Equal(t, Retry{Attempts: 3, Backoff: 500 * time.Millisecond}, rs[0].Retry)
+	assert.Equal(t, Retry{Attempts: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 5 * time.Second}, rs[0].Retry.Or(Retry{Attempts: 1, MaxBackoff: 5 * time.Second}))
+
+	parsed, err := ParseRetry("attempts=4, backoff=100ms,maxBackoff=2s")
+	assert.NoError(t, err)
+	assert.Equal(t, Retry{Attempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}, parsed)
+
+	_, err = ParseRetry("jitter=1")
+	assert.ErrorContains(t, err, "invalid retry 'jitter=1'")
+	_, err = ParseRetry("attempts=0")
+	assert.ErrorContains(t, err, "invalid retry attempts: must be at least 1")
+}
+
+func TestMatchNormalizesHost(t *testing.T) {
+	rs := RuleSet{{Domain: "Example.com"}}
+	rs[0].Headers.UserAgent = "ladder"
+	assert.Equal(t, "ladder", rs.Match("WWW.EXAMPLE.COM.", "/").Headers.UserAgent)
+}
+
+func TestMatchDomainPatterns(t *testing.T) {
+	rs := RuleSet{
+		{Domain: "~^news[0-9]+\\.example\\.(com|org)$", Paths: []string{"/regex"}},
+		{Domain: "~example"},
+		{Domain: "*.example.com"},
+		{Domain: "news-*.example.com"},
+		{Domain: "example.com"},
+		{Domain: "www.example.com"},
+		{Domains: []string{"ample.com"}},
+	}
+	match := func(host, path string) string {
+		return rs.Match(host, path).Domain
+	}
+	assert.Equal(t, "www.example.com", match("WWW.example.com", "/"))
+	assert.Equal(t, "example.com", match("news1.example.com", "/"))
+	assert.Equal(t, "example.com", match("example.com", "/"))
+	assert.Equal(t, "~^news[0-9]+\\.example\\.(com|org)$", match("news1.example.org", "/regex"))
+	assert.Equal(t, "~example", match("news1.example.org", "/"))
+	assert.Equal(t, "~example", match("notexample.com", "/"))
+	assert.Equal(t, "", match("sample.net", "/"))
+
+	globs := RuleSet{{Domain: "*.example.com"}, {Domain: "news-*.example.com"}, {Domain: "~.*"}}
+	assert.Equal(t, "news-*.example.com", globs.Match("news-eu.example.com", "/").Domain)
+	assert.Equal(t, "*.example.com", globs.Match("www.example.com", "/").Domain)
+	assert.Equal(t, "~.*", globs.Match("a.b.example.com", "/").Domain)
+	assert.Equal(t, "~.*", globs.Match("example.com", "/").Domain)
+
+	assert.True(t, Rule{Domains: []string{"*.example.org"}}.MatchDomain("www.example.org."))
+	assert.NoError(t, ValidateDomain("*.example.com"))
+	assert.ErrorContains(t, ValidateDomain("~(news"), "invalid domain regex '~(news'")
+	invalid := RuleSet{{Domain: "~(news"}}
+	assert.Equal(t, "", invalid.Match("(news", "/").Domain)
+
+	// the compiled domains are bounded
+	for i := 0; i <= maxDomainPatterns; i++ {
+		ValidateDomain(fmt.Sprintf("news%d.example.com", i))
+	}
+	assert.LessOrEqual(t, len(domainPatterns), maxDomainPatterns)
+}
+
+func TestRuleOverlaps(t *testing.T) {
+	overlaps := func(domain, other string) bool {
+		return Rule{Domain: domain}.overlaps(Rule{Domains: []string{"example.net", other}})
+	}
+	assert.True(t, overlaps("example.com", "www.example.com"))
+	assert.True(t, overlaps("www.example.com", "example.com"))
+	assert.False(t, overlaps("example.com", "example.org"))
+	assert.True(t, overlaps("*.example.com", "example.com"))
+	assert.True(t, overlaps("*.example.com", "news-*.example.com"))
+	assert.False(t, overlaps("*.example.com", "*.example.org"))
+	assert.True(t, overlaps("~example", "www.example.com"))
+	assert.False(t, overlaps("~^news", "example.com"))
+	assert.False(t, overlaps("~^news", "~^www"))
+}
+
+func TestMatchMergesRules(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- domains: [example.com, example.org]
+  blockScripts: [piano.io]
+  stripOverlays: true
+  headers:
+    user-agent: googlebot
+    referer: https://www.google.com/
+- domain: www.example.com
+  removeElements: [.paywall]
+  headers:
+    user-agent: bingbot
+- domain: "*.example.com"
+  priority: 10
+  headers:
+    referer: https://t.co/
+- domain: www.example.com
+  paths: [/news]
+  headers:
+    user-agent: facebookbot`)
+	require.NoError(t, err)
+
+	rule := rs.Match("www.example.com", "/news/article")
+	assert.Equal(t, "*.example.com", rule.Domain)
+	assert.Equal(t, 10, rule.Priority)
+	assert.Equal(t, []string{"piano.io"}, rule.BlockScripts)
+	assert.Equal(t, []string{".paywall"}, rule.RemoveElements)
+	assert.True(t, rule.StripOverlays)
+	assert.Equal(t, "https://t.co/", rule.Headers.Referer)
+	assert.Equal(t, "facebookbot", rule.Headers.UserAgent)
+
+	assert.Equal(t, "bingbot", rs.Match("www.example.com", "/").Headers.UserAgent)
+	assert.Equal(t, "googlebot", rs.Match("example.org", "/").Headers.UserAgent)
+
+	// merged rules are copies
+	rule.BlockScripts[0] = "changed"
+	assert.Equal(t, "piano.io", rs[0].BlockScripts[0])
+}
+
+func TestMatchUnsetsFields(t *testing.T) {
+	rs, err := loadRuleFromString(`
+- domains: [example.com, example.org]
+  googleCache: true
+  stripOverlays: true
+- domain: www.example.com
+  priority: 1
+  googleCache: false
+- domain: www.example.com
+  stripOverlays: false`)
+	require.NoError(t, err)
+
+	rule := rs.Match("www.example.com", "/")
+	assert.False(t, rule.GoogleCache)
+	assert.False(t, rule.StripOverlays)
+	assert.True(t, rs.Match("example.org", "/").GoogleCache)
+	// setting a field to false over a rule of the same priority conflicts with it
+	assert.Equal(t, []string{"stripOverlays"}, Conflicts(rs[0], rs[2]))
+}
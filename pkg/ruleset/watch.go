@@ -0,0 +1,208 @@
+package ruleset
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadDelay is the time a Watcher waits for the changes to the files of a ruleset to settle
+// before reloading it, so that saving several files, or a file in several writes, reloads once.
+var ReloadDelay = 250 * time.Millisecond
+
+// yamlFile matches the rule files of directories, see loadRulesFromLocalDir.
+var yamlFile = regexp.MustCompile(`\.ya?ml$`)
+
+// Watcher reloads a RuleSet when its local files change.
+type Watcher struct {
+	rulePaths string
+	validate  func(RuleSet) error
+	onLoad    func(RuleSet)
+
+	watcher *fsnotify.Watcher
+	// files are the rule files watched through the directory containing them, as editors
+	// often save files by replacing them.
+	files map[string]bool
+	// fileDirs are the directories of files.
+	fileDirs map[string]bool
+	// dirs are the rule directories watched along with their subdirectories.
+	dirs []string
+
+	mu    sync.Mutex
+	timer *time.Timer
+	done  chan struct{}
+}
+
+// Watch watches the local files and directories of rulePaths, see NewRuleset, and loads the
+// RuleSet again with LoadRuleset once they changed. The RuleSet is checked with validate, if
+// set, then passed to onLoad. RuleSets that fail to load or to validate are logged, and
+// onLoad isn't called, so that the previous RuleSet stays in use. Remote rulesets are
+// fetched again along with the local ones, but don't trigger reloads.
+func Watch(rulePaths string, validate func(RuleSet) error, onLoad func(RuleSet)) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		rulePaths: rulePaths,
+		validate:  validate,
+		onLoad:    onLoad,
+		watcher:   fw,
+		files:     map[string]bool{},
+		fileDirs:  map[string]bool{},
+		done:      make(chan struct{}),
+	}
+	for _, rulePath := range strings.Split(rulePaths, ";") {
+		rulePath = strings.TrimSpace(rulePath)
+		if rulePath == "" || isRemote(rulePath) {
+			continue
+		}
+		if err := w.add(rulePath); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// add watches the rule file or directory at path.
+func (w *Watcher) add(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		w.files[path] = true
+		w.fileDirs[filepath.Dir(path)] = true
+		return w.watcher.Add(filepath.Dir(path))
+	}
+	w.dirs = append(w.dirs, path)
+	return w.addDir(path)
+}
+
+// addDir watches the directory at path and its subdirectories.
+func (w *Watcher) addDir(path string) error {
+	return filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+// run schedules a reload on every change of the rule files, until w is closed.
+func (w *Watcher) run() {
+	for {
+		select {
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.relevant(e) {
+				w.schedule()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("failed to watch ruleset", "error", err)
+		}
+	}
+}
+
+// relevant reports whether the event e changes the rule files, watching the directories
+// created in the rule directories.
+func (w *Watcher) relevant(e fsnotify.Event) bool {
+	if e.Has(fsnotify.Chmod) && !e.Has(fsnotify.Write) {
+		return false
+	}
+	if w.files[e.Name] {
+		return true
+	}
+	// Kubernetes updates the files of ConfigMaps by replacing the ..data link they point through
+	if filepath.Base(e.Name) == "..data" && w.fileDirs[filepath.Dir(e.Name)] {
+		return true
+	}
+	for _, dir := range w.dirs {
+		if e.Name != dir && !strings.HasPrefix(e.Name, dir+string(filepath.Separator)) {
+			continue
+		}
+		if e.Has(fsnotify.Create) {
+			if info, err := os.Stat(e.Name); err == nil && info.IsDir() {
+				if err := w.addDir(e.Name); err != nil {
+					slog.Error("failed to watch ruleset", "path", e.Name, "error", err)
+				}
+				return true
+			}
+		}
+		// removed directories can't be told apart from files anymore
+		return yamlFile.MatchString(e.Name) || e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename)
+	}
+	return false
+}
+
+// schedule reloads the RuleSet once no change happened for ReloadDelay.
+func (w *Watcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(ReloadDelay, func() { reload(w.rulePaths, w.validate, w.onLoad) })
+}
+
+// reloading serializes reloads, so that a slow reload can't apply an older RuleSet.
+var reloading sync.Mutex
+
+// reload loads the RuleSet of rulePaths again and passes it to onLoad if it is valid.
+func reload(rulePaths string, validate func(RuleSet) error, onLoad func(RuleSet)) {
+	reloading.Lock()
+	defer reloading.Unlock()
+	rs, err := LoadRuleset(rulePaths)
+	if err == nil && validate != nil {
+		err = validate(rs)
+	}
+	if err != nil {
+		slog.Error("failed to reload ruleset, keeping the previous rules", "error", err)
+		return
+	}
+	onLoad(rs)
+	slog.Info("reloaded ruleset", "rules", rs.Count(), "domains", rs.DomainCount())
+}
+
+// Close stops watching the files of the RuleSet.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		return errors.New("ruleset watcher already closed")
+	default:
+	}
+	close(w.done)
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
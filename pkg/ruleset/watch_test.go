@@ -0,0 +1,86 @@
+package ruleset
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRulesetStrict(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "valid.yaml"), []byte(validYAML), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte(invalidYAML), 0644))
+
+	rs, err := NewRuleset(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rs.Count())
+
+	_, err = LoadRuleset(dir)
+	assert.ErrorContains(t, err, "invalid.yaml")
+}
+
+func TestWatch(t *testing.T) {
+	defer func(delay time.Duration) { ReloadDelay = delay }(ReloadDelay)
+	ReloadDelay = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ruleset.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(validYAML), 0644))
+	rulesDir := filepath.Join(dir, "rules")
+	require.NoError(t, os.Mkdir(rulesDir, 0755))
+
+	loaded := make(chan RuleSet, 10)
+	validate := func(rs RuleSet) error {
+		for _, rule := range rs {
+			if rule.Domain == "invalid.example" {
+				return errors.New("invalid rule")
+			}
+		}
+		return nil
+	}
+	w, err := Watch(file+"; "+rulesDir, validate, func(rs RuleSet) { loaded <- rs })
+	require.NoError(t, err)
+	defer w.Close()
+
+	// next returns the domains of the next ruleset loaded
+	next := func() []string {
+		select {
+		case rs := <-loaded:
+			return rs.Domains()
+		case <-time.After(5 * time.Second):
+			t.Fatal("ruleset not reloaded")
+			return nil
+		}
+	}
+	// files replaced by editors
+	tmp := filepath.Join(dir, "ruleset.yaml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte(validYAML+"\n- domain: example.org"), 0644))
+	require.NoError(t, os.Rename(tmp, file))
+	assert.Equal(t, []string{"example.com", "example.org"}, next())
+
+	// files created in new subdirectories
+	nested := filepath.Join(rulesDir, "news")
+	require.NoError(t, os.Mkdir(nested, 0755))
+	assert.Equal(t, []string{"example.com", "example.org"}, next())
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "news.yml"), []byte("- domain: example.net"), 0644))
+	assert.Equal(t, []string{"example.com", "example.org", "example.net"}, next())
+
+	// invalid and broken rulesets keep the previous one
+	require.NoError(t, os.WriteFile(filepath.Join(rulesDir, "invalid.yaml"), []byte("- domain: invalid.example"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rulesDir, "broken.yaml"), []byte(invalidYAML), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rulesDir, "notes.txt"), []byte("ignored"), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, loaded)
+
+	require.NoError(t, os.Remove(filepath.Join(rulesDir, "broken.yaml")))
+	require.NoError(t, os.Remove(filepath.Join(rulesDir, "invalid.yaml")))
+	assert.Equal(t, []string{"example.com", "example.org", "example.net"}, next())
+
+	require.NoError(t, w.Close())
+	assert.Error(t, w.Close())
+}
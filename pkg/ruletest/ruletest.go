@@ -0,0 +1,105 @@
+// Package ruletest checks the rules of a RuleSet against the live pages of their test URLs,
+// fetched through a ladder.Client the way the proxy serves them, so that ruleset maintainers
+// find out in CI which rules stopped working, eg: once a site changed its paywall.
+package ruletest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/ruleset"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Result is the outcome of the test of a page.
+type Result struct {
+	// Rule names the rule tested, by its domains.
+	Rule string
+	Test ruleset.RuleTest
+	// Failures lists the expectations the page didn't meet, empty if it passed.
+	Failures []string
+	// Strategy is the strategy that got the page, see ladder.Result.Strategy.
+	Strategy string
+	Duration time.Duration
+}
+
+// Passed reports whether the page met every expectation.
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Run fetches the test URLs of the rules of rules with client, concurrency at a time, and
+// returns the results in the order of the rules and of their tests. Only the rules matching
+// domain are tested if set.
+func Run(ctx context.Context, client *ladder.Client, rules ruleset.RuleSet, domain string, concurrency int) []Result {
+	var results []Result
+	for _, rule := range rules {
+		if domain != "" && !rule.MatchDomain(domain) {
+			continue
+		}
+		for _, test := range rule.TestUrls {
+			results = append(results, Result{Rule: strings.Join(rule.AllDomains(), ", "), Test: test})
+		}
+	}
+
+	concurrency = max(concurrency, 1)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *Result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			r.Failures, r.Strategy = check(ctx, client, r.Rule, r.Test)
+			r.Duration = time.Since(start)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// check fetches the page of test, expected to be served with the rule named rule, and returns
+// the expectations it didn't meet and the strategy that got it.
+func check(ctx context.Context, client *ladder.Client, rule string, test ruleset.RuleTest) ([]string, string) {
+	if _, err := url.ParseRequestURI(test.URL); err != nil {
+		return []string{"invalid url: " + err.Error()}, ""
+	}
+	result, err := client.Fetch(ctx, test.URL, ladder.FetchOptions{Format: ladder.FormatHTML})
+	if err != nil {
+		return []string{err.Error()}, ""
+	}
+
+	var failures []string
+	if matched := strings.Join(result.Rule.AllDomains(), ", "); matched != rule {
+		failures = append(failures, fmt.Sprintf("matched the rule for %q instead", matched))
+	}
+	if result.Response.StatusCode >= 400 {
+		failures = append(failures, "upstream answered "+result.Response.Status)
+	}
+	if result.Blockage != "" && result.Blockage != ladder.BlockageNone && result.Blockage != ladder.BlockageError {
+		failures = append(failures, "page shows a "+string(result.Blockage))
+	}
+	if test.MinLength > 0 && len(result.Content) < test.MinLength {
+		failures = append(failures, fmt.Sprintf("page is %d bytes, expected at least %d", len(result.Content), test.MinLength))
+	}
+	if test.Contains != "" && !strings.Contains(result.Content, test.Contains) {
+		failures = append(failures, fmt.Sprintf("page doesn't contain %q", test.Contains))
+	}
+	if test.Selector != "" {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(result.Content))
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else if doc.Find(test.Selector).Length() == 0 {
+			failures = append(failures, fmt.Sprintf("no element matches %q", test.Selector))
+		}
+	}
+	return failures, result.Strategy
+}
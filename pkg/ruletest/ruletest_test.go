@@ -0,0 +1,49 @@
+package ruletest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ladder/pkg/ladder"
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><article class="story"><p>The full story</p></article></body></html>`))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	rules := ruleset.RuleSet{
+		{Domain: u.Host, TestUrls: []ruleset.RuleTest{
+			{URL: upstream.URL + "/story", Selector: "article.story", Contains: "full story", MinLength: 20},
+			{URL: upstream.URL + "/story", Selector: ".paywall", Contains: "subscribe", MinLength: 1 << 20},
+			{URL: upstream.URL + "/gone"},
+		}},
+		{Domain: "example.com", TestUrls: []ruleset.RuleTest{{URL: "https://example.com/"}}},
+	}
+	results := Run(context.Background(), ladder.NewClient(rules), rules, u.Host, 2)
+	require.Len(t, results, 3)
+
+	assert.True(t, results[0].Passed(), results[0].Failures)
+	assert.Equal(t, u.Host, results[0].Rule)
+	assert.Equal(t, []string{
+		`page is 80 bytes, expected at least 1048576`,
+		`page doesn't contain "subscribe"`,
+		`no element matches ".paywall"`,
+	}, results[1].Failures)
+	assert.False(t, results[2].Passed())
+	assert.Contains(t, results[2].Failures[0], "404")
+}
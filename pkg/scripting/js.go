@@ -0,0 +1,172 @@
+package scripting
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// JSScript is a pair of JavaScript request and response scripts. It implements ladder.Modifier.
+type JSScript struct {
+	request  *goja.Program
+	response *goja.Program
+	limits   Limits
+}
+
+// JS compiles the JavaScript request and response scripts. Either may be empty.
+// Compiled scripts are cached, so identical rules share a single JSScript.
+func JS(request, response string) (*JSScript, error) {
+	key := scriptKey{engine: "js", request: request, response: response}
+	return cached(key, func() (*JSScript, error) {
+		s := &JSScript{limits: DefaultLimits}
+
+		var err error
+		if s.request, err = compileJS("request", request); err != nil {
+			return nil, err
+		}
+		if s.response, err = compileJS("response", response); err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// compileJS compiles source into a program, or returns nil for an empty source.
+func compileJS(name, source string) (*goja.Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, nil
+	}
+
+	program, err := goja.Compile(name, source, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile js %s script: %w", name, err)
+	}
+	return program, nil
+}
+
+// ModifyRequest runs the request script against req.
+func (s *JSScript) ModifyRequest(req *http.Request) error {
+	if s.request == nil {
+		return nil
+	}
+
+	request := map[string]any{
+		"method":  req.Method,
+		"url":     req.URL.String(),
+		"headers": headerValues(req.Header),
+	}
+	if err := s.run(req.Context(), s.request, "request", request); err != nil {
+		return fmt.Errorf("js request script failed: %w", err)
+	}
+
+	u, err := url.Parse(fmt.Sprint(request["url"]))
+	if err != nil {
+		return fmt.Errorf("js request script set an invalid URL: %w", err)
+	}
+	req.URL = u
+	req.Host = u.Host
+	req.Header = fromJSHeaders(request["headers"])
+	return nil
+}
+
+// ModifyResponse runs the response script against resp and body.
+func (s *JSScript) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	if s.response == nil {
+		return body, nil
+	}
+
+	ctx := context.Background()
+	response := map[string]any{
+		"status":  resp.StatusCode,
+		"headers": headerValues(resp.Header),
+		"body":    string(body),
+	}
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+		response["url"] = resp.Request.URL.String()
+	}
+	if err := s.run(ctx, s.response, "response", response); err != nil {
+		return nil, fmt.Errorf("js response script failed: %w", err)
+	}
+
+	switch status := response["status"].(type) {
+	case int:
+		resp.StatusCode = status
+	case int64:
+		resp.StatusCode = int(status)
+	case float64:
+		resp.StatusCode = int(status)
+	}
+	resp.Header = fromJSHeaders(response["headers"])
+	return []byte(fmt.Sprint(response["body"])), nil
+}
+
+// run executes program in a fresh runtime with obj exposed as the global name.
+// The runtime has no host access beyond log / console.log and is interrupted
+// once the timeout of the limits expires.
+func (s *JSScript) run(ctx context.Context, program *goja.Program, name string, obj map[string]any) error {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(s.limits.CallStackSize)
+
+	logFn := func(call goja.FunctionCall) goja.Value {
+		args := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			args = append(args, arg.String())
+		}
+		slog.Info(strings.Join(args, " "), "script", "js")
+		return goja.Undefined()
+	}
+	console := vm.NewObject()
+	if err := console.Set("log", logFn); err != nil {
+		return err
+	}
+	if err := vm.Set("console", console); err != nil {
+		return err
+	}
+	if err := vm.Set("log", logFn); err != nil {
+		return err
+	}
+	if err := vm.Set(name, obj); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.limits.Timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(ctx.Err())
+	})
+	defer stop()
+
+	_, err := vm.RunProgram(program)
+	return err
+}
+
+// fromJSHeaders converts the headers object of a script back into a http.Header.
+func fromJSHeaders(v any) http.Header {
+	h := http.Header{}
+	headers, ok := v.(map[string]any)
+	if !ok {
+		return h
+	}
+	for k, v := range headers {
+		switch v := v.(type) {
+		case nil:
+		case []string:
+			for _, value := range v {
+				h.Add(k, value)
+			}
+		case []any:
+			for _, value := range v {
+				h.Add(k, fmt.Sprint(value))
+			}
+		default:
+			h.Set(k, fmt.Sprint(v))
+		}
+	}
+	return h
+}
@@ -0,0 +1,325 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	// memoryCheckInterval is the minimum number of instructions between two
+	// measures of the memory held by a Lua script.
+	memoryCheckInterval = 1 << 12
+	// entrySize approximates the memory of a table entry besides its key and value.
+	entrySize = 16
+)
+
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// LuaScript is a pair of Lua request and response scripts. It implements ladder.Modifier.
+type LuaScript struct {
+	request  *lua.FunctionProto
+	response *lua.FunctionProto
+	limits   Limits
+}
+
+// Lua compiles the Lua request and response scripts. Either may be empty.
+// Compiled scripts are cached, so identical rules share a single LuaScript.
+func Lua(request, response string) (*LuaScript, error) {
+	key := scriptKey{engine: "lua", request: request, response: response}
+	return cached(key, func() (*LuaScript, error) {
+		s := &LuaScript{limits: DefaultLimits}
+
+		var err error
+		if s.request, err = compileLua("request", request); err != nil {
+			return nil, err
+		}
+		if s.response, err = compileLua("response", response); err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// compileLua compiles source into a function prototype, or returns nil for an empty source.
+func compileLua(name, source string) (*lua.FunctionProto, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lua %s script: %w", name, err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile lua %s script: %w", name, err)
+	}
+	return proto, nil
+}
+
+// ModifyRequest runs the request script against req.
+func (s *LuaScript) ModifyRequest(req *http.Request) error {
+	if s.request == nil {
+		return nil
+	}
+
+	L, cancel := s.newState(req.Context())
+	defer cancel()
+	defer L.Close()
+
+	request := L.NewTable()
+	L.SetField(request, "method", lua.LString(req.Method))
+	L.SetField(request, "url", lua.LString(req.URL.String()))
+	L.SetField(request, "headers", toLuaHeaders(L, req.Header))
+	L.SetGlobal("request", request)
+
+	if err := s.run(L, s.request); err != nil {
+		return fmt.Errorf("lua request script failed: %w", err)
+	}
+
+	u, err := url.Parse(lua.LVAsString(L.GetField(request, "url")))
+	if err != nil {
+		return fmt.Errorf("lua request script set an invalid URL: %w", err)
+	}
+	req.URL = u
+	req.Host = u.Host
+	req.Header = fromLuaHeaders(L.GetField(request, "headers"))
+	return nil
+}
+
+// ModifyResponse runs the response script against resp and body.
+func (s *LuaScript) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	if s.response == nil {
+		return body, nil
+	}
+
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+
+	L, cancel := s.newState(ctx)
+	defer cancel()
+	defer L.Close()
+
+	response := L.NewTable()
+	if resp.Request != nil {
+		L.SetField(response, "url", lua.LString(resp.Request.URL.String()))
+	}
+	L.SetField(response, "status", lua.LNumber(resp.StatusCode))
+	L.SetField(response, "headers", toLuaHeaders(L, resp.Header))
+	L.SetField(response, "body", lua.LString(body))
+	L.SetGlobal("response", response)
+
+	if err := s.run(L, s.response); err != nil {
+		return nil, fmt.Errorf("lua response script failed: %w", err)
+	}
+
+	if status, ok := L.GetField(response, "status").(lua.LNumber); ok {
+		resp.StatusCode = int(status)
+	}
+	resp.Header = fromLuaHeaders(L.GetField(response, "headers"))
+	return []byte(lua.LVAsString(L.GetField(response, "body"))), nil
+}
+
+// newState returns a sandboxed Lua state with only the base, table, string and math libraries,
+// which is interrupted once the timeout or the memory of the limits is exceeded.
+func (s *LuaScript) newState(ctx context.Context) (*lua.LState, context.CancelFunc) {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:  true,
+		CallStackSize: s.limits.CallStackSize,
+	})
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	// remove the base functions with host access
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	logFn := L.NewFunction(func(L *lua.LState) int {
+		args := make([]string, 0, L.GetTop())
+		for i := 1; i <= L.GetTop(); i++ {
+			args = append(args, L.ToStringMeta(L.Get(i)).String())
+		}
+		slog.Info(strings.Join(args, " "), "script", "lua")
+		return 0
+	})
+	L.SetGlobal("log", logFn)
+	L.SetGlobal("print", logFn)
+
+	// string.rep can allocate gigabytes in a single instruction, before the memory is checked
+	L.SetField(L.GetGlobal(lua.StringLibName), "rep", L.NewFunction(func(L *lua.LState) int {
+		str, n := L.CheckString(1), L.CheckInt(2)
+		if n > 0 && len(str) > s.limits.MaxMemory/n {
+			L.RaiseError("string.rep: %s", errMemoryLimit)
+		}
+		L.Push(lua.LString(strings.Repeat(str, max(n, 0))))
+		return 1
+	}))
+
+	ctx, cancel := context.WithTimeout(ctx, s.limits.Timeout)
+	L.SetContext(&memoryContext{Context: ctx, L: L, limits: s.limits})
+	return L, cancel
+}
+
+// closed is a closed channel, returned by memoryContext.Done once the memory limit is exceeded.
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// memoryContext bounds the memory held by a Lua state. gopher-lua polls Done
+// before every instruction, so the values reachable from the state are measured
+// every few polls, and the run is interrupted once they exceed the MaxMemory of
+// the limits. The polls between two measures grow with the measured size, which
+// keeps the cost of measuring proportional to the instructions run.
+type memoryContext struct {
+	context.Context
+	L      *lua.LState
+	limits Limits
+	next   int // polls left before the next measure
+	err    error
+}
+
+func (c *memoryContext) Done() <-chan struct{} {
+	if c.err == nil {
+		if c.next--; c.next <= 0 {
+			size := luaSize(c.L, c.limits)
+			if size > c.limits.MaxMemory {
+				c.err = errMemoryLimit
+			}
+			c.next = max(memoryCheckInterval, size/entrySize)
+		}
+	}
+	if c.err != nil {
+		return closed
+	}
+	return c.Context.Done()
+}
+
+func (c *memoryContext) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
+
+// luaSize estimates the size of the strings and tables reachable from the
+// globals and the call stack of L, stopping once it exceeds the MaxMemory of limits.
+func luaSize(L *lua.LState, limits Limits) int {
+	size := 0
+	seen := map[lua.LValue]bool{}
+	var walk func(lv lua.LValue)
+	walk = func(lv lua.LValue) {
+		if size > limits.MaxMemory {
+			return
+		}
+		switch v := lv.(type) {
+		case lua.LString:
+			size += len(v)
+		case *lua.LTable:
+			if seen[v] {
+				return
+			}
+			seen[v] = true
+			v.ForEach(func(key, value lua.LValue) {
+				size += entrySize
+				walk(key)
+				walk(value)
+			})
+			walk(v.Metatable)
+		case *lua.LFunction:
+			if seen[v] {
+				return
+			}
+			seen[v] = true
+			for _, uv := range v.Upvalues {
+				walk(uv.Value())
+			}
+		}
+	}
+
+	walk(L.G.Global)
+	// GetStack keeps returning the bottom frame past the top of the stack after
+	// tail calls, so the levels are bounded by the call stack size
+	for level := 0; level < limits.CallStackSize; level++ {
+		dbg, ok := L.GetStack(level)
+		if !ok {
+			break
+		}
+		for n := 1; ; n++ {
+			name, lv := L.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			walk(lv)
+		}
+	}
+	return size
+}
+
+// run executes proto in L.
+func (s *LuaScript) run(L *lua.LState, proto *lua.FunctionProto) error {
+	L.Push(L.NewFunctionFromProto(proto))
+	return L.PCall(0, lua.MultRet, nil)
+}
+
+// toLuaHeaders converts h into a Lua table.
+func toLuaHeaders(L *lua.LState, h http.Header) *lua.LTable {
+	t := L.NewTable()
+	for k, v := range headerValues(h) {
+		switch v := v.(type) {
+		case string:
+			t.RawSetString(k, lua.LString(v))
+		case []string:
+			values := L.NewTable()
+			for _, value := range v {
+				values.Append(lua.LString(value))
+			}
+			t.RawSetString(k, values)
+		}
+	}
+	return t
+}
+
+// fromLuaHeaders converts a Lua headers table back into a http.Header.
+func fromLuaHeaders(lv lua.LValue) http.Header {
+	h := http.Header{}
+	t, ok := lv.(*lua.LTable)
+	if !ok {
+		return h
+	}
+	t.ForEach(func(k, v lua.LValue) {
+		switch v := v.(type) {
+		case *lua.LTable:
+			v.ForEach(func(_, value lua.LValue) {
+				h.Add(k.String(), value.String())
+			})
+		case lua.LString, lua.LNumber:
+			h.Set(k.String(), v.String())
+		}
+	})
+	return h
+}
@@ -0,0 +1,111 @@
+// Package scripting runs short request and response modifying scripts embedded
+// in rulesets, for manipulations too complex for the declarative rule fields but
+// too small to justify a plugin.
+//
+// Scripts are written in Lua (gopher-lua) or JavaScript (goja), the latter
+// easing the port of existing paywall-bypass browser extension logic.
+// Every engine exposes the same API to scripts. Request scripts get a global
+// `request` object, response scripts a global `response` object:
+//
+//	request.method    -- HTTP method, read only
+//	request.url       -- URL sent upstream
+//	request.headers   -- headers sent upstream
+//
+//	response.url      -- URL that was fetched, read only
+//	response.status   -- status code
+//	response.headers  -- response headers
+//	response.body     -- response body
+//
+// Headers are keyed by their canonical name (e.g. "User-Agent"). A header with a
+// single value is a string, one with multiple values a list of strings. Assigning
+// nil (or null / undefined) removes a header. log(...), and console.log(...) in
+// JavaScript, write to the ladder log.
+//
+// Scripts are sandboxed: they have no access to the filesystem, network or
+// environment, and each run is bounded by Limits.
+package scripting
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits bounds the resources a script can use on each run.
+type Limits struct {
+	// Timeout is the maximum execution time of a single run.
+	Timeout time.Duration
+	// CallStackSize is the maximum call depth of a script.
+	CallStackSize int
+	// MaxMemory is the approximate maximum size in bytes of the strings and
+	// tables held by a Lua script.
+	MaxMemory int
+}
+
+// DefaultLimits is applied to every script compiled by this package.
+var DefaultLimits = Limits{
+	Timeout:       500 * time.Millisecond,
+	CallStackSize: 256,
+	MaxMemory:     64 << 20,
+}
+
+// maxScripts is the number of compiled scripts kept by cached.
+const maxScripts = 1024
+
+type scriptKey struct {
+	engine   string
+	request  string
+	response string
+}
+
+type scriptEntry struct {
+	key    scriptKey
+	script any
+}
+
+var (
+	scriptsMu  sync.Mutex
+	scripts    = map[scriptKey]*list.Element{}
+	scriptsLRU = list.New()
+)
+
+// cached returns the compiled script for key, compiling it with compile on first use.
+// Only the maxScripts most recently used scripts are kept.
+func cached[T any](key scriptKey, compile func() (T, error)) (T, error) {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	if e, ok := scripts[key]; ok {
+		scriptsLRU.MoveToFront(e)
+		return e.Value.(*scriptEntry).script.(T), nil
+	}
+
+	s, err := compile()
+	if err != nil {
+		return s, err
+	}
+	scripts[key] = scriptsLRU.PushFront(&scriptEntry{key: key, script: s})
+	if scriptsLRU.Len() > maxScripts {
+		e := scriptsLRU.Back()
+		scriptsLRU.Remove(e)
+		delete(scripts, e.Value.(*scriptEntry).key)
+	}
+	return s, nil
+}
+
+// headerValues converts a http.Header into the script representation:
+// a string for single values and a list of strings for multiple values.
+func headerValues(h http.Header) map[string]any {
+	values := make(map[string]any, len(h))
+	for k, v := range h {
+		switch len(v) {
+		case 0:
+		case 1:
+			values[k] = v[0]
+		default:
+			values[k] = append([]string{}, v...)
+		}
+	}
+	return values
+}
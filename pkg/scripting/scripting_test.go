@@ -0,0 +1,153 @@
+package scripting
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLua(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		s, err := Lua(`
+			request.url = request.url .. "?amp=1"
+			request.headers["Cookie"] = nil
+			request.headers["Accept-Language"] = { "en-US", "en" }
+		`, "")
+		assert.NoError(t, err)
+
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/article", nil)
+		req.Header.Set("Cookie", "session=1")
+		req.Header.Set("User-Agent", "ladder")
+		assert.NoError(t, s.ModifyRequest(req))
+
+		assert.Equal(t, "https://example.com/article?amp=1", req.URL.String())
+		assert.Empty(t, req.Header.Get("Cookie"))
+		assert.Equal(t, "ladder", req.Header.Get("User-Agent"))
+		assert.Equal(t, []string{"en-US", "en"}, req.Header.Values("Accept-Language"))
+	})
+
+	t.Run("response", func(t *testing.T) {
+		s, err := Lua("", `
+			response.body = string.gsub(response.body, "<div class=\"paywall\">.-</div>", "")
+			response.headers["Content-Security-Policy"] = nil
+			response.status = 200
+		`)
+		assert.NoError(t, err)
+
+		resp := &http.Response{
+			StatusCode: http.StatusPaymentRequired,
+			Header:     http.Header{"Content-Security-Policy": []string{"script-src 'none'"}},
+		}
+		body, err := s.ModifyResponse(resp, []byte(`<p>article</p><div class="paywall">subscribe</div>`))
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>article</p>", string(body))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Security-Policy"))
+	})
+
+	t.Run("sandbox", func(t *testing.T) {
+		s, err := Lua(`dofile("/etc/passwd")`, "")
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		assert.Error(t, s.ModifyRequest(req))
+
+		s, err = Lua(`os.exit(1)`, "")
+		assert.NoError(t, err)
+		assert.Error(t, s.ModifyRequest(req))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s, err := Lua(`while true do end`, "")
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		assert.Error(t, s.ModifyRequest(req))
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		for _, script := range []string{
+			`local s = string.rep("x", 2^30)`,
+			`local s = ("x"):rep(2^30)`,
+			`local t = {} for i = 1, 1e9 do t[i] = i end`,
+			`t = {} for i = 1, 1e9 do t[#t+1] = { i } end`,
+		} {
+			s, err := Lua(script, "")
+			assert.NoError(t, err)
+			s.limits.MaxMemory = 1 << 20
+			assert.ErrorContains(t, s.ModifyRequest(req), errMemoryLimit.Error(), script)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := Lua(`request.url = `, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestCached(t *testing.T) {
+	first, err := Lua(`log("first")`, "")
+	assert.NoError(t, err)
+	for i := 0; i < maxScripts; i++ {
+		_, err := Lua(fmt.Sprintf("log(%d)", i), "")
+		assert.NoError(t, err)
+	}
+
+	assert.LessOrEqual(t, len(scripts), maxScripts)
+	again, err := Lua(`log("first")`, "")
+	assert.NoError(t, err)
+	assert.NotSame(t, first, again)
+}
+
+func TestJS(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		s, err := JS(`
+			request.url = request.url + "?amp=1";
+			delete request.headers["Cookie"];
+			request.headers["Accept-Language"] = ["en-US", "en"];
+		`, "")
+		assert.NoError(t, err)
+
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/article", nil)
+		req.Header.Set("Cookie", "session=1")
+		req.Header.Set("User-Agent", "ladder")
+		assert.NoError(t, s.ModifyRequest(req))
+
+		assert.Equal(t, "https://example.com/article?amp=1", req.URL.String())
+		assert.Empty(t, req.Header.Get("Cookie"))
+		assert.Equal(t, "ladder", req.Header.Get("User-Agent"))
+		assert.Equal(t, []string{"en-US", "en"}, req.Header.Values("Accept-Language"))
+	})
+
+	t.Run("response", func(t *testing.T) {
+		s, err := JS("", `
+			response.body = response.body.replace(/<div class="paywall">.*?<\/div>/g, "");
+			response.headers["Content-Security-Policy"] = null;
+			response.status = 200;
+		`)
+		assert.NoError(t, err)
+
+		resp := &http.Response{
+			StatusCode: http.StatusPaymentRequired,
+			Header:     http.Header{"Content-Security-Policy": []string{"script-src 'none'"}},
+		}
+		body, err := s.ModifyResponse(resp, []byte(`<p>article</p><div class="paywall">subscribe</div>`))
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>article</p>", string(body))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Security-Policy"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s, err := JS(`while (true) {}`, "")
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		assert.Error(t, s.ModifyRequest(req))
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := JS(`request.url = `, "")
+		assert.Error(t, err)
+	})
+}
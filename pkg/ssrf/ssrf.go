@@ -0,0 +1,221 @@
+// Package ssrf protects ladder from server-side request forgery: it blocks
+// requests to non-HTTP(S) schemes and to loopback, private, link-local and
+// cloud metadata addresses, so that a public instance can't be used to probe
+// the internal network of its operator.
+package ssrf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ErrBlocked is wrapped by the errors of blocked destinations.
+var ErrBlocked = errors.New("destination blocked")
+
+// blockedPrefixes are the address ranges that are not reachable on the public internet.
+var blockedPrefixes = mustParsePrefixes(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, including cloud metadata at 169.254.169.254
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, including broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+	"fc00::/7",       // unique local, including cloud metadata at fd00:ec2::254
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+// Translation prefixes embed IPv4 addresses in IPv6 ones, which reach the IPv4 address through
+// NAT64 or 6to4 relays, so that the IPv4 address is checked too, see embeddedIPv4.
+var (
+	nat64Prefix      = netip.MustParsePrefix("64:ff9b::/96") // well-known NAT64 prefix
+	compatiblePrefix = netip.MustParsePrefix("::/96")        // deprecated IPv4-compatible addresses
+	sixToFourPrefix  = netip.MustParsePrefix("2002::/16")    // 6to4
+)
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		parsed[i] = netip.MustParsePrefix(p)
+	}
+	return parsed
+}
+
+// Guard checks destinations before they are fetched. The zero Guard blocks all
+// internal destinations, see NewGuard to allow some of them.
+type Guard struct {
+	allowPrefixes []netip.Prefix
+	allowHosts    []string
+	// self are the addresses of the host ladder runs on, see BlockSelf.
+	self []netip.Prefix
+}
+
+// NewGuard returns a Guard allowing the destinations in allow, which may be IP
+// addresses, CIDR ranges or host names, eg: 10.0.0.0/8 or intranet.example.com.
+func NewGuard(allow []string) (*Guard, error) {
+	g := &Guard{}
+	for _, entry := range allow {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed range '%s': %w", entry, err)
+			}
+			g.allowPrefixes = append(g.allowPrefixes, prefix.Masked())
+		default:
+			if addr, err := netip.ParseAddr(entry); err == nil {
+				g.allowPrefixes = append(g.allowPrefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			g.allowHosts = append(g.allowHosts, strings.ToLower(strings.TrimSuffix(entry, ".")))
+		}
+	}
+	return g, nil
+}
+
+// BlockSelf blocks the addresses of the host ladder runs on, which the internal ranges don't
+// cover when they are public, so that ladder can't be made to fetch itself or the other
+// services of its host: the addresses of its network interfaces, and addrs, eg: the public
+// address of a host behind NAT, as IP addresses or CIDR ranges. Allowed destinations stay allowed.
+func (g *Guard) BlockSelf(addrs []string) error {
+	interfaces, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+	for _, a := range interfaces {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			if addr, ok := netip.AddrFromSlice(ipNet.IP); ok {
+				g.self = append(g.self, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			}
+		}
+	}
+	for _, entry := range addrs {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("invalid address of the host '%s': %w", entry, err)
+		}
+		g.self = append(g.self, prefix)
+	}
+	return nil
+}
+
+// parsePrefix parses an IP address or a CIDR range.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// CheckURL checks the scheme and host of u. Host names that are not allowed
+// explicitly are checked once resolved, with CheckAddr.
+func (g *Guard) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme '%s' is not http or https", ErrBlocked, u.Scheme)
+	}
+	host := u.Hostname()
+	if g.AllowsHost(host) {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.CheckAddr(host, addr)
+	}
+	return nil
+}
+
+// AllowsHost reports whether host was allowed explicitly, by name or address.
+func (g *Guard) AllowsHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range g.allowHosts {
+		if host == allowed {
+			return true
+		}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.allowsAddr(addr.Unmap())
+	}
+	return false
+}
+
+// CheckAddr checks addr, the resolved address of host.
+func (g *Guard) CheckAddr(host string, addr netip.Addr) error {
+	addr = addr.Unmap()
+	addrs := []netip.Addr{addr}
+	if v4, ok := embeddedIPv4(addr); ok {
+		addrs = append(addrs, v4)
+	}
+	for _, a := range addrs {
+		if g.allowsAddr(a) {
+			return nil
+		}
+	}
+	for _, a := range addrs {
+		for _, prefix := range blockedPrefixes {
+			if prefix.Contains(a) {
+				return fmt.Errorf("%w: %s resolves to internal address %s", ErrBlocked, host, addr)
+			}
+		}
+		for _, prefix := range g.self {
+			if prefix.Contains(a) {
+				return fmt.Errorf("%w: %s resolves to address %s of ladder's host", ErrBlocked, host, addr)
+			}
+		}
+	}
+	return nil
+}
+
+// embeddedIPv4 returns the IPv4 address embedded in the IPv6 address addr by a translation
+// prefix, eg: 169.254.169.254 in 64:ff9b::a9fe:a9fe.
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case !addr.Is6():
+		return netip.Addr{}, false
+	case nat64Prefix.Contains(addr), compatiblePrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFourPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+// CheckIP checks ip, the resolved address of host, see CheckAddr.
+func (g *Guard) CheckIP(host string, ip net.IP) error {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return fmt.Errorf("%w: %s resolves to invalid address %s", ErrBlocked, host, ip)
+	}
+	return g.CheckAddr(host, addr)
+}
+
+func (g *Guard) allowsAddr(addr netip.Addr) bool {
+	for _, prefix := range g.allowPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package ssrf
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAddr(t *testing.T) {
+	g, err := NewGuard(nil)
+	require.NoError(t, err)
+
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00:ec2::254", "fe80::1", "::ffff:127.0.0.1",
+		// IPv4 addresses reached through NAT64, local-use translation, IPv4-compatible addresses and 6to4
+		"64:ff9b::a9fe:a9fe", "64:ff9b::7f00:1", "64:ff9b:1::a00:1", "::a9fe:a9fe", "2002:a9fe:a9fe::1", "2002:c0a8:101::"} {
+		assert.ErrorIs(t, g.CheckAddr("host", netip.MustParseAddr(addr)), ErrBlocked, addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "1.1.1.1", "2606:4700:4700::1111", "64:ff9b::5db8:d822", "2002:5db8:d822::1"} {
+		assert.NoError(t, g.CheckAddr("host", netip.MustParseAddr(addr)), addr)
+	}
+	assert.ErrorContains(t, g.CheckIP("metadata.internal", net.ParseIP("169.254.169.254")),
+		"destination blocked: metadata.internal resolves to internal address 169.254.169.254")
+	assert.ErrorContains(t, g.CheckIP("metadata.internal", net.ParseIP("64:ff9b::a9fe:a9fe")),
+		"destination blocked: metadata.internal resolves to internal address 64:ff9b::a9fe:a9fe")
+
+	// the allowed IPv4 addresses are allowed through NAT64 too
+	g, err = NewGuard([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.NoError(t, g.CheckAddr("host", netip.MustParseAddr("64:ff9b::a00:1")))
+}
+
+func TestBlockSelf(t *testing.T) {
+	g, err := NewGuard([]string{"127.0.0.1"})
+	require.NoError(t, err)
+	require.NoError(t, g.BlockSelf([]string{"203.0.113.7", "2001:db8::/32", ""}))
+
+	assert.ErrorContains(t, g.CheckAddr("ladder.example.com", netip.MustParseAddr("203.0.113.7")),
+		"destination blocked: ladder.example.com resolves to address 203.0.113.7 of ladder's host")
+	assert.ErrorIs(t, g.CheckAddr("host", netip.MustParseAddr("2001:db8::1")), ErrBlocked)
+	assert.NoError(t, g.CheckAddr("host", netip.MustParseAddr("203.0.113.8")))
+	// allowed addresses stay allowed, including those of the interfaces
+	assert.NoError(t, g.CheckAddr("localhost", netip.MustParseAddr("127.0.0.1")))
+
+	assert.ErrorContains(t, g.BlockSelf([]string{"ladder.example.com"}), "invalid address of the host 'ladder.example.com'")
+}
+
+func TestCheckURL(t *testing.T) {
+	g, err := NewGuard([]string{"10.0.0.0/8", "192.168.1.10", "Intranet.example.com"})
+	require.NoError(t, err)
+
+	check := func(rawURL string) error {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return g.CheckURL(u)
+	}
+	assert.NoError(t, check("https://www.example.com/article"))
+	assert.NoError(t, check("http://10.20.30.40/"))
+	assert.NoError(t, check("http://192.168.1.10:8080/"))
+	assert.NoError(t, check("http://intranet.example.com/"))
+	assert.ErrorIs(t, check("http://192.168.1.11/"), ErrBlocked)
+	assert.ErrorIs(t, check("http://[::1]:8080/"), ErrBlocked)
+	assert.ErrorIs(t, check("file:///etc/passwd"), ErrBlocked)
+	assert.ErrorIs(t, check("gopher://www.example.com/"), ErrBlocked)
+
+	assert.True(t, g.AllowsHost("intranet.example.com."))
+	assert.False(t, g.AllowsHost("www.example.com"))
+
+	_, err = NewGuard([]string{"10.0.0.0/33"})
+	assert.ErrorContains(t, err, "invalid allowed range")
+}
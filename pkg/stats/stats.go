@@ -0,0 +1,189 @@
+// Package stats aggregates the outcomes of proxied requests per domain over
+// sliding windows, so operators and rule maintainers can see which sites are
+// degrading: which ones fail, show a paywall or a bot challenge despite their rules.
+package stats
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome classifies the result of a proxied request.
+type Outcome string
+
+const (
+	// Success is a page served without detected paywall or challenge.
+	Success Outcome = "success"
+	// Paywall is a page that still shows paywall markup after the rules were applied.
+	Paywall Outcome = "paywall"
+	// Challenge is a bot challenge or captcha served instead of the page.
+	Challenge Outcome = "challenge"
+	// Error is a failed request or an upstream error status.
+	Error Outcome = "error"
+)
+
+// outcomes lists the outcomes in the order of their counters.
+var outcomes = []Outcome{Success, Paywall, Challenge, Error}
+
+var (
+	challengeRegex = regexp.MustCompile(`(?i)<title>\s*(just a moment|attention required|access denied|are you a robot)|cf-chl-|challenge-platform|g-recaptcha|h-captcha|px-captcha|captcha-delivery\.com|geo\.captcha`)
+	paywallRegex   = regexp.MustCompile(`(?i)class="[^"]*\b(paywall|piano-offer|tp-modal|subscriber-only|regwall)\b|subscribe to (continue|read)|this (article|content) is (only available|for subscribers)`)
+)
+
+// Classify returns the outcome of a response with status, header and body.
+// The body is only inspected for HTML responses.
+func Classify(status int, header http.Header, body string) Outcome {
+	if header.Get("Cf-Mitigated") == "challenge" {
+		return Challenge
+	}
+	html := strings.Contains(header.Get("Content-Type"), "html")
+	if html && (status == http.StatusForbidden || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) && challengeRegex.MatchString(body) {
+		return Challenge
+	}
+	if status >= 400 {
+		return Error
+	}
+	if html && paywallRegex.MatchString(body) {
+		return Paywall
+	}
+	return Success
+}
+
+const (
+	// bucketSize is the resolution of the sliding windows.
+	bucketSize = time.Minute
+	// Retention is the largest window outcomes are kept for.
+	Retention = 24 * time.Hour
+	// MaxDomains caps the number of domains tracked. The least recently seen domain is dropped for a new one.
+	MaxDomains = 10000
+)
+
+// bucket counts the outcomes of one bucketSize interval.
+type bucket struct {
+	start  int64
+	counts [4]int
+}
+
+// Recorder aggregates outcomes per domain. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	domains map[string][]bucket
+	now     func() time.Time
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{domains: map[string][]bucket{}, now: time.Now}
+}
+
+// Record counts outcome for domain.
+func (r *Recorder) Record(domain string, outcome Outcome) {
+	i := index(outcome)
+	if i < 0 || domain == "" {
+		return
+	}
+	start := r.now().Truncate(bucketSize).Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buckets, ok := r.domains[domain]
+	if !ok && len(r.domains) >= MaxDomains {
+		r.evict()
+	}
+	buckets = trim(buckets, start)
+	if n := len(buckets); n == 0 || buckets[n-1].start != start {
+		buckets = append(buckets, bucket{start: start})
+	}
+	buckets[len(buckets)-1].counts[i]++
+	r.domains[domain] = buckets
+}
+
+// evict drops the least recently seen domain.
+func (r *Recorder) evict() {
+	var oldest string
+	var oldestStart int64
+	for domain, buckets := range r.domains {
+		if last := buckets[len(buckets)-1].start; oldest == "" || last < oldestStart {
+			oldest, oldestStart = domain, last
+		}
+	}
+	delete(r.domains, oldest)
+}
+
+// trim drops the buckets of buckets older than Retention at now.
+func trim(buckets []bucket, now int64) []bucket {
+	cutoff := now - int64(Retention/time.Second)
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].start > cutoff })
+	if i == 0 {
+		return buckets
+	}
+	return append(buckets[:0], buckets[i:]...)
+}
+
+// index returns the counter index of outcome, or -1 for unknown outcomes.
+func index(outcome Outcome) int {
+	for i, o := range outcomes {
+		if o == outcome {
+			return i
+		}
+	}
+	return -1
+}
+
+// DomainStats are the outcomes of the requests to a domain within a window.
+type DomainStats struct {
+	Domain    string `json:"domain"`
+	Total     int    `json:"total"`
+	Success   int    `json:"success"`
+	Paywall   int    `json:"paywall"`
+	Challenge int    `json:"challenge"`
+	Error     int    `json:"error"`
+	// SuccessRate is the ratio of successful requests, from 0 to 1.
+	SuccessRate float64 `json:"successRate"`
+}
+
+// Snapshot returns the stats of the domains with requests within the last window,
+// at most Retention, sorted by ascending success rate and then by domain.
+func (r *Recorder) Snapshot(window time.Duration) []DomainStats {
+	if window > Retention {
+		window = Retention
+	}
+	// the current bucket counts as a whole
+	cutoff := r.now().Truncate(bucketSize).Add(-window).Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []DomainStats{}
+	for domain, buckets := range r.domains {
+		s := DomainStats{Domain: domain}
+		for _, b := range buckets {
+			if b.start <= cutoff {
+				continue
+			}
+			s.Success += b.counts[0]
+			s.Paywall += b.counts[1]
+			s.Challenge += b.counts[2]
+			s.Error += b.counts[3]
+		}
+		s.Total = s.Success + s.Paywall + s.Challenge + s.Error
+		if s.Total == 0 {
+			continue
+		}
+		s.SuccessRate = float64(s.Success) / float64(s.Total)
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SuccessRate != result[j].SuccessRate {
+			return result[i].SuccessRate < result[j].SuccessRate
+		}
+		return result[i].Domain < result[j].Domain
+	})
+	return result
+}
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   Outcome
+	}{
+		{"success", 200, html, "<p>article</p>", Success},
+		{"paywall", 200, html, `<div class="article paywall">Subscribe</div>`, Paywall},
+		{"paywall message", 200, html, "<p>Subscribe to continue reading.</p>", Paywall},
+		{"paywall in binary", 200, http.Header{"Content-Type": {"image/png"}}, "paywall", Success},
+		{"cloudflare", 403, html, "<title>Just a moment...</title>", Challenge},
+		{"captcha", 429, html, `<div class="g-recaptcha"></div>`, Challenge},
+		{"mitigated", 200, http.Header{"Cf-Mitigated": {"challenge"}}, "", Challenge},
+		{"forbidden", 403, html, "<p>Forbidden</p>", Error},
+		{"server error", 502, html, "", Error},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Classify(test.status, test.header, test.body))
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder()
+	r.now = func() time.Time { return now }
+
+	r.Record("old.example.com", Error)
+	now = now.Add(2 * time.Hour)
+	r.Record("a.example.com", Success)
+	r.Record("a.example.com", Paywall)
+	now = now.Add(30 * time.Minute)
+	r.Record("a.example.com", Success)
+	r.Record("a.example.com", Success)
+	r.Record("b.example.com", Challenge)
+	r.Record("b.example.com", "unknown")
+
+	assert.Equal(t, []DomainStats{
+		{Domain: "b.example.com", Total: 1, Challenge: 1},
+		{Domain: "a.example.com", Total: 2, Success: 2, SuccessRate: 1},
+	}, r.Snapshot(5*time.Minute))
+
+	assert.Equal(t, []DomainStats{
+		{Domain: "b.example.com", Total: 1, Challenge: 1},
+		{Domain: "a.example.com", Total: 4, Success: 3, Paywall: 1, SuccessRate: 0.75},
+	}, r.Snapshot(time.Hour))
+
+	assert.Len(t, r.Snapshot(48*time.Hour), 3)
+
+	// outcomes older than the retention are dropped
+	now = now.Add(Retention)
+	r.Record("a.example.com", Error)
+	require.Len(t, r.domains["a.example.com"], 1)
+}
+
+func TestRecorderMaxDomains(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder()
+	r.now = func() time.Time { return now }
+
+	r.Record("first.example.com", Success)
+	now = now.Add(time.Minute)
+	for i := 1; i < MaxDomains; i++ {
+		r.Record(strconv.Itoa(i)+".example.com", Success)
+	}
+	r.Record("new.example.com", Success)
+
+	assert.Len(t, r.domains, MaxDomains)
+	assert.NotContains(t, r.domains, "first.example.com")
+	assert.Contains(t, r.domains, "new.example.com")
+}
@@ -0,0 +1,99 @@
+// Package strategies registers named presets of the ways of fetching sites, eg: as Googlebot
+// or from archives, that rules and requests select by name instead of listing their settings.
+package strategies
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"ladder/pkg/ruleset"
+)
+
+// Preset adapts the rule of a site to fetch it a certain way. The rule is a copy owned by the caller.
+type Preset func(rule *ruleset.Rule)
+
+// The presets registered by default.
+const (
+	// Googlebot fetches sites with the headers of Googlebot.
+	Googlebot = "googlebot"
+	// Archive fetches the copies of pages archived by the Wayback Machine, or else by archive.today.
+	Archive = "archive"
+	// NoScript removes the scripts of pages and forbids running any.
+	NoScript = "noscript"
+	// CacheFirst fetches the copies of pages cached by Google or archives, and the page itself last.
+	CacheFirst = "cache-first"
+	// Stealth fetches sites with the TLS and HTTP/2 fingerprints, headers and cookies of Chrome.
+	Stealth = "stealth"
+)
+
+// stealthUserAgent is the User-Agent consistent with the fingerprints of Stealth.
+const stealthUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36"
+
+var (
+	mu      sync.RWMutex
+	presets = map[string]Preset{
+		Googlebot: func(rule *ruleset.Rule) {
+			rule.Headers.Masquerade = "googlebot"
+			rule.Headers.UserAgent, rule.Headers.Referer, rule.Headers.XForwardedFor = "", "", ""
+			rule.Headers.ClientHints = "none"
+		},
+		Archive: func(rule *ruleset.Rule) {
+			rule.Strategies = []string{"archive.org", "archive.is"}
+		},
+		NoScript: func(rule *ruleset.Rule) {
+			rule.RemoveElements = append(rule.RemoveElements, "script")
+			rule.Headers.CSP = "script-src 'none'"
+		},
+		CacheFirst: func(rule *ruleset.Rule) {
+			rule.Strategies = []string{"googlecache", "archive.org", "archive.is", "direct"}
+		},
+		Stealth: func(rule *ruleset.Rule) {
+			rule.Headers.Masquerade = ""
+			rule.Headers.UserAgent = stealthUserAgent
+			rule.Headers.XForwardedFor = "none"
+			rule.Headers.ClientHints = "auto"
+			rule.TLS.Fingerprint = "chrome"
+			rule.TLS.HTTP2 = "chrome"
+			rule.CookieJar = true
+		},
+	}
+)
+
+// Register registers preset under name, replacing the preset registered under it, if any.
+func Register(name string, preset Preset) {
+	mu.Lock()
+	defer mu.Unlock()
+	presets[strings.ToLower(name)] = preset
+}
+
+// Lookup returns the preset registered under name, which is case insensitive.
+func Lookup(name string) (Preset, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	preset, ok := presets[strings.ToLower(name)]
+	return preset, ok
+}
+
+// Names returns the sorted names of the registered presets.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply adapts rule with the preset registered under name.
+func Apply(name string, rule *ruleset.Rule) error {
+	preset, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown preset '%s', available: %s", name, strings.Join(Names(), ", "))
+	}
+	preset(rule)
+	return nil
+}
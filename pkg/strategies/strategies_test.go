@@ -0,0 +1,43 @@
+package strategies
+
+import (
+	"testing"
+
+	"ladder/pkg/ruleset"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	assert.Equal(t, []string{Archive, CacheFirst, Googlebot, NoScript, Stealth}, Names())
+
+	rule := ruleset.Rule{RemoveElements: []string{".banner"}}
+	rule.Headers.UserAgent = "curl/8.0"
+	require.NoError(t, Apply("Googlebot", &rule))
+	assert.Equal(t, "googlebot", rule.Headers.Masquerade)
+	assert.Empty(t, rule.Headers.UserAgent)
+
+	require.NoError(t, Apply(NoScript, &rule))
+	assert.Equal(t, []string{".banner", "script"}, rule.RemoveElements)
+
+	require.NoError(t, Apply(Stealth, &rule))
+	assert.Empty(t, rule.Headers.Masquerade)
+	assert.Equal(t, "chrome", rule.TLS.Fingerprint)
+
+	assert.ErrorContains(t, Apply("bing", &rule), "unknown preset 'bing', available: archive, cache-first")
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		mu.Lock()
+		delete(presets, "mobile")
+		mu.Unlock()
+	}()
+	Register("Mobile", func(rule *ruleset.Rule) { rule.Images.MaxWidth = 800 })
+
+	var rule ruleset.Rule
+	require.NoError(t, Apply("mobile", &rule))
+	assert.Equal(t, 800, rule.Images.MaxWidth)
+	assert.Contains(t, Names(), "mobile")
+}
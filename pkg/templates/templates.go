@@ -0,0 +1,62 @@
+// Package templates renders the HTML pages and components of ladder, such as
+// the landing page, error pages and the reader toolbar, with html/template.
+// Operators can rebrand them without recompiling by placing templates of the
+// same name in an override directory.
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Set is a set of named templates. It is safe for concurrent use.
+type Set struct {
+	tmpl *template.Template
+}
+
+// New parses the *.html templates of defaults, then those of dir, if set.
+// Templates of dir replace the default template of the same file name, and
+// can also redefine the blocks of the defaults with {{define}}.
+func New(defaults fs.FS, dir string) (*Set, error) {
+	tmpl, err := template.New("").ParseFS(defaults, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse default templates: %w", err)
+	}
+
+	if dir != "" {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			if tmpl, err = tmpl.ParseFS(os.DirFS(dir), "*.html"); err != nil {
+				return nil, fmt.Errorf("failed to parse templates of '%s': %w", dir, err)
+			}
+		}
+	}
+
+	return &Set{tmpl: tmpl}, nil
+}
+
+// Render executes the template name with data into w.
+func (s *Set) Render(w io.Writer, name string, data any) error {
+	t := s.tmpl.Lookup(name)
+	if t == nil {
+		return fmt.Errorf("template '%s' does not exist", name)
+	}
+	return t.Execute(w, data)
+}
+
+// RenderString executes the template name with data and returns the result.
+func (s *Set) RenderString(name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := s.Render(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,57 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaults = fstest.MapFS{
+	"page.html":  {Data: []byte(`<h1>{{template "brand" .}}</h1><p>{{.}}</p>`)},
+	"brand.html": {Data: []byte(`{{define "brand"}}Ladder{{end}}`)},
+	"error.html": {Data: []byte(`<p>Error: {{.}}</p>`)},
+}
+
+func TestDefaults(t *testing.T) {
+	s, err := New(defaults, "")
+	require.NoError(t, err)
+
+	out, err := s.RenderString("page.html", "<script>")
+	require.NoError(t, err)
+	assert.Equal(t, `<h1>Ladder</h1><p>&lt;script&gt;</p>`, out)
+
+	_, err = s.RenderString("missing.html", nil)
+	assert.ErrorContains(t, err, "does not exist")
+}
+
+func TestOverrides(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "error.html"), []byte(`<p>Oops: {{.}}</p>`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "brand.html"), []byte(`{{define "brand"}}My Ladder{{end}}`), 0o644))
+
+	s, err := New(defaults, dir)
+	require.NoError(t, err)
+
+	out, err := s.RenderString("error.html", "timeout")
+	require.NoError(t, err)
+	assert.Equal(t, `<p>Oops: timeout</p>`, out)
+
+	out, err = s.RenderString("page.html", "article")
+	require.NoError(t, err)
+	assert.Equal(t, `<h1>My Ladder</h1><p>article</p>`, out)
+}
+
+func TestInvalidOverride(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{.Unclosed`), 0o644))
+
+	_, err := New(defaults, dir)
+	assert.ErrorContains(t, err, "failed to parse templates")
+
+	_, err = New(defaults, filepath.Join(dir, "empty"))
+	assert.NoError(t, err)
+}
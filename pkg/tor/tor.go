@@ -0,0 +1,143 @@
+// Package tor routes upstream requests through a local Tor client, for origins
+// that block the addresses of a ladder instance, and switches to a new circuit,
+// and so a new exit node, when an origin blocks the current one.
+//
+// Requests go through the SOCKS port of Tor with a username naming the current
+// circuit generation. Tor isolates streams by SOCKS credentials, so the requests
+// after a rotation use new circuits, even without access to the control port.
+// When it is set, NEWNYM is signaled on the control port as well, so that Tor
+// drops its existing circuits.
+//
+//	t := tor.New(tor.DefaultSOCKS, "127.0.0.1:9051", "secret")
+//	client := &http.Client{Transport: &tor.Transport{Next: &http.Transport{Proxy: t.Proxy}, Tor: t}}
+package tor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSOCKS is the default address of the SOCKS port of Tor.
+const DefaultSOCKS = "127.0.0.1:9050"
+
+// DefaultRetries is the default number of new circuits tried after an origin blocks the exit node.
+const DefaultRetries = 1
+
+// Tor is a local Tor client. It is safe for concurrent use.
+type Tor struct {
+	// SOCKS is the address of the SOCKS port, eg: 127.0.0.1:9050.
+	SOCKS string
+	// Control is the address of the control port, eg: 127.0.0.1:9051. NEWNYM is not signaled if empty.
+	Control string
+	// ControlPassword authenticates to the control port, as set by HashedControlPassword in torrc.
+	ControlPassword string
+	// Retries is the number of new circuits Transport tries when an origin blocks the exit node.
+	Retries int
+
+	mu         sync.Mutex
+	generation int
+}
+
+// New returns a Tor client with its SOCKS port at socks and its control port at control, if set.
+func New(socks, control, password string) *Tor {
+	return &Tor{SOCKS: socks, Control: control, ControlPassword: password, Retries: DefaultRetries}
+}
+
+// Proxy returns the SOCKS proxy of the current circuit generation, which resolves host
+// names through Tor as well. It has the signature of http.Transport.Proxy.
+func (t *Tor) Proxy(*http.Request) (*url.URL, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &url.URL{
+		Scheme: "socks5h",
+		User:   url.UserPassword("ladder-"+strconv.Itoa(t.generation), "ladder"),
+		Host:   t.SOCKS,
+	}, nil
+}
+
+// Addrs returns the address of the SOCKS port.
+func (t *Tor) Addrs() []string {
+	return []string{t.SOCKS}
+}
+
+// NewCircuit switches the requests to come to new circuits, and signals NEWNYM on the
+// control port if set. Tor rate limits NEWNYM, so successive signals may not take effect.
+func (t *Tor) NewCircuit(ctx context.Context) error {
+	t.mu.Lock()
+	t.generation++
+	t.mu.Unlock()
+	if t.Control == "" {
+		return nil
+	}
+	return t.signal(ctx, "NEWNYM")
+}
+
+// signal sends signal on the control port.
+func (t *Tor) signal(ctx context.Context, signal string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.Control)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the Tor control port: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	password := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(t.ControlPassword)
+	for _, command := range []string{`AUTHENTICATE "` + password + `"`, "SIGNAL " + signal} {
+		if _, err := io.WriteString(conn, command+"\r\n"); err != nil {
+			return err
+		}
+		reply, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read the reply of the Tor control port: %w", err)
+		}
+		if reply = strings.TrimSpace(reply); !strings.HasPrefix(reply, "250") {
+			return fmt.Errorf("tor control port refused %s: %s", strings.Fields(command)[0], reply)
+		}
+	}
+	io.WriteString(conn, "QUIT\r\n")
+	return nil
+}
+
+// Transport is a http.RoundTripper that retries requests through new circuits of Tor
+// when origins block the exit node, answering with 403 Forbidden, 429 Too Many Requests
+// or a Cloudflare challenge.
+type Transport struct {
+	// Next sends the requests through Tor, see Tor.Proxy.
+	Next http.RoundTripper
+	Tor  *Tor
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		resp, err := t.Next.RoundTrip(req)
+		if err != nil || !blocked(resp) || retry >= t.Tor.Retries || (req.Body != nil && req.Body != http.NoBody) {
+			return resp, err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		slog.Info("site blocked the Tor exit node, switching to a new circuit", "host", req.URL.Host, "status", resp.Status)
+		if err := t.Tor.NewCircuit(req.Context()); err != nil {
+			slog.Warn("failed to signal NEWNYM to Tor", "error", err)
+		}
+	}
+}
+
+// blocked reports whether resp looks like an origin blocking the exit node.
+func blocked(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.Header.Get("Cf-Mitigated") == "challenge"
+}
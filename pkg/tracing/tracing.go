@@ -0,0 +1,91 @@
+// Package tracing traces the requests served by ladder, with a span for each step of their
+// processing, such as the modifiers applied and the upstream fetch, and exports the traces to
+// an OpenTelemetry collector over OTLP/HTTP, for debugging slow or failing requests.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Scope is the name of the instrumentation of ladder, and its default service name.
+const Scope = "ladder"
+
+// Config configures the export of traces.
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector,
+	// eg: http://localhost:4318/v1/traces.
+	Endpoint string
+	// Headers are sent along with the exported spans, eg: the API key of a tracing service.
+	Headers map[string]string
+	// ServiceName is the service.name of the traces, ladder if empty.
+	ServiceName string
+	// SampleRatio is the share of the traces started by ladder that are exported, from 0 to 1.
+	// Traces continued from a traceparent header follow its sampling decision.
+	SampleRatio float64
+}
+
+// New returns a TracerProvider exporting its spans to config.Endpoint in batches, until it is
+// shut down.
+func New(config Config) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(config.Endpoint),
+		otlptracehttp.WithHeaders(config.Headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = Scope
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	), nil
+}
+
+// Propagator reads the W3C Trace Context headers of requests, traceparent and tracestate.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// spanKey is the key of the span of a request in contexts.
+type spanKey struct{}
+
+// ContextKey is the key of the span of a request, for contexts storing values themselves, eg:
+// with fasthttp.RequestCtx.SetUserValue, whose spans trace.SpanFromContext doesn't see.
+var ContextKey any = spanKey{}
+
+// Context returns ctx with the span stored under ContextKey as its current span, unless it has
+// a current span already.
+func Context(ctx context.Context) context.Context {
+	if trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx
+	}
+	if span, ok := ctx.Value(ContextKey).(trace.Span); ok {
+		return trace.ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// Start starts the span name as a child of the current span of ctx, see Context, with the
+// provider of its parent. Untraced contexts get spans recording nothing.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = Context(ctx)
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(Scope).Start(ctx, name, opts...)
+}
+
+// RecordError marks span failed with err, if not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExport(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*collectortrace.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "abc123", r.Header.Get("X-Api-Key"))
+		body, _ := io.ReadAll(r.Body)
+		req := &collectortrace.ExportTraceServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	provider, err := New(Config{Endpoint: collector.URL + "/v1/traces", Headers: map[string]string{"X-Api-Key": "abc123"}, ServiceName: "ladder-test", SampleRatio: 1})
+	require.NoError(t, err)
+	ctx, root := provider.Tracer(Scope).Start(context.Background(), "GET /*")
+	_, span := Start(ctx, "fetch")
+	RecordError(span, errors.New("blocked"))
+	span.End()
+	root.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	require.Len(t, requests, 1)
+	resourceSpans := requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "ladder-test", resourceSpans.Resource.Attributes[0].Value.GetStringValue())
+	spans := resourceSpans.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "fetch", spans[0].Name)
+	assert.Equal(t, "blocked", spans[0].Status.Message)
+	assert.Equal(t, spans[1].SpanId, spans[0].ParentSpanId)
+}
+
+func TestStart(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder), sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0))))
+
+	// untraced contexts start spans recording nothing
+	_, span := Start(context.Background(), "fetch")
+	assert.False(t, span.IsRecording())
+
+	// requests continue the trace of their traceparent header, following its sampling decision
+	parent := Propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	_, root := provider.Tracer(Scope).Start(parent, "GET /*", trace.WithSpanKind(trace.SpanKindServer))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.SpanContext().TraceID().String())
+	assert.True(t, root.IsRecording())
+
+	// the span of the request is found in contexts storing it themselves
+	ctx := context.WithValue(context.Background(), ContextKey, root)
+	ctx, span = Start(ctx, "fetch")
+	_, child := Start(ctx, "GET", trace.WithSpanKind(trace.SpanKindClient))
+	RecordError(child, errors.New("blocked"))
+	RecordError(child, nil)
+	child.End()
+	span.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, root.SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "blocked", spans[0].Status().Description)
+
+	// traces started by ladder are sampled at the ratio
+	_, unsampled := provider.Tracer(Scope).Start(context.Background(), "GET /*")
+	assert.False(t, unsampled.IsRecording())
+	_, remote := provider.Tracer(Scope).Start(Propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}), "GET /*")
+	assert.False(t, remote.IsRecording())
+}
@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimit bounds the upstream requests in flight, overall and per host, so that a slow
+// origin can't hold every request, and so that small sites aren't flooded. It is safe for
+// concurrent use.
+type ConcurrencyLimit struct {
+	// total holds a token per request in flight, if bounded.
+	total   chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots holds a token per request in flight to a host, along with the number of requests
+// holding or waiting for one, so that idle hosts are dropped.
+type hostSlots struct {
+	tokens chan struct{}
+	users  int
+}
+
+// NewConcurrencyLimit returns a ConcurrencyLimit allowing total requests in flight, and perHost
+// requests to each host. 0 means no limit.
+func NewConcurrencyLimit(total, perHost int) *ConcurrencyLimit {
+	l := &ConcurrencyLimit{perHost: perHost, hosts: map[string]*hostSlots{}}
+	if total > 0 {
+		l.total = make(chan struct{}, total)
+	}
+	return l
+}
+
+// acquire waits until a request to host may be sent, and returns the func releasing its slots.
+// Requests wait for a slot of their host first, so that those to a busy host don't hold the
+// slots other hosts could use.
+func (l *ConcurrencyLimit) acquire(ctx context.Context, host string) (func(), error) {
+	var slots *hostSlots
+	if l.perHost > 0 {
+		l.mu.Lock()
+		slots = l.hosts[host]
+		if slots == nil {
+			slots = &hostSlots{tokens: make(chan struct{}, l.perHost)}
+			l.hosts[host] = slots
+		}
+		slots.users++
+		l.mu.Unlock()
+		select {
+		case slots.tokens <- struct{}{}:
+		case <-ctx.Done():
+			l.leave(host, slots)
+			return nil, ctx.Err()
+		}
+	}
+	if l.total != nil {
+		select {
+		case l.total <- struct{}{}:
+		case <-ctx.Done():
+			if slots != nil {
+				<-slots.tokens
+				l.leave(host, slots)
+			}
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.total != nil {
+				<-l.total
+			}
+			if slots != nil {
+				<-slots.tokens
+				l.leave(host, slots)
+			}
+		})
+	}, nil
+}
+
+// leave drops slots from the hosts once no request holds nor waits for them.
+func (l *ConcurrencyLimit) leave(host string, slots *hostSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slots.users--; slots.users == 0 {
+		delete(l.hosts, host)
+	}
+}
+
+// streamTypes are the content types of the responses streamed for as long as their connection
+// is open, such as server-sent events, which release their slots once their headers arrived.
+var streamTypes = []string{"text/event-stream", "multipart/x-mixed-replace"}
+
+// ConcurrencyTransport is a http.RoundTripper that waits for Limit to allow each request. A
+// request holds its slots until its response body is closed, as passthrough bodies are streamed
+// long after RoundTrip returned, or for MaxHold at most. Streams, see streamTypes, release their
+// slots once their headers arrived, so that long-lived connections don't hold the slots of
+// every other request.
+type ConcurrencyTransport struct {
+	Next  http.RoundTripper
+	Limit *ConcurrencyLimit
+	// MaxHold bounds the time a response body holds the slots of its request, eg: for large
+	// downloads. 0 holds them until the body is closed.
+	MaxHold time.Duration
+}
+
+func (t *ConcurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.Limit.acquire(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil || isStream(resp) {
+		release()
+		return resp, err
+	}
+	body := &releaseBody{ReadCloser: resp.Body, release: release}
+	if t.MaxHold > 0 {
+		body.timer = time.AfterFunc(t.MaxHold, release)
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// isStream reports whether resp is streamed for as long as its connection is open, see streamTypes.
+func isStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return slices.Contains(streamTypes, mediaType)
+}
+
+// releaseBody releases the slots of a request once closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	// timer releases the slots once the body held them for MaxHold, if set.
+	timer *time.Timer
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.release()
+	return err
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyTransport(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	limit := NewConcurrencyLimit(4, 2)
+	client := &http.Client{Transport: &ConcurrencyTransport{Next: http.DefaultTransport, Limit: limit}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	// all requests go to the same host, bounded by the limit per host
+	assert.EqualValues(t, 2, peak.Load())
+	assert.Empty(t, limit.hosts, "idle hosts are dropped")
+
+	// slots are held until the body is closed
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp2, err := client.Get(server.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	resp.Body.Close()
+	resp2.Body.Close()
+	assert.Empty(t, limit.hosts)
+	assert.Empty(t, limit.total)
+}
+
+// TestConcurrencyTransportStreams checks that long-lived responses don't hold the slots of the
+// other requests to their host.
+func TestConcurrencyTransportStreams(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		case "/download":
+			w.Header().Set("Content-Type", "video/mp4")
+		default:
+			w.Write([]byte("ok"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	limit := NewConcurrencyLimit(1, 1)
+	client := &http.Client{Transport: &ConcurrencyTransport{Next: http.DefaultTransport, Limit: limit, MaxHold: 50 * time.Millisecond}}
+	get := func(path string, timeout time.Duration) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		return client.Do(req)
+	}
+
+	// the event stream stays open, without its slot
+	events, err := get("/events", time.Second)
+	require.NoError(t, err)
+	defer events.Body.Close()
+	resp, err := get("/", time.Second)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// the download holds its slot for MaxHold
+	download, err := client.Get(server.URL + "/download")
+	require.NoError(t, err)
+	defer download.Body.Close()
+	_, err = get("/", 10*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	resp, err = get("/", time.Second)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ECHResolver is the DNS-over-HTTPS JSON endpoint used to look up the HTTPS
+// resource records that carry an origin's ECH config.
+var ECHResolver = "https://cloudflare-dns.com/dns-query"
+
+// echRetryTTL is the time the ECH configs an origin sends back when rejecting a stale one are cached.
+const echRetryTTL = 5 * time.Minute
+
+// errNoECHConfig is returned when an origin does not publish an ECH config.
+var errNoECHConfig = errors.New("no ECH config published")
+
+// echKey is the SvcParamKey of the "ech" parameter in HTTPS records (RFC 9460).
+const echKey = 5
+
+type echCacheEntry struct {
+	configList []byte
+	expires    time.Time
+}
+
+var (
+	echCacheMu sync.Mutex
+	echCache   = map[string]echCacheEntry{}
+)
+
+// dohResponse is the subset of the DNS JSON format (application/dns-json) that we need.
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// LookupECHConfig returns the ECHConfigList published in the HTTPS record of host.
+// Results, including the absence of a config, are cached for the TTL of the record.
+func LookupECHConfig(ctx context.Context, host string) ([]byte, error) {
+	echCacheMu.Lock()
+	entry, ok := echCache[host]
+	echCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if entry.configList == nil {
+			return nil, errNoECHConfig
+		}
+		return entry.configList, nil
+	}
+
+	configList, ttl, err := queryECHConfig(ctx, host)
+	if err != nil && !errors.Is(err, errNoECHConfig) {
+		return nil, err
+	}
+
+	cacheECHConfig(host, configList, ttl)
+	return configList, err
+}
+
+// cacheECHConfig caches configList as the ECHConfigList of host for ttl, nil caching the absence of a config.
+func cacheECHConfig(host string, configList []byte, ttl time.Duration) {
+	echCacheMu.Lock()
+	defer echCacheMu.Unlock()
+	echCache[host] = echCacheEntry{configList: configList, expires: time.Now().Add(ttl)}
+}
+
+// queryECHConfig asks the DoH resolver for the HTTPS records of host and extracts the ech parameter.
+func queryECHConfig(ctx context.Context, host string) ([]byte, time.Duration, error) {
+	q := url.Values{}
+	q.Set("name", host)
+	q.Set("type", "HTTPS")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ECHResolver+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query HTTPS record for '%s': %w", host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to query HTTPS record for '%s': %s", host, resp.Status)
+	}
+
+	var dr dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dr); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode HTTPS record for '%s': %w", host, err)
+	}
+
+	ttl := 5 * time.Minute
+	for _, answer := range dr.Answer {
+		// 65 is the HTTPS resource record type
+		if answer.Type != 65 {
+			continue
+		}
+		configList, err := parseECHConfig(answer.Data)
+		if err != nil {
+			continue
+		}
+		return configList, time.Duration(answer.TTL) * time.Second, nil
+	}
+
+	return nil, ttl, errNoECHConfig
+}
+
+// parseECHConfig extracts the ECHConfigList from the data of a HTTPS record.
+// Resolvers either return the presentation format (`1 . alpn=h2 ech=AEX...`)
+// or the generic RFC 3597 format (`\# 73 00 01 00 ...`), so both are supported.
+func parseECHConfig(data string) ([]byte, error) {
+	if strings.HasPrefix(data, `\#`) {
+		fields := strings.Fields(data)
+		if len(fields) < 2 {
+			return nil, errors.New("malformed generic HTTPS record")
+		}
+		rdata, err := hex.DecodeString(strings.Join(fields[2:], ""))
+		if err != nil {
+			return nil, err
+		}
+		return parseECHConfigWire(rdata)
+	}
+
+	for _, field := range strings.Fields(data) {
+		value, ok := strings.CutPrefix(field, "ech=")
+		if !ok {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(strings.Trim(value, `"`))
+	}
+	return nil, errNoECHConfig
+}
+
+// parseECHConfigWire extracts the ech SvcParam from HTTPS record rdata in wire format.
+func parseECHConfigWire(rdata []byte) ([]byte, error) {
+	errMalformed := errors.New("malformed HTTPS record")
+
+	// SvcPriority
+	if len(rdata) < 2 {
+		return nil, errMalformed
+	}
+	rdata = rdata[2:]
+
+	// TargetName, an uncompressed sequence of labels terminated by the root label
+	for {
+		if len(rdata) < 1 {
+			return nil, errMalformed
+		}
+		labelLen := int(rdata[0])
+		rdata = rdata[1:]
+		if labelLen == 0 {
+			break
+		}
+		if len(rdata) < labelLen {
+			return nil, errMalformed
+		}
+		rdata = rdata[labelLen:]
+	}
+
+	// SvcParams
+	for len(rdata) >= 4 {
+		key := binary.BigEndian.Uint16(rdata[0:2])
+		valueLen := int(binary.BigEndian.Uint16(rdata[2:4]))
+		rdata = rdata[4:]
+		if len(rdata) < valueLen {
+			return nil, errMalformed
+		}
+		if key == echKey {
+			return rdata[:valueLen], nil
+		}
+		rdata = rdata[valueLen:]
+	}
+	return nil, errNoECHConfig
+}
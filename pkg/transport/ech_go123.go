@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+)
+
+// echDialer returns a DialTLSContext func that negotiates Encrypted Client Hello
+// with origins publishing an ECH config, and falls back to regular TLS otherwise.
+// nextProtos restricts the advertised ALPN protocols, h2 and http/1.1 by default.
+func echDialer(dialer *dialer, nextProtos ...string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(nextProtos) == 0 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{
+			ServerName: host,
+			NextProtos: nextProtos,
+		}
+
+		configList, err := LookupECHConfig(ctx, host)
+		switch {
+		case err == nil:
+			config.MinVersion = tls.VersionTLS13
+			config.EncryptedClientHelloConfigList = configList
+		case errors.Is(err, errNoECHConfig):
+		default:
+			slog.Warn("ECH lookup failed, falling back to plain TLS", "host", host, "error", err)
+		}
+
+		conn, err := echHandshake(ctx, dialer, network, addr, config)
+		var rejection *tls.ECHRejectionError
+		if errors.As(err, &rejection) && len(rejection.RetryConfigList) > 0 {
+			// the config published in DNS is stale: retry once with the configs the origin sent back
+			cacheECHConfig(host, rejection.RetryConfigList, echRetryTTL)
+			config.EncryptedClientHelloConfigList = rejection.RetryConfigList
+			conn, err = echHandshake(ctx, dialer, network, addr, config)
+		}
+		return conn, err
+	}
+}
+
+// echHandshake dials addr and performs the TLS handshake with config.
+func echHandshake(ctx context.Context, dialer *dialer, network, addr string, config *tls.Config) (net.Conn, error) {
+	rawConn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, config)
+	handshakeCtx, cancel := dialer.handshakeContext(ctx)
+	defer cancel()
+	if err := conn.HandshakeContext(handshakeCtx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,16 @@
+//go:build !go1.23
+
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"net"
+)
+
+// echDialer is unavailable before go1.23, as crypto/tls lacks ECH support.
+// It logs a warning and keeps the default TLS dialing.
+func echDialer(_ *dialer, _ ...string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	slog.Warn("ECH requested, but ladder was built without ECH support (requires go1.23+)")
+	return nil
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseECHConfig(t *testing.T) {
+	echConfig := []byte{0x00, 0x04, 0xfe, 0x0d, 0x00, 0x00}
+
+	t.Run("presentation format", func(t *testing.T) {
+		data := "1 . alpn=h3,h2 ipv4hint=104.18.10.118 ech=" + base64.StdEncoding.EncodeToString(echConfig)
+		got, err := parseECHConfig(data)
+		assert.NoError(t, err)
+		assert.Equal(t, echConfig, got)
+	})
+
+	t.Run("generic format", func(t *testing.T) {
+		// priority 1, root target name, alpn=h2, ech=echConfig
+		data := `\# 19 00 01 00 00 01 00 03 02 68 32 00 05 00 06 00 04 fe 0d 00 00`
+		got, err := parseECHConfig(data)
+		assert.NoError(t, err)
+		assert.Equal(t, echConfig, got)
+	})
+
+	t.Run("no ech parameter", func(t *testing.T) {
+		_, err := parseECHConfig("1 . alpn=h3,h2")
+		assert.ErrorIs(t, err, errNoECHConfig)
+
+		_, err = parseECHConfig(`\# 10 00 01 00 00 01 00 03 02 68 32`)
+		assert.ErrorIs(t, err, errNoECHConfig)
+	})
+
+	t.Run("truncated record", func(t *testing.T) {
+		_, err := parseECHConfig(`\# 8 00 01 00 00 05 00 06 00`)
+		assert.Error(t, err)
+	})
+}
+
+func TestCacheECHConfig(t *testing.T) {
+	retryConfigs := []byte{0x00, 0x04, 0xfe, 0x0d, 0x00, 0x01}
+	cacheECHConfig("ech.invalid", retryConfigs, echRetryTTL)
+	got, err := LookupECHConfig(context.Background(), "ech.invalid")
+	assert.NoError(t, err)
+	assert.Equal(t, retryConfigs, got)
+
+	cacheECHConfig("noech.invalid", nil, echRetryTTL)
+	_, err = LookupECHConfig(context.Background(), "noech.invalid")
+	assert.ErrorIs(t, err, errNoECHConfig)
+}
@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// maxFastBodySize is the largest response body buffered by the fasthttp transport.
+// Larger responses are fetched again with net/http, which streams them.
+const maxFastBodySize = 8 << 20
+
+// fastTransport is a http.RoundTripper sending HTTP/1.1 requests with fasthttp,
+// which allocates less per request than net/http. Requests it can't serve, such
+// as proxied requests, streamed request bodies and oversized responses, are
+// sent with the net/http fallback instead.
+type fastTransport struct {
+	client   *fasthttp.Client
+	fallback *http.Transport
+}
+
+// newFastTransport builds a fastTransport for opts, falling back to fallback.
+func newFastTransport(opts Options, d *dialer, fallback *http.Transport) *fastTransport {
+	return &fastTransport{
+		client: &fasthttp.Client{
+			Dial: func(addr string) (net.Conn, error) {
+				return d.DialContext(context.Background(), "tcp", addr)
+			},
+			// fasthttp reads the whole response at once, so the timeout bounds the body as well
+			ReadTimeout:                   opts.Timeouts.ResponseHeader,
+			MaxIdleConnDuration:           90 * time.Second,
+			MaxResponseBodySize:           maxFastBodySize,
+			NoDefaultUserAgentHeader:      true,
+			DisableHeaderNamesNormalizing: true,
+			DisablePathNormalizing:        true,
+		},
+		fallback: fallback,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *fastTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.supports(req) {
+		return t.fallback.RoundTrip(req)
+	}
+
+	freq := fasthttp.AcquireRequest()
+	fresp := fasthttp.AcquireResponse()
+	release := func() {
+		fasthttp.ReleaseRequest(freq)
+		fasthttp.ReleaseResponse(fresp)
+	}
+
+	freq.SetRequestURI(req.URL.String())
+	freq.Header.SetMethod(req.Method)
+	for key, values := range req.Header {
+		for _, value := range values {
+			freq.Header.Add(key, value)
+		}
+	}
+	if req.Host != "" {
+		freq.Header.SetHost(req.Host)
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			release()
+			return nil, err
+		}
+		freq.SetBody(body)
+	}
+
+	// fasthttp doesn't take a context, so the request runs aside and is abandoned on cancellation
+	done := make(chan error, 1)
+	deadline, hasDeadline := req.Context().Deadline()
+	go func() {
+		if hasDeadline {
+			done <- t.client.DoDeadline(freq, fresp, deadline)
+		} else {
+			done <- t.client.Do(freq, fresp)
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-req.Context().Done():
+		go func() {
+			<-done
+			release()
+		}()
+		return nil, req.Context().Err()
+	}
+	defer release()
+
+	if errors.Is(err, fasthttp.ErrTimeout) && hasDeadline && !time.Now().Before(deadline) {
+		return nil, context.DeadlineExceeded
+	}
+	if errors.Is(err, fasthttp.ErrBodyTooLarge) && (req.Body == nil || req.Body == http.NoBody) {
+		return t.fallback.RoundTrip(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toResponse(req, fresp), nil
+}
+
+// supports reports whether req can be sent with fasthttp.
+func (t *fastTransport) supports(req *http.Request) bool {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return false
+	}
+	// fasthttp buffers request bodies, so those of unknown or large lengths are streamed with net/http
+	if req.Body != nil && req.Body != http.NoBody && (req.ContentLength <= 0 || req.ContentLength > maxFastBodySize) {
+		return false
+	}
+	// fasthttp reads whole responses, which event streams never end
+	if req.Header.Get("Accept") == "text/event-stream" {
+		return false
+	}
+	if proxy, err := t.fallback.Proxy(req); err != nil || proxy != nil {
+		return false
+	}
+	return true
+}
+
+// toResponse copies fresp into a http.Response to req.
+func toResponse(req *http.Request, fresp *fasthttp.Response) *http.Response {
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", fresp.StatusCode(), http.StatusText(fresp.StatusCode())),
+		StatusCode:    fresp.StatusCode(),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		ContentLength: int64(len(fresp.Body())),
+		Request:       req,
+	}
+	fresp.Header.VisitAll(func(key, value []byte) {
+		resp.Header.Add(string(key), string(value))
+	})
+	// the body has been dechunked, as net/http does
+	resp.Header.Del("Transfer-Encoding")
+	resp.Body = io.NopCloser(bytes.NewReader(bytes.Clone(fresp.Body())))
+	return resp
+}
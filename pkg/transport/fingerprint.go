@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// FingerprintCustom selects the ClientHello given in Options.ClientHello instead of a named preset.
+const FingerprintCustom = "custom"
+
+// fingerprints maps the preset names usable in rulesets to uTLS ClientHello parrots.
+var fingerprints = map[string]utls.ClientHelloID{
+	"chrome":      utls.HelloChrome_Auto,
+	"chrome-102":  utls.HelloChrome_102,
+	"chrome-106":  utls.HelloChrome_106_Shuffle,
+	"chrome-120":  utls.HelloChrome_120,
+	"firefox":     utls.HelloFirefox_Auto,
+	"firefox-105": utls.HelloFirefox_105,
+	"firefox-120": utls.HelloFirefox_120,
+	"safari":      utls.HelloSafari_Auto,
+	"safari-16":   utls.HelloSafari_16_0,
+	"ios":         utls.HelloIOS_Auto,
+	"ios-14":      utls.HelloIOS_14,
+	"edge":        utls.HelloEdge_Auto,
+	"edge-106":    utls.HelloEdge_106,
+	"android":     utls.HelloAndroid_11_OkHttp,
+	"randomized":  utls.HelloRandomized,
+}
+
+// Fingerprints returns the sorted names of all available TLS fingerprint presets.
+func Fingerprints() []string {
+	names := make([]string, 0, len(fingerprints))
+	for name := range fingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateFingerprint checks that the fingerprint preset exists, or for custom
+// fingerprints that the ClientHello spec can be parsed.
+func ValidateFingerprint(fingerprint, clientHello string) error {
+	if fingerprint == "" {
+		return nil
+	}
+	_, err := clientHelloSpec(fingerprint, clientHello)
+	return err
+}
+
+// clientHelloSpec builds a fresh ClientHelloSpec for a preset name or custom ClientHello.
+// Specs hold per-connection state and must not be shared between connections.
+func clientHelloSpec(fingerprint, clientHello string) (*utls.ClientHelloSpec, error) {
+	if strings.EqualFold(fingerprint, FingerprintCustom) {
+		return parseClientHello(clientHello)
+	}
+
+	id, ok := fingerprints[strings.ToLower(fingerprint)]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS fingerprint '%s', available: %s", fingerprint, strings.Join(Fingerprints(), ", "))
+	}
+	spec, err := utls.UTLSIdToSpec(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS fingerprint '%s': %w", fingerprint, err)
+	}
+	return &spec, nil
+}
+
+// parseClientHello parses a custom ClientHello spec. Two formats are accepted:
+// the JSON ClientHello format used by uTLS and tlsfingerprint.io, or the hex encoded
+// bytes of a captured ClientHello (with or without the TLS record header).
+func parseClientHello(clientHello string) (*utls.ClientHelloSpec, error) {
+	clientHello = strings.TrimSpace(clientHello)
+	if clientHello == "" {
+		return nil, fmt.Errorf("TLS fingerprint '%s' requires a clientHello spec", FingerprintCustom)
+	}
+
+	f := &utls.Fingerprinter{AllowBluntMimicry: true}
+
+	if strings.HasPrefix(clientHello, "{") {
+		spec, err := f.UnmarshalJSONClientHello([]byte(clientHello))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON clientHello spec: %w", err)
+		}
+		return spec, nil
+	}
+
+	raw, err := hex.DecodeString(strings.Join(strings.Fields(clientHello), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode hex clientHello spec: %w", err)
+	}
+	// prepend the TLS record header to bare handshake messages
+	if len(raw) > 0 && raw[0] == 0x01 {
+		raw = append([]byte{0x16, 0x03, 0x01, byte(len(raw) >> 8), byte(len(raw))}, raw...)
+	}
+	spec, err := f.FingerprintClientHello(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse raw clientHello spec: %w", err)
+	}
+	return spec, nil
+}
+
+// fingerprintDialer returns a DialTLSContext func that performs the TLS handshake
+// with the ClientHello of the selected fingerprint. net/http only speaks HTTP/2 over
+// *tls.Conn, so connections negotiating h2 fail, unless http1 restricts the advertised
+// ALPN protocols to http/1.1, at the cost of a ClientHello differing from the browser's.
+func fingerprintDialer(dialer *dialer, fingerprint, clientHello string, http1 bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		spec, err := clientHelloSpec(fingerprint, clientHello)
+		if err != nil {
+			return nil, err
+		}
+		if http1 {
+			for _, ext := range spec.Extensions {
+				if alpn, ok := ext.(*utls.ALPNExtension); ok {
+					alpn.AlpnProtocols = []string{"http/1.1"}
+				}
+			}
+		}
+
+		rawConn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		conn := utls.UClient(rawConn, &utls.Config{ServerName: host}, utls.HelloCustom)
+		if err := conn.ApplyPreset(spec); err != nil {
+			rawConn.Close()
+			return nil, fmt.Errorf("failed to apply TLS fingerprint '%s': %w", fingerprint, err)
+		}
+		handshakeCtx, cancel := dialer.handshakeContext(ctx)
+		defer cancel()
+		if err := conn.HandshakeContext(handshakeCtx); err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+		if conn.ConnectionState().NegotiatedProtocol == "h2" {
+			conn.Close()
+			return nil, fmt.Errorf("%s negotiated HTTP/2 on a HTTP/1.1 connection", addr)
+		}
+		return conn, nil
+	}
+}
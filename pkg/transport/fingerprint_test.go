@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateFingerprint(t *testing.T) {
+	for _, name := range Fingerprints() {
+		assert.NoError(t, ValidateFingerprint(name, ""), name)
+	}
+
+	assert.NoError(t, ValidateFingerprint("", ""))
+	assert.NoError(t, ValidateFingerprint("Chrome-120", ""))
+	assert.Error(t, ValidateFingerprint("netscape-4", ""))
+	// versions without a parrot of their own are unknown rather than aliased
+	assert.Error(t, ValidateFingerprint("firefox-121", ""))
+	assert.Error(t, ValidateFingerprint("safari-17", ""))
+	assert.Error(t, ValidateFingerprint(FingerprintCustom, ""))
+	assert.Error(t, ValidateFingerprint(FingerprintCustom, "not a client hello"))
+}
+
+func TestCustomClientHello(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := utls.UClient(client, &utls.Config{ServerName: "example.com"}, utls.HelloFirefox_120)
+	assert.NoError(t, conn.BuildHandshakeState())
+
+	raw := hex.EncodeToString(conn.HandshakeState.Hello.Raw)
+	assert.NoError(t, ValidateFingerprint(FingerprintCustom, raw))
+}
@@ -0,0 +1,398 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// maxIdleOrderedConns bounds the idle connections of ordered transports kept per origin.
+	maxIdleOrderedConns = 4
+	// orderedIdleTimeout is the time idle connections of ordered transports are kept.
+	orderedIdleTimeout = 90 * time.Second
+)
+
+// headerProfile is the order and casing of the HTTP/1.1 request headers of a browser,
+// which WAFs compare with the browser its User-Agent claims. net/http sends headers
+// sorted and in canonical case instead.
+type headerProfile struct {
+	// order lists the headers the browser sends, spelled as it does. The others are sent after them, sorted.
+	order []string
+	// acceptEncoding is sent unless the request sets an Accept-Encoding.
+	acceptEncoding string
+}
+
+var chromeHeaderProfile = headerProfile{
+	order: []string{
+		"Host", "Connection", "Cache-Control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+		"Upgrade-Insecure-Requests", "User-Agent", "Accept", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-User",
+		"Sec-Fetch-Dest", "Referer", "Accept-Encoding", "Accept-Language", "Cookie",
+	},
+	acceptEncoding: "gzip, deflate, br, zstd",
+}
+
+// headerProfiles maps the header order profiles usable in rulesets to the HTTP/1.1 headers of recent browser versions.
+var headerProfiles = map[string]headerProfile{
+	"chrome": chromeHeaderProfile,
+	"edge":   chromeHeaderProfile,
+	"firefox": {
+		order: []string{
+			"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Referer", "Connection", "Cookie",
+			"Upgrade-Insecure-Requests", "Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User", "Priority",
+		},
+		acceptEncoding: "gzip, deflate, br, zstd",
+	},
+	"safari": {
+		order: []string{
+			"Host", "Accept", "Sec-Fetch-Site", "Cookie", "Sec-Fetch-Dest", "Accept-Language", "Sec-Fetch-Mode",
+			"User-Agent", "Referer", "Accept-Encoding", "Connection",
+		},
+		acceptEncoding: "gzip, deflate, br",
+	},
+}
+
+// HeaderOrders returns the sorted names of all available header order profiles.
+func HeaderOrders() []string {
+	names := make([]string, 0, len(headerProfiles))
+	for name := range headerProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateHeaderOrder checks that the header order profile exists.
+func ValidateHeaderOrder(profile string) error {
+	if profile == "" {
+		return nil
+	}
+	if _, ok := headerProfiles[strings.ToLower(profile)]; !ok {
+		return fmt.Errorf("unknown header order '%s', available: %s", profile, strings.Join(HeaderOrders(), ", "))
+	}
+	return nil
+}
+
+// orderedTransport writes HTTP/1.1 requests itself, with the headers in the order and
+// casing of a browser. HTTPS connections use the TLS dialer of fallback if set, eg:
+// for fingerprints, or else crypto/tls restricted to http/1.1. Proxied requests are
+// sent with fallback.
+type orderedTransport struct {
+	profile  headerProfile
+	dialer   *dialer
+	timeouts Timeouts
+	fallback *http.Transport
+
+	mu   sync.Mutex
+	idle map[string][]*orderedConn
+}
+
+func newOrderedTransport(opts Options, dialer *dialer, fallback *http.Transport) http.RoundTripper {
+	return &orderedTransport{
+		profile:  headerProfiles[strings.ToLower(opts.HeaderOrder)],
+		dialer:   dialer,
+		timeouts: opts.Timeouts,
+		fallback: fallback,
+		idle:     map[string][]*orderedConn{},
+	}
+}
+
+func (t *orderedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return t.fallback.RoundTrip(req)
+	}
+	if proxy, err := t.fallback.Proxy(req); err != nil || proxy != nil {
+		return t.fallback.RoundTrip(req)
+	}
+
+	key := req.URL.Scheme + "://" + canonicalAddr(req)
+	replayable := req.Body == nil || req.Body == http.NoBody
+	// idle connections may have been closed by the origin in the meantime, requests without a body are retried on a new one
+	for conn := t.getIdle(key); conn != nil; conn = t.getIdle(key) {
+		resp, err := conn.roundTrip(req, t.profile, t.timeouts.ResponseHeader)
+		if err == nil || !replayable || conn.gotResponse || req.Context().Err() != nil {
+			return resp, err
+		}
+	}
+	conn, err := t.dial(req.Context(), req.URL.Scheme, canonicalAddr(req))
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	conn.release = func(c *orderedConn) { t.putIdle(key, c) }
+	return conn.roundTrip(req, t.profile, t.timeouts.ResponseHeader)
+}
+
+// dial opens a connection to addr, over TLS for https.
+func (t *orderedTransport) dial(ctx context.Context, scheme, addr string) (*orderedConn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case scheme == "http":
+		conn, err = t.dialer.DialContext(ctx, "tcp", addr)
+	case t.fallback.DialTLSContext != nil:
+		conn, err = t.fallback.DialTLSContext(ctx, "tcp", addr)
+	default:
+		conn, err = t.dialTLS(ctx, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &orderedConn{conn: conn, br: bufio.NewReader(conn), bw: bufio.NewWriter(conn)}, nil
+}
+
+// dialTLS opens a TLS connection to addr negotiating http/1.1.
+func (t *orderedTransport) dialTLS(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, &tls.Config{ServerName: host, NextProtos: []string{"http/1.1"}})
+	handshakeCtx, cancel := t.dialer.handshakeContext(ctx)
+	defer cancel()
+	if err := conn.HandshakeContext(handshakeCtx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *orderedTransport) getIdle(key string) *orderedConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conns := t.idle[key]; len(conns) > 0; conns = t.idle[key] {
+		conn := conns[len(conns)-1]
+		t.idle[key] = conns[:len(conns)-1]
+		if time.Since(conn.idleSince) < orderedIdleTimeout {
+			return conn
+		}
+		conn.conn.Close()
+	}
+	return nil
+}
+
+func (t *orderedTransport) putIdle(key string, conn *orderedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.idle[key]) >= maxIdleOrderedConns {
+		conn.conn.Close()
+		return
+	}
+	conn.idleSince = time.Now()
+	t.idle[key] = append(t.idle[key], conn)
+}
+
+// orderedConn is a HTTP/1.1 client connection.
+type orderedConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	release func(*orderedConn)
+
+	// gotResponse is set once the current request got a response.
+	gotResponse bool
+	idleSince   time.Time
+}
+
+// roundTrip writes req with the headers ordered by profile and returns its response once
+// its headers are read, within responseHeaderTimeout if positive. The connection is
+// released once the body of the response is read, or closed when the body is closed before.
+func (c *orderedConn) roundTrip(req *http.Request, profile headerProfile, responseHeaderTimeout time.Duration) (*http.Response, error) {
+	c.gotResponse = false
+	// the connection is closed to abort blocked reads and writes once the request is canceled
+	stop := context.AfterFunc(req.Context(), func() { c.conn.Close() })
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		c.conn.Close()
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	if err := c.writeRequest(req, profile); err != nil {
+		return fail(err)
+	}
+	if responseHeaderTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(responseHeaderTimeout))
+	}
+	var resp *http.Response
+	for {
+		var err error
+		resp, err = http.ReadResponse(c.br, req)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = fmt.Errorf("timeout awaiting response headers after %s", responseHeaderTimeout)
+			}
+			return fail(err)
+		}
+		// informational responses precede the final one
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+	}
+	c.gotResponse = true
+	c.conn.SetReadDeadline(time.Time{})
+
+	body := &orderedBody{
+		ReadCloser: resp.Body,
+		conn:       c,
+		stop:       stop,
+		reusable:   !resp.Close && !req.Close && resp.StatusCode != http.StatusSwitchingProtocols,
+	}
+	if resp.Body == http.NoBody {
+		body.finish(true)
+		return resp, nil
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// writeRequest writes the request line and headers of req, in the order and casing of
+// profile, followed by its body, which is closed once written.
+func (c *orderedConn) writeRequest(req *http.Request, profile headerProfile) error {
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	// header maps the lowercase names of the headers to their values, names to their spelling
+	header := map[string][]string{}
+	names := map[string]string{}
+	set := func(name string, values ...string) {
+		header[strings.ToLower(name)] = values
+		names[strings.ToLower(name)] = name
+	}
+	for name, values := range req.Header {
+		switch strings.ToLower(name) {
+		case "host", "connection", "content-length", "transfer-encoding", "keep-alive", "proxy-connection", "upgrade":
+			continue
+		}
+		set(name, values...)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	set("Host", host)
+	if req.Close {
+		set("Connection", "close")
+	} else {
+		set("Connection", "keep-alive")
+	}
+	if _, ok := header["accept-encoding"]; !ok && profile.acceptEncoding != "" {
+		set("Accept-Encoding", profile.acceptEncoding)
+	}
+	chunked := false
+	switch {
+	case hasBody && req.ContentLength > 0:
+		set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	case hasBody:
+		chunked = true
+		set("Transfer-Encoding", "chunked")
+	case req.Method == http.MethodPost || req.Method == http.MethodPut || req.Method == http.MethodPatch:
+		set("Content-Length", "0")
+	}
+
+	order := make([]string, len(profile.order))
+	for i, name := range profile.order {
+		order[i] = strings.ToLower(name)
+		if _, ok := header[order[i]]; ok {
+			names[order[i]] = name
+		}
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	fmt.Fprintf(c.bw, "%s %s HTTP/1.1\r\n", method, req.URL.RequestURI())
+	for _, name := range orderedHeaders(header, order) {
+		if !httpguts.ValidHeaderFieldName(names[name]) {
+			return fmt.Errorf("invalid header field name '%s'", names[name])
+		}
+		for _, value := range header[name] {
+			if !httpguts.ValidHeaderFieldValue(value) {
+				return fmt.Errorf("invalid value of header field '%s'", names[name])
+			}
+			c.bw.WriteString(names[name] + ": " + value + "\r\n")
+		}
+	}
+	c.bw.WriteString("\r\n")
+
+	if hasBody {
+		if chunked {
+			w := httputil.NewChunkedWriter(c.bw)
+			if _, err := io.Copy(w, req.Body); err != nil {
+				return err
+			}
+			w.Close()
+			c.bw.WriteString("\r\n")
+		} else if _, err := io.Copy(c.bw, req.Body); err != nil {
+			return err
+		}
+	}
+	return c.bw.Flush()
+}
+
+// orderedBody is the body of a response of an orderedConn, which releases the connection
+// once read to the end and drops it when closed before.
+type orderedBody struct {
+	io.ReadCloser
+	conn     *orderedConn
+	stop     func() bool
+	reusable bool
+	finished bool
+}
+
+func (b *orderedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.finish(err == io.EOF)
+	}
+	return n, err
+}
+
+func (b *orderedBody) Close() error {
+	if b.finished {
+		return b.ReadCloser.Close()
+	}
+	// the rest of the body is not drained, the connection is closed beforehand
+	b.finish(false)
+	b.ReadCloser.Close()
+	return nil
+}
+
+// finish releases the connection, or closes it unless reuse is set and the response allows it.
+func (b *orderedBody) finish(reuse bool) {
+	if b.finished {
+		return
+	}
+	b.finished = true
+	b.stop()
+	if reuse && b.reusable {
+		b.conn.release(b.conn)
+		return
+	}
+	b.conn.conn.Close()
+}
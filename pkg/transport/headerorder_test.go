@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedTransportHeaders(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// the raw request heads, which net/http servers would canonicalize
+	heads := make(chan []string, 2)
+	accepted := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					var head []string
+					for {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line = strings.TrimRight(line, "\r\n"); line == "" {
+							break
+						}
+						head = append(head, line)
+					}
+					heads <- head
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+
+	client := &http.Client{Transport: New(Options{HeaderOrder: "chrome"})}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/page?q=1", nil)
+		req.Header.Set("Referer", "https://www.google.com/")
+		req.Header.Set("X-Forwarded-For", "66.249.66.1")
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
+		req.Header.Set("Accept", "text/html")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "ok", string(body))
+
+		assert.Equal(t, []string{
+			"GET /page?q=1 HTTP/1.1",
+			"Host: " + ln.Addr().String(),
+			"Connection: keep-alive",
+			"sec-ch-ua-mobile: ?0",
+			"User-Agent: Mozilla/5.0",
+			"Accept: text/html",
+			"Referer: https://www.google.com/",
+			"Accept-Encoding: gzip, deflate, br, zstd",
+			"X-Forwarded-For: 66.249.66.1",
+		}, <-heads)
+	}
+	// the connection was reused
+	assert.Len(t, accepted, 1)
+}
+
+func TestOrderedTransportBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(r.Method + " " + strings.Join(r.TransferEncoding, ",") + " " + string(body)))
+		}
+	}))
+	defer server.Close()
+
+	rt := New(Options{HeaderOrder: "firefox", Timeouts: Timeouts{ResponseHeader: 100 * time.Millisecond}})
+	require.IsType(t, &orderedTransport{}, rt)
+	client := &http.Client{Transport: rt}
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("a=1"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "POST  a=1", string(body))
+
+	resp, err = client.Post(server.URL, "text/plain", io.MultiReader(strings.NewReader("a="), strings.NewReader("2")))
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "POST chunked a=2", string(body))
+
+	resp, err = client.Head(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = client.Get(server.URL + "/slow")
+	assert.ErrorContains(t, err, "timeout awaiting response headers after 100ms")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/slow", nil)
+	_, err = (&http.Client{Transport: New(Options{HeaderOrder: "safari"})}).Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestValidateHeaderOrder(t *testing.T) {
+	assert.NoError(t, ValidateHeaderOrder(""))
+	assert.NoError(t, ValidateHeaderOrder("Edge"))
+	assert.ErrorContains(t, ValidateHeaderOrder("opera"), "available: chrome, edge, firefox, safari")
+	assert.IsType(t, &http2Transport{}, New(Options{HeaderOrder: "chrome", HTTP2: "chrome"}))
+}
@@ -0,0 +1,647 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// maxIdleHTTP2Conns bounds the idle HTTP/2 connections kept per origin.
+	maxIdleHTTP2Conns = 2
+	// http2IdleTimeout is the time idle HTTP/2 connections are kept.
+	http2IdleTimeout = 90 * time.Second
+)
+
+// http2Profile is the HTTP/2 fingerprint of a browser: the SETTINGS and WINDOW_UPDATE
+// frames opening its connections, the priority of its requests and the order of their
+// headers, as hashed by HTTP/2 fingerprinting such as Akamai's.
+type http2Profile struct {
+	settings     []http2.Setting
+	windowUpdate uint32
+	priority     http2.PriorityParam
+	// pseudoOrder is the order of the pseudo-headers, eg: m,a,s,p for :method, :authority, :scheme and :path.
+	pseudoOrder string
+	// headerOrder is the order of the headers the browser sends, the others are sent after them, sorted.
+	headerOrder []string
+	// acceptEncoding is sent unless the request sets an Accept-Encoding.
+	acceptEncoding string
+	// fingerprint is the TLS fingerprint preset of the browser, used unless Options.Fingerprint is set.
+	fingerprint string
+}
+
+// http2Profiles maps the profile names usable in rulesets to the HTTP/2 fingerprints of recent browser versions.
+var http2Profiles = map[string]http2Profile{
+	"chrome": {
+		settings: []http2.Setting{
+			{ID: http2.SettingHeaderTableSize, Val: 65536},
+			{ID: http2.SettingEnablePush, Val: 0},
+			{ID: http2.SettingInitialWindowSize, Val: 6291456},
+			{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+		},
+		windowUpdate: 15663105,
+		priority:     http2.PriorityParam{Exclusive: true, Weight: 255},
+		pseudoOrder:  "masp",
+		headerOrder: []string{
+			"cache-control", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "upgrade-insecure-requests",
+			"user-agent", "accept", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest",
+			"referer", "accept-encoding", "accept-language", "cookie", "priority",
+		},
+		acceptEncoding: "gzip, deflate, br, zstd",
+		fingerprint:    "chrome",
+	},
+	"firefox": {
+		settings: []http2.Setting{
+			{ID: http2.SettingHeaderTableSize, Val: 65536},
+			{ID: http2.SettingInitialWindowSize, Val: 131072},
+			{ID: http2.SettingMaxFrameSize, Val: 16384},
+		},
+		windowUpdate: 12517377,
+		priority:     http2.PriorityParam{Weight: 41},
+		pseudoOrder:  "mpas",
+		headerOrder: []string{
+			"user-agent", "accept", "accept-language", "accept-encoding", "referer", "cookie",
+			"upgrade-insecure-requests", "sec-fetch-dest", "sec-fetch-mode", "sec-fetch-site", "sec-fetch-user",
+			"priority", "te",
+		},
+		acceptEncoding: "gzip, deflate, br, zstd",
+		fingerprint:    "firefox",
+	},
+	"safari": {
+		settings: []http2.Setting{
+			{ID: http2.SettingEnablePush, Val: 0},
+			{ID: http2.SettingInitialWindowSize, Val: 4194304},
+			{ID: http2.SettingMaxConcurrentStreams, Val: 100},
+		},
+		windowUpdate: 10485760,
+		priority:     http2.PriorityParam{Weight: 254},
+		pseudoOrder:  "mspa",
+		headerOrder: []string{
+			"accept", "sec-fetch-site", "cookie", "sec-fetch-dest", "accept-language", "sec-fetch-mode",
+			"user-agent", "referer", "accept-encoding", "priority",
+		},
+		acceptEncoding: "gzip, deflate, br",
+		fingerprint:    "safari",
+	},
+}
+
+// HTTP2Profiles returns the sorted names of all available HTTP/2 fingerprint profiles.
+func HTTP2Profiles() []string {
+	names := make([]string, 0, len(http2Profiles))
+	for name := range http2Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateHTTP2 checks that the HTTP/2 fingerprint profile exists.
+func ValidateHTTP2(profile string) error {
+	if profile == "" {
+		return nil
+	}
+	if _, ok := http2Profiles[strings.ToLower(profile)]; !ok {
+		return fmt.Errorf("unknown HTTP/2 profile '%s', available: %s", profile, strings.Join(HTTP2Profiles(), ", "))
+	}
+	return nil
+}
+
+// fingerprintProfile returns the HTTP/2 profile of the browser of a TLS fingerprint,
+// chrome for the fingerprints of Chromium based browsers and of other clients.
+func fingerprintProfile(fingerprint string) string {
+	browser, _, _ := strings.Cut(strings.ToLower(fingerprint), "-")
+	switch browser {
+	case "firefox":
+		return "firefox"
+	case "safari", "ios":
+		return "safari"
+	default:
+		return "chrome"
+	}
+}
+
+// http2Transport sends HTTPS requests over HTTP/2 with the fingerprint of a browser,
+// which net/http can't do as it only speaks HTTP/2 over crypto/tls connections and
+// sends its own SETTINGS and header order. Each connection carries one request at a
+// time. Proxied requests and origins that don't negotiate h2 are sent with fallback
+// instead, and requests with a body with http1, which only advertises http/1.1.
+type http2Transport struct {
+	profile     http2Profile
+	fingerprint string
+	clientHello string
+	dialer      *dialer
+	timeouts    Timeouts
+	fallback    *http.Transport
+	http1       *http.Transport
+
+	mu          sync.Mutex
+	idle        map[string][]*http2Conn
+	http1Origin map[string]bool
+}
+
+func newHTTP2Transport(opts Options, dialer *dialer, fallback *http.Transport) http.RoundTripper {
+	name := opts.HTTP2
+	if name == "" {
+		name = fingerprintProfile(opts.Fingerprint)
+	}
+	profile := http2Profiles[strings.ToLower(name)]
+	fingerprint := opts.Fingerprint
+	if fingerprint == "" {
+		fingerprint = profile.fingerprint
+	}
+	fallback.DialTLSContext = fingerprintDialer(dialer, fingerprint, opts.ClientHello, false)
+	http1 := fallback.Clone()
+	http1.DialTLSContext = fingerprintDialer(dialer, fingerprint, opts.ClientHello, true)
+	return &http2Transport{
+		profile:     profile,
+		fingerprint: fingerprint,
+		clientHello: opts.ClientHello,
+		dialer:      dialer,
+		timeouts:    opts.Timeouts,
+		fallback:    fallback,
+		http1:       http1,
+		idle:        map[string][]*http2Conn{},
+		http1Origin: map[string]bool{},
+	}
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := canonicalAddr(req)
+	if req.URL.Scheme != "https" || t.usesHTTP1(addr) {
+		return t.fallback.RoundTrip(req)
+	}
+	if proxy, err := t.fallback.Proxy(req); err != nil || proxy != nil {
+		return t.fallback.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return t.http1.RoundTrip(req)
+	}
+
+	// idle connections may have been closed by the origin in the meantime, the request is retried on a new one
+	for conn := t.getIdle(addr); conn != nil; conn = t.getIdle(addr) {
+		resp, err := conn.roundTrip(req, t.timeouts.ResponseHeader)
+		if err == nil || !conn.reused || conn.gotResponse {
+			return resp, err
+		}
+	}
+	conn, err := t.dial(req.Context(), addr)
+	if errors.Is(err, errNoHTTP2) {
+		return t.fallback.RoundTrip(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conn.roundTrip(req, t.timeouts.ResponseHeader)
+}
+
+// errNoHTTP2 is returned when dialing origins that don't negotiate h2.
+var errNoHTTP2 = errors.New("origin does not support HTTP/2")
+
+// dial opens a HTTP/2 connection to addr with the TLS and HTTP/2 fingerprints of the transport.
+func (t *http2Transport) dial(ctx context.Context, addr string) (*http2Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := clientHelloSpec(t.fingerprint, t.clientHello)
+	if err != nil {
+		return nil, err
+	}
+	rawConn, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := utls.UClient(rawConn, &utls.Config{ServerName: host}, utls.HelloCustom)
+	if err := tlsConn.ApplyPreset(spec); err != nil {
+		rawConn.Close()
+		return nil, fmt.Errorf("failed to apply TLS fingerprint '%s': %w", t.fingerprint, err)
+	}
+	handshakeCtx, cancel := t.dialer.handshakeContext(ctx)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		tlsConn.Close()
+		t.mu.Lock()
+		t.http1Origin[addr] = true
+		t.mu.Unlock()
+		return nil, errNoHTTP2
+	}
+	return newHTTP2Conn(tlsConn, t.profile, func(c *http2Conn) { t.putIdle(addr, c) })
+}
+
+func (t *http2Transport) usesHTTP1(addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.http1Origin[addr]
+}
+
+func (t *http2Transport) getIdle(addr string) *http2Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conns := t.idle[addr]; len(conns) > 0; conns = t.idle[addr] {
+		conn := conns[len(conns)-1]
+		t.idle[addr] = conns[:len(conns)-1]
+		if time.Since(conn.idleSince) < http2IdleTimeout {
+			conn.reused = true
+			return conn
+		}
+		conn.close()
+	}
+	return nil
+}
+
+func (t *http2Transport) putIdle(addr string, conn *http2Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.idle[addr]) >= maxIdleHTTP2Conns {
+		conn.close()
+		return
+	}
+	conn.idleSince = time.Now()
+	t.idle[addr] = append(t.idle[addr], conn)
+}
+
+// canonicalAddr returns the host:port of the URL of req.
+func canonicalAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// http2Conn is a HTTP/2 client connection carrying one request at a time.
+type http2Conn struct {
+	conn    net.Conn
+	bw      *bufio.Writer
+	framer  *http2.Framer
+	henc    *hpack.Encoder
+	hbuf    bytes.Buffer
+	profile http2Profile
+	release func(*http2Conn)
+
+	nextStreamID uint32
+	maxFrameSize uint32
+	goAway       bool
+	// reused is set on connections taken from the idle pool, gotResponse once the current request got a response.
+	reused      bool
+	gotResponse bool
+	idleSince   time.Time
+}
+
+// newHTTP2Conn starts a HTTP/2 connection over conn, sending the preface, SETTINGS and
+// WINDOW_UPDATE of profile. release is called with the connection once a request is done with it.
+func newHTTP2Conn(conn net.Conn, profile http2Profile, release func(*http2Conn)) (*http2Conn, error) {
+	c := &http2Conn{
+		conn:         conn,
+		bw:           bufio.NewWriter(conn),
+		profile:      profile,
+		release:      release,
+		nextStreamID: 1,
+		maxFrameSize: 16384,
+	}
+	c.framer = http2.NewFramer(c.bw, bufio.NewReader(conn))
+	c.henc = hpack.NewEncoder(&c.hbuf)
+	tableSize := uint32(4096)
+	for _, s := range profile.settings {
+		switch s.ID {
+		case http2.SettingHeaderTableSize:
+			tableSize = s.Val
+		case http2.SettingMaxHeaderListSize:
+			c.framer.MaxHeaderListSize = s.Val
+		}
+	}
+	c.framer.ReadMetaHeaders = hpack.NewDecoder(tableSize, nil)
+
+	c.bw.WriteString(http2.ClientPreface)
+	c.framer.WriteSettings(profile.settings...)
+	if profile.windowUpdate > 0 {
+		c.framer.WriteWindowUpdate(0, profile.windowUpdate)
+	}
+	if err := c.bw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *http2Conn) close() {
+	c.conn.Close()
+}
+
+// roundTrip sends req on a new stream and returns its response once its headers are
+// received, within responseHeaderTimeout if positive. The connection is released
+// once the body of the response is read or closed.
+func (c *http2Conn) roundTrip(req *http.Request, responseHeaderTimeout time.Duration) (*http.Response, error) {
+	c.gotResponse = false
+	streamID := c.nextStreamID
+	c.nextStreamID += 2
+
+	// the connection is closed to abort blocked reads and writes once the request is canceled
+	stop := context.AfterFunc(req.Context(), c.close)
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		c.close()
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	if err := c.writeHeaders(req, streamID); err != nil {
+		return fail(err)
+	}
+	if responseHeaderTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(responseHeaderTimeout))
+	}
+	for {
+		f, err := c.readFrame(streamID)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = fmt.Errorf("timeout awaiting response headers after %s", responseHeaderTimeout)
+			}
+			return fail(err)
+		}
+		headers, ok := f.(*http2.MetaHeadersFrame)
+		if !ok {
+			continue
+		}
+		status, err := strconv.Atoi(headers.PseudoValue("status"))
+		if err != nil {
+			return fail(fmt.Errorf("invalid HTTP/2 response status '%s'", headers.PseudoValue("status")))
+		}
+		if status < 200 {
+			// informational responses precede the final one
+			continue
+		}
+		c.gotResponse = true
+		c.conn.SetReadDeadline(time.Time{})
+
+		resp := &http.Response{
+			Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+			StatusCode:    status,
+			Proto:         "HTTP/2.0",
+			ProtoMajor:    2,
+			Header:        http.Header{},
+			ContentLength: -1,
+			Request:       req,
+		}
+		for _, field := range headers.RegularFields() {
+			resp.Header.Add(http.CanonicalHeaderKey(field.Name), field.Value)
+		}
+		if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+			resp.ContentLength = n
+		}
+		body := &http2Body{conn: c, ctx: req.Context(), streamID: streamID, stop: stop}
+		if headers.StreamEnded() {
+			body.done = true
+			body.finish()
+		}
+		resp.Body = body
+		return resp, nil
+	}
+}
+
+// writeHeaders writes the HEADERS of req on the stream, in the order of the profile of the connection.
+func (c *http2Conn) writeHeaders(req *http.Request, streamID uint32) error {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	pseudo := map[byte]hpack.HeaderField{
+		'm': {Name: ":method", Value: req.Method},
+		'a': {Name: ":authority", Value: host},
+		's': {Name: ":scheme", Value: req.URL.Scheme},
+		'p': {Name: ":path", Value: req.URL.RequestURI()},
+	}
+	c.hbuf.Reset()
+	for i := 0; i < len(c.profile.pseudoOrder); i++ {
+		c.henc.WriteField(pseudo[c.profile.pseudoOrder[i]])
+	}
+
+	header := map[string][]string{}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		switch name {
+		case "connection", "host", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+			continue
+		}
+		header[name] = values
+	}
+	if _, ok := header["accept-encoding"]; !ok && c.profile.acceptEncoding != "" {
+		header["accept-encoding"] = []string{c.profile.acceptEncoding}
+	}
+	for _, name := range orderedHeaders(header, c.profile.headerOrder) {
+		for _, value := range header[name] {
+			c.henc.WriteField(hpack.HeaderField{Name: name, Value: value, Sensitive: name == "cookie" || name == "authorization"})
+		}
+	}
+
+	block := c.hbuf.Bytes()
+	first := true
+	for len(block) > 0 || first {
+		chunk := block
+		if len(chunk) > int(c.maxFrameSize) {
+			chunk = chunk[:c.maxFrameSize]
+		}
+		block = block[len(chunk):]
+		var err error
+		if first {
+			err = c.framer.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      streamID,
+				BlockFragment: chunk,
+				EndStream:     true,
+				EndHeaders:    len(block) == 0,
+				Priority:      c.profile.priority,
+			})
+			first = false
+		} else {
+			err = c.framer.WriteContinuation(streamID, len(block) == 0, chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return c.bw.Flush()
+}
+
+// orderedHeaders returns the names of header in order, followed by the other names, sorted.
+func orderedHeaders(header map[string][]string, order []string) []string {
+	names := make([]string, 0, len(header))
+	ranked := map[string]bool{}
+	for _, name := range order {
+		if _, ok := header[name]; ok {
+			names = append(names, name)
+			ranked[name] = true
+		}
+	}
+	rest := make([]string, 0, len(header)-len(names))
+	for name := range header {
+		if !ranked[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// readFrame reads the next frame of the stream, handling the frames of the connection
+// and ignoring those of other streams, which belong to canceled requests.
+func (c *http2Conn) readFrame(streamID uint32) (http2.Frame, error) {
+	for {
+		f, err := c.framer.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			f.ForeachSetting(func(s http2.Setting) error {
+				switch s.ID {
+				case http2.SettingMaxFrameSize:
+					c.maxFrameSize = s.Val
+				case http2.SettingHeaderTableSize:
+					c.henc.SetMaxDynamicTableSizeLimit(s.Val)
+				}
+				return nil
+			})
+			c.framer.WriteSettingsAck()
+			if err := c.bw.Flush(); err != nil {
+				return nil, err
+			}
+		case *http2.PingFrame:
+			if f.IsAck() {
+				continue
+			}
+			c.framer.WritePing(true, f.Data)
+			if err := c.bw.Flush(); err != nil {
+				return nil, err
+			}
+		case *http2.GoAwayFrame:
+			c.goAway = true
+			if f.LastStreamID < streamID {
+				return nil, fmt.Errorf("HTTP/2 connection closed by the origin: %s", f.ErrCode)
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == streamID {
+				return nil, fmt.Errorf("HTTP/2 stream reset by the origin: %s", f.ErrCode)
+			}
+		case *http2.DataFrame:
+			if f.StreamID == streamID {
+				return f, nil
+			}
+			// the data of other streams counts towards the window of the connection all the same
+			if n := f.Length; n > 0 {
+				c.framer.WriteWindowUpdate(0, n)
+			}
+		case *http2.MetaHeadersFrame:
+			if f.StreamID == streamID {
+				return f, nil
+			}
+		}
+	}
+}
+
+// http2Body is the body of a HTTP/2 response. The connection is released once it is read
+// to the end, or closed when the body is closed before.
+type http2Body struct {
+	conn     *http2Conn
+	ctx      context.Context
+	streamID uint32
+	stop     func() bool
+	buf      []byte
+	done     bool
+	err      error
+	closed   bool
+}
+
+func (b *http2Body) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.done {
+			return 0, io.EOF
+		}
+		f, err := b.conn.readFrame(b.streamID)
+		if err != nil {
+			b.stop()
+			b.conn.close()
+			b.err = err
+			if ctxErr := b.ctx.Err(); ctxErr != nil {
+				b.err = ctxErr
+			}
+			continue
+		}
+		switch f := f.(type) {
+		case *http2.DataFrame:
+			b.buf = append(b.buf[:0], f.Data()...)
+			if f.StreamEnded() {
+				b.done = true
+			} else if f.Length > 0 {
+				b.conn.framer.WriteWindowUpdate(b.streamID, f.Length)
+			}
+			if f.Length > 0 {
+				b.conn.framer.WriteWindowUpdate(0, f.Length)
+			}
+			if err := b.conn.bw.Flush(); err != nil && !b.done {
+				b.err = err
+			}
+		case *http2.MetaHeadersFrame:
+			// trailers end the stream
+			b.done = f.StreamEnded()
+		}
+		if b.done {
+			b.finish()
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// finish releases the connection once the stream ended.
+func (b *http2Body) finish() {
+	b.stop()
+	if b.conn.goAway {
+		b.conn.close()
+		return
+	}
+	b.conn.release(b.conn)
+}
+
+func (b *http2Body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if !b.done && b.err == nil {
+		// the rest of the stream can't be told apart from the next response, the connection is dropped
+		b.stop()
+		b.conn.close()
+	}
+	return nil
+}
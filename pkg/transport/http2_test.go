@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestValidateHTTP2(t *testing.T) {
+	assert.NoError(t, ValidateHTTP2(""))
+	assert.NoError(t, ValidateHTTP2("Chrome"))
+	assert.ErrorContains(t, ValidateHTTP2("netscape"), "available: chrome, firefox, safari")
+}
+
+func TestFingerprintProfile(t *testing.T) {
+	assert.Equal(t, "chrome", fingerprintProfile("chrome-120"))
+	assert.Equal(t, "chrome", fingerprintProfile("edge"))
+	assert.Equal(t, "firefox", fingerprintProfile("Firefox-105"))
+	assert.Equal(t, "safari", fingerprintProfile("ios-14"))
+	assert.Equal(t, "chrome", fingerprintProfile(FingerprintCustom))
+
+	// fingerprints keep the ALPN protocols of the browser, h2 included
+	tr := New(Options{Fingerprint: "firefox-120"}).(*http2Transport)
+	assert.Equal(t, http2Profiles["firefox"].settings, tr.profile.settings)
+	assert.Equal(t, "firefox-120", tr.fingerprint)
+}
+
+func TestHTTP2ConnFingerprint(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	type frames struct {
+		settings     []http2.Setting
+		windowUpdate uint32
+		priority     http2.PriorityParam
+		fields       []string
+	}
+	received := make(chan frames, 1)
+	go func() {
+		defer server.Close()
+		br := bufio.NewReader(server)
+		preface := make([]byte, len(http2.ClientPreface))
+		if _, err := io.ReadFull(br, preface); err != nil {
+			return
+		}
+		framer := http2.NewFramer(server, br)
+		framer.ReadMetaHeaders = hpack.NewDecoder(65536, nil)
+		var got frames
+		for {
+			f, err := framer.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := f.(type) {
+			case *http2.SettingsFrame:
+				if f.IsAck() {
+					continue
+				}
+				f.ForeachSetting(func(s http2.Setting) error {
+					got.settings = append(got.settings, s)
+					return nil
+				})
+			case *http2.WindowUpdateFrame:
+				got.windowUpdate = f.Increment
+			case *http2.MetaHeadersFrame:
+				got.priority = f.Priority
+				for _, field := range f.Fields {
+					got.fields = append(got.fields, field.Name)
+				}
+				received <- got
+
+				var block []byte
+				enc := hpack.NewEncoder(writerFunc(func(p []byte) (int, error) {
+					block = append(block, p...)
+					return len(p), nil
+				}))
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				enc.WriteField(hpack.HeaderField{Name: "content-type", Value: "text/plain"})
+				// net.Pipe is unbuffered, the frames of the client are read meanwhile
+				go func(streamID uint32) {
+					framer.WriteSettings()
+					framer.WriteHeaders(http2.HeadersFrameParam{StreamID: streamID, BlockFragment: block, EndHeaders: true})
+					framer.WriteData(streamID, false, []byte("hello "))
+					framer.WriteData(streamID, true, []byte("world"))
+				}(f.StreamID)
+			}
+		}
+	}()
+
+	released := make(chan *http2Conn, 1)
+	conn, err := newHTTP2Conn(client, http2Profiles["chrome"], func(c *http2Conn) { released <- c })
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://www.example.com/article?id=1", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("X-Custom", "1")
+	req.Header.Set("Connection", "close")
+	resp, err := conn.roundTrip(req, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.Same(t, conn, <-released)
+
+	got := <-received
+	assert.Equal(t, http2Profiles["chrome"].settings, got.settings)
+	assert.Equal(t, uint32(15663105), got.windowUpdate)
+	assert.Equal(t, http2.PriorityParam{Exclusive: true, Weight: 255}, got.priority)
+	assert.Equal(t, []string{":method", ":authority", ":scheme", ":path", "user-agent", "accept", "accept-encoding", "x-custom"}, got.fields)
+}
+
+func TestHTTP2ConnInterop(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		w.Write([]byte(r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("Accept-Encoding")))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tlsConn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	require.NoError(t, err)
+	require.Equal(t, "h2", tlsConn.ConnectionState().NegotiatedProtocol)
+
+	released := 0
+	conn, err := newHTTP2Conn(tlsConn, http2Profiles["firefox"], func(*http2Conn) { released++ })
+	require.NoError(t, err)
+	defer conn.close()
+
+	// requests are sent one after another on the same connection
+	for _, path := range []string{"/a", "/b?c=d"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		resp, err := conn.roundTrip(req, 0)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/2.0", resp.Header.Get("X-Proto"))
+		assert.Equal(t, "GET "+path+" gzip, deflate, br, zstd", string(body))
+	}
+	assert.Equal(t, 2, released)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
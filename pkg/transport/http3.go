@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3RetryAfter is the time origins that failed to establish a QUIC connection are
+// fetched over TCP before HTTP/3 is attempted again.
+const http3RetryAfter = 10 * time.Minute
+
+// http3Transport sends HTTPS requests over HTTP/3, falling back to TCP for origins that
+// don't answer over QUIC, such as those that don't support HTTP/3 or are behind
+// firewalls dropping UDP, and for requests sent through a proxy.
+type http3Transport struct {
+	h3             *http3.RoundTripper
+	fallback       *http.Transport
+	responseHeader time.Duration
+
+	mu     sync.Mutex
+	broken map[string]time.Time
+}
+
+// quicDialError is the error of establishing a QUIC connection, after which requests fall back to TCP.
+type quicDialError struct {
+	err error
+}
+
+func (e *quicDialError) Error() string {
+	return "failed to establish QUIC connection: " + e.err.Error()
+}
+
+func (e *quicDialError) Unwrap() error {
+	return e.err
+}
+
+func newHTTP3Transport(opts Options, dialer *dialer, fallback *http.Transport) http.RoundTripper {
+	h3 := &http3.RoundTripper{
+		QuicConfig: &quic.Config{
+			HandshakeIdleTimeout: dialer.tlsTimeout,
+			MaxIdleTimeout:       90 * time.Second,
+		},
+		// the addresses of the origin are resolved and checked like those of TCP connections
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			addrs, err := dialer.resolve(ctx, "udp", addr)
+			if err != nil {
+				return nil, &quicDialError{err}
+			}
+			for _, addr := range addrs {
+				var conn quic.EarlyConnection
+				if conn, err = quic.DialAddrEarly(ctx, addr, tlsCfg, cfg); err == nil {
+					return conn, nil
+				}
+			}
+			return nil, &quicDialError{err}
+		},
+	}
+	return &http3Transport{
+		h3:             h3,
+		fallback:       fallback,
+		responseHeader: opts.Timeouts.ResponseHeader,
+		broken:         map[string]time.Time{},
+	}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := canonicalAddr(req)
+	if req.URL.Scheme != "https" || t.isBroken(addr) {
+		return t.fallback.RoundTrip(req)
+	}
+	if proxy, err := t.fallback.Proxy(req); err != nil || proxy != nil {
+		return t.fallback.RoundTrip(req)
+	}
+
+	resp, err := t.roundTrip(req)
+	var dialErr *quicDialError
+	if !errors.As(err, &dialErr) || req.Context().Err() != nil {
+		return resp, err
+	}
+	t.mu.Lock()
+	t.broken[addr] = time.Now().Add(http3RetryAfter)
+	t.mu.Unlock()
+
+	// the body of the request is not sent before the connection is established, but may be closed
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// roundTrip sends req over HTTP/3, within the response header timeout if set.
+func (t *http3Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.responseHeader <= 0 {
+		return t.h3.RoundTrip(req)
+	}
+	// the request is canceled if the headers are late, its context must outlive the body otherwise
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.responseHeader, cancel)
+	resp, err := t.h3.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && req.Context().Err() == nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("timeout awaiting response headers after %s", t.responseHeader)
+	}
+	if err != nil {
+		cancel()
+	}
+	return resp, err
+}
+
+// isBroken reports whether addr recently failed to establish a QUIC connection.
+func (t *http3Transport) isBroken(addr string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.broken[addr]
+	if ok && time.Now().After(until) {
+		delete(t.broken, addr)
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHTTP3TestTransport returns a HTTP/3 transport trusting the certificate of server.
+func newHTTP3TestTransport(server *httptest.Server) *http3Transport {
+	t := newTransport(Options{HTTP3: true, Timeouts: Timeouts{TLSHandshake: time.Second}}).(*http3Transport)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	t.h3.TLSClientConfig = &tls.Config{RootCAs: roots}
+	t.fallback.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return t
+}
+
+func TestHTTP3Transport(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(server.TLS.Clone())}
+	go h3.Serve(udpConn)
+	defer h3.Close()
+
+	transport := newHTTP3TestTransport(server)
+	port := strconv.Itoa(udpConn.LocalAddr().(*net.UDPAddr).Port)
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "https://127.0.0.1:"+port+"/", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/3.0", string(body))
+}
+
+func TestHTTP3TransportFallback(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer server.Close()
+
+	// nothing answers over QUIC on the port of the server, which is fetched over TCP instead
+	transport := newHTTP3TestTransport(server)
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, server.URL, nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/1.1", string(body))
+		if i == 1 {
+			assert.Less(t, time.Since(start), 500*time.Millisecond, "QUIC is not attempted again")
+		}
+	}
+	assert.True(t, transport.isBroken(server.Listener.Addr().String()))
+}
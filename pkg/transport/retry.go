@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry configures the retries of the requests upstreams answer with 429 Too Many Requests or
+// a server error, or that time out.
+type Retry struct {
+	// Attempts is the number of times a request is sent at most, 1 or less never retrying it.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled before each following one.
+	Backoff time.Duration
+	// MaxBackoff bounds the delay before a retry, including the one asked by a Retry-After header.
+	MaxBackoff time.Duration
+}
+
+// RetryBudget bounds the retries to a ratio of the requests, so that retries don't pile up
+// on upstreams that are down. It is safe for concurrent use.
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+// retryBurst is the number of retries a RetryBudget allows before any request deposits into it.
+const retryBurst = 10
+
+// NewRetryBudget returns a RetryBudget allowing ratio retries per request, eg: 0.1 for one retry
+// every ten requests, along with bursts of up to 10 retries.
+func NewRetryBudget(ratio float64) *RetryBudget {
+	return &RetryBudget{ratio: ratio, tokens: retryBurst}
+}
+
+// deposit credits the budget for a request.
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, retryBurst)
+}
+
+// withdraw debits the budget for a retry, and reports whether the budget allowed it.
+// A nil budget allows all retries.
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryTransport is a http.RoundTripper that retries the safe requests without body, see
+// retryable, upstreams answer with 429 Too Many Requests or a server error, or that time out,
+// with exponential backoff and jitter.
+type RetryTransport struct {
+	Next  http.RoundTripper
+	Retry Retry
+	// Budget bounds the retries across requests, if set.
+	Budget *RetryBudget
+	// OnRetry is called before waiting delay to retry the request, after attempt failed with reason, if set.
+	OnRetry func(attempt int, delay time.Duration, reason string)
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Budget.deposit()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.Next.RoundTrip(req)
+		reason := retryReason(resp, err)
+		if reason == "" || attempt >= t.Retry.Attempts || !retryable(req) ||
+			req.Context().Err() != nil || !t.Budget.withdraw() {
+			return resp, err
+		}
+		delay := t.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if t.OnRetry != nil {
+			t.OnRetry(attempt, delay, reason)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether req can be sent again: requests of safe methods, which upstreams
+// don't change state for, and without body, which was consumed. POST, PUT, PATCH and DELETE
+// requests, even without body, may have been processed by an upstream that failed or timed
+// out afterwards, and are never retried, so that their side effects aren't duplicated.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+// backoff returns the delay before retrying the request after attempt got resp: Backoff doubled
+// for each previous attempt, with jitter, or the delay of the Retry-After header of resp if longer,
+// bounded by MaxBackoff.
+func (t *RetryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	delay := t.Retry.Backoff << (attempt - 1)
+	if delay < t.Retry.Backoff {
+		// overflow
+		delay = t.Retry.MaxBackoff
+	}
+	if t.Retry.MaxBackoff > 0 && delay > t.Retry.MaxBackoff {
+		delay = t.Retry.MaxBackoff
+	}
+	// equal jitter keeps at least half of the delay
+	if delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if after := retryAfter(resp); after > delay {
+		delay = after
+		if t.Retry.MaxBackoff > 0 && delay > t.Retry.MaxBackoff {
+			delay = t.Retry.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// retryReason returns why the request that got resp or err is worth retrying, or an empty string if it is not.
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "timeout"
+		}
+		return ""
+	}
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && resp.StatusCode != http.StatusHTTPVersionNotSupported) {
+		return resp.Status
+	}
+	return ""
+}
+
+// retryAfter returns the delay asked by the Retry-After header of resp, in seconds or as a date, or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
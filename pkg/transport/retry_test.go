@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	rt := &RetryTransport{
+		Next:    http.DefaultTransport,
+		Retry:   Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 20 * time.Millisecond},
+		OnRetry: func(attempt int, delay time.Duration, reason string) { delays = append(delays, delay) },
+	}
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 3, requests.Load())
+	require.Len(t, delays, 2)
+	assert.LessOrEqual(t, delays[0], time.Millisecond)
+	// Retry-After is bounded by MaxBackoff
+	assert.Equal(t, 20*time.Millisecond, delays[1])
+
+	// attempts run out
+	requests.Store(0)
+	rt.Retry.Attempts = 2
+	resp, err = (&http.Client{Transport: rt}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+// TestRetryTransportUnsafeMethods checks that requests that may have side effects upstream
+// aren't sent twice, even without body.
+func TestRetryTransportUnsafeMethods(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &RetryTransport{Next: http.DefaultTransport, Retry: Retry{Attempts: 3}}}
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		requests.Store(0)
+		req, _ := http.NewRequest(method, server.URL, nil)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.EqualValues(t, 1, requests.Load(), method)
+	}
+
+	requests.Store(0)
+	req, _ := http.NewRequest(http.MethodHead, server.URL, nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.EqualValues(t, 3, requests.Load())
+}
+
+func TestRetryTransportBudget(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	rt := &RetryTransport{Next: http.DefaultTransport, Retry: Retry{Attempts: 5}, Budget: NewRetryBudget(0)}
+	for i := 0; i < 4; i++ {
+		resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	// 4 requests and the 10 retries of the burst
+	assert.EqualValues(t, 14, requests.Load())
+}
+
+func TestRetryTransportTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	rt := &RetryTransport{
+		Next:  &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond},
+		Retry: Retry{Attempts: 2},
+	}
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// requests are not retried once canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,380 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ladder/pkg/resolver"
+	"ladder/pkg/ssrf"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Options configures the upstream transport used to fetch a site.
+// Options must stay comparable, as it is used as the key of the transport cache.
+type Options struct {
+	// ECH enables Encrypted Client Hello for origins that publish an ECH config.
+	ECH bool
+	// Fingerprint is the name of a TLS ClientHello preset to impersonate, see Fingerprints.
+	// It takes precedence over ECH, which the impersonated ClientHellos don't support.
+	// HTTPS requests are sent over HTTP/2 when the origin negotiates it, with the HTTP/2
+	// fingerprint of HTTP2 or else of the same browser, except along with HeaderOrder.
+	Fingerprint string
+	// ClientHello is the custom ClientHello spec used with the "custom" fingerprint.
+	ClientHello string
+	// HTTP2 is the name of a browser whose HTTP/2 fingerprint to impersonate, see HTTP2Profiles.
+	// HTTPS requests are then sent over HTTP/2 when the origin supports it, with the TLS
+	// fingerprint of Fingerprint or else of the same browser, and ECH is ignored.
+	HTTP2 string
+	// HTTP3 sends HTTPS requests over HTTP/3 (QUIC), falling back to TCP for the origins
+	// that don't support it. It is ignored along with HTTP/2 and ECH or TLS fingerprints,
+	// which can't be used over QUIC.
+	HTTP3 bool
+	// HeaderOrder is the name of a browser whose HTTP/1.1 header order and casing to send,
+	// see HeaderOrders, instead of the sorted and canonical headers of net/http. It applies
+	// along with ECH and TLS fingerprints, over HTTP/1.1, and is ignored along with HTTP2,
+	// whose profile orders headers itself, and HTTP3.
+	HeaderOrder string
+	// Resolver is the name of the resolver looking up the addresses of origins, eg: cloudflare,
+	// see resolver.Get. Empty uses the resolver of the operating system.
+	Resolver string
+	// Hosts pins hosts to addresses, which are dialed without looking them up, as comma separated
+	// host:ip pairs, see resolver.FormatHosts.
+	Hosts string
+	// Timeouts bounds the phases of establishing connections and awaiting responses.
+	Timeouts Timeouts
+	// Proxies picks the upstream proxy of each request, if set, instead of the proxies
+	// configured in the environment, eg: a proxypool.Pool or Tor. Requests are then
+	// sent with net/http, which negotiates TLS through proxies itself, so HTTP/2, HTTP/3,
+	// ECH and TLS fingerprints are ignored.
+	Proxies Proxies
+	// Guard blocks connections to internal addresses, once resolved, if set.
+	// Connections to the proxies configured in the environment or pool are not checked,
+	// while requests to their addresses that aren't proxied are blocked.
+	Guard *ssrf.Guard
+	// FastHTTP sends plain HTTP/1.1 requests with fasthttp instead of net/http.
+	// It is ignored along with ECH, HTTP/2, HTTP/3, header orders and fingerprints, which require net/http, and
+	// requests fasthttp can't serve, such as proxied ones, fall back to net/http.
+	FastHTTP bool
+}
+
+// Proxies picks the upstream proxy of requests. Implementations must be comparable, eg: pointers.
+type Proxies interface {
+	// Proxy returns the proxy to send req through, see http.Transport.Proxy.
+	Proxy(req *http.Request) (*url.URL, error)
+	// Addrs returns the host:port addresses of all proxies, which are exempt from the SSRF guard.
+	Addrs() []string
+}
+
+// Timeouts bounds the individual phases of an upstream request.
+// Zero values select the defaults documented on each field.
+type Timeouts struct {
+	// DNS bounds the lookup of the origin's addresses. By default the lookup counts towards Connect.
+	DNS time.Duration
+	// Connect bounds establishing the TCP connection, including the lookup of the origin's
+	// addresses unless DNS is set, across all the addresses tried. Defaults to 30 seconds, as
+	// net/http, when zero; ladder sets it from its timeouts, 10 seconds by default.
+	Connect time.Duration
+	// TLSHandshake bounds the TLS handshake. Defaults to 10 seconds.
+	TLSHandshake time.Duration
+	// ResponseHeader bounds waiting for the response headers once the request is sent. No limit by default.
+	ResponseHeader time.Duration
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = map[Options]http.RoundTripper{}
+)
+
+// New returns a http.RoundTripper configured according to opts.
+// Transports are cached per Options value so that connections are reused across requests.
+func New(opts Options) http.RoundTripper {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if t, ok := transports[opts]; ok {
+		return t
+	}
+
+	t := newTransport(opts)
+	transports[opts] = t
+	return t
+}
+
+// Dial returns the dial function of the transports of opts, which resolves hosts and checks
+// their addresses like them, eg: for the connections of a headless browser. As its connections
+// don't go through the proxies of opts, none of them is exempt from the guard.
+func Dial(opts Options) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := newDialer(opts)
+	d.proxies = nil
+	return d.DialContext
+}
+
+// newDialer builds the dialer of the transports of opts.
+func newDialer(opts Options) *dialer {
+	dialer := &dialer{
+		Dialer: net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		dnsTimeout: opts.Timeouts.DNS,
+		tlsTimeout: 10 * time.Second,
+		guard:      opts.Guard,
+		proxies:    proxyAddrs(),
+	}
+	if opts.Resolver != "" {
+		// the resolver is validated along with the rules using it
+		dialer.resolver, _ = resolver.Get(opts.Resolver)
+	}
+	if opts.Hosts != "" {
+		// the pins are validated along with the rules using them
+		dialer.hosts, _ = resolver.ParseHosts(strings.Split(opts.Hosts, ","))
+	}
+	if opts.Proxies != nil {
+		dialer.proxies = append(dialer.proxies, opts.Proxies.Addrs()...)
+	}
+	if opts.Timeouts.Connect > 0 {
+		dialer.Timeout = opts.Timeouts.Connect
+	}
+	if opts.Timeouts.TLSHandshake > 0 {
+		dialer.tlsTimeout = opts.Timeouts.TLSHandshake
+	}
+	return dialer
+}
+
+// newTransport builds a fresh http.RoundTripper for opts.
+func newTransport(opts Options) http.RoundTripper {
+	dialer := newDialer(opts)
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxies != nil {
+		proxy = opts.Proxies.Proxy
+	}
+
+	t := &http.Transport{
+		Proxy:                 dialer.proxyFunc(proxy),
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   dialer.tlsTimeout,
+		ResponseHeaderTimeout: opts.Timeouts.ResponseHeader,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	switch {
+	case opts.Proxies != nil:
+		// only net/http can send requests through the proxies
+	case opts.HTTP2 != "":
+		return newHTTP2Transport(opts, dialer, t)
+	case opts.HeaderOrder != "":
+		if opts.Fingerprint != "" {
+			t.DialTLSContext = fingerprintDialer(dialer, opts.Fingerprint, opts.ClientHello, true)
+		} else if opts.ECH {
+			t.DialTLSContext = echDialer(dialer, "http/1.1")
+		}
+		return newOrderedTransport(opts, dialer, t)
+	case opts.Fingerprint != "":
+		return newHTTP2Transport(opts, dialer, t)
+	case opts.ECH:
+		t.DialTLSContext = echDialer(dialer)
+	case opts.HTTP3:
+		return newHTTP3Transport(opts, dialer, t)
+	case opts.FastHTTP:
+		return newFastTransport(opts, dialer, t)
+	}
+
+	return t
+}
+
+// dialer is a net.Dialer resolving addresses with its own timeout, so that slow
+// DNS and slow connections can be told apart, checking the resolved addresses
+// with its guard and bounding TLS handshakes of the custom TLS dialers.
+type dialer struct {
+	net.Dialer
+	dnsTimeout time.Duration
+	tlsTimeout time.Duration
+	guard      *ssrf.Guard
+	// proxies are the host:port addresses of the proxies, whose connections aren't checked.
+	proxies []string
+	// resolver looks up the addresses of hosts instead of the Resolver of net.Dialer, if set.
+	resolver resolver.Resolver
+	// hosts pins hosts to their addresses, which are not looked up.
+	hosts map[string][]net.IP
+}
+
+// DialContext connects to addr, resolving its host within the DNS timeout
+// before dialing its allowed addresses in order until one succeeds. Like
+// net.Dialer, the connect timeout bounds all the attempts, each address getting
+// an equal share of the time left, so that a host with several unreachable
+// addresses doesn't take the timeout for each of them.
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var cancel context.CancelFunc
+	if d.Timeout > 0 && d.dnsTimeout <= 0 {
+		// the lookup counts towards the connect timeout
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	addrs, err := d.resolve(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.Timeout > 0 && d.dnsTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	dialer := d.Dialer
+	dialer.Timeout = 0
+	// the checked addresses are dialed directly, so the host can't resolve differently in between
+	for i, addr := range addrs {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		}
+		var conn net.Conn
+		conn, err = dialer.DialContext(attemptCtx, network, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// resolve returns the addresses to dial to connect to addr: the addresses of its host
+// allowed by the guard, pinned or resolved by the resolver within the DNS timeout, or
+// addr itself when none of them is set.
+func (d *dialer) resolve(ctx context.Context, network, addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	guard := d.guard
+	if guard != nil && (slices.Contains(d.proxies, addr) || guard.AllowsHost(host)) {
+		guard = nil
+	}
+	if d.dnsTimeout <= 0 && guard == nil && d.resolver == nil && len(d.hosts) == 0 {
+		return []string{addr}, nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if guard != nil {
+			if err := guard.CheckIP(host, ip); err != nil {
+				return nil, err
+			}
+		}
+		return []string{addr}, nil
+	}
+
+	ips, pinned := d.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+	if !pinned {
+		if ips, err = d.lookup(ctx, network, host); err != nil {
+			return nil, err
+		}
+	}
+
+	var addrs []string
+	for _, ip := range ips {
+		if guard != nil {
+			if err = guard.CheckIP(host, ip); err != nil {
+				continue
+			}
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	if len(addrs) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// lookup looks up the addresses of host with the resolver, within the DNS timeout.
+func (d *dialer) lookup(ctx context.Context, network, host string) ([]net.IP, error) {
+	lookupCtx := ctx
+	if d.dnsTimeout > 0 {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = context.WithTimeout(ctx, d.dnsTimeout)
+		defer cancel()
+	}
+	var r resolver.Resolver = net.DefaultResolver
+	if d.resolver != nil {
+		r = d.resolver
+	} else if d.Resolver != nil {
+		r = d.Resolver
+	}
+	network = strings.TrimPrefix(strings.TrimPrefix(network, "tcp"), "udp")
+	ips, err := r.LookupIP(lookupCtx, "ip"+network, host)
+	if err != nil {
+		if errors.Is(lookupCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, fmt.Errorf("dns lookup of %s timed out after %s", host, d.dnsTimeout)
+		}
+		return nil, err
+	}
+	return ips, nil
+}
+
+// proxyAddrs returns the host:port addresses of the proxies configured in the environment.
+func proxyAddrs() []string {
+	var addrs []string
+	config := httpproxy.FromEnvironment()
+	for _, proxy := range []string{config.HTTPProxy, config.HTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		if u, err := url.Parse(proxy); err == nil {
+			addrs = append(addrs, hostPort(u))
+		}
+	}
+	return addrs
+}
+
+// defaultPorts are the ports of URLs by scheme, when they have none.
+var defaultPorts = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}
+
+// hostPort returns the host:port address of u.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// proxyFunc wraps proxy, the proxy of requests, blocking the requests it doesn't send through
+// a proxy to the address of a proxy: the dialer doesn't check the connections to that address,
+// which are meant for proxied requests only, eg: to a proxy on localhost, which net/http never
+// sends through a proxy.
+func (d *dialer) proxyFunc(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if err != nil || u != nil || d.guard == nil {
+			return u, err
+		}
+		if slices.Contains(d.proxies, hostPort(req.URL)) {
+			return nil, fmt.Errorf("%w: %s is the address of a proxy", ssrf.ErrBlocked, req.URL.Host)
+		}
+		return nil, nil
+	}
+}
+
+// handshakeContext returns ctx bounded by the TLS handshake timeout.
+func (d *dialer) handshakeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.tlsTimeout)
+}
@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"ladder/pkg/ssrf"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerDNSTimeout(t *testing.T) {
+	d := &dialer{dnsTimeout: 50 * time.Millisecond}
+	d.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	start := time.Now()
+	_, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	assert.ErrorContains(t, err, "dns lookup of example.com timed out after 50ms")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDialerResolves(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	d := &dialer{dnsTimeout: time.Second}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+	require.NoError(t, err)
+	conn.Close()
+}
+
+type staticResolver []net.IP
+
+func (r staticResolver) LookupIP(context.Context, string, string) ([]net.IP, error) {
+	return r, nil
+}
+
+func TestDialerResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// hosts are looked up with the resolver even without a DNS timeout or guard
+	d := &dialer{resolver: staticResolver{net.ParseIP("127.0.0.1")}}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("upstream.invalid", port))
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	client := &http.Client{Transport: New(Options{Hosts: "upstream.invalid:127.0.0.1"})}
+	resp, err := client.Get("http://Upstream.invalid:" + port + "/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "Upstream.invalid:"+port, string(body))
+
+	// hosts that aren't pinned are still looked up
+	_, err = client.Get("http://other.invalid:" + port + "/")
+	assert.Error(t, err)
+}
+
+func TestFastTransport(t *testing.T) {
+	big := strings.Repeat("a", maxFastBodySize+1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			w.Write([]byte(big))
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+			http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte(r.Header.Get("User-Agent") + " " + r.URL.RequestURI()))
+		}
+	}))
+	defer server.Close()
+
+	rt := New(Options{FastHTTP: true})
+	require.IsType(t, &fastTransport{}, rt)
+	client := &http.Client{Transport: rt}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/page?q=1", nil)
+	req.Header.Set("User-Agent", "ladder")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ladder /page?q=1", string(body))
+	assert.Equal(t, "418 I'm a teapot", resp.Status)
+	assert.Len(t, resp.Cookies(), 2)
+
+	// oversized responses are fetched again with net/http
+	resp, err = client.Get(server.URL + "/big")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Len(t, body, len(big))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/slow", nil)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFastTransportIgnoredForTLSOptions(t *testing.T) {
+	assert.IsType(t, &http2Transport{}, New(Options{FastHTTP: true, Fingerprint: "chrome"}))
+}
+
+func TestDialerConnectTimeout(t *testing.T) {
+	// connections to all addresses hang, until their attempt times out
+	var mu sync.Mutex
+	var tried []string
+	d := &dialer{resolver: staticResolver{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3"), net.ParseIP("127.0.0.4")}}
+	d.Timeout = 300 * time.Millisecond
+	d.ControlContext = func(ctx context.Context, _, address string, _ syscall.RawConn) error {
+		mu.Lock()
+		tried = append(tried, address)
+		mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	_, err := d.DialContext(context.Background(), "tcp", "upstream.invalid:80")
+	assert.Error(t, err)
+	// the timeout bounds all the attempts, shared between the addresses
+	assert.Less(t, time.Since(start), 600*time.Millisecond)
+	assert.Equal(t, []string{"127.0.0.2:80", "127.0.0.3:80", "127.0.0.4:80"}, tried)
+}
+
+// loopbackProxies sends requests through proxy, except those to localhost, like net/http.
+type loopbackProxies struct {
+	proxy *url.URL
+}
+
+func (p *loopbackProxies) Proxy(req *http.Request) (*url.URL, error) {
+	if req.URL.Hostname() == "localhost" {
+		return nil, nil
+	}
+	return p.proxy, nil
+}
+
+func (p *loopbackProxies) Addrs() []string { return []string{p.proxy.Host} }
+
+func TestGuardProxies(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "internal")
+	}))
+	defer upstream.Close()
+	_, proxyPort, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+	_, upstreamPort, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	proxies := &loopbackProxies{proxy: &url.URL{Scheme: "http", Host: "localhost:" + proxyPort}}
+	client := &http.Client{Transport: New(Options{Proxies: proxies, Guard: &ssrf.Guard{}})}
+
+	// the connections to the proxy aren't checked
+	resp, err := client.Get("http://www.example.com/")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "proxied http://www.example.com/", string(body))
+
+	// unlike the other ports of the host of the proxy, nor the proxy reached directly
+	_, err = client.Get("http://localhost:" + upstreamPort + "/")
+	assert.ErrorIs(t, err, ssrf.ErrBlocked)
+	_, err = client.Get("http://localhost:" + proxyPort + "/")
+	assert.ErrorIs(t, err, ssrf.ErrBlocked)
+}
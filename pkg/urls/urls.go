@@ -0,0 +1,155 @@
+// Package urls canonicalizes the URLs handled by ladder: it extracts the
+// upstream URL from proxy request paths, reconstructs relative URLs from the
+// Referer of proxied pages and normalizes URLs, so that routing, rulesets and
+// caches agree on a single form of every URL.
+package urls
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// collapsedScheme matches schemes whose double slash was cleaned by a router, eg: https:/example.com
+	collapsedScheme = regexp.MustCompile(`(?i)^(https?):/+`)
+	// encodedScheme matches URLs that were query escaped as a whole, eg: https%3A%2F%2Fexample.com
+	encodedScheme = regexp.MustCompile(`(?i)^https?%3A`)
+	// hostname matches the labels of a domain name with a top level domain.
+	hostname = regexp.MustCompile(`(?i)^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z][a-z0-9-]*[a-z0-9]$`)
+)
+
+// Extract returns the upstream URL of a proxy request. target is the request path below
+// prefix, eg: https://www.example.com/article for /https://www.example.com/article.
+//
+// Targets without scheme are paths requested by a proxied page, eg: /images/logo.png,
+// and are resolved against the page in referer, the Referer header of the request.
+// Without a proxied referer, targets starting with a domain name, eg: www.example.com/article,
+// are fetched over https.
+func Extract(target, referer, prefix string) (string, error) {
+	u, err := parse(strings.TrimPrefix(target, "/"))
+	if err != nil {
+		return "", fmt.Errorf("error parsing request URL '%s': %w", target, err)
+	}
+	if isAbsolute(u) {
+		return Normalize(u).String(), nil
+	}
+
+	if base, ok := proxiedPage(referer, prefix); ok {
+		ref, err := url.Parse("/" + strings.TrimPrefix(target, "/"))
+		if err != nil {
+			return "", fmt.Errorf("error parsing request URL '%s': %w", target, err)
+		}
+		return Normalize(base.ResolveReference(ref)).String(), nil
+	}
+
+	host, _, _ := strings.Cut(strings.TrimPrefix(target, "/"), "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if hostname.MatchString(host) {
+		u, err := url.Parse("https://" + strings.TrimPrefix(target, "/"))
+		if err != nil {
+			return "", fmt.Errorf("error parsing request URL '%s': %w", target, err)
+		}
+		return Normalize(u).String(), nil
+	}
+
+	return "", fmt.Errorf("cannot resolve relative URL '%s' without the Referer of a proxied page", target)
+}
+
+// parse parses rawURL, unescaping it first if it was escaped as a whole and
+// restoring the double slash of a collapsed scheme.
+func parse(rawURL string) (*url.URL, error) {
+	if encodedScheme.MatchString(rawURL) {
+		if unescaped, err := url.QueryUnescape(rawURL); err == nil {
+			rawURL = unescaped
+		}
+	}
+	return url.Parse(collapsedScheme.ReplaceAllString(rawURL, "$1://"))
+}
+
+// isAbsolute reports whether u is an absolute http or https URL.
+func isAbsolute(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// proxiedPage returns the upstream URL of the proxied page in referer.
+func proxiedPage(referer, prefix string) (*url.URL, bool) {
+	if referer == "" {
+		return nil, false
+	}
+	ref, err := url.Parse(referer)
+	if err != nil || !strings.HasPrefix(ref.Path, prefix) {
+		return nil, false
+	}
+	page, err := parse(strings.TrimPrefix(ref.Path, prefix))
+	if err != nil || !isAbsolute(page) {
+		return nil, false
+	}
+	return page, true
+}
+
+// Normalize returns a copy of u in canonical form: with lower case scheme and host,
+// without default port, fragment and dot segments, and with a path of at least "/".
+func Normalize(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = NormalizeHost(n.Host)
+	if port := n.Port(); (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	n.Fragment, n.RawFragment = "", ""
+
+	if n.Opaque == "" {
+		if n.Path == "" {
+			n.Path, n.RawPath = "/", ""
+		} else if strings.Contains(n.Path, "/.") {
+			// resolving the path against itself removes its dot segments
+			resolved := n.ResolveReference(&url.URL{Path: n.Path, RawPath: n.RawPath, RawQuery: n.RawQuery})
+			n.Path, n.RawPath = resolved.Path, resolved.RawPath
+		}
+	}
+	return &n
+}
+
+// NormalizeHost returns host in canonical form: lower case and without the trailing dot of a fully qualified name.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil && strings.HasSuffix(h, ".") {
+		return net.JoinHostPort(strings.TrimSuffix(h, "."), port)
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// WithQuery returns rawURL with the query parameters added, replacing parameters of the same name.
+func WithQuery(rawURL string, query map[string]string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if len(query) == 0 {
+		return u.String(), nil
+	}
+	values := u.Query()
+	for k, v := range query {
+		values.Set(k, v)
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// Key returns the canonical form of rawURL with sorted query parameters, which
+// identifies the same resource regardless of how its URL was written, eg: for
+// caching or deduplicating requests.
+func Key(rawURL string) (string, error) {
+	u, err := parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	n := Normalize(u)
+	n.RawQuery = n.Query().Encode()
+	return n.String(), nil
+}
@@ -0,0 +1,72 @@
+package urls
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name, target, referer, prefix, want string
+	}{
+		{"absolute", "https://www.example.com/article", "", "/", "https://www.example.com/article"},
+		{"leading slash", "/https://www.example.com/article", "", "/", "https://www.example.com/article"},
+		{"escaped", "https%3A%2F%2Fwww.example.com%2Farticle%3Fid%3D1", "", "/", "https://www.example.com/article?id=1"},
+		{"escaped path kept", "https://www.example.com/a%2Fb", "", "/", "https://www.example.com/a%2Fb"},
+		{"plus kept", "https://www.example.com/a+b", "", "/", "https://www.example.com/a+b"},
+		{"collapsed scheme", "https:/www.example.com/article", "", "/", "https://www.example.com/article"},
+		{"normalized", "HTTPS://WWW.Example.com:443/a/./b/../c#top", "", "/", "https://www.example.com/a/c"},
+		{"empty path", "https://www.example.com", "", "/", "https://www.example.com/"},
+		{"relative", "images/logo.png", "http://localhost:8080/https://www.example.com/a/article", "/", "https://www.example.com/images/logo.png"},
+		{"relative with query", "search?q=1", "http://localhost:8080/https://www.example.com/article", "/", "https://www.example.com/search?q=1"},
+		{"relative below prefix", "images/logo.png", "http://localhost/ladder/https:/www.example.com/article", "/ladder/", "https://www.example.com/images/logo.png"},
+		{"relative to dotted page", "style.css", "http://localhost:8080/https://www.example.com/", "/", "https://www.example.com/style.css"},
+		{"scheme inferred", "www.example.com/article", "", "/", "https://www.example.com/article"},
+		{"scheme inferred with port", "www.example.com:8443/article", "http://localhost:8080/", "/", "https://www.example.com:8443/article"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Extract(test.target, test.referer, test.prefix)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err := Extract("images/logo.png", "", "/")
+	assert.ErrorContains(t, err, "cannot resolve relative URL")
+	_, err = Extract("images/logo.png", "http://localhost:8080/about", "/")
+	assert.ErrorContains(t, err, "cannot resolve relative URL")
+}
+
+func TestNormalizeHost(t *testing.T) {
+	assert.Equal(t, "www.example.com", NormalizeHost("WWW.Example.com."))
+	assert.Equal(t, "www.example.com:8080", NormalizeHost("www.example.com.:8080"))
+}
+
+func TestWithQuery(t *testing.T) {
+	got, err := WithQuery("https://www.example.com/search?q=a", map[string]string{"q": "a b&c", "page": "2"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/search?page=2&q=a+b%26c", got)
+
+	got, err = WithQuery("https://www.example.com/search?b=1&a=2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com/search?b=1&a=2", got)
+}
+
+func TestKey(t *testing.T) {
+	a, err := Key("https://WWW.example.com:443/article?b=2&a=1#comments")
+	require.NoError(t, err)
+	b, err := Key("https://www.example.com/article?a=1&b=2")
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+}
+
+func TestNormalizeCopies(t *testing.T) {
+	u, _ := url.Parse("HTTP://Example.com:80")
+	n := Normalize(u)
+	assert.Equal(t, "http://example.com/", n.String())
+	assert.Equal(t, "Example.com:80", u.Host)
+}
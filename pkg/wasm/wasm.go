@@ -0,0 +1,262 @@
+// Package wasm runs untrusted request and response modifiers compiled to
+// WebAssembly in a wazero sandbox, with bounded memory and execution time
+// and without access to the host filesystem, network or environment.
+//
+// A module implements the following ABI. Messages are JSON documents written
+// into the module's memory, and results are returned as a pointer and length
+// packed into an i64 (ptr<<32 | len). Returning 0 leaves the message unchanged.
+//
+//	(export "memory" (memory))
+//	(export "alloc" (func (param $size i32) (result $ptr i32)))
+//	(export "modify_request" (func (param $ptr i32) (param $len i32) (result i64)))   ;; optional
+//	(export "modify_response" (func (param $ptr i32) (param $len i32) (result i64)))  ;; optional
+//
+// modify_request receives {"method", "url", "header"} and modify_response receives
+// {"url", "statusCode", "header", "body"}, where body is base64 encoded. A result
+// without statusCode keeps the upstream status.
+// WASI is available without any preopened directories, so modules built with
+// TinyGo or Rust's wasm32-wasi target work out of the box.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Limits bounds the resources a module can use on each call.
+type Limits struct {
+	// MemoryPages is the maximum memory of a module, in 64KiB pages.
+	MemoryPages uint32
+	// Timeout is the maximum execution time of a single call.
+	Timeout time.Duration
+}
+
+// DefaultLimits allows 16MiB of memory and 1 second of execution time per call.
+var DefaultLimits = Limits{
+	MemoryPages: 256,
+	Timeout:     time.Second,
+}
+
+// Request is the upstream request as seen by a module.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+}
+
+// Response is the upstream response as seen by a module.
+type Response struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Runtime compiles and runs modules. It is safe for concurrent use.
+type Runtime struct {
+	limits  Limits
+	runtime wazero.Runtime
+
+	mu      sync.Mutex
+	modules map[string]*Module
+}
+
+// NewRuntime returns a Runtime enforcing limits on every module call.
+func NewRuntime(limits Limits) *Runtime {
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(limits.MemoryPages).
+		WithCloseOnContextDone(true)
+
+	rt := wazero.NewRuntimeWithConfig(ctx, config)
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+
+	return &Runtime{
+		limits:  limits,
+		runtime: rt,
+		modules: map[string]*Module{},
+	}
+}
+
+// Load compiles the module at path, or returns it from cache if it was already loaded.
+func (r *Runtime) Load(path string) (*Module, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.modules[path]; ok {
+		return m, nil
+	}
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm module '%s': %w", path, err)
+	}
+
+	m, err := r.Compile(path, code)
+	if err != nil {
+		return nil, err
+	}
+	r.modules[path] = m
+	return m, nil
+}
+
+// Compile compiles the module code, named name in errors.
+func (r *Runtime) Compile(name string, code []byte) (*Module, error) {
+	compiled, err := r.runtime.CompileModule(context.Background(), code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module '%s': %w", name, err)
+	}
+
+	if _, ok := compiled.ExportedFunctions()["alloc"]; !ok {
+		return nil, fmt.Errorf("wasm module '%s' does not export alloc", name)
+	}
+
+	return &Module{Name: name, runtime: r, compiled: compiled}, nil
+}
+
+// Close releases all compiled modules.
+func (r *Runtime) Close() error {
+	return r.runtime.Close(context.Background())
+}
+
+// Module is a compiled modifier module. It implements ladder.Modifier.
+// Every call runs in a fresh instance, so no state is shared between requests.
+type Module struct {
+	Name     string
+	runtime  *Runtime
+	compiled wazero.CompiledModule
+}
+
+// ModifyRequest passes req to the modify_request export and applies the returned URL and headers.
+func (m *Module) ModifyRequest(req *http.Request) error {
+	in := Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header,
+	}
+	out := Request{}
+
+	changed, err := m.call(req.Context(), "modify_request", in, &out)
+	if err != nil || !changed {
+		return err
+	}
+
+	u, err := url.Parse(out.URL)
+	if err != nil {
+		return fmt.Errorf("wasm module '%s' returned an invalid URL: %w", m.Name, err)
+	}
+	req.URL = u
+	req.Host = u.Host
+	req.Header = out.Header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	return nil
+}
+
+// ModifyResponse passes resp and body to the modify_response export, applies the
+// returned status and headers and returns the modified body.
+func (m *Module) ModifyResponse(resp *http.Response, body []byte) ([]byte, error) {
+	ctx := context.Background()
+	in := Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+		in.URL = resp.Request.URL.String()
+	}
+	out := Response{}
+
+	changed, err := m.call(ctx, "modify_response", in, &out)
+	if err != nil || !changed {
+		return body, err
+	}
+
+	// a result without statusCode keeps the upstream status
+	if out.StatusCode != 0 {
+		resp.StatusCode = out.StatusCode
+	}
+	resp.Header = out.Header
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	return out.Body, nil
+}
+
+// call instantiates the module and calls fn with in, decoding the result into out.
+// It reports whether the module returned a result. Missing exports are skipped.
+func (m *Module) call(ctx context.Context, fn string, in any, out any) (bool, error) {
+	if _, ok := m.compiled.ExportedFunctions()[fn]; !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.runtime.limits.Timeout)
+	defer cancel()
+
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize")
+	mod, err := m.runtime.runtime.InstantiateModule(ctx, m.compiled, config)
+	if err != nil {
+		return false, fmt.Errorf("failed to instantiate wasm module '%s': %w", m.Name, err)
+	}
+	defer mod.Close(context.Background())
+
+	input, err := json.Marshal(in)
+	if err != nil {
+		return false, err
+	}
+
+	ptr, err := m.write(ctx, mod, input)
+	if err != nil {
+		return false, err
+	}
+
+	results, err := mod.ExportedFunction(fn).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return false, fmt.Errorf("wasm module '%s' failed in %s: %w", m.Name, fn, err)
+	}
+	if len(results) != 1 || results[0] == 0 {
+		return false, nil
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return false, fmt.Errorf("wasm module '%s' returned an out of bounds result from %s", m.Name, fn)
+	}
+	if err := json.Unmarshal(output, out); err != nil {
+		return false, fmt.Errorf("wasm module '%s' returned an invalid result from %s: %w", m.Name, fn, err)
+	}
+	return true, nil
+}
+
+// write copies data into memory allocated by the module's alloc export.
+func (m *Module) write(ctx context.Context, mod api.Module, data []byte) (uint32, error) {
+	results, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("wasm module '%s' failed to allocate memory: %w", m.Name, err)
+	}
+	if len(results) != 1 {
+		return 0, errors.New("wasm module '" + m.Name + "' alloc must return a pointer")
+	}
+
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("wasm module '%s' allocated out of bounds memory", m.Name)
+	}
+	return ptr, nil
+}
@@ -0,0 +1,82 @@
+package wasm
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testModule is a hand assembled module exporting:
+//
+//	alloc:           a bump allocator starting at offset 1024
+//	modify_request:  an infinite loop
+//	modify_response: returns its input unchanged
+const testModule = "0061736d01000000010c0260017f017f60027f7f017e03040300010105030100010607017f014180080b07350406" +
+	"6d656d6f7279020005616c6c6f6300000e6d6f646966795f7265717565737400010f6d6f646966795f726573706f6e73650002" +
+	"0a24030b002300230020006a24000b090003400c000b42000b0c002000ad4220862001ad840b"
+
+// bodyModule is a hand assembled module exporting:
+//
+//	alloc:           a bump allocator starting at offset 1024
+//	modify_response: returns {"body":"aGk="}, without statusCode
+const bodyModule = "0061736d01000000010c0260017f017f60027f7f017e030302000105030100010607017f014180080b072403066d656d6f72" +
+	"79020005616c6c6f6300000f6d6f646966795f726573706f6e736500010a17020b002300230020006a24000b0900428f8080" +
+	"8080020b0b15010041100b0f7b22626f6479223a2261476b3d227d"
+
+func TestModule(t *testing.T) {
+	code, err := hex.DecodeString(testModule)
+	assert.NoError(t, err)
+
+	rt := NewRuntime(Limits{MemoryPages: 16, Timeout: 100 * time.Millisecond})
+	defer rt.Close()
+
+	m, err := rt.Compile("test", code)
+	assert.NoError(t, err)
+
+	t.Run("response roundtrip", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Request:    req,
+		}
+		body, err := m.ModifyResponse(resp, []byte("<p>hello</p>"))
+		assert.NoError(t, err)
+		assert.Equal(t, "<p>hello</p>", string(body))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		start := time.Now()
+		err := m.ModifyRequest(req)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("missing alloc", func(t *testing.T) {
+		_, err := rt.Compile("empty", []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+		assert.Error(t, err)
+	})
+}
+
+func TestModuleStatus(t *testing.T) {
+	code, err := hex.DecodeString(bodyModule)
+	assert.NoError(t, err)
+
+	rt := NewRuntime(Limits{MemoryPages: 16, Timeout: 100 * time.Millisecond})
+	defer rt.Close()
+
+	m, err := rt.Compile("body", code)
+	assert.NoError(t, err)
+
+	resp := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}
+	body, err := m.ModifyResponse(resp, []byte("<p>hello</p>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", string(body))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}